@@ -0,0 +1,60 @@
+package pgxrecord
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// arrayElementTypes are the Go types of the elements of the arrays that convertArrays converts to typed slices.
+var arrayElementTypes = map[uint32]reflect.Type{
+	pgtype.BoolOID:        reflect.TypeOf(false),
+	pgtype.Int2OID:        reflect.TypeOf(int16(0)),
+	pgtype.Int4OID:        reflect.TypeOf(int32(0)),
+	pgtype.Int8OID:        reflect.TypeOf(int64(0)),
+	pgtype.Float4OID:      reflect.TypeOf(float32(0)),
+	pgtype.Float8OID:      reflect.TypeOf(float64(0)),
+	pgtype.TextOID:        reflect.TypeOf(""),
+	pgtype.VarcharOID:     reflect.TypeOf(""),
+	pgtype.BPCharOID:      reflect.TypeOf(""),
+	pgtype.UUIDOID:        reflect.TypeOf([16]byte{}),
+	pgtype.DateOID:        reflect.TypeOf(time.Time{}),
+	pgtype.TimestampOID:   reflect.TypeOf(time.Time{}),
+	pgtype.TimestamptzOID: reflect.TypeOf(time.Time{}),
+}
+
+// convertArrays converts the []any values read from one-dimensional array columns to typed slices such as []string for
+// a text[] column. NULL stays nil and an empty array becomes an empty slice. Arrays that contain NULL elements or whose
+// element type is not known are left as []any.
+func (t *Table) convertArrays(attributes []any) {
+	for i, c := range t.Columns {
+		if c.ElementOID == 0 || c.Dimensions > 1 {
+			continue
+		}
+
+		elemType, ok := arrayElementTypes[c.ElementOID]
+		if !ok {
+			continue
+		}
+
+		values, ok := attributes[i].([]any)
+		if !ok {
+			continue
+		}
+
+		slice := reflect.MakeSlice(reflect.SliceOf(elemType), len(values), len(values))
+		converted := true
+		for j, v := range values {
+			if v == nil || reflect.TypeOf(v) != elemType {
+				converted = false
+				break
+			}
+			slice.Index(j).Set(reflect.ValueOf(v))
+		}
+
+		if converted {
+			attributes[i] = slice.Interface()
+		}
+	}
+}
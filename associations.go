@@ -0,0 +1,203 @@
+package pgxrecord
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type associationKind int
+
+const (
+	hasMany associationKind = iota
+	belongsTo
+)
+
+// association is an association declared with HasMany or BelongsTo.
+type association struct {
+	kind       associationKind
+	table      *Table
+	foreignKey string
+}
+
+// HasMany declares an association named name to the records of child whose foreignKey column references the primary
+// key of t. e.g. orders.HasMany("items", items, "order_id"). The table must have a single column primary key. child does
+// not need to be finalized yet so two tables can refer to each other. It must be called before Finalize.
+func (t *Table) HasMany(name string, child *Table, foreignKey string) {
+	t.addAssociation(name, &association{kind: hasMany, table: child, foreignKey: foreignKey})
+}
+
+// BelongsTo declares an association named name to the record of parent whose primary key is referenced by the
+// foreignKey column of t. e.g. items.BelongsTo("order", orders, "order_id"). parent must have a single column primary
+// key. parent does not need to be finalized yet so two tables can refer to each other. It must be called before
+// Finalize.
+func (t *Table) BelongsTo(name string, parent *Table, foreignKey string) {
+	t.addAssociation(name, &association{kind: belongsTo, table: parent, foreignKey: foreignKey})
+}
+
+func (t *Table) addAssociation(name string, a *association) {
+	if t.finalized {
+		panic("cannot call after table finalized")
+	}
+
+	if t.associations == nil {
+		t.associations = make(map[string]*association)
+	}
+	t.associations[name] = a
+}
+
+// Load loads the records of the association name for r. They are returned by Associated. The associated table is the
+// one the association was declared with even when r belongs to a copy returned by WithSchema, so the associated
+// records are loaded from the schema of that table rather than the schema of the copy. It must be called after
+// Finalize.
+func (r *Record) Load(ctx context.Context, db DB, name string) error {
+	err := r.table.loadAssociation(ctx, db, []*Record{r}, name)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Record (%s): Load: %w", r.table.quotedQualifiedName, err)
+	}
+
+	return nil
+}
+
+// LoadAssociation loads the records of the association name for every record in records with a single query. The
+// records must belong to t. Use it instead of calling Load for each record such as after FindAll to avoid a query per
+// record. Soft deleted associated records are not loaded. As with Load, a copy returned by WithSchema loads the
+// associated records from the schema of the table the association was declared with. It must be called after Finalize.
+func (t *Table) LoadAssociation(ctx context.Context, db DB, records []*Record, name string) error {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	err := t.loadAssociation(ctx, db, records, name)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Table (%s): LoadAssociation: %w", t.quotedQualifiedName, err)
+	}
+
+	return nil
+}
+
+func (t *Table) loadAssociation(ctx context.Context, db DB, records []*Record, name string) error {
+	a, ok := t.associations[name]
+	if !ok {
+		return fmt.Errorf("association %q is not found", name)
+	}
+
+	// ownerTable has the key column that is read from records and otherTable has the column it is matched to.
+	var ownerIdx, otherIdx int
+	otherTable := a.table
+	switch a.kind {
+	case hasMany:
+		if len(t.pkIndexes) != 1 {
+			return fmt.Errorf("association %q: table must have a single column primary key", name)
+		}
+		ownerIdx = t.pkIndexes[0]
+		idx, ok := otherTable.nameToColumnIndex[a.foreignKey]
+		if !ok {
+			return fmt.Errorf("association %q: foreign key column %q is not found in %s", name, a.foreignKey, otherTable.quotedQualifiedName)
+		}
+		otherIdx = idx
+	case belongsTo:
+		idx, ok := t.nameToColumnIndex[a.foreignKey]
+		if !ok {
+			return fmt.Errorf("association %q: foreign key column %q is not found", name, a.foreignKey)
+		}
+		ownerIdx = idx
+		if len(otherTable.pkIndexes) != 1 {
+			return fmt.Errorf("association %q: %s must have a single column primary key", name, otherTable.quotedQualifiedName)
+		}
+		otherIdx = otherTable.pkIndexes[0]
+	}
+
+	typeMap := typeMapPool.Get().(*pgtype.Map)
+	defer typeMapPool.Put(typeMap)
+
+	// Keys are compared in their text format so the types of the two columns do not need to match. e.g. an int4 primary
+	// key and an int8 foreign key.
+	ownerOID := t.Columns[ownerIdx].OID
+	keys := make([]any, 0, len(records))
+	seen := make(map[string]struct{}, len(records))
+	for _, r := range records {
+		if r.table != t {
+			return fmt.Errorf("association %q: record does not belong to table", name)
+		}
+
+		value := r.attributes[ownerIdx]
+		if value == nil {
+			continue
+		}
+		key := formatText(typeMap, ownerOID, value)
+		if _, ok := seen[key]; !ok {
+			seen[key] = struct{}{}
+			keys = append(keys, value)
+		}
+	}
+
+	grouped := make(map[string][]*Record, len(keys))
+	if len(keys) > 0 {
+		others, err := otherTable.findAllByAny(ctx, db, otherIdx, keys)
+		if err != nil {
+			return fmt.Errorf("association %q: %w", name, err)
+		}
+
+		otherOID := otherTable.Columns[otherIdx].OID
+		for _, other := range others {
+			key := formatText(typeMap, otherOID, other.attributes[otherIdx])
+			grouped[key] = append(grouped[key], other)
+		}
+	}
+
+	for _, r := range records {
+		associated := []*Record{}
+		if value := r.attributes[ownerIdx]; value != nil {
+			if others, ok := grouped[formatText(typeMap, ownerOID, value)]; ok {
+				associated = others
+			}
+		}
+
+		if r.associated == nil {
+			r.associated = make(map[string][]*Record)
+		}
+		r.associated[name] = associated
+	}
+
+	return nil
+}
+
+// findAllByAny returns the records whose column at idx is any of values. The records are ordered by the primary key if
+// the table has a single column primary key.
+func (t *Table) findAllByAny(ctx context.Context, db DB, idx int, values []any) ([]*Record, error) {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	b := &strings.Builder{}
+	b.WriteString(t.selectFromQuery)
+	b.WriteString(" where ")
+	if t.softDeleteCondition != "" {
+		b.WriteString(t.softDeleteCondition)
+		b.WriteString(" and ")
+	}
+	t.writeAnyCondition(b, idx)
+	if len(t.pkIndexes) == 1 {
+		b.WriteString(" order by ")
+		b.WriteString(t.quotedName)
+		b.WriteByte('.')
+		b.WriteString(t.Columns[t.pkIndexes[0]].quotedName)
+	}
+
+	rows, err := t.db(db, "select").Query(ctx, b.String(), values)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectRows(ctx, rows, t.RowToRecord)
+}
+
+// Associated returns the records of the association name loaded by Load or LoadAssociation. A has many association
+// returns every associated record and a belongs to association returns at most one. It returns nil if the association
+// has not been loaded.
+func (r *Record) Associated(name string) []*Record {
+	return r.associated[name]
+}
@@ -0,0 +1,94 @@
+package pgxrecord
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// cachedTable is a table loaded by LoadAllColumnsCached.
+type cachedTable struct {
+	columns      []Column
+	comment      string
+	relationKind string
+}
+
+// tableCache caches tables loaded by LoadAllColumnsCached by sanitized table name.
+var tableCache = struct {
+	mu     sync.Mutex
+	tables map[string]cachedTable
+}{
+	tables: make(map[string]cachedTable),
+}
+
+// LoadAllColumnsCached is like LoadAllColumns but the columns are cached for the life of the process by table name.
+// The database is only queried the first time a table is loaded or after the table is invalidated with
+// InvalidateTableCache. It is safe for concurrent use. An unqualified name is cached without regard to search_path so
+// it should not be used with names that resolve to different tables on different connections such as temporary
+// tables. It must not be called after Finalize.
+func (t *Table) LoadAllColumnsCached(ctx context.Context, db DB) error {
+	if t.finalized {
+		panic("cannot call after table finalized")
+	}
+
+	key := t.Name.Sanitize()
+
+	tableCache.mu.Lock()
+	ct, ok := tableCache.tables[key]
+	tableCache.mu.Unlock()
+
+	if ok {
+		t.Columns = make([]*Column, len(ct.columns))
+		for i := range ct.columns {
+			t.Columns[i] = copyColumn(&ct.columns[i])
+		}
+		t.Comment = ct.comment
+		t.RelationKind = ct.relationKind
+		return nil
+	}
+
+	err := t.LoadAllColumns(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	// Finalize and callers may modify the columns of the table so cache copies.
+	ct = cachedTable{columns: make([]Column, len(t.Columns)), comment: t.Comment, relationKind: t.RelationKind}
+	for i, c := range t.Columns {
+		ct.columns[i] = *copyColumn(c)
+	}
+
+	tableCache.mu.Lock()
+	tableCache.tables[key] = ct
+	tableCache.mu.Unlock()
+
+	return nil
+}
+
+// copyColumn returns a copy of c that does not share slices with c.
+func copyColumn(c *Column) *Column {
+	cc := *c
+	if c.EnumLabels != nil {
+		cc.EnumLabels = append([]string{}, c.EnumLabels...)
+	}
+	if c.CompositeFields != nil {
+		cc.CompositeFields = append([]CompositeField{}, c.CompositeFields...)
+	}
+	return &cc
+}
+
+// InvalidateTableCache removes the table name from the cache used by LoadAllColumnsCached. It should be called after a
+// migration changes the table.
+func InvalidateTableCache(name pgx.Identifier) {
+	tableCache.mu.Lock()
+	delete(tableCache.tables, name.Sanitize())
+	tableCache.mu.Unlock()
+}
+
+// InvalidateAllTableCache removes all tables from the cache used by LoadAllColumnsCached.
+func InvalidateAllTableCache() {
+	tableCache.mu.Lock()
+	tableCache.tables = make(map[string]cachedTable)
+	tableCache.mu.Unlock()
+}
@@ -0,0 +1,65 @@
+package pgxrecord
+
+import (
+	"context"
+)
+
+// Callback is a record lifecycle callback. db is the db the operation is run on so a callback can make further
+// changes in the same transaction. op is "insert" or "update" for save callbacks and "delete" or "soft delete" for
+// delete callbacks.
+type Callback func(ctx context.Context, db DB, r *Record, op string) error
+
+// AddBeforeSave adds a callback that runs before Save and SaveBatch write a record. It runs after validations and can
+// change the record. Changes are included in the write. An error aborts the save. Timestamps and the version column
+// are set by the write itself so a before save callback sees their previous values. It must be called before
+// Finalize.
+func (t *Table) AddBeforeSave(fn Callback) {
+	if t.finalized {
+		panic("cannot call after table finalized")
+	}
+
+	t.beforeSave = append(t.beforeSave, fn)
+}
+
+// AddAfterSave adds a callback that runs after Save and SaveBatch successfully write a record and read it back. It sees
+// the timestamps and version set by the write. An error is returned from Save but the row has already been written. If
+// the save is in a transaction the transaction can still be rolled back. It must be called before Finalize.
+func (t *Table) AddAfterSave(fn Callback) {
+	if t.finalized {
+		panic("cannot call after table finalized")
+	}
+
+	t.afterSave = append(t.afterSave, fn)
+}
+
+// AddBeforeDelete adds a callback that runs before Delete and SoftDelete. An error aborts the delete. It must be called
+// before Finalize.
+func (t *Table) AddBeforeDelete(fn Callback) {
+	if t.finalized {
+		panic("cannot call after table finalized")
+	}
+
+	t.beforeDelete = append(t.beforeDelete, fn)
+}
+
+// AddAfterDelete adds a callback that runs after Delete and SoftDelete succeed. An error is returned from the delete but
+// the row has already been deleted. It must be called before Finalize.
+func (t *Table) AddAfterDelete(fn Callback) {
+	if t.finalized {
+		panic("cannot call after table finalized")
+	}
+
+	t.afterDelete = append(t.afterDelete, fn)
+}
+
+// runCallbacks runs callbacks in the order they were added. It stops at the first error.
+func (r *Record) runCallbacks(ctx context.Context, db DB, callbacks []Callback, op string) error {
+	for _, fn := range callbacks {
+		err := fn(ctx, db, r, op)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
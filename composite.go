@@ -0,0 +1,98 @@
+package pgxrecord
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// GetComposite decodes the value of a composite attribute into dest. dest can be a pointer to a struct whose exported
+// fields are in the same order as the fields of the composite type. For an array of a composite type dest can be a
+// pointer to a slice of such structs. Only one-dimensional arrays are supported. The field types must be registered
+// with pgx.
+func (r *Record) GetComposite(attribute string, dest any) error {
+	idx, typeMap, err := r.compositeAttribute(attribute)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Record (%s): GetComposite: %w", r.table.quotedQualifiedName, err)
+	}
+
+	var src []byte
+	switch value := r.attributes[idx].(type) {
+	case nil:
+	case string:
+		src = []byte(value)
+	default:
+		return fmt.Errorf("pgxrecord.Record (%s): GetComposite: attribute %q is %T not string", r.table.quotedQualifiedName, attribute, value)
+	}
+
+	err = typeMap.Scan(r.table.Columns[idx].OID, pgtype.TextFormatCode, src, dest)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Record (%s): GetComposite: attribute %q: %w", r.table.quotedQualifiedName, attribute, err)
+	}
+
+	return nil
+}
+
+// SetComposite sets a composite attribute to value encoded with the fields of the composite type. value can be a
+// struct whose exported fields are in the same order as the fields of the composite type. For an array of a composite
+// type value can be a slice of such structs. A nil value sets the attribute to NULL.
+func (r *Record) SetComposite(attribute string, value any) error {
+	idx, typeMap, err := r.compositeAttribute(attribute)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Record (%s): SetComposite: %w", r.table.quotedQualifiedName, err)
+	}
+
+	var text any
+	if value != nil {
+		buf, err := typeMap.Encode(r.table.Columns[idx].OID, pgtype.TextFormatCode, value, nil)
+		if err != nil {
+			return fmt.Errorf("pgxrecord.Record (%s): SetComposite: attribute %q: %w", r.table.quotedQualifiedName, attribute, err)
+		}
+		if buf != nil {
+			text = string(buf)
+		}
+	}
+
+	err = r.setAttribute(idx, text)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Record (%s): SetComposite: attribute %q: %w", r.table.quotedQualifiedName, attribute, err)
+	}
+
+	return nil
+}
+
+// compositeAttribute returns the index of attribute and a type map with its composite type registered. For an array of
+// a composite type the element type and the array type are registered. It returns an error if attribute is not found or
+// is not a composite type.
+func (r *Record) compositeAttribute(attribute string) (int, *pgtype.Map, error) {
+	idx, ok := r.table.nameToColumnIndex[attribute]
+	if !ok {
+		return 0, nil, fmt.Errorf("attribute %q is not found", attribute)
+	}
+
+	c := r.table.Columns[idx]
+	if c.CompositeFields == nil {
+		return 0, nil, fmt.Errorf("attribute %q is not a composite type", attribute)
+	}
+
+	typeMap := pgtype.NewMap()
+	fields := make([]pgtype.CompositeCodecField, len(c.CompositeFields))
+	for i, f := range c.CompositeFields {
+		fieldType, ok := typeMap.TypeForOID(f.OID)
+		if !ok {
+			return 0, nil, fmt.Errorf("attribute %q field %q has unregistered type OID %d", attribute, f.Name, f.OID)
+		}
+		fields[i] = pgtype.CompositeCodecField{Name: f.Name, Type: fieldType}
+	}
+	if c.ElementOID == 0 {
+		typeMap.RegisterType(&pgtype.Type{Name: c.TypeName, OID: c.OID, Codec: &pgtype.CompositeCodec{Fields: fields}})
+		return idx, typeMap, nil
+	}
+
+	elementType := &pgtype.Type{Name: strings.TrimSuffix(c.TypeName, "[]"), OID: c.ElementOID, Codec: &pgtype.CompositeCodec{Fields: fields}}
+	typeMap.RegisterType(elementType)
+	typeMap.RegisterType(&pgtype.Type{Name: c.TypeName, OID: c.OID, Codec: &pgtype.ArrayCodec{ElementType: elementType}})
+
+	return idx, typeMap, nil
+}
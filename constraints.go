@@ -0,0 +1,299 @@
+package pgxrecord
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ForeignKey is a foreign key constraint where the table is the referencing side.
+type ForeignKey struct {
+	Name string
+
+	// Columns are the names of the referencing columns in the table.
+	Columns []string
+
+	ReferencedTable pgx.Identifier
+
+	// ReferencedColumns are the names of the referenced columns. ReferencedColumns[i] is referenced by Columns[i].
+	ReferencedColumns []string
+}
+
+// LoadForeignKeys queries the database for the foreign keys of the table and stores them in ForeignKeys. It must not
+// be called after Finalize.
+func (t *Table) LoadForeignKeys(ctx context.Context, db DB) error {
+	if t.finalized {
+		panic("cannot call after table finalized")
+	}
+
+	tableOID, err := t.loadTableOID(ctx, db)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Table (%s): LoadForeignKeys: %w", t.Name.Sanitize(), err)
+	}
+
+	rows, _ := db.Query(ctx, foreignKeysSQL("$1"), tableOID)
+	t.ForeignKeys, err = collectForeignKeys(rows)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Table (%s): LoadForeignKeys: %w", t.Name.Sanitize(), err)
+	}
+
+	return nil
+}
+
+// foreignKeysSQL returns the query for the foreign keys of the table with the OID tableOID. tableOID is an SQL
+// expression.
+func foreignKeysSQL(tableOID string) string {
+	return fmt.Sprintf(`select con.conname,
+		array(
+			select a.attname::text
+			from unnest(con.conkey) with ordinality k(attnum, n)
+				join pg_catalog.pg_attribute a on a.attrelid=con.conrelid and a.attnum=k.attnum
+			order by k.n
+		),
+		fn.nspname,
+		fc.relname,
+		array(
+			select a.attname::text
+			from unnest(con.confkey) with ordinality k(attnum, n)
+				join pg_catalog.pg_attribute a on a.attrelid=con.confrelid and a.attnum=k.attnum
+			order by k.n
+		)
+	from pg_catalog.pg_constraint con
+		join pg_catalog.pg_class fc on fc.oid=con.confrelid
+		join pg_catalog.pg_namespace fn on fn.oid=fc.relnamespace
+	where con.conrelid=%s
+		and con.contype='f'
+	order by con.conname`, tableOID)
+}
+
+// collectForeignKeys reads the result of foreignKeysSQL.
+func collectForeignKeys(rows pgx.Rows) ([]ForeignKey, error) {
+	foreignKeys, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (ForeignKey, error) {
+		var fk ForeignKey
+		var schemaName, tableName string
+		err := row.Scan(&fk.Name, &fk.Columns, &schemaName, &tableName, &fk.ReferencedColumns)
+		fk.ReferencedTable = pgx.Identifier{schemaName, tableName}
+		return fk, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find foreign keys: %v", err)
+	}
+
+	return foreignKeys, nil
+}
+
+// UniqueConstraint is a unique constraint or unique index on the table.
+type UniqueConstraint struct {
+	// Name is the name of the index. For a unique or primary key constraint it is also the name of the constraint.
+	Name string
+
+	// Columns are the names of the indexed columns in index order. An expression is given as its SQL text.
+	Columns []string
+
+	PrimaryKey bool
+
+	// Partial is true if the index is a partial index. Predicate is the SQL text of its where clause.
+	Partial   bool
+	Predicate string
+}
+
+// LoadUniqueConstraints queries the database for the unique constraints and unique indexes of the table, including
+// the primary key, and stores them in UniqueConstraints. It must not be called after Finalize.
+func (t *Table) LoadUniqueConstraints(ctx context.Context, db DB) error {
+	if t.finalized {
+		panic("cannot call after table finalized")
+	}
+
+	tableOID, err := t.loadTableOID(ctx, db)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Table (%s): LoadUniqueConstraints: %w", t.Name.Sanitize(), err)
+	}
+
+	rows, _ := db.Query(ctx, uniqueConstraintsSQL("$1"), tableOID)
+	t.UniqueConstraints, err = collectUniqueConstraints(rows)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Table (%s): LoadUniqueConstraints: %w", t.Name.Sanitize(), err)
+	}
+
+	return nil
+}
+
+// uniqueConstraintsSQL returns the query for the unique constraints of the table with the OID tableOID. tableOID is an
+// SQL expression.
+func uniqueConstraintsSQL(tableOID string) string {
+	return fmt.Sprintf(`select c.relname,
+		array(
+			select coalesce(a.attname::text, pg_catalog.pg_get_indexdef(i.indexrelid, k.n::int, true))
+			from unnest(i.indkey) with ordinality k(attnum, n)
+				left join pg_catalog.pg_attribute a on a.attrelid=i.indrelid and a.attnum=k.attnum
+			where k.n <= i.indnkeyatts
+			order by k.n
+		),
+		i.indisprimary,
+		i.indpred is not null,
+		coalesce(pg_catalog.pg_get_expr(i.indpred, i.indrelid, true), '')
+	from pg_catalog.pg_index i
+		join pg_catalog.pg_class c on c.oid=i.indexrelid
+	where i.indrelid=%s
+		and i.indisunique
+	order by c.relname`, tableOID)
+}
+
+// collectUniqueConstraints reads the result of uniqueConstraintsSQL.
+func collectUniqueConstraints(rows pgx.Rows) ([]UniqueConstraint, error) {
+	uniqueConstraints, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (UniqueConstraint, error) {
+		var uc UniqueConstraint
+		err := row.Scan(&uc.Name, &uc.Columns, &uc.PrimaryKey, &uc.Partial, &uc.Predicate)
+		return uc, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find unique constraints: %v", err)
+	}
+
+	return uniqueConstraints, nil
+}
+
+// UniqueConstraintByName returns the unique constraint loaded by LoadUniqueConstraints with name. It returns false if
+// there is no such constraint. It can be used to find the columns covered by the constraint named in a unique
+// violation.
+func (t *Table) UniqueConstraintByName(name string) (UniqueConstraint, bool) {
+	for _, uc := range t.UniqueConstraints {
+		if uc.Name == name {
+			return uc, true
+		}
+	}
+	return UniqueConstraint{}, false
+}
+
+// CheckConstraint is a check constraint on the table.
+type CheckConstraint struct {
+	Name string
+
+	// Expression is the SQL text of the check expression. e.g. age >= 0. It is not evaluated by pgxrecord.
+	Expression string
+
+	// Columns are the names of the columns referenced by the expression in column order.
+	Columns []string
+}
+
+// LoadCheckConstraints queries the database for the check constraints of the table and stores them in
+// CheckConstraints. Not null constraints are not included. It must not be called after Finalize.
+func (t *Table) LoadCheckConstraints(ctx context.Context, db DB) error {
+	if t.finalized {
+		panic("cannot call after table finalized")
+	}
+
+	tableOID, err := t.loadTableOID(ctx, db)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Table (%s): LoadCheckConstraints: %w", t.Name.Sanitize(), err)
+	}
+
+	rows, _ := db.Query(ctx, checkConstraintsSQL("$1"), tableOID)
+	t.CheckConstraints, err = collectCheckConstraints(rows)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Table (%s): LoadCheckConstraints: %w", t.Name.Sanitize(), err)
+	}
+
+	return nil
+}
+
+// checkConstraintsSQL returns the query for the check constraints of the table with the OID tableOID. tableOID is an
+// SQL expression.
+func checkConstraintsSQL(tableOID string) string {
+	return fmt.Sprintf(`select con.conname,
+		pg_catalog.pg_get_expr(con.conbin, con.conrelid, true),
+		array(
+			select a.attname::text
+			from pg_catalog.pg_attribute a
+			where a.attrelid=con.conrelid
+				and a.attnum = any(con.conkey)
+			order by a.attnum
+		)
+	from pg_catalog.pg_constraint con
+	where con.conrelid=%s
+		and con.contype='c'
+	order by con.conname`, tableOID)
+}
+
+// collectCheckConstraints reads the result of checkConstraintsSQL.
+func collectCheckConstraints(rows pgx.Rows) ([]CheckConstraint, error) {
+	checkConstraints, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (CheckConstraint, error) {
+		var cc CheckConstraint
+		err := row.Scan(&cc.Name, &cc.Expression, &cc.Columns)
+		return cc, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find check constraints: %v", err)
+	}
+
+	return checkConstraints, nil
+}
+
+// ConstraintValidationError converts err to a *ValidationError if it is or wraps a unique violation or check violation
+// of a constraint loaded by LoadUniqueConstraints or LoadCheckConstraints. The *ValidationError has a *FieldError for
+// each column covered by the constraint. e.g. a unique violation of an index on email becomes a *FieldError with Column
+// "email" and Message "has already been taken". Messages can be set per constraint with ConstraintMessages. Any other
+// error is returned unchanged. It is meant to be applied to the error returned by Save so the failure can be shown
+// like any other validation failure. Use PgErrorTranslator or TranslatePgError to have Save translate errors itself.
+// It must be called after Finalize.
+func (t *Table) ConstraintValidationError(err error) error {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	var columns []string
+	var message string
+	switch pgErr.Code {
+	case "23505":
+		uc, ok := t.UniqueConstraintByName(pgErr.ConstraintName)
+		if !ok {
+			return err
+		}
+		columns = uc.Columns
+		message = "has already been taken"
+	case "23514":
+		cc, ok := t.checkConstraintByName(pgErr.ConstraintName)
+		if !ok {
+			return err
+		}
+		columns = cc.Columns
+		message = "is invalid"
+	default:
+		return err
+	}
+
+	if m, ok := t.ConstraintMessages[pgErr.ConstraintName]; ok {
+		message = m
+	}
+
+	var errs []error
+	for _, column := range columns {
+		// A unique index on an expression such as lower(email) has the expression in place of a column.
+		if _, ok := t.nameToColumnIndex[column]; !ok {
+			continue
+		}
+		errs = append(errs, &FieldError{Column: column, Message: message})
+	}
+	if len(errs) == 0 {
+		errs = append(errs, errors.New(message))
+	}
+
+	return &ValidationError{Errors: errs}
+}
+
+func (t *Table) checkConstraintByName(name string) (CheckConstraint, bool) {
+	for _, cc := range t.CheckConstraints {
+		if cc.Name == name {
+			return cc, true
+		}
+	}
+	return CheckConstraint{}, false
+}
@@ -0,0 +1,156 @@
+package pgxrecord
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// CopyFormat is the format of the data written by Query.CopyTo.
+type CopyFormat string
+
+const (
+	CopyText   CopyFormat = "text"
+	CopyCSV    CopyFormat = "csv"
+	CopyBinary CopyFormat = "binary"
+)
+
+// CopyToOption is an option for Query.CopyTo.
+type CopyToOption func(*copyToOptions)
+
+type copyToOptions struct {
+	header bool
+}
+
+// CopyHeader causes CopyTo to write a header row of the column names before the data. It requires CopyCSV.
+func CopyHeader() CopyToOption {
+	return func(o *copyToOptions) {
+		o.header = true
+	}
+}
+
+// CopyTo runs the query with copy (query) to stdout and streams the result to w in format without creating records. It
+// returns the number of rows copied. This is much faster and uses much less memory than All for large exports.
+//
+// copy does not accept parameters so the arguments of the query are bound as literals. The query is prepared first to
+// learn the parameter types and each argument is encoded by the type map of conn.
+func (q *Query) CopyTo(ctx context.Context, conn CopyToer, w io.Writer, format CopyFormat, options ...CopyToOption) (int64, error) {
+	var o copyToOptions
+	for _, option := range options {
+		option(&o)
+	}
+
+	sql, err := q.copySQL(ctx, conn, format, o)
+	if err != nil {
+		return 0, fmt.Errorf("pgxrecord.Query (%s): CopyTo: %w", q.table.quotedQualifiedName, err)
+	}
+
+	commandTag, err := conn.PgConn().CopyTo(ctx, w, sql)
+	if err != nil {
+		return 0, fmt.Errorf("pgxrecord.Query (%s): CopyTo: %w", q.table.quotedQualifiedName, err)
+	}
+
+	return commandTag.RowsAffected(), nil
+}
+
+// copySQL returns the copy statement for the query with its arguments bound as literals.
+func (q *Query) copySQL(ctx context.Context, conn CopyToer, format CopyFormat, o copyToOptions) (string, error) {
+	switch format {
+	case CopyText, CopyCSV, CopyBinary:
+	default:
+		return "", fmt.Errorf("copy format %q is not supported", format)
+	}
+
+	if o.header && format != CopyCSV {
+		return "", fmt.Errorf("copy header requires %s format", CopyCSV)
+	}
+
+	sql, args, err := q.sql()
+	if err != nil {
+		return "", err
+	}
+	sql = q.table.rewriteSQL("select", sql)
+
+	var literals []string
+	if len(args) > 0 {
+		literals, err = encodeLiterals(ctx, conn, sql, args)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	b := &strings.Builder{}
+	b.WriteString("copy (")
+	err = writeBoundSQL(b, sql, literals)
+	if err != nil {
+		return "", err
+	}
+	b.WriteString(") to stdout with (format ")
+	b.WriteString(string(format))
+	if o.header {
+		b.WriteString(", header true")
+	}
+	b.WriteByte(')')
+
+	return b.String(), nil
+}
+
+// encodeLiterals prepares sql on conn to learn its parameter types and returns args encoded as SQL literals of those
+// types.
+func encodeLiterals(ctx context.Context, conn CopyToer, sql string, args []any) ([]string, error) {
+	sd, err := conn.PgConn().Prepare(ctx, "", sql, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sd.ParamOIDs) != len(args) {
+		return nil, fmt.Errorf("expected %d arguments but got %d", len(sd.ParamOIDs), len(args))
+	}
+
+	typeMap := conn.TypeMap()
+	literals := make([]string, len(args))
+	for i, arg := range args {
+		oid := sd.ParamOIDs[i]
+		buf, err := typeMap.Encode(oid, pgtype.TextFormatCode, arg, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode argument $%d: %w", i+1, err)
+		}
+
+		if buf == nil {
+			literals[i] = "null"
+		} else {
+			literals[i] = quoteLiteral(string(buf))
+		}
+
+		// Types pgx does not know such as enums are left to be inferred from the context as the parameter was.
+		if dt, ok := typeMap.TypeForOID(oid); ok {
+			literals[i] += "::" + dt.Name
+		}
+	}
+
+	return literals, nil
+}
+
+// quoteLiteral returns s as a quoted SQL string literal. An escape string is used if s contains a backslash so the
+// result does not depend on standard_conforming_strings.
+func quoteLiteral(s string) string {
+	s = strings.ReplaceAll(s, "'", "''")
+	if strings.Contains(s, `\`) {
+		return `E'` + strings.ReplaceAll(s, `\`, `\\`) + `'`
+	}
+	return `'` + s + `'`
+}
+
+// writeBoundSQL writes sql to b with each placeholder $n replaced by literals[n-1]. Placeholders are found with
+// replacePlaceholders.
+func writeBoundSQL(b *strings.Builder, sql string, literals []string) error {
+	return replacePlaceholders(b, sql, func(n int) (string, error) {
+		if n < 1 || n > len(literals) {
+			return "", fmt.Errorf("placeholder $%d does not have an argument: %s", n, sql)
+		}
+		return literals[n-1], nil
+	})
+}
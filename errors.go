@@ -0,0 +1,194 @@
+package pgxrecord
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// MultipleRowsError is returned when a single record is expected but more than one matches. errors.Is(err,
+// ErrMultipleRows) is true for it.
+type MultipleRowsError struct {
+	// Keys are the primary keys of the matching records. At most maxMultipleRowsKeys are included. Each key is the
+	// value of the primary key column or a []any of the values for a composite primary key. Keys is nil when the table
+	// has no primary key.
+	Keys []any
+}
+
+func (e *MultipleRowsError) Error() string {
+	if len(e.Keys) == 0 {
+		return ErrMultipleRows.Error()
+	}
+	return fmt.Sprintf("%v: primary keys %v", ErrMultipleRows, e.Keys)
+}
+
+func (e *MultipleRowsError) Unwrap() error {
+	return ErrMultipleRows
+}
+
+// maxMultipleRowsKeys is the number of matching records read to populate MultipleRowsError.Keys.
+const maxMultipleRowsKeys = 5
+
+// NotUpdatedError is returned by Table.UpsertMany when ConflictTarget.UpdateWhere excludes the existing rows of some
+// of the records. errors.Is(err, ErrNotUpdated) is true for it.
+type NotUpdatedError struct {
+	// Indexes are the indexes of the records that were not updated in ascending order. Those records are unchanged.
+	Indexes []int
+}
+
+func (e *NotUpdatedError) Error() string {
+	return fmt.Sprintf("%v: records %v", ErrNotUpdated, e.Indexes)
+}
+
+func (e *NotUpdatedError) Unwrap() error {
+	return ErrNotUpdated
+}
+
+// UniqueViolationError is a unique_violation (23505) error. Columns are the columns of the violated key when they can
+// be derived from the error detail.
+type UniqueViolationError struct {
+	ConstraintName string
+	Columns        []string
+	PgError        *pgconn.PgError
+}
+
+func (e *UniqueViolationError) Error() string {
+	return e.PgError.Error()
+}
+
+func (e *UniqueViolationError) Unwrap() error {
+	return e.PgError
+}
+
+// ForeignKeyViolationError is a foreign_key_violation (23503) error. Columns are the referencing columns when they can
+// be derived from the error detail.
+type ForeignKeyViolationError struct {
+	ConstraintName string
+	Columns        []string
+	PgError        *pgconn.PgError
+}
+
+func (e *ForeignKeyViolationError) Error() string {
+	return e.PgError.Error()
+}
+
+func (e *ForeignKeyViolationError) Unwrap() error {
+	return e.PgError
+}
+
+// NotNullViolationError is a not_null_violation (23502) error. Columns is the column that was NULL.
+type NotNullViolationError struct {
+	ConstraintName string
+	Columns        []string
+	PgError        *pgconn.PgError
+}
+
+func (e *NotNullViolationError) Error() string {
+	return e.PgError.Error()
+}
+
+func (e *NotNullViolationError) Unwrap() error {
+	return e.PgError
+}
+
+// CheckViolationError is a check_violation (23514) error. PostgreSQL does not report the columns of a check
+// constraint so Columns is always nil.
+type CheckViolationError struct {
+	ConstraintName string
+	Columns        []string
+	PgError        *pgconn.PgError
+}
+
+func (e *CheckViolationError) Error() string {
+	return e.PgError.Error()
+}
+
+func (e *CheckViolationError) Unwrap() error {
+	return e.PgError
+}
+
+// ConvertPgError converts pgErr to a *UniqueViolationError, *ForeignKeyViolationError, *NotNullViolationError, or
+// *CheckViolationError by its SQLSTATE. Any other error is returned unchanged. The typed errors unwrap to pgErr. A nil
+// pgErr returns nil.
+func ConvertPgError(pgErr *pgconn.PgError) error {
+	if pgErr == nil {
+		return nil
+	}
+
+	switch pgErr.Code {
+	case "23505":
+		return &UniqueViolationError{ConstraintName: pgErr.ConstraintName, Columns: keyColumnsFromDetail(pgErr.Detail), PgError: pgErr}
+	case "23503":
+		return &ForeignKeyViolationError{ConstraintName: pgErr.ConstraintName, Columns: keyColumnsFromDetail(pgErr.Detail), PgError: pgErr}
+	case "23502":
+		var columns []string
+		if pgErr.ColumnName != "" {
+			columns = []string{pgErr.ColumnName}
+		}
+		return &NotNullViolationError{ConstraintName: pgErr.ConstraintName, Columns: columns, PgError: pgErr}
+	case "23514":
+		return &CheckViolationError{ConstraintName: pgErr.ConstraintName, PgError: pgErr}
+	}
+
+	return pgErr
+}
+
+// translatePgError returns the error translate returns for the *pgconn.PgError that err is or wraps. translate defaults
+// to the PgErrorTranslator of t. err is returned unchanged if it does not wrap a *pgconn.PgError, if there is no
+// translator, or if the translator returns nil.
+func (t *Table) translatePgError(err error, translate func(*pgconn.PgError) error) error {
+	if translate == nil {
+		translate = t.PgErrorTranslator
+	}
+	if translate == nil {
+		return err
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	if translated := translate(pgErr); translated != nil {
+		return translated
+	}
+	return err
+}
+
+// IsUniqueViolation returns true if err is or wraps a unique violation of the constraint constraintName. An empty
+// constraintName matches a unique violation of any constraint.
+func IsUniqueViolation(err error, constraintName string) bool {
+	return isConstraintViolation(err, "23505", constraintName)
+}
+
+// IsForeignKeyViolation returns true if err is or wraps a foreign key violation of the constraint constraintName. An
+// empty constraintName matches a foreign key violation of any constraint.
+func IsForeignKeyViolation(err error, constraintName string) bool {
+	return isConstraintViolation(err, "23503", constraintName)
+}
+
+func isConstraintViolation(err error, code string, constraintName string) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+
+	return pgErr.Code == code && (constraintName == "" || pgErr.ConstraintName == constraintName)
+}
+
+// keyColumnsFromDetail returns the columns from a detail message such as "Key (a, b)=(1, 2) already exists." It
+// returns nil if detail is not in that form.
+func keyColumnsFromDetail(detail string) []string {
+	if !strings.HasPrefix(detail, "Key (") {
+		return nil
+	}
+
+	end := strings.Index(detail, ")=(")
+	if end < 0 {
+		return nil
+	}
+
+	return strings.Split(detail[len("Key ("):end], ", ")
+}
@@ -0,0 +1,159 @@
+package pgxrecord
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// GetBool returns the value of a boolean attribute. ok is false if the value is NULL. It returns an error if the column
+// is not a boolean column or the value is not a bool.
+func (r *Record) GetBool(attribute string) (value bool, ok bool, err error) {
+	v, err := r.typedValue("GetBool", attribute, "boolean", pgtype.BoolOID)
+	if err != nil || v == nil {
+		return false, false, err
+	}
+
+	b, isBool := v.(bool)
+	if !isBool {
+		return false, false, r.typedValueError("GetBool", attribute, v, "bool")
+	}
+
+	return b, true, nil
+}
+
+// MustGetBool is like GetBool but panics on failure. A NULL value is not a failure.
+func (r *Record) MustGetBool(attribute string) (value bool, ok bool) {
+	value, ok, err := r.GetBool(attribute)
+	if err != nil {
+		panic(err.Error())
+	}
+	return value, ok
+}
+
+// GetInt64 returns the value of an integer attribute as an int64. ok is false if the value is NULL. It returns an error
+// if the column is not a smallint, integer, or bigint column or the value is not an integer that fits in an int64.
+func (r *Record) GetInt64(attribute string) (value int64, ok bool, err error) {
+	v, err := r.typedValue("GetInt64", attribute, "integer", pgtype.Int2OID, pgtype.Int4OID, pgtype.Int8OID)
+	if err != nil || v == nil {
+		return 0, false, err
+	}
+
+	rv := reflect.ValueOf(v)
+	switch {
+	case isIntKind(rv.Kind()):
+		return rv.Int(), true, nil
+	case isUintKind(rv.Kind()) && rv.Uint() <= math.MaxInt64:
+		return int64(rv.Uint()), true, nil
+	default:
+		return 0, false, r.typedValueError("GetInt64", attribute, v, "int64")
+	}
+}
+
+// MustGetInt64 is like GetInt64 but panics on failure. A NULL value is not a failure.
+func (r *Record) MustGetInt64(attribute string) (value int64, ok bool) {
+	value, ok, err := r.GetInt64(attribute)
+	if err != nil {
+		panic(err.Error())
+	}
+	return value, ok
+}
+
+// GetString returns the value of a text attribute. ok is false if the value is NULL. It returns an error if the column
+// is not a text, varchar, char, or name column or the value is not a string. Columns of types that are not registered
+// with pgx such as enums and citext are not checked.
+func (r *Record) GetString(attribute string) (value string, ok bool, err error) {
+	v, err := r.typedValue("GetString", attribute, "text", pgtype.TextOID, pgtype.VarcharOID, pgtype.BPCharOID, pgtype.NameOID)
+	if err != nil || v == nil {
+		return "", false, err
+	}
+
+	s, isString := v.(string)
+	if !isString {
+		return "", false, r.typedValueError("GetString", attribute, v, "string")
+	}
+
+	return s, true, nil
+}
+
+// MustGetString is like GetString but panics on failure. A NULL value is not a failure.
+func (r *Record) MustGetString(attribute string) (value string, ok bool) {
+	value, ok, err := r.GetString(attribute)
+	if err != nil {
+		panic(err.Error())
+	}
+	return value, ok
+}
+
+// GetTime returns the value of a timestamptz, timestamp, or date attribute. ok is false if the value is NULL. It
+// returns an error if the column is not one of those types or the value is not a time.Time.
+func (r *Record) GetTime(attribute string) (value time.Time, ok bool, err error) {
+	v, err := r.typedValue("GetTime", attribute, "timestamp or date", pgtype.TimestamptzOID, pgtype.TimestampOID, pgtype.DateOID)
+	if err != nil || v == nil {
+		return time.Time{}, false, err
+	}
+
+	t, isTime := v.(time.Time)
+	if !isTime {
+		return time.Time{}, false, r.typedValueError("GetTime", attribute, v, "time.Time")
+	}
+
+	return t, true, nil
+}
+
+// MustGetTime is like GetTime but panics on failure. A NULL value is not a failure.
+func (r *Record) MustGetTime(attribute string) (value time.Time, ok bool) {
+	value, ok, err := r.GetTime(attribute)
+	if err != nil {
+		panic(err.Error())
+	}
+	return value, ok
+}
+
+// typedValue returns the value of attribute for the typed getter method. It returns an error if the attribute is not
+// found or not loaded, or if its column has a type registered with pgx that is not one of oids. kind describes oids in
+// the error.
+func (r *Record) typedValue(method string, attribute string, kind string, oids ...uint32) (any, error) {
+	idx, ok := r.table.nameToColumnIndex[attribute]
+	if !ok {
+		return nil, fmt.Errorf("pgxrecord.Record (%s): %s: attribute %q is not found", r.table.quotedQualifiedName, method, attribute)
+	}
+
+	if !r.isLoaded(idx) {
+		return nil, fmt.Errorf("pgxrecord.Record (%s): %s: attribute %q is not loaded", r.table.quotedQualifiedName, method, attribute)
+	}
+
+	c := r.table.Columns[idx]
+	if c.OID != 0 {
+		matched := false
+		for _, oid := range oids {
+			if c.OID == oid {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			typeMap := typeMapPool.Get().(*pgtype.Map)
+			dt, registered := typeMap.TypeForOID(c.OID)
+			typeMapPool.Put(typeMap)
+			if registered {
+				typeName := c.TypeName
+				if typeName == "" {
+					typeName = dt.Name
+				}
+				return nil, fmt.Errorf("pgxrecord.Record (%s): %s: attribute %q is a %s column, not %s", r.table.quotedQualifiedName, method, attribute, typeName, kind)
+			}
+		}
+	}
+
+	return r.attributes[idx], nil
+}
+
+// typedValueError returns the error for a value of attribute that is not of goType.
+func (r *Record) typedValueError(method string, attribute string, value any, goType string) error {
+	return fmt.Errorf("pgxrecord.Record (%s): %s: attribute %q has a %T value, not %s", r.table.quotedQualifiedName, method, attribute, value, goType)
+}
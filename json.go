@@ -0,0 +1,197 @@
+package pgxrecord
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// MarshalJSON implements json.Marshaler. The record is marshaled as an object of its loaded attributes. uuid attributes
+// are marshaled as strings.
+func (r *Record) MarshalJSON() ([]byte, error) {
+	var typeMap *pgtype.Map
+	m := make(map[string]any, len(r.attributes))
+	for i, c := range r.table.Columns {
+		if !r.isLoaded(i) {
+			continue
+		}
+
+		value := r.attributes[i]
+		if c.OID == pgtype.UUIDOID && value != nil {
+			if typeMap == nil {
+				typeMap = pgtype.NewMap()
+			}
+			value = formatText(typeMap, c.OID, value)
+		}
+		m[c.Name] = value
+	}
+
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. The record must have been created by its table such as with NewRecord.
+// Each column whose name is a key in the JSON object is set to the value converted to the column's type. e.g. a number
+// for an int4 column is set as an int32. Generated columns and generated always identity columns are not changed.
+// Unknown keys are ignored unless the table's DisallowUnknownJSONFields is set.
+func (r *Record) UnmarshalJSON(data []byte) error {
+	if r.table == nil {
+		return fmt.Errorf("pgxrecord.Record: UnmarshalJSON: record does not have a table")
+	}
+
+	var m map[string]json.RawMessage
+	err := json.Unmarshal(data, &m)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Record (%s): UnmarshalJSON: %w", r.table.quotedQualifiedName, err)
+	}
+
+	if r.table.DisallowUnknownJSONFields {
+		// Go maps are iterated in random order. Sort the keys so the error is stable.
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			if _, ok := r.table.nameToColumnIndex[k]; !ok {
+				return fmt.Errorf("pgxrecord.Record (%s): UnmarshalJSON: unknown field %q", r.table.quotedQualifiedName, k)
+			}
+		}
+	}
+
+	typeMap := pgtype.NewMap()
+	for i, c := range r.table.Columns {
+		raw, ok := m[c.Name]
+		if !ok || c.readOnly() {
+			continue
+		}
+
+		value, err := unmarshalJSONValue(typeMap, c.OID, raw)
+		if err == nil {
+			err = r.setAttribute(i, value)
+		}
+		if err != nil {
+			return fmt.Errorf("pgxrecord.Record (%s): UnmarshalJSON: attribute %q: %w", r.table.quotedQualifiedName, c.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// unmarshalJSONValue converts the JSON value raw to a Go value for the type with oid.
+func unmarshalJSONValue(typeMap *pgtype.Map, oid uint32, raw json.RawMessage) (any, error) {
+	if bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+
+	switch oid {
+	case pgtype.JSONOID, pgtype.JSONBOID:
+		var value any
+		err := json.Unmarshal(raw, &value)
+		return value, err
+	case pgtype.BoolOID:
+		var value bool
+		err := json.Unmarshal(raw, &value)
+		return value, err
+	case pgtype.DateOID, pgtype.TimestampOID, pgtype.TimestamptzOID:
+		var value time.Time
+		err := json.Unmarshal(raw, &value)
+		return value, err
+	case pgtype.ByteaOID:
+		var value []byte
+		err := json.Unmarshal(raw, &value)
+		return value, err
+	}
+
+	// Other values are converted through their text format. A JSON string is used as is and any other JSON value uses
+	// its JSON representation, which matches the PostgreSQL text format for numbers.
+	var s string
+	if len(raw) > 0 && raw[0] == '"' {
+		err := json.Unmarshal(raw, &s)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		s = string(raw)
+	}
+
+	return parseText(typeMap, oid, s)
+}
+
+// SetJSON sets a json or jsonb attribute to v encoded as JSON. A nil v sets the attribute to NULL.
+func (r *Record) SetJSON(attribute string, v any) error {
+	idx, err := r.jsonAttributeIndex(attribute)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Record (%s): SetJSON: %w", r.table.quotedQualifiedName, err)
+	}
+
+	// Store the value as it would be read from the database so dirty tracking compares like with like.
+	var value any
+	if v != nil {
+		buf, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("pgxrecord.Record (%s): SetJSON: attribute %q: %w", r.table.quotedQualifiedName, attribute, err)
+		}
+		err = json.Unmarshal(buf, &value)
+		if err != nil {
+			return fmt.Errorf("pgxrecord.Record (%s): SetJSON: attribute %q: %w", r.table.quotedQualifiedName, attribute, err)
+		}
+	}
+
+	err = r.setAttribute(idx, value)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Record (%s): SetJSON: attribute %q: %w", r.table.quotedQualifiedName, attribute, err)
+	}
+
+	return nil
+}
+
+// GetJSON decodes the value of a json or jsonb attribute into dest as with json.Unmarshal. NULL is decoded as the JSON
+// null.
+func (r *Record) GetJSON(attribute string, dest any) error {
+	idx, err := r.jsonAttributeIndex(attribute)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Record (%s): GetJSON: %w", r.table.quotedQualifiedName, err)
+	}
+
+	var buf []byte
+	switch value := r.attributes[idx].(type) {
+	case nil:
+		buf = []byte("null")
+	case []byte:
+		buf = value
+	case json.RawMessage:
+		buf = value
+	default:
+		buf, err = json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("pgxrecord.Record (%s): GetJSON: attribute %q: %w", r.table.quotedQualifiedName, attribute, err)
+		}
+	}
+
+	err = json.Unmarshal(buf, dest)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Record (%s): GetJSON: attribute %q: %w", r.table.quotedQualifiedName, attribute, err)
+	}
+
+	return nil
+}
+
+// jsonAttributeIndex returns the index of attribute. It returns an error if attribute is not found or is not json or
+// jsonb.
+func (r *Record) jsonAttributeIndex(attribute string) (int, error) {
+	idx, ok := r.table.nameToColumnIndex[attribute]
+	if !ok {
+		return 0, fmt.Errorf("attribute %q is not found", attribute)
+	}
+
+	if oid := r.table.Columns[idx].OID; oid != pgtype.JSONOID && oid != pgtype.JSONBOID {
+		return 0, fmt.Errorf("attribute %q is not json or jsonb", attribute)
+	}
+
+	return idx, nil
+}
@@ -1,24 +1,96 @@
 // Package pgxrecord is a tiny library for CRUD operations.
+//
+// Attribute values read from the database are the Go types pgx scans into an any. For common types these are:
+//
+//	boolean                              bool
+//	smallint, integer, bigint            int16, int32, int64
+//	real, double precision               float32, float64
+//	numeric                              pgtype.Numeric
+//	text, varchar, char                  string
+//	bytea                                []byte
+//	uuid                                 [16]byte
+//	date                                 time.Time (UTC midnight)
+//	timestamp                            time.Time (UTC with the same wall clock)
+//	timestamptz                          time.Time (local time zone)
+//	interval                             pgtype.Interval
+//	json, jsonb                          the value decoded by encoding/json
+//	one-dimensional arrays               a typed slice such as []string or []int32 for the element types above
+//	                                     except numeric and interval, otherwise []any
+//	enum, composite, array of composite  string in the text format (see Record.GetComposite)
+//
+// Multidimensional arrays are read as pgx decodes them and are not converted to nested slices. Record.Set accepts any
+// value pgx can encode as the column type. Save reads back every column so after Save the attributes are the types
+// above. A value saved and read back is equal to the value that was set except a time.Time is in the location above
+// and is truncated to microseconds.
 package pgxrecord
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-var errTooManyRows = fmt.Errorf("too many rows")
+// maxByteaSize is the maximum size of a bytea value in PostgreSQL.
+const maxByteaSize = 1 << 30
+
+// ErrNotFound is returned when a row is expected but none is found. It is pgx.ErrNoRows so either can be used with
+// errors.Is.
+var ErrNotFound = pgx.ErrNoRows
+
+// ErrMultipleRows is returned when a single row is expected but more than one is found.
+var ErrMultipleRows = errors.New("too many rows")
+
+// ErrStaleObject is returned when saving a record fails because the row was changed since it was read. See
+// Table.VersionColumn.
+var ErrStaleObject = errors.New("stale object")
+
+// ErrNotUpdated is returned by Record.Upsert when the insert conflicts but ConflictTarget.UpdateWhere excludes the
+// existing row so nothing is changed. Table.UpsertMany returns a *NotUpdatedError that wraps it.
+var ErrNotUpdated = errors.New("not updated")
 
 // DB is the interface pgxrecord uses to access the database. It is satisfied by *pgx.Conn, pgx.Tx, *pgxpool.Pool, etc.
 type DB interface {
 	Query(ctx context.Context, sql string, optionsAndArgs ...interface{}) (pgx.Rows, error)
 }
 
+// Execer is the interface for executing a statement that does not return rows. It is satisfied by *pgx.Conn, pgx.Tx,
+// *pgxpool.Pool, etc. A DB that also implements Execer is used with Exec for such statements.
+type Execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+// CopyFromer is the interface pgxrecord uses to bulk insert with the copy protocol. It is satisfied by *pgx.Conn,
+// pgx.Tx, *pgxpool.Pool, etc.
+type CopyFromer interface {
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+// CopyToer is the interface pgxrecord uses to copy query results out of the database with the copy protocol. It is
+// satisfied by *pgx.Conn. Use the Conn method of a pgx.Tx or a *pgxpool.Conn to copy with those.
+type CopyToer interface {
+	PgConn() *pgconn.PgConn
+	TypeMap() *pgtype.Map
+}
+
+// BatchDB is the interface pgxrecord uses to send a batch of queries. It is satisfied by *pgx.Conn, pgx.Tx,
+// *pgxpool.Pool, etc.
+type BatchDB interface {
+	DB
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+}
+
 // Column represents a column in a table.
 type Column struct {
 	Name       string
@@ -26,22 +98,253 @@ type Column struct {
 	OID        uint32
 	NotNull    bool
 	PrimaryKey bool
+
+	// TypeName is the SQL name of the column type including any type modifiers. e.g. character varying(100)
+	TypeName string
+
+	// MaxLength is the declared maximum length in characters of a character varying or character column. It is 0 if the
+	// length is not limited.
+	MaxLength int
+
+	// Precision and Scale are the declared precision and scale of a numeric column. They are 0 if the precision is not
+	// limited.
+	Precision int
+	Scale     int
+
+	// castTypeName is the type used to cast parameters. It is built by Finalize.
+	castTypeName string
+
+	// loadedTypeName and loadedCastTypeName are TypeName and TypeName without type modifiers as loaded by
+	// LoadAllColumns.
+	loadedTypeName     string
+	loadedCastTypeName string
+
+	// HasDefault is true if the column has a default value. Columns that are not assigned are omitted from inserts so
+	// the default is used.
+	HasDefault bool
+
+	// Generated is true for a generated column. It cannot be set but it is read back after each insert and update.
+	Generated bool
+
+	// Identity is "always" or "by default" for an identity column and empty otherwise. A generated always identity
+	// column cannot be set. A generated by default identity column is only inserted when it is set.
+	Identity string
+
+	// AutoIncrement is true if the column is an identity column or its value comes from a sequence owned by the column
+	// such as a serial column. Like any column that is not set it is omitted from inserts and read back from the
+	// database.
+	AutoIncrement bool
+
+	// ElementOID is the OID of the element type of an array column and 0 otherwise.
+	ElementOID uint32
+
+	// Dimensions is the number of dimensions declared for an array column. PostgreSQL does not enforce it and it is 0
+	// when the column was not declared with dimensions.
+	Dimensions int
+
+	// EnumLabels are the labels of an enum column in sort order. It is nil for other columns.
+	EnumLabels []string
+
+	// CompositeFields are the fields of a composite type column in order. For an array of a composite type they are the
+	// fields of the element type. It is nil for other columns. Composite values and arrays of composite values are read
+	// and written as strings in the PostgreSQL text format. See Record.GetComposite and Record.SetComposite.
+	CompositeFields []CompositeField
+
+	// Comment is the comment on the column set with comment on column. It is empty if there is no comment.
+	Comment string
+}
+
+// CompositeField is a field of a composite type.
+type CompositeField struct {
+	Name string
+	OID  uint32
+}
+
+// slicesAreValues returns true if a slice is a single value of the column such as for an array or json column rather
+// than a list of values.
+func (c *Column) slicesAreValues() bool {
+	return c.ElementOID != 0 || strings.HasSuffix(c.TypeName, "[]") || c.OID == pgtype.JSONOID || c.OID == pgtype.JSONBOID
+}
+
+// readOnly returns true if the database does not allow the column to be written.
+func (c *Column) readOnly() bool {
+	return c.Generated || c.Identity == "always"
 }
 
-// Table represents a table in a database. It must not be mutated after Finalize is called.
+// Table represents a table in a database. Its fields must not be changed after Finalize is called unless Finalize is
+// called again before the table is used. Methods that must be called before Finalize such as AddValidation cannot be
+// used after it.
 type Table struct {
 	Name    pgx.Identifier
 	Columns []*Column
 
-	finalized           bool
-	quotedQualifiedName string
-	quotedName          string
-	selectQuery         string
-	selectByPKQuery     string
-	pkWhereClause       string
-	returningClause     string
-	pkIndexes           []int
-	nameToColumnIndex   map[string]int
+	// Comment is the comment on the table set with comment on table. It is loaded by LoadAllColumns. It is empty if there
+	// is no comment.
+	Comment string
+
+	// RelationKind is the kind of relation: "table", "partitioned table", "foreign table", "view", or "materialized
+	// view". It is loaded by LoadAllColumns. Views and materialized views can be read but Save, Upsert, Delete,
+	// SoftDelete, SaveBatch, and InsertMany return an error. The columns of a view are never primary keys and are only
+	// not null when PostgreSQL can tell. An empty RelationKind is treated as a table.
+	RelationKind string
+
+	// ForeignKeys are the foreign keys where the table is the referencing side. They are loaded by LoadForeignKeys.
+	ForeignKeys []ForeignKey
+
+	// UniqueConstraints are the unique constraints and unique indexes of the table. They are loaded by
+	// LoadUniqueConstraints.
+	UniqueConstraints []UniqueConstraint
+
+	// CheckConstraints are the check constraints of the table. They are loaded by LoadCheckConstraints.
+	CheckConstraints []CheckConstraint
+
+	// ConstraintMessages are the messages used by ConstraintValidationError by constraint name. A constraint that is not
+	// in the map uses "has already been taken" for a unique violation and "is invalid" for a check violation.
+	ConstraintMessages map[string]string
+
+	// PgErrorTranslator is called with the *pgconn.PgError when the insert or update of Save, SaveWithResult, or
+	// SaveNoReturning fails with a database error. The error it returns is returned in place of the database error.
+	// e.g. ConvertPgError. If it returns nil the database error is returned unchanged. It can be overridden for a single
+	// call with the TranslatePgError option.
+	PgErrorTranslator func(*pgconn.PgError) error
+
+	// UnquotedIdentifiers causes the SQL generated by the table to use table and column names without quotes. e.g.
+	// users.name instead of "users"."name". A name that needs quotes such as one with upper case letters or one that is a
+	// reserved word then refers to a different identifier or is a syntax error, so it should only be used with simple lower
+	// case names. It is meant for logging and for tools that cannot parse quoted identifiers. Placeholders are always
+	// numbered like $1 either way. It does not apply to InsertMany because pgx always quotes the names used with the copy
+	// protocol.
+	UnquotedIdentifiers bool
+
+	// OmitSchema causes the SQL generated by the table and InsertMany to refer to the table without its schema. The table
+	// is then found through the search_path.
+	OmitSchema bool
+
+	// CastParameters causes parameters in generated conditions to be cast to the type of the column they are compared
+	// to. e.g. "created_at" = $1::timestamp with time zone. This can help the planner choose the correct operator and
+	// index when the parameter type would otherwise be ambiguous. Columns without a known type are not cast.
+	CastParameters bool
+
+	// RewriteSQL is called with the operation ("select", "insert", "update", "upsert", "delete", or "truncate") and the
+	// generated SQL immediately before each statement is sent to the database. The returned SQL is executed instead.
+	// Parameter placeholders have already been numbered so RewriteSQL must not change them. It can be used to add
+	// comments such as planner hints or routing information.
+	RewriteSQL func(op string, sql string) string
+
+	// QueryExecMode is the pgx.QueryExecMode of the statements the table runs through DB.Query. The zero value uses the
+	// default of the connection. e.g. pgx.QueryExecModeCacheStatement prepares each statement the first time it is used
+	// on a connection and reuses it after. The SQL generated by the table only depends on the table and the columns
+	// involved, so repeated calls such as FindByPK and Save reuse the prepared statement. pgx keeps a cache per
+	// connection, so statements are prepared again as needed when a pool hands out a different connection. The cache is
+	// bounded, so one-off SQL is eventually evicted. Use pgx.QueryExecModeCacheDescribe to cache only the statement
+	// descriptions, or pgx.QueryExecModeSimpleProtocol when a connection pooler does not support prepared statements.
+	// SaveBatch, InsertMany, and Query.CopyTo do not run through DB.Query so they use the default of the connection.
+	QueryExecMode pgx.QueryExecMode
+
+	// AcquireWait is called with the operation and the time spent waiting for a connection when a statement is run on a
+	// *pgxpool.Pool. When it is set, a connection is explicitly acquired from the pool for each statement instead of
+	// letting the pool acquire one implicitly. This reports pool starvation separately from slow queries. It is opt-in
+	// because explicit acquisition changes pooling behavior. It is not called for SaveBatch, InsertMany, and
+	// Query.CopyTo.
+	AcquireWait func(ctx context.Context, op string, wait time.Duration)
+
+	// QueryTracer is called with the operation, SQL, arguments, elapsed time, and resulting error of each statement the
+	// table runs through DB.Query. The SQL is the SQL after RewriteSQL. For a query that returns rows, it is called when
+	// the rows are exhausted or closed so the elapsed time includes reading the rows. It can be used to log slow queries or to record
+	// metrics or spans. It is not called for SaveBatch, InsertMany, and Query.CopyTo.
+	QueryTracer func(ctx context.Context, op string, sql string, args []any, elapsed time.Duration, err error)
+
+	// ValidateEnums causes Record.Set to return an error when a string value for an enum column is not one of the
+	// column's EnumLabels instead of leaving it to the database.
+	ValidateEnums bool
+
+	// ValidateTypes causes Record.Set to return an error when a value cannot be converted to the type of its column
+	// instead of leaving it to the database. Compatible values are allowed, e.g. an int for an int4 column or a string
+	// in the text format of the type. Values for types that are not registered with pgx are not checked.
+	ValidateTypes bool
+
+	// CoerceStrings causes Record.Set to convert a string value to the type of its column. e.g. "42" is set as an int32
+	// for an int4 column. Integer, floating point, numeric, boolean, date, timestamp, and interval columns are converted.
+	// Timestamps may be in RFC 3339 or the PostgreSQL text format. A string that cannot be converted is an error. It is
+	// useful for values from HTML forms.
+	CoerceStrings bool
+
+	// SkipNotNullCheck disables the check before inserting a record that every not null column is set or has a value
+	// supplied by the database. Without the check a missing value is reported by the database as a not_null_violation.
+	SkipNotNullCheck bool
+
+	// DisallowUnknownJSONFields causes Record.UnmarshalJSON to return an error for a key that is not a column instead of
+	// ignoring it.
+	DisallowUnknownJSONFields bool
+
+	// VersionColumn is the name of an integer column used for optimistic locking. When the table has this column, an
+	// update increments it and only succeeds if it still has the value that was read from the database. Otherwise Save
+	// returns ErrStaleObject. The column should be not null and have a default.
+	VersionColumn string
+
+	// Timestamps enables automatic timestamps. When the table has the created at column it is set to now() on insert.
+	// When the table has the updated at column it is set to now() on insert and update. A value explicitly assigned to
+	// either column takes precedence.
+	Timestamps bool
+
+	// CreatedAtColumn is the name of the created at column. It defaults to "created_at".
+	CreatedAtColumn string
+
+	// UpdatedAtColumn is the name of the updated at column. It defaults to "updated_at".
+	UpdatedAtColumn string
+
+	// SoftDeleteColumn is the name of a timestamp column that marks a row as deleted. When the table has this column,
+	// Record.SoftDelete sets it to now() instead of deleting the row and the queries generated by the table exclude rows
+	// where it is not null. Use WithDeleted to include them.
+	SoftDeleteColumn string
+
+	// ImmutableColumns are the names of columns that are never updated once a row is inserted such as created_by.
+	// Record.Save and Table.SaveBatch leave a changed immutable column out of the update and the value in the database
+	// is read back into the record. The update of a conflicting row by an upsert leaves them out too. Table.UpdateAll
+	// returns an error if one is set. They can still be set on insert.
+	ImmutableColumns []string
+
+	// StrictImmutableColumns causes Record.Save and Table.SaveBatch to return an error when an immutable column of a
+	// persisted record was changed instead of ignoring the change.
+	StrictImmutableColumns bool
+
+	finalized            bool
+	quotedQualifiedName  string
+	quotedName           string
+	selectFromQuery      string
+	selectQuery          string
+	selectByPKQuery      string
+	softDeleteCondition  string
+	pkWhereClause        string
+	returningClause      string
+	pkIndexes            []int
+	nameToColumnIndex    map[string]int
+	versionIndex         int
+	createdAtIndex       int
+	updatedAtIndex       int
+	softDeleteIndex      int
+	includeDeleted       bool
+	deleteQuery          string
+	deleteReturningQuery string
+	softDeleteQuery      string
+	immutable            []bool
+
+	queryValidations []queryValidation
+	validations      []func(r *Record, op string) error
+
+	permittedAttributes map[string]struct{}
+
+	associations map[string]*association
+
+	scopes map[string]func(*Query) *Query
+
+	// registeredTypes are the pointer types registered with RegisterType by OID.
+	registeredTypes map[uint32]reflect.Type
+
+	beforeSave   []Callback
+	afterSave    []Callback
+	beforeDelete []Callback
+	afterDelete  []Callback
 }
 
 // Record represents a row from a table in the database.
@@ -50,6 +353,23 @@ type Record struct {
 	originalAttributes []any
 	attributes         []any
 	assigned           []bool
+
+	// unloaded is true for attributes that were not read from the database. It is nil if every attribute was read.
+	unloaded []bool
+
+	// computed holds the values of the expressions selected with Query.SelectExpr by attribute.
+	computed map[string]any
+
+	// systemColumns holds the system columns returned by the last Save by name. See SystemColumn.
+	systemColumns map[string]any
+
+	snapshot *recordSnapshot
+
+	// associated holds the associated records loaded by Load and LoadAssociation by association name.
+	associated map[string][]*Record
+
+	// lastCommandTag is the command tag of the most recent write of the record. See LastCommandTag.
+	lastCommandTag pgconn.CommandTag
 }
 
 // LoadAllColumns queries the database for the table columns. It must not be called after Finalize.
@@ -58,390 +378,4285 @@ func (t *Table) LoadAllColumns(ctx context.Context, db DB) error {
 		panic("cannot call after table finalized")
 	}
 
-	var tableOID uint32
+	lt, err := t.loadAllColumns(ctx, db)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Table (%s): LoadAllColumns: %w", t.Name.Sanitize(), err)
+	}
+	t.setLoadedTable(lt)
+
+	return nil
+}
+
+// Reload queries the database for the table columns again and finalizes the table with them. It is used to pick up
+// columns changed by a migration. The queries cached by Finalize are rebuilt. It must be called after Finalize. Reload
+// is not safe to call concurrently with any other use of the table. Records and tables from WithDeleted that were
+// created before Reload must not be used after it.
+func (t *Table) Reload(ctx context.Context, db DB) error {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	lt, err := t.loadAllColumns(ctx, db)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Table (%s): Reload: %w", t.quotedQualifiedName, err)
+	}
+
+	t.setLoadedTable(lt)
+	t.finalize()
+
+	return nil
+}
 
-	{
-		var rows pgx.Rows
+// loadTableOID queries the database for the OID of the table.
+func (t *Table) loadTableOID(ctx context.Context, db DB) (uint32, error) {
+	var rows pgx.Rows
 
-		if len(t.Name) == 1 {
-			rows, _ = db.Query(ctx, `select c.oid
+	if len(t.Name) == 1 {
+		rows, _ = db.Query(ctx, `select c.oid
 	from pg_catalog.pg_class c
 	where c.relname=$1
 		and pg_catalog.pg_table_is_visible(c.oid)
 	limit 1`,
-				t.Name[0],
-			)
-		} else if len(t.Name) == 2 {
-			rows, _ = db.Query(ctx, `select c.oid
+			t.Name[0],
+		)
+	} else if len(t.Name) == 2 {
+		rows, _ = db.Query(ctx, `select c.oid
 	from pg_catalog.pg_class c
 		join pg_catalog.pg_namespace n on n.oid=c.relnamespace
 	where c.relname=$1
 		and n.nspname=$2
 		and pg_catalog.pg_table_is_visible(c.oid)
 	limit 1`,
-				t.Name[1], t.Name[0],
-			)
-		}
+			t.Name[1], t.Name[0],
+		)
+	}
 
-		var err error
-		tableOID, err = pgx.CollectOneRow(rows, pgx.RowTo[uint32])
-		if err != nil {
-			return fmt.Errorf("pgxrecord.Table (%s): LoadAllColumns: failed to find table OID: %v", t.Name.Sanitize(), err)
-		}
+	tableOID, err := pgx.CollectOneRow(rows, pgx.RowTo[uint32])
+	if err != nil {
+		return 0, fmt.Errorf("failed to find table OID: %v", err)
+	}
+
+	return tableOID, nil
+}
+
+// loadedTable is what loadAllColumns reads from the database about a table.
+type loadedTable struct {
+	columns      []*Column
+	comment      string
+	relationKind string
+}
+
+// setLoadedTable sets the columns and other attributes of t read by loadAllColumns.
+func (t *Table) setLoadedTable(lt *loadedTable) {
+	t.Columns = lt.columns
+	t.Comment = lt.comment
+	t.RelationKind = lt.relationKind
+}
+
+// checkWritable returns an error if t is a view or materialized view.
+func (t *Table) checkWritable() error {
+	if t.RelationKind == "view" || t.RelationKind == "materialized view" {
+		return fmt.Errorf("%s is a %s and is not writable", t.quotedQualifiedName, t.RelationKind)
+	}
+	return nil
+}
+
+func (t *Table) loadAllColumns(ctx context.Context, db DB) (*loadedTable, error) {
+	tableOID, err := t.loadTableOID(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	lt := &loadedTable{}
+	rows, _ := db.Query(ctx, tableSQL("$1", true), tableOID)
+	err = collectTable(rows, lt)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, _ = db.Query(ctx, columnsSQL("$1", true), tableOID)
+	lt.columns, err = collectColumns(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return lt, nil
+}
+
+// tableSQL returns the query for the comment and relation kind of the table with the OID tableOID. tableOID is an SQL
+// expression. The comment is empty unless comments is true.
+func tableSQL(tableOID string, comments bool) string {
+	comment := "coalesce(pg_catalog.obj_description(oid, 'pg_class'), '')"
+	if !comments {
+		comment = "''"
+	}
+
+	return fmt.Sprintf(`select %[2]s,
+		case relkind
+			when 'r' then 'table'
+			when 'p' then 'partitioned table'
+			when 'f' then 'foreign table'
+			when 'v' then 'view'
+			when 'm' then 'materialized view'
+			else relkind::text
+		end
+	from pg_catalog.pg_class
+	where oid=%[1]s`, tableOID, comment)
+}
+
+// collectTable reads the result of tableSQL into lt.
+func collectTable(rows pgx.Rows, lt *loadedTable) error {
+	_, err := pgx.CollectOneRow(rows, func(row pgx.CollectableRow) (struct{}, error) {
+		return struct{}{}, row.Scan(&lt.comment, &lt.relationKind)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find table: %v", err)
+	}
+
+	return nil
+}
+
+// columnsSQL returns the query for the columns of the table with the OID tableOID. tableOID is an SQL expression. The
+// column comments are empty unless comments is true.
+func columnsSQL(tableOID string, comments bool) string {
+	comment := "coalesce(pg_catalog.col_description(attrelid, attnum), '')"
+	if !comments {
+		comment = "''"
 	}
 
-	rows, _ := db.Query(ctx, `select attname, atttypid, attnotnull,
+	return fmt.Sprintf(`select attname, atttypid, attnotnull,
 		coalesce((
 			select true
 			from pg_catalog.pg_index
 			where pg_index.indrelid=pg_attribute.attrelid
 				and pg_index.indisprimary
 				and pg_attribute.attnum = any(pg_index.indkey)
-		), false) as isprimary
+		), false) as isprimary,
+		pg_catalog.format_type(atttypid, atttypmod),
+		pg_catalog.format_type(atttypid, null),
+		case when atttypid in ('pg_catalog.varchar'::regtype, 'pg_catalog.bpchar'::regtype) and atttypmod >= 4 then atttypmod - 4 else 0 end,
+		case when atttypid='pg_catalog.numeric'::regtype and atttypmod >= 4 then ((atttypmod - 4) >> 16) & 65535 else 0 end,
+		case when atttypid='pg_catalog.numeric'::regtype and atttypmod >= 4 then (atttypmod - 4) & 65535 else 0 end,
+		atthasdef,
+		attgenerated <> '',
+		case attidentity when 'a' then 'always' when 'd' then 'by default' else '' end,
+		coalesce((
+			select typelem
+			from pg_catalog.pg_type
+			where pg_type.oid=atttypid
+				and pg_type.typcategory='A'
+		), 0),
+		attndims,
+		(
+			select array(
+				select enumlabel::text
+				from pg_catalog.pg_enum
+				where enumtypid=atttypid
+				order by enumsortorder
+			)
+			from pg_catalog.pg_type
+			where pg_type.oid=atttypid
+				and pg_type.typtype='e'
+		),
+		(
+			select array(
+				select a.attname::text
+				from pg_catalog.pg_attribute a
+				where a.attrelid=pg_type.typrelid
+					and a.attnum > 0
+					and not a.attisdropped
+				order by a.attnum
+			)
+			from pg_catalog.pg_type
+			where pg_type.oid=coalesce((
+					select e.typelem
+					from pg_catalog.pg_type e
+					where e.oid=atttypid
+						and e.typcategory='A'
+				), atttypid)
+				and pg_type.typtype='c'
+		),
+		(
+			select array(
+				select a.atttypid
+				from pg_catalog.pg_attribute a
+				where a.attrelid=pg_type.typrelid
+					and a.attnum > 0
+					and not a.attisdropped
+				order by a.attnum
+			)
+			from pg_catalog.pg_type
+			where pg_type.oid=coalesce((
+					select e.typelem
+					from pg_catalog.pg_type e
+					where e.oid=atttypid
+						and e.typcategory='A'
+				), atttypid)
+				and pg_type.typtype='c'
+		),
+		%[2]s,
+		attidentity <> '' or exists(
+			select 1
+			from pg_catalog.pg_depend d
+				join pg_catalog.pg_class s on s.oid=d.objid
+			where d.classid='pg_catalog.pg_class'::regclass
+				and d.refclassid='pg_catalog.pg_class'::regclass
+				and d.refobjid=attrelid
+				and d.refobjsubid=attnum
+				and s.relkind='S'
+		)
 	from pg_catalog.pg_attribute
-	where attrelid=$1
+	where attrelid=%[1]s
 		and attnum > 0
 		and not attisdropped
-	order by attnum`, tableOID)
-	var err error
-	t.Columns, err = pgx.CollectRows(rows, pgx.RowToAddrOfStructByPos[Column])
+	order by attnum`, tableOID, comment)
+}
+
+// collectColumns reads the result of columnsSQL.
+func collectColumns(rows pgx.Rows) ([]*Column, error) {
+	columns, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*Column, error) {
+		c := &Column{}
+		var fieldNames []string
+		var fieldOIDs []uint32
+		err := row.Scan(&c.Name, &c.OID, &c.NotNull, &c.PrimaryKey, &c.TypeName, &c.loadedCastTypeName, &c.MaxLength, &c.Precision, &c.Scale, &c.HasDefault, &c.Generated, &c.Identity, &c.ElementOID, &c.Dimensions, &c.EnumLabels, &fieldNames, &fieldOIDs, &c.Comment, &c.AutoIncrement)
+		c.loadedTypeName = c.TypeName
+		if fieldNames != nil {
+			c.CompositeFields = make([]CompositeField, len(fieldNames))
+			for i := range fieldNames {
+				c.CompositeFields[i] = CompositeField{Name: fieldNames[i], OID: fieldOIDs[i]}
+			}
+		}
+		return c, err
+	})
 	if err != nil {
-		return fmt.Errorf("pgxrecord.Table (%s): LoadAllColumns: failed to find columns: %v", t.Name.Sanitize(), err)
+		return nil, fmt.Errorf("failed to find columns: %v", err)
 	}
 
-	return nil
+	return columns, nil
 }
 
-// Finalize finishes the table initialization.
-func (t *Table) Finalize() {
-	if t.finalized {
-		panic("cannot call after table finalized")
-	}
+// ColumnMismatchError is returned by EnsureColumns when the columns in the database do not match the expected columns.
+type ColumnMismatchError struct {
+	TableName string
 
-	t.finalized = true
+	// Missing are the names of expected columns that are not in the database.
+	Missing []string
 
-	t.quotedQualifiedName = t.Name.Sanitize()
-	t.quotedName = pgx.Identifier{t.Name[len(t.Name)-1]}.Sanitize()
-	for i, c := range t.Columns {
-		c.quotedName = pgx.Identifier{c.Name}.Sanitize()
-		if c.PrimaryKey {
-			t.pkIndexes = append(t.pkIndexes, i)
-		}
-	}
+	// Extra are the names of columns in the database that were not expected.
+	Extra []string
 
-	t.pkWhereClause = t.buildPKWhereClause()
-	t.selectQuery = t.buildSelectQuery()
-	t.selectByPKQuery = t.selectQuery + " " + t.pkWhereClause
-	t.returningClause = t.buildReturningClause()
-	t.nameToColumnIndex = buildNameToColumnIndex(t.Columns)
+	// Mismatched describes each expected column whose type or nullability differs from the database.
+	Mismatched []string
 }
 
-func (t *Table) buildSelectQuery() string {
+func (e *ColumnMismatchError) Error() string {
 	b := &strings.Builder{}
-	b.WriteString("select ")
-	for i := range t.Columns {
-		if i > 0 {
-			b.WriteString(", ")
-		}
-		b.WriteString(t.quotedName)
-		b.WriteByte('.')
-		b.WriteString(t.Columns[i].quotedName)
+	fmt.Fprintf(b, "table %s columns do not match", e.TableName)
+	if len(e.Missing) > 0 {
+		fmt.Fprintf(b, "; missing: %s", strings.Join(e.Missing, ", "))
+	}
+	if len(e.Extra) > 0 {
+		fmt.Fprintf(b, "; extra: %s", strings.Join(e.Extra, ", "))
+	}
+	if len(e.Mismatched) > 0 {
+		fmt.Fprintf(b, "; mismatched: %s", strings.Join(e.Mismatched, ", "))
 	}
-	b.WriteString(" from ")
-	b.WriteString(t.quotedQualifiedName)
 
 	return b.String()
 }
 
-func (t *Table) buildPKWhereClause() string {
-	b := &strings.Builder{}
-	b.WriteString("where ")
-	for i := range t.pkIndexes {
-		if i > 0 {
-			b.WriteString(" and ")
+// EnsureColumns queries the database for the table columns and compares them to expected by name, OID, and NotNull.
+// An expected OID of 0 matches any type. If the columns do not match it returns a *ColumnMismatchError describing the
+// missing, extra, and mismatched columns. It does not modify t so it can be used at startup to fail fast when the
+// schema is not what the application expects.
+func (t *Table) EnsureColumns(ctx context.Context, db DB, expected []Column) error {
+	actualTable := &Table{Name: t.Name}
+	err := actualTable.LoadAllColumns(ctx, db)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Table (%s): EnsureColumns: %w", t.Name.Sanitize(), err)
+	}
+
+	actualColumns := make(map[string]*Column, len(actualTable.Columns))
+	for _, c := range actualTable.Columns {
+		actualColumns[c.Name] = c
+	}
+
+	mismatchErr := &ColumnMismatchError{TableName: t.Name.Sanitize()}
+	expectedNames := make(map[string]struct{}, len(expected))
+	for _, e := range expected {
+		expectedNames[e.Name] = struct{}{}
+
+		a, ok := actualColumns[e.Name]
+		if !ok {
+			mismatchErr.Missing = append(mismatchErr.Missing, e.Name)
+			continue
+		}
+
+		if e.OID != 0 && e.OID != a.OID {
+			mismatchErr.Mismatched = append(mismatchErr.Mismatched, fmt.Sprintf("%s expected OID %d but was %d (%s)", e.Name, e.OID, a.OID, a.TypeName))
+		}
+		if e.NotNull != a.NotNull {
+			mismatchErr.Mismatched = append(mismatchErr.Mismatched, fmt.Sprintf("%s expected not null %t but was %t", e.Name, e.NotNull, a.NotNull))
 		}
-		c := t.Columns[t.pkIndexes[i]]
-		b.WriteString(c.quotedName)
-		b.WriteString(" = $")
-		b.WriteString(strconv.FormatInt(int64(i+1), 10))
 	}
 
-	return b.String()
+	for _, a := range actualTable.Columns {
+		if _, ok := expectedNames[a.Name]; !ok {
+			mismatchErr.Extra = append(mismatchErr.Extra, a.Name)
+		}
+	}
+
+	if len(mismatchErr.Missing) > 0 || len(mismatchErr.Extra) > 0 || len(mismatchErr.Mismatched) > 0 {
+		return fmt.Errorf("pgxrecord.Table (%s): EnsureColumns: %w", t.Name.Sanitize(), mismatchErr)
+	}
+
+	return nil
 }
 
-func (t *Table) buildReturningClause() string {
-	b := &strings.Builder{}
-	b.WriteString("returning ")
-	for i, c := range t.Columns {
-		if i > 0 {
-			b.WriteString(", ")
-		}
-		b.WriteString(c.quotedName)
+// Validate returns an error for a configuration mistake that would otherwise only show up as a failing query. It checks
+// that the table has columns with unique names, that a table that is not a view has a not null primary key, and that
+// VersionColumn, SoftDeleteColumn, ImmutableColumns, and CreatedAtColumn and UpdatedAtColumn when they are set are
+// columns of the table. It can be called before or after Finalize.
+func (t *Table) Validate() error {
+	err := t.validate()
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Table (%s): Validate: %w", t.Name.Sanitize(), err)
 	}
 
-	return b.String()
+	return nil
 }
 
-func (t *Table) buildSelectByPKQuery() string {
-	b := &strings.Builder{}
-	b.WriteString(t.selectQuery)
+func (t *Table) validate() error {
+	if len(t.Columns) == 0 {
+		return fmt.Errorf("table has no columns")
+	}
 
-	for i := range t.Columns {
-		if i > 0 {
-			b.WriteString(", ")
+	columns := make(map[string]*Column, len(t.Columns))
+	hasPK := false
+	for _, c := range t.Columns {
+		if _, ok := columns[c.Name]; ok {
+			return fmt.Errorf("column %q is defined more than once", c.Name)
+		}
+		columns[c.Name] = c
+
+		if c.PrimaryKey {
+			hasPK = true
+			if !c.NotNull {
+				return fmt.Errorf("primary key column %q must be not null", c.Name)
+			}
 		}
-		b.WriteString(t.quotedName)
-		b.WriteByte('.')
-		b.WriteString(t.Columns[i].quotedName)
 	}
-	b.WriteString(" from ")
-	b.WriteString(t.quotedQualifiedName)
 
-	return b.String()
+	if !hasPK && t.RelationKind != "view" && t.RelationKind != "materialized view" {
+		return fmt.Errorf("table has no primary key")
+	}
+
+	if t.VersionColumn != "" {
+		c, ok := columns[t.VersionColumn]
+		if !ok {
+			return fmt.Errorf("version column %q is not found", t.VersionColumn)
+		}
+		if c.OID != 0 && c.OID != pgtype.Int2OID && c.OID != pgtype.Int4OID && c.OID != pgtype.Int8OID {
+			return fmt.Errorf("version column %q must be an integer", t.VersionColumn)
+		}
+	}
+
+	if t.SoftDeleteColumn != "" {
+		if _, ok := columns[t.SoftDeleteColumn]; !ok {
+			return fmt.Errorf("soft delete column %q is not found", t.SoftDeleteColumn)
+		}
+	}
+
+	// The default timestamp column names are optional but a name that was set explicitly must exist.
+	if t.Timestamps {
+		if _, ok := columns[t.CreatedAtColumn]; t.CreatedAtColumn != "" && !ok {
+			return fmt.Errorf("created at column %q is not found", t.CreatedAtColumn)
+		}
+		if _, ok := columns[t.UpdatedAtColumn]; t.UpdatedAtColumn != "" && !ok {
+			return fmt.Errorf("updated at column %q is not found", t.UpdatedAtColumn)
+		}
+	}
+
+	for _, name := range t.ImmutableColumns {
+		if _, ok := columns[name]; !ok {
+			return fmt.Errorf("immutable column %q is not found", name)
+		}
+	}
+
+	return nil
 }
 
-func buildNameToColumnIndex(columns []*Column) map[string]int {
-	m := make(map[string]int, len(columns))
-	for i := range columns {
-		m[columns[i].Name] = i
+// Finalize finishes the table initialization. It builds and caches the queries that only depend on the table such as
+// the select by primary key and delete queries. Calling Finalize again rebuilds them from scratch so changes to the
+// fields of the table and its columns made since the previous call take effect. Methods that must be called before
+// Finalize such as AddValidation and HasMany still panic after it. It must not be called while the table is in use. Use
+// Reload to rebuild the table after the columns changed in the database.
+func (t *Table) Finalize() {
+	if len(t.Name) == 0 {
+		panic("cannot finalize table without a name")
 	}
-	return m
+	if len(t.Columns) == 0 {
+		panic(fmt.Sprintf("cannot finalize table %s without columns", t.Name.Sanitize()))
+	}
+
+	t.finalize()
 }
 
-// NewRecord creates an empty Record. It must be called after Finalize.
-func (t *Table) NewRecord() *Record {
-	if !t.finalized {
-		panic("cannot call until table finalized")
+// finalize builds everything derived from the table configuration and columns from scratch and marks the table
+// finalized.
+func (t *Table) finalize() {
+	t.finalized = true
+
+	t.quotedQualifiedName = t.quoteQualifiedName(t.Name)
+	t.quotedName = t.quoteIdentifier(t.Name[len(t.Name)-1])
+	t.pkIndexes = nil
+	for i, c := range t.Columns {
+		c.quotedName = t.quoteIdentifier(c.Name)
+		// The type without modifiers is only known for a type that was loaded and has not been changed since.
+		c.castTypeName = c.TypeName
+		if c.loadedCastTypeName != "" && c.TypeName == c.loadedTypeName {
+			c.castTypeName = c.loadedCastTypeName
+		}
+		if c.PrimaryKey {
+			t.pkIndexes = append(t.pkIndexes, i)
+		}
+	}
+
+	t.pkWhereClause = t.buildPKWhereClause()
+	t.returningClause = t.buildReturningClause()
+	t.nameToColumnIndex = buildNameToColumnIndex(t.Columns)
+
+	t.versionIndex = -1
+	if idx, ok := t.nameToColumnIndex[t.VersionColumn]; ok && t.VersionColumn != "" {
+		t.versionIndex = idx
+	}
+
+	t.createdAtIndex = -1
+	t.updatedAtIndex = -1
+	if t.Timestamps {
+		if idx, ok := t.nameToColumnIndex[defaultString(t.CreatedAtColumn, "created_at")]; ok {
+			t.createdAtIndex = idx
+		}
+		if idx, ok := t.nameToColumnIndex[defaultString(t.UpdatedAtColumn, "updated_at")]; ok {
+			t.updatedAtIndex = idx
+		}
+	}
+
+	t.softDeleteIndex = -1
+	if idx, ok := t.nameToColumnIndex[t.SoftDeleteColumn]; ok && t.SoftDeleteColumn != "" {
+		t.softDeleteIndex = idx
+	}
+
+	t.immutable = nil
+	if len(t.ImmutableColumns) > 0 {
+		t.immutable = make([]bool, len(t.Columns))
+		for _, name := range t.ImmutableColumns {
+			if idx, ok := t.nameToColumnIndex[name]; ok {
+				t.immutable[idx] = true
+			}
+		}
+	}
+
+	t.buildSelectQueries()
+	t.buildDeleteQueries()
+}
+
+// isImmutable returns true if the column at index i is one of ImmutableColumns.
+func (t *Table) isImmutable(i int) bool {
+	return t.immutable != nil && t.immutable[i]
+}
+
+// buildDeleteQueries builds the delete and soft delete queries. They only depend on the table so they are built once
+// instead of for each record. Their arguments are the primary key values followed by the version if the table has a
+// version column.
+func (t *Table) buildDeleteQueries() {
+	b := &strings.Builder{}
+	b.WriteString("delete from ")
+	b.WriteString(t.quotedQualifiedName)
+	b.WriteByte(' ')
+	b.WriteString(t.pkWhereClause)
+	t.writeVersionConditionSQL(b)
+	t.deleteQuery = b.String()
+	t.deleteReturningQuery = t.deleteQuery + " " + t.returningClause
+
+	t.softDeleteQuery = ""
+	if t.softDeleteIndex < 0 {
+		return
+	}
+
+	b.Reset()
+	t.writeSoftDeleteUpdate(b)
+	b.WriteByte(' ')
+	b.WriteString(t.pkWhereClause)
+	t.writeVersionConditionSQL(b)
+	b.WriteByte(' ')
+	b.WriteString(t.returningClause)
+	t.softDeleteQuery = b.String()
+}
+
+// writeSoftDeleteUpdate writes an update statement without a where clause that soft deletes rows to b. The updated at
+// column is set and the version column is incremented if the table has them.
+func (t *Table) writeSoftDeleteUpdate(b *strings.Builder) {
+	b.WriteString("update ")
+	b.WriteString(t.quotedQualifiedName)
+	b.WriteString(" set ")
+	b.WriteString(t.Columns[t.softDeleteIndex].quotedName)
+	b.WriteString(" = now()")
+
+	if t.updatedAtIndex >= 0 {
+		b.WriteString(", ")
+		b.WriteString(t.Columns[t.updatedAtIndex].quotedName)
+		b.WriteString(" = now()")
+	}
+
+	if t.versionIndex >= 0 {
+		c := t.Columns[t.versionIndex]
+		b.WriteString(", ")
+		b.WriteString(c.quotedName)
+		b.WriteString(" = ")
+		b.WriteString(c.quotedName)
+		b.WriteString(" + 1")
+	}
+}
+
+// writeVersionConditionSQL writes the optimistic locking condition to b if the table has a version column. The version
+// parameter follows the primary key parameters.
+func (t *Table) writeVersionConditionSQL(b *strings.Builder) {
+	if t.versionIndex < 0 {
+		return
+	}
+
+	c := t.Columns[t.versionIndex]
+	b.WriteString(" and ")
+	b.WriteString(c.quotedName)
+	b.WriteString(" = ")
+	t.writeParameter(b, c, len(t.pkIndexes)+1)
+}
+
+// buildSelectQueries builds the select queries. They depend on whether soft deleted rows are excluded.
+func (t *Table) buildSelectQueries() {
+	t.selectFromQuery = t.buildSelectQuery()
+
+	t.softDeleteCondition = ""
+	if t.softDeleteIndex >= 0 && !t.includeDeleted {
+		t.softDeleteCondition = t.quotedName + "." + t.Columns[t.softDeleteIndex].quotedName + " is null"
+	}
+
+	if t.softDeleteCondition == "" {
+		t.selectQuery = t.selectFromQuery
+		t.selectByPKQuery = t.selectFromQuery + " " + t.pkWhereClause
+	} else {
+		t.selectQuery = t.selectFromQuery + " where " + t.softDeleteCondition
+		t.selectByPKQuery = t.selectFromQuery + " " + t.pkWhereClause + " and " + t.softDeleteCondition
+	}
+}
+
+// WithDeleted returns a copy of t whose queries include soft deleted rows. It shares its columns with t. If t does not
+// have a soft delete column it returns t. It must be called after Finalize.
+func (t *Table) WithDeleted() *Table {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	if t.softDeleteIndex < 0 || t.includeDeleted {
+		return t
+	}
+
+	withDeleted := *t
+	withDeleted.includeDeleted = true
+	withDeleted.buildSelectQueries()
+
+	return &withDeleted
+}
+
+// WithSchema returns a copy of t for the table with the same name in schema. e.g. for a schema per tenant. It shares
+// its columns and configuration with t except that OmitSchema is false. Only the table name is changed so the table in
+// schema must have the same columns. It must be called after Finalize.
+func (t *Table) WithSchema(schema string) *Table {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	withSchema := *t
+	withSchema.Name = pgx.Identifier{schema, t.Name[len(t.Name)-1]}
+	withSchema.OmitSchema = false
+	withSchema.quotedQualifiedName = withSchema.quoteQualifiedName(withSchema.Name)
+	withSchema.buildSelectQueries()
+	withSchema.buildDeleteQueries()
+
+	return &withSchema
+}
+
+// PermitAttributes adds attributes to the allowlist used by Record.SetAttributesPermitted. If it is never called no
+// attributes are permitted. It must be called before Finalize.
+func (t *Table) PermitAttributes(attributes ...string) {
+	if t.finalized {
+		panic("cannot call after table finalized")
+	}
+
+	if t.permittedAttributes == nil {
+		t.permittedAttributes = make(map[string]struct{}, len(attributes))
+	}
+	for _, a := range attributes {
+		t.permittedAttributes[a] = struct{}{}
+	}
+}
+
+func (t *Table) buildSelectQuery() string {
+	b := &strings.Builder{}
+	b.WriteString("select ")
+	for i := range t.Columns {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(t.quotedName)
+		b.WriteByte('.')
+		b.WriteString(t.Columns[i].quotedName)
+	}
+	b.WriteString(" from ")
+	b.WriteString(t.quotedQualifiedName)
+
+	return b.String()
+}
+
+func (t *Table) buildPKWhereClause() string {
+	b := &strings.Builder{}
+	b.WriteString("where ")
+	for i := range t.pkIndexes {
+		if i > 0 {
+			b.WriteString(" and ")
+		}
+		c := t.Columns[t.pkIndexes[i]]
+		b.WriteString(c.quotedName)
+		b.WriteString(" = ")
+		t.writeParameter(b, c, i+1)
+	}
+
+	return b.String()
+}
+
+// writeArrayParameter writes the placeholder for parameter n that is an array of values of column c to b.
+func (t *Table) writeArrayParameter(b *strings.Builder, c *Column, n int) {
+	b.WriteByte('$')
+	b.WriteString(strconv.FormatInt(int64(n), 10))
+	if t.CastParameters && c.castTypeName != "" {
+		b.WriteString("::")
+		b.WriteString(c.castTypeName)
+		b.WriteString("[]")
+	}
+}
+
+// writeParameter writes the placeholder for parameter n that is compared to column c to b.
+func (t *Table) writeParameter(b *strings.Builder, c *Column, n int) {
+	b.WriteByte('$')
+	b.WriteString(strconv.FormatInt(int64(n), 10))
+	if t.CastParameters && c.castTypeName != "" {
+		b.WriteString("::")
+		b.WriteString(c.castTypeName)
+	}
+}
+
+func (t *Table) buildReturningClause() string {
+	b := &strings.Builder{}
+	b.WriteString("returning ")
+	for i, c := range t.Columns {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(c.quotedName)
+	}
+
+	return b.String()
+}
+
+func (t *Table) buildSelectByPKQuery() string {
+	b := &strings.Builder{}
+	b.WriteString(t.selectQuery)
+
+	for i := range t.Columns {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(t.quotedName)
+		b.WriteByte('.')
+		b.WriteString(t.Columns[i].quotedName)
+	}
+	b.WriteString(" from ")
+	b.WriteString(t.quotedQualifiedName)
+
+	return b.String()
+}
+
+// db returns db wrapped with the hooks configured on t for operation op.
+func (t *Table) db(db DB, op string) DB {
+	if t.RewriteSQL == nil && t.AcquireWait == nil && t.QueryTracer == nil && t.QueryExecMode == 0 {
+		return db
+	}
+
+	return &tableDB{table: t, db: db, op: op}
+}
+
+// tableDB is a DB that applies the hooks configured on a table to each query.
+type tableDB struct {
+	table *Table
+	db    DB
+	op    string
+}
+
+func (tdb *tableDB) Query(ctx context.Context, sql string, optionsAndArgs ...interface{}) (pgx.Rows, error) {
+	sql = tdb.table.rewriteSQL(tdb.op, sql)
+
+	if tdb.table.QueryTracer == nil {
+		return tdb.query(ctx, sql, optionsAndArgs)
+	}
+
+	start := time.Now()
+	rows, err := tdb.query(ctx, sql, optionsAndArgs)
+	if err != nil {
+		tdb.table.QueryTracer(ctx, tdb.op, sql, optionsAndArgs, time.Since(start), err)
+		return nil, err
+	}
+
+	return &tracingRows{Rows: rows, tdb: tdb, ctx: ctx, sql: sql, args: optionsAndArgs, start: start}, nil
+}
+
+func (tdb *tableDB) query(ctx context.Context, sql string, optionsAndArgs []any) (pgx.Rows, error) {
+	if mode := tdb.table.QueryExecMode; mode != 0 {
+		optionsAndArgs = append([]any{mode}, optionsAndArgs...)
+	}
+
+	if tdb.table.AcquireWait != nil {
+		if pool, ok := tdb.db.(*pgxpool.Pool); ok {
+			return tdb.queryAcquired(ctx, pool, sql, optionsAndArgs)
+		}
+	}
+
+	return tdb.db.Query(ctx, sql, optionsAndArgs...)
+}
+
+// queryAcquired explicitly acquires a connection from pool, reports the wait to AcquireWait, and runs the query on
+// the acquired connection. The connection is released when the returned rows are closed.
+func (tdb *tableDB) queryAcquired(ctx context.Context, pool *pgxpool.Pool, sql string, optionsAndArgs []any) (pgx.Rows, error) {
+	start := time.Now()
+	conn, err := pool.Acquire(ctx)
+	tdb.table.AcquireWait(ctx, tdb.op, time.Since(start))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.Query(ctx, sql, optionsAndArgs...)
+	if err != nil {
+		conn.Release()
+		return nil, err
+	}
+
+	return &releasingRows{Rows: rows, conn: conn}, nil
+}
+
+// releasingRows releases its connection back to the pool when it is closed.
+type releasingRows struct {
+	pgx.Rows
+	conn *pgxpool.Conn
+}
+
+func (rows *releasingRows) Close() {
+	rows.Rows.Close()
+	if rows.conn != nil {
+		rows.conn.Release()
+		rows.conn = nil
+	}
+}
+
+// tracingRows calls the QueryTracer of its table once when the rows are exhausted or closed, whichever happens first.
+type tracingRows struct {
+	pgx.Rows
+	tdb    *tableDB
+	ctx    context.Context
+	sql    string
+	args   []any
+	start  time.Time
+	traced bool
+}
+
+func (rows *tracingRows) Next() bool {
+	if rows.Rows.Next() {
+		return true
+	}
+	rows.trace()
+	return false
+}
+
+func (rows *tracingRows) Close() {
+	rows.Rows.Close()
+	rows.trace()
+}
+
+func (rows *tracingRows) trace() {
+	if !rows.traced {
+		rows.traced = true
+		rows.tdb.table.QueryTracer(rows.ctx, rows.tdb.op, rows.sql, rows.args, time.Since(rows.start), rows.Rows.Err())
+	}
+}
+
+func containsString(ss []string, s string) bool {
+	for _, e := range ss {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(is []int, i int) bool {
+	for _, e := range is {
+		if e == i {
+			return true
+		}
+	}
+	return false
+}
+
+func defaultString(s, defaultValue string) string {
+	if s == "" {
+		return defaultValue
+	}
+	return s
+}
+
+func buildNameToColumnIndex(columns []*Column) map[string]int {
+	m := make(map[string]int, len(columns))
+	for i := range columns {
+		m[columns[i].Name] = i
+	}
+	return m
+}
+
+// NewRecord creates an empty Record. It must be called after Finalize.
+func (t *Table) NewRecord() *Record {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	record := &Record{
+		table:      t,
+		attributes: make([]any, len(t.Columns)),
+		assigned:   make([]bool, len(t.Columns)),
+	}
+
+	return record
+}
+
+// CreateTableSQL returns a create table statement built from the table's columns. It includes each column's name, type,
+// and not null constraint and the primary key. Anything Column does not describe such as defaults, identity and
+// generated columns, indexes, and other constraints is omitted. It is useful for test fixtures and schema comparison but
+// it is not a complete reconstruction of the original table. Columns without a TypeName use the name pgx has registered
+// for their OID. It must be called after Finalize.
+func (t *Table) CreateTableSQL() string {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	var typeMap *pgtype.Map
+
+	b := &strings.Builder{}
+	b.WriteString("create table ")
+	b.WriteString(t.quotedQualifiedName)
+	b.WriteString(" (\n")
+	for i, c := range t.Columns {
+		if i > 0 {
+			b.WriteString(",\n")
+		}
+		b.WriteByte('\t')
+		b.WriteString(c.quotedName)
+		b.WriteByte(' ')
+
+		typeName := c.TypeName
+		if typeName == "" {
+			if typeMap == nil {
+				typeMap = pgtype.NewMap()
+			}
+			if dt, ok := typeMap.TypeForOID(c.OID); ok {
+				typeName = dt.Name
+			}
+		}
+		b.WriteString(typeName)
+
+		if c.NotNull {
+			b.WriteString(" not null")
+		}
+	}
+
+	if len(t.pkIndexes) > 0 {
+		b.WriteString(",\n\tprimary key (")
+		for i, pkIdx := range t.pkIndexes {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(t.Columns[pkIdx].quotedName)
+		}
+		b.WriteByte(')')
+	}
+	b.WriteString("\n)")
+
+	return b.String()
+}
+
+// SelectQuery returns the SQL query to select all rows from the table. If the table has a soft delete column soft
+// deleted rows are excluded. It must be called after Finalize.
+func (t *Table) SelectQuery() string {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	return t.selectQuery
+}
+
+// ColumnByName returns the column with name. It returns false if there is no such column. It must be called after
+// Finalize.
+func (t *Table) ColumnByName(name string) (*Column, bool) {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	idx, ok := t.nameToColumnIndex[name]
+	if !ok {
+		return nil, false
+	}
+	return t.Columns[idx], true
+}
+
+// PrimaryKeyColumns returns the primary key columns in the order they appear in Columns. It must be called after
+// Finalize.
+func (t *Table) PrimaryKeyColumns() []*Column {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	columns := make([]*Column, len(t.pkIndexes))
+	for i, idx := range t.pkIndexes {
+		columns[i] = t.Columns[idx]
+	}
+	return columns
+}
+
+// FindByPK finds a record by primary key. pk must have a value for each primary key column. The values are encoded by
+// pgx so any type pgx can encode for the column may be used. e.g. a string for a uuid column. It must be called after
+// Finalize.
+func (t *Table) FindByPK(ctx context.Context, db DB, pk ...any) (*Record, error) {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	if len(pk) != len(t.pkIndexes) {
+		return nil, fmt.Errorf("pgxrecord.Table (%s): FindByPK (%v): expected %d primary key values but got %d", t.quotedQualifiedName, pk, len(t.pkIndexes), len(pk))
+	}
+
+	record, err := t.findByPK(ctx, db, pk)
+	if err != nil {
+		return nil, fmt.Errorf("pgxrecord.Table (%s): FindByPK (%v): %w", t.quotedQualifiedName, pk, err)
+	}
+
+	return record, nil
+}
+
+// FindByPKMap finds a record by primary key like FindByPK but takes the primary key values by column name. pk must have
+// a value for each primary key column and no other keys. This avoids passing the values of a composite primary key out
+// of order. It must be called after Finalize.
+func (t *Table) FindByPKMap(ctx context.Context, db DB, pk map[string]any) (*Record, error) {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	values := make([]any, len(t.pkIndexes))
+	for i, idx := range t.pkIndexes {
+		name := t.Columns[idx].Name
+		v, ok := pk[name]
+		if !ok {
+			return nil, fmt.Errorf("pgxrecord.Table (%s): FindByPKMap (%v): primary key column %q is missing", t.quotedQualifiedName, pk, name)
+		}
+		values[i] = v
+	}
+
+	if len(pk) != len(t.pkIndexes) {
+		extra := make([]string, 0, len(pk)-len(t.pkIndexes))
+		for k := range pk {
+			if idx, ok := t.nameToColumnIndex[k]; !ok || !t.Columns[idx].PrimaryKey {
+				extra = append(extra, k)
+			}
+		}
+		sort.Strings(extra)
+		return nil, fmt.Errorf("pgxrecord.Table (%s): FindByPKMap (%v): %q is not a primary key column", t.quotedQualifiedName, pk, extra[0])
+	}
+
+	record, err := t.findByPK(ctx, db, values)
+	if err != nil {
+		return nil, fmt.Errorf("pgxrecord.Table (%s): FindByPKMap (%v): %w", t.quotedQualifiedName, pk, err)
+	}
+
+	return record, nil
+}
+
+// findByPK selects the record whose primary key is pk. pk must be in primary key column order.
+func (t *Table) findByPK(ctx context.Context, db DB, pk []any) (*Record, error) {
+	rows, err := t.db(db, "select").Query(ctx, t.selectByPKQuery, pk...)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectOneRow(ctx, rows, t.RowToRecord)
+}
+
+// FindByPKs finds the records whose primary key is one of pks in a single query. The records are ordered by primary key.
+// Primary keys that are not found are omitted from the result rather than returning an error. Only tables with a single
+// column primary key are supported. It must be called after Finalize.
+func (t *Table) FindByPKs(ctx context.Context, db DB, pks ...any) ([]*Record, error) {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	if len(t.pkIndexes) != 1 {
+		return nil, fmt.Errorf("pgxrecord.Table (%s): FindByPKs: table must have a single column primary key", t.quotedQualifiedName)
+	}
+
+	if len(pks) == 0 {
+		return []*Record{}, nil
+	}
+
+	records, err := t.findAllByAny(ctx, db, t.pkIndexes[0], pks)
+	if err != nil {
+		return nil, fmt.Errorf("pgxrecord.Table (%s): FindByPKs: %w", t.quotedQualifiedName, err)
+	}
+
+	return records, nil
+}
+
+// writePKAnyCondition writes a condition that the single column primary key is any of the array parameter $1 to b.
+func (t *Table) writePKAnyCondition(b *strings.Builder) {
+	t.writeAnyCondition(b, t.pkIndexes[0])
+}
+
+// writeAnyCondition writes a condition that the column at idx is any of the array parameter $1 to b.
+func (t *Table) writeAnyCondition(b *strings.Builder, idx int) {
+	c := t.Columns[idx]
+	b.WriteString(t.quotedName)
+	b.WriteByte('.')
+	b.WriteString(c.quotedName)
+	b.WriteString(" = any(")
+	t.writeArrayParameter(b, c, 1)
+	b.WriteByte(')')
+}
+
+// DeleteByPKs deletes the records whose primary key is one of pks in a single statement and returns the number of
+// records deleted. If the table has a soft delete column the records are soft deleted instead and records that are
+// already soft deleted are not counted. Delete callbacks are not run and the version column is not checked. Only tables
+// with a single column primary key are supported. Passing no primary keys does nothing. It must be called after
+// Finalize.
+func (t *Table) DeleteByPKs(ctx context.Context, db DB, pks ...any) (int64, error) {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	err := t.checkWritable()
+	if err != nil {
+		return 0, fmt.Errorf("pgxrecord.Table (%s): DeleteByPKs: %w", t.quotedQualifiedName, err)
+	}
+
+	if len(t.pkIndexes) != 1 {
+		return 0, fmt.Errorf("pgxrecord.Table (%s): DeleteByPKs: table must have a single column primary key", t.quotedQualifiedName)
+	}
+
+	if len(pks) == 0 {
+		return 0, nil
+	}
+
+	b := &strings.Builder{}
+	if t.softDeleteIndex < 0 {
+		b.WriteString("delete from ")
+		b.WriteString(t.quotedQualifiedName)
+		b.WriteString(" where ")
+		t.writePKAnyCondition(b)
+	} else {
+		t.writeSoftDeleteUpdate(b)
+		b.WriteString(" where ")
+		t.writePKAnyCondition(b)
+		b.WriteString(" and ")
+		b.WriteString(t.quotedName)
+		b.WriteByte('.')
+		b.WriteString(t.Columns[t.softDeleteIndex].quotedName)
+		b.WriteString(" is null")
+	}
+
+	ct, err := exec(ctx, t.db(db, "delete"), b.String(), []any{pks})
+	if err != nil {
+		return 0, fmt.Errorf("pgxrecord.Table (%s): DeleteByPKs: %w", t.quotedQualifiedName, err)
+	}
+
+	return ct.RowsAffected(), nil
+}
+
+// FindBy finds the record where column equals value. A nil value matches NULL. If no record is found it returns an error
+// where errors.Is(pgx.ErrNoRows) is true. If more than one record is found it returns a different error. It must be
+// called after Finalize.
+func (t *Table) FindBy(ctx context.Context, db DB, column string, value any) (*Record, error) {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	record, err := t.findOne(ctx, db, map[string]any{column: value})
+	if err != nil {
+		return nil, fmt.Errorf("pgxrecord.Table (%s): FindBy (%s = %v): %w", t.quotedQualifiedName, column, value, err)
+	}
+
+	return record, nil
+}
+
+// FindByAttributes finds the record matching conditions. conditions is a map of column names to values that are
+// combined with and. A nil value matches NULL. It is useful for columns that are unique together. e.g.
+// map[string]any{"tenant_id": tenantID, "slug": slug}. If no record is found it returns an error where
+// errors.Is(ErrNotFound) is true. If more than one record is found it returns an error where errors.Is(ErrMultipleRows)
+// is true. conditions must not be empty. It must be called after Finalize.
+func (t *Table) FindByAttributes(ctx context.Context, db DB, conditions map[string]any) (*Record, error) {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	if len(conditions) == 0 {
+		return nil, fmt.Errorf("pgxrecord.Table (%s): FindByAttributes: conditions must not be empty", t.quotedQualifiedName)
+	}
+
+	record, err := t.findOne(ctx, db, conditions)
+	if err != nil {
+		return nil, fmt.Errorf("pgxrecord.Table (%s): FindByAttributes: %w", t.quotedQualifiedName, err)
+	}
+
+	return record, nil
+}
+
+// findOne finds the single record matching conditions. It returns pgx.ErrNoRows if there is no record and
+// a *MultipleRowsError if there is more than one.
+func (t *Table) findOne(ctx context.Context, db DB, conditions map[string]any) (*Record, error) {
+	sql, args, err := t.findAllSQL(conditions)
+	if err != nil {
+		return nil, err
+	}
+	sql += fmt.Sprintf(" limit %d", maxMultipleRowsKeys)
+
+	rows, _ := t.db(db, "select").Query(ctx, sql, args...)
+	records, err := collectRows(ctx, rows, t.RowToRecord)
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(records) {
+	case 0:
+		return nil, pgx.ErrNoRows
+	case 1:
+		return records[0], nil
+	default:
+		return nil, t.multipleRowsError(records)
+	}
+}
+
+// multipleRowsError returns a *MultipleRowsError with the primary keys of records.
+func (t *Table) multipleRowsError(records []*Record) error {
+	if len(t.pkIndexes) == 0 {
+		return &MultipleRowsError{}
+	}
+
+	keys := make([]any, len(records))
+	for i, r := range records {
+		pk := r.pkArgs(0)
+		if len(pk) == 1 {
+			keys[i] = pk[0]
+		} else {
+			keys[i] = pk
+		}
+	}
+
+	return &MultipleRowsError{Keys: keys}
+}
+
+// FirstOrCreate finds the first record by primary key matching find. If none is found it inserts a record with the
+// attributes in create and find. find takes precedence over create for a column in both. It returns the record and true
+// if the record was inserted. If the insert fails with a unique violation because a concurrent insert won the race,
+// the find is retried. When db is a pgx.Tx the insert is made in a savepoint so the transaction can continue after a
+// unique violation. It must be called after Finalize.
+func (t *Table) FirstOrCreate(ctx context.Context, db DB, find map[string]any, create map[string]any) (*Record, bool, error) {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	record, err := t.first(ctx, db, find)
+	if err == nil {
+		return record, false, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, fmt.Errorf("pgxrecord.Table (%s): FirstOrCreate: %w", t.quotedQualifiedName, err)
+	}
+
+	record = t.NewRecord()
+	err = record.SetAttributes(create)
+	if err != nil {
+		return nil, false, fmt.Errorf("pgxrecord.Table (%s): FirstOrCreate: %w", t.quotedQualifiedName, err)
+	}
+	err = record.SetAttributes(find)
+	if err != nil {
+		return nil, false, fmt.Errorf("pgxrecord.Table (%s): FirstOrCreate: %w", t.quotedQualifiedName, err)
+	}
+
+	insert := func() error {
+		return record.Save(ctx, db)
+	}
+	if _, ok := db.(pgx.Tx); ok {
+		err = WithSavepoint(ctx, db, "", insert)
+	} else {
+		err = insert()
+	}
+	if err == nil {
+		return record, true, nil
+	}
+
+	if IsUniqueViolation(err, "") {
+		var findErr error
+		record, findErr = t.first(ctx, db, find)
+		if findErr == nil {
+			return record, false, nil
+		}
+		if !errors.Is(findErr, pgx.ErrNoRows) {
+			err = findErr
+		}
+	}
+
+	return nil, false, fmt.Errorf("pgxrecord.Table (%s): FirstOrCreate: %w", t.quotedQualifiedName, err)
+}
+
+// FindOrInitialize finds the first record by primary key matching find. If none is found it returns a new record with
+// the attributes in find set that has not been saved. It returns true if the record was found. Nothing is written to
+// the database. It must be called after Finalize.
+func (t *Table) FindOrInitialize(ctx context.Context, db DB, find map[string]any) (*Record, bool, error) {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	record, err := t.first(ctx, db, find)
+	if err == nil {
+		return record, true, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, fmt.Errorf("pgxrecord.Table (%s): FindOrInitialize: %w", t.quotedQualifiedName, err)
+	}
+
+	record = t.NewRecord()
+	err = record.SetAttributes(find)
+	if err != nil {
+		return nil, false, fmt.Errorf("pgxrecord.Table (%s): FindOrInitialize: %w", t.quotedQualifiedName, err)
+	}
+
+	return record, false, nil
+}
+
+// first finds the first record by primary key matching conditions. If no record is found it returns pgx.ErrNoRows.
+func (t *Table) first(ctx context.Context, db DB, conditions map[string]any) (*Record, error) {
+	sql, args, err := t.findAllSQL(conditions)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &strings.Builder{}
+	b.WriteString(sql)
+	for i, idx := range t.pkIndexes {
+		if i == 0 {
+			b.WriteString(" order by ")
+		} else {
+			b.WriteString(", ")
+		}
+		b.WriteString(t.quotedName)
+		b.WriteByte('.')
+		b.WriteString(t.Columns[idx].quotedName)
+	}
+	b.WriteString(" limit 1")
+
+	rows, err := t.db(db, "select").Query(ctx, b.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	return collectOneRow(ctx, rows, t.RowToRecord)
+}
+
+// FindAll finds all records matching conditions. conditions is a map of column names to values that are combined with
+// and. A nil value matches NULL. A slice matches any of its values unless the column is an array or json column. Use
+// NotIn to match none of the values. A nil or empty conditions matches all rows. It must be called after Finalize.
+func (t *Table) FindAll(ctx context.Context, db DB, conditions map[string]any) ([]*Record, error) {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	sql, args, err := t.findAllSQL(conditions)
+	if err != nil {
+		return nil, fmt.Errorf("pgxrecord.Table (%s): FindAll: %w", t.quotedQualifiedName, err)
+	}
+
+	rows, _ := t.db(db, "select").Query(ctx, sql, args...)
+	records, err := collectRows(ctx, rows, t.RowToRecord)
+	if err != nil {
+		return nil, fmt.Errorf("pgxrecord.Table (%s): FindAll: %w", t.quotedQualifiedName, err)
+	}
+
+	return records, nil
+}
+
+// FindAllInto finds all records matching conditions and stores them in dst. conditions is a map of column names to
+// values that are combined with and. A nil value matches NULL. A nil or empty conditions matches all rows.
+//
+// Records already in dst that belong to t are reused rather than allocated. This reduces allocations when the same
+// query is run repeatedly. A reused record is overwritten so the caller must not retain records from dst across calls.
+// dst is resized to the number of rows found. It must be called after Finalize.
+func (t *Table) FindAllInto(ctx context.Context, db DB, dst *[]*Record, conditions map[string]any) error {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	sql, args, err := t.findAllSQL(conditions)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Table (%s): FindAllInto: %w", t.quotedQualifiedName, err)
+	}
+
+	rows, err := t.db(db, "select").Query(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Table (%s): FindAllInto: %w", t.quotedQualifiedName, err)
+	}
+	defer rows.Close()
+
+	records := (*dst)[:cap(*dst)]
+	ptrsToAttributes := make([]any, len(t.Columns))
+	n := 0
+	for rows.Next() {
+		err = ctx.Err()
+		if err != nil {
+			return fmt.Errorf("pgxrecord.Table (%s): FindAllInto: %w", t.quotedQualifiedName, err)
+		}
+
+		var record *Record
+		if n < len(records) && records[n] != nil && records[n].table == t {
+			record = records[n]
+		} else {
+			record = t.NewRecord()
+			if n < len(records) {
+				records[n] = record
+			} else {
+				records = append(records, record)
+			}
+		}
+
+		err = t.scanRecord(rows, record, ptrsToAttributes)
+		if err != nil {
+			return fmt.Errorf("pgxrecord.Table (%s): FindAllInto: %w", t.quotedQualifiedName, err)
+		}
+		n++
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Table (%s): FindAllInto: %w", t.quotedQualifiedName, err)
+	}
+
+	*dst = records[:n]
+
+	return nil
+}
+
+// Each finds all records matching conditions and calls fn for each one as it is read. Unlike FindAll the result is not
+// held in memory so it is suitable for very large results. conditions is a map of column names to values that are
+// combined with and. A nil value matches NULL. A nil or empty conditions matches all rows.
+//
+// A single record is reused for every row so fn must not retain r after it returns. If fn returns an error iteration
+// stops, the rows are closed, and the error is returned. It must be called after Finalize.
+func (t *Table) Each(ctx context.Context, db DB, conditions map[string]any, fn func(r *Record) error) error {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	sql, args, err := t.findAllSQL(conditions)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Table (%s): Each: %w", t.quotedQualifiedName, err)
+	}
+
+	rows, err := t.db(db, "select").Query(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Table (%s): Each: %w", t.quotedQualifiedName, err)
+	}
+	defer rows.Close()
+
+	record := t.NewRecord()
+	ptrsToAttributes := make([]any, len(t.Columns))
+	for rows.Next() {
+		err = ctx.Err()
+		if err != nil {
+			return fmt.Errorf("pgxrecord.Table (%s): Each: %w", t.quotedQualifiedName, err)
+		}
+
+		err = t.scanRecord(rows, record, ptrsToAttributes)
+		if err != nil {
+			return fmt.Errorf("pgxrecord.Table (%s): Each: %w", t.quotedQualifiedName, err)
+		}
+
+		err = fn(record)
+		if err != nil {
+			return fmt.Errorf("pgxrecord.Table (%s): Each: %w", t.quotedQualifiedName, err)
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Table (%s): Each: %w", t.quotedQualifiedName, err)
+	}
+
+	return nil
+}
+
+// TruncateOption is an option for Truncate.
+type TruncateOption func(*truncateOptions)
+
+type truncateOptions struct {
+	restartIdentity bool
+	cascade         bool
+}
+
+// RestartIdentity causes Truncate to restart the sequences owned by the columns of the table.
+func RestartIdentity() TruncateOption {
+	return func(o *truncateOptions) {
+		o.restartIdentity = true
+	}
+}
+
+// Cascade causes Truncate to also truncate the tables with foreign keys that reference the table.
+func Cascade() TruncateOption {
+	return func(o *truncateOptions) {
+		o.cascade = true
+	}
+}
+
+// Truncate removes all rows from the table with truncate. It is much faster than deleting every row but it does not run
+// delete triggers or callbacks and ignores the soft delete column. It must be called after Finalize.
+func (t *Table) Truncate(ctx context.Context, db DB, options ...TruncateOption) error {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	err := t.checkWritable()
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Table (%s): Truncate: %w", t.quotedQualifiedName, err)
+	}
+
+	var o truncateOptions
+	for _, option := range options {
+		option(&o)
+	}
+
+	sql := "truncate " + t.quotedQualifiedName
+	if o.restartIdentity {
+		sql += " restart identity"
+	}
+	if o.cascade {
+		sql += " cascade"
+	}
+
+	_, err = exec(ctx, t.db(db, "truncate"), sql, nil)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Table (%s): Truncate: %w", t.quotedQualifiedName, err)
+	}
+
+	return nil
+}
+
+// BulkOption is an option for UpdateAll and DeleteAll.
+type BulkOption func(*bulkOptions)
+
+type bulkOptions struct {
+	everything bool
+	commandTag *pgconn.CommandTag
+}
+
+// Everything allows UpdateAll and DeleteAll to be called with empty conditions to change every row. Without it empty
+// conditions are an error to prevent accidentally changing the whole table.
+func Everything() BulkOption {
+	return func(o *bulkOptions) {
+		o.everything = true
+	}
+}
+
+// StoreCommandTag causes UpdateAll and DeleteAll to store the command tag of the statement in dst.
+func StoreCommandTag(dst *pgconn.CommandTag) BulkOption {
+	return func(o *bulkOptions) {
+		o.commandTag = dst
+	}
+}
+
+// UpdateAll sets the columns in set for every record matching conditions without loading them and returns the number
+// of records updated. conditions is a map of column names to values that are combined with and. A nil value matches
+// NULL. Empty conditions return an error unless Everything is used. The updated at column is set and the version
+// column is incremented if the table has them. Soft deleted records are not updated. Validations and callbacks are not
+// run. It must be called after Finalize.
+func (t *Table) UpdateAll(ctx context.Context, db DB, set map[string]any, conditions map[string]any, options ...BulkOption) (int64, error) {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	o, err := t.checkBulk(conditions, options)
+	if err != nil {
+		return 0, fmt.Errorf("pgxrecord.Table (%s): UpdateAll: %w", t.quotedQualifiedName, err)
+	}
+
+	if len(set) == 0 {
+		return 0, fmt.Errorf("pgxrecord.Table (%s): UpdateAll: set must not be empty", t.quotedQualifiedName)
+	}
+
+	// Go maps are iterated in random order. The generated SQL should be stable so sort the keys.
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	b := &strings.Builder{}
+	b.WriteString("update ")
+	b.WriteString(t.quotedQualifiedName)
+	b.WriteString(" set ")
+
+	args := make([]any, 0, len(set)+len(conditions))
+	setIndexes := make([]int, 0, len(set))
+	for i, k := range keys {
+		idx, ok := t.nameToColumnIndex[k]
+		if !ok {
+			return 0, fmt.Errorf("pgxrecord.Table (%s): UpdateAll: set column %q is not found", t.quotedQualifiedName, k)
+		}
+		c := t.Columns[idx]
+		if c.readOnly() {
+			return 0, fmt.Errorf("pgxrecord.Table (%s): UpdateAll: column %q cannot be set", t.quotedQualifiedName, k)
+		}
+		if t.isImmutable(idx) {
+			return 0, fmt.Errorf("pgxrecord.Table (%s): UpdateAll: column %q is immutable", t.quotedQualifiedName, k)
+		}
+		setIndexes = append(setIndexes, idx)
+
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		args = append(args, set[k])
+		b.WriteString(c.quotedName)
+		b.WriteString(" = $")
+		b.WriteString(strconv.FormatInt(int64(len(args)), 10))
+	}
+
+	if t.updatedAtIndex >= 0 && !containsInt(setIndexes, t.updatedAtIndex) {
+		b.WriteString(", ")
+		b.WriteString(t.Columns[t.updatedAtIndex].quotedName)
+		b.WriteString(" = now()")
+	}
+
+	if t.versionIndex >= 0 && !containsInt(setIndexes, t.versionIndex) {
+		c := t.Columns[t.versionIndex]
+		b.WriteString(", ")
+		b.WriteString(c.quotedName)
+		b.WriteString(" = ")
+		b.WriteString(c.quotedName)
+		b.WriteString(" + 1")
+	}
+
+	if t.softDeleteCondition != "" || len(conditions) > 0 {
+		b.WriteString(" where ")
+		if t.softDeleteCondition != "" {
+			b.WriteString(t.softDeleteCondition)
+			if len(conditions) > 0 {
+				b.WriteString(" and ")
+			}
+		}
+		args, err = t.writeConditions(b, conditions, args)
+		if err != nil {
+			return 0, fmt.Errorf("pgxrecord.Table (%s): UpdateAll: %w", t.quotedQualifiedName, err)
+		}
+	}
+
+	ct, err := exec(ctx, t.db(db, "update"), b.String(), args)
+	if err != nil {
+		return 0, fmt.Errorf("pgxrecord.Table (%s): UpdateAll: %w", t.quotedQualifiedName, err)
+	}
+	o.storeCommandTag(ct)
+
+	return ct.RowsAffected(), nil
+}
+
+// DeleteAll deletes every record matching conditions without loading them and returns the number of records deleted.
+// conditions is a map of column names to values that are combined with and. A nil value matches NULL. Empty conditions
+// return an error unless Everything is used. If the table has a soft delete column the records are soft deleted
+// instead and records that are already soft deleted are not counted. Callbacks are not run. It must be called after
+// Finalize.
+func (t *Table) DeleteAll(ctx context.Context, db DB, conditions map[string]any, options ...BulkOption) (int64, error) {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	o, err := t.checkBulk(conditions, options)
+	if err != nil {
+		return 0, fmt.Errorf("pgxrecord.Table (%s): DeleteAll: %w", t.quotedQualifiedName, err)
+	}
+
+	var prefix string
+	if t.softDeleteIndex < 0 {
+		prefix = "delete from " + t.quotedQualifiedName
+	} else {
+		b := &strings.Builder{}
+		t.writeSoftDeleteUpdate(b)
+		prefix = b.String()
+	}
+
+	sql, args, err := t.whereSQL(prefix, conditions)
+	if err != nil {
+		return 0, fmt.Errorf("pgxrecord.Table (%s): DeleteAll: %w", t.quotedQualifiedName, err)
+	}
+
+	ct, err := exec(ctx, t.db(db, "delete"), sql, args)
+	if err != nil {
+		return 0, fmt.Errorf("pgxrecord.Table (%s): DeleteAll: %w", t.quotedQualifiedName, err)
+	}
+	o.storeCommandTag(ct)
+
+	return ct.RowsAffected(), nil
+}
+
+// checkBulk returns options applied to bulkOptions. It returns an error if t is not writable or if conditions is empty
+// and options do not include Everything.
+func (t *Table) checkBulk(conditions map[string]any, options []BulkOption) (bulkOptions, error) {
+	var o bulkOptions
+	err := t.checkWritable()
+	if err != nil {
+		return o, err
+	}
+
+	for _, option := range options {
+		option(&o)
+	}
+
+	if len(conditions) == 0 && !o.everything {
+		return o, fmt.Errorf("conditions must not be empty unless Everything is used")
+	}
+
+	return o, nil
+}
+
+// storeCommandTag stores ct for StoreCommandTag.
+func (o *bulkOptions) storeCommandTag(ct pgconn.CommandTag) {
+	if o.commandTag != nil {
+		*o.commandTag = ct
+	}
+}
+
+// Count returns the number of records matching conditions. conditions is a map of column names to values that are
+// combined with and. A nil value matches NULL. A nil or empty conditions counts all rows. It must be called after
+// Finalize.
+func (t *Table) Count(ctx context.Context, db DB, conditions map[string]any) (int64, error) {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	sql, args, err := t.whereSQL("select count(*) from "+t.quotedQualifiedName, conditions)
+	if err != nil {
+		return 0, fmt.Errorf("pgxrecord.Table (%s): Count: %w", t.quotedQualifiedName, err)
+	}
+
+	rows, _ := t.db(db, "select").Query(ctx, sql, args...)
+	n, err := collectOneRow(ctx, rows, pgx.RowTo[int64])
+	if err != nil {
+		return 0, fmt.Errorf("pgxrecord.Table (%s): Count: %w", t.quotedQualifiedName, err)
+	}
+
+	return n, nil
+}
+
+// CountAll returns the number of records in the table. It must be called after Finalize.
+func (t *Table) CountAll(ctx context.Context, db DB) (int64, error) {
+	return t.Count(ctx, db, nil)
+}
+
+// Exists returns true if any record matches conditions. conditions is a map of column names to values that are
+// combined with and. A nil value matches NULL. A nil or empty conditions matches all rows. It must be called after
+// Finalize.
+func (t *Table) Exists(ctx context.Context, db DB, conditions map[string]any) (bool, error) {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	sql, args, err := t.whereSQL("select 1 from "+t.quotedQualifiedName, conditions)
+	if err != nil {
+		return false, fmt.Errorf("pgxrecord.Table (%s): Exists: %w", t.quotedQualifiedName, err)
+	}
+
+	rows, _ := t.db(db, "select").Query(ctx, "select exists("+sql+")", args...)
+	exists, err := collectOneRow(ctx, rows, pgx.RowTo[bool])
+	if err != nil {
+		return false, fmt.Errorf("pgxrecord.Table (%s): Exists: %w", t.quotedQualifiedName, err)
+	}
+
+	return exists, nil
+}
+
+// Pluck returns the values of column for the records matching conditions. conditions is a map of column names to values
+// that are combined with and. A nil value matches NULL. A nil or empty conditions matches all rows. Use PluckInto to
+// scan the values into a specific type.
+func (t *Table) Pluck(ctx context.Context, db DB, column string, conditions map[string]any) ([]any, error) {
+	values, err := pluck[any](ctx, db, t, column, conditions)
+	if err != nil {
+		return nil, fmt.Errorf("pgxrecord.Table (%s): Pluck: %w", t.quotedQualifiedName, err)
+	}
+
+	return values, nil
+}
+
+// PluckInto is like Table.Pluck but scans the values into T.
+func PluckInto[T any](ctx context.Context, db DB, t *Table, column string, conditions map[string]any) ([]T, error) {
+	values, err := pluck[T](ctx, db, t, column, conditions)
+	if err != nil {
+		return nil, fmt.Errorf("pgxrecord.Table (%s): PluckInto: %w", t.quotedQualifiedName, err)
+	}
+
+	return values, nil
+}
+
+func pluck[T any](ctx context.Context, db DB, t *Table, column string, conditions map[string]any) ([]T, error) {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	idx, ok := t.nameToColumnIndex[column]
+	if !ok {
+		return nil, fmt.Errorf("column %q is not found", column)
+	}
+
+	sql, args, err := t.whereSQL("select "+t.quotedName+"."+t.Columns[idx].quotedName+" from "+t.quotedQualifiedName, conditions)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := t.db(db, "select").Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	return collectRows(ctx, rows, pgx.RowTo[T])
+}
+
+func (t *Table) findAllSQL(conditions map[string]any) (string, []any, error) {
+	if len(conditions) == 0 {
+		return t.selectQuery, nil, nil
+	}
+
+	return t.whereSQL(t.selectFromQuery, conditions)
+}
+
+// whereSQL returns prefix followed by a where clause for the soft delete condition and conditions.
+func (t *Table) whereSQL(prefix string, conditions map[string]any) (string, []any, error) {
+	if t.softDeleteCondition == "" && len(conditions) == 0 {
+		return prefix, nil, nil
+	}
+
+	b := &strings.Builder{}
+	b.WriteString(prefix)
+	b.WriteString(" where ")
+	if t.softDeleteCondition != "" {
+		b.WriteString(t.softDeleteCondition)
+		if len(conditions) > 0 {
+			b.WriteString(" and ")
+		}
+	}
+	args, err := t.writeConditions(b, conditions, nil)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return b.String(), args, nil
+}
+
+// writeConditions writes conditions combined with and to b. Placeholders are numbered after the existing args. A nil
+// value is compared with is null, a *Subquery with in, a slice with = any, a NotInCondition with != all, a
+// ComparisonCondition with its operator, and a BetweenCondition with between. It returns args with the condition
+// arguments appended. An error is returned if a condition refers to a column that does not exist.
+func (t *Table) writeConditions(b *strings.Builder, conditions map[string]any, args []any) ([]any, error) {
+	// Go maps are iterated in random order. The generated SQL should be stable so sort the keys.
+	keys := make([]string, 0, len(conditions))
+	for k := range conditions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for i, k := range keys {
+		idx, ok := t.nameToColumnIndex[k]
+		if !ok {
+			return nil, fmt.Errorf("condition column %q is not found", k)
+		}
+		c := t.Columns[idx]
+
+		if i > 0 {
+			b.WriteString(" and ")
+		}
+		b.WriteString(t.quotedName)
+		b.WriteByte('.')
+		b.WriteString(c.quotedName)
+
+		value := conditions[k]
+		if value == nil {
+			b.WriteString(" is null")
+			continue
+		}
+
+		if sq, ok := value.(*Subquery); ok {
+			b.WriteString(" in (")
+			var err error
+			args, err = sq.writeSQL(b, args)
+			if err != nil {
+				return nil, err
+			}
+			b.WriteByte(')')
+			continue
+		}
+
+		if notIn, ok := value.(NotInCondition); ok {
+			if !isValueList(notIn.Values) {
+				return nil, fmt.Errorf("condition column %q: NotIn values must be a slice", k)
+			}
+			args = append(args, notIn.Values)
+			b.WriteString(" != all(")
+			t.writeArrayParameter(b, c, len(args))
+			b.WriteByte(')')
+			continue
+		}
+
+		if cmp, ok := value.(ComparisonCondition); ok {
+			if cmp.Value == nil {
+				if cmp.operator != "!=" {
+					return nil, fmt.Errorf("condition column %q: %s value must not be nil", k, cmp.operator)
+				}
+				b.WriteString(" is not null")
+				continue
+			}
+			args = append(args, cmp.Value)
+			b.WriteByte(' ')
+			b.WriteString(cmp.operator)
+			b.WriteByte(' ')
+			t.writeParameter(b, c, len(args))
+			continue
+		}
+
+		if between, ok := value.(BetweenCondition); ok {
+			if between.Low == nil || between.High == nil {
+				return nil, fmt.Errorf("condition column %q: Between values must not be nil", k)
+			}
+			args = append(args, between.Low)
+			b.WriteString(" between ")
+			t.writeParameter(b, c, len(args))
+			args = append(args, between.High)
+			b.WriteString(" and ")
+			t.writeParameter(b, c, len(args))
+			continue
+		}
+
+		args = append(args, value)
+		if !c.slicesAreValues() && isValueList(value) {
+			b.WriteString(" = any(")
+			t.writeArrayParameter(b, c, len(args))
+			b.WriteByte(')')
+			continue
+		}
+
+		b.WriteString(" = ")
+		t.writeParameter(b, c, len(args))
+	}
+
+	return args, nil
+}
+
+// NotInCondition is a condition value that matches rows where the column is not any of Values. It is created by NotIn.
+type NotInCondition struct {
+	Values any
+}
+
+// NotIn returns a condition value that matches rows where the column is not any of values. values must be a slice. It
+// is written as != all($1). e.g. map[string]any{"status": pgxrecord.NotIn([]string{"archived", "deleted"})}. An empty
+// slice matches every row. As in SQL a row where the column is NULL is not matched.
+func NotIn(values any) NotInCondition {
+	return NotInCondition{Values: values}
+}
+
+// ComparisonCondition is a condition value that compares the column with Value using an operator other than =. It is
+// created by Gt, Gte, Lt, Lte, Ne, Like, and ILike.
+type ComparisonCondition struct {
+	operator string
+	Value    any
+}
+
+// Gt returns a condition value that matches rows where the column is greater than value. e.g.
+// map[string]any{"age": pgxrecord.Gt(18)} is written as "age" > $1.
+func Gt(value any) ComparisonCondition {
+	return ComparisonCondition{operator: ">", Value: value}
+}
+
+// Gte returns a condition value that matches rows where the column is greater than or equal to value.
+func Gte(value any) ComparisonCondition {
+	return ComparisonCondition{operator: ">=", Value: value}
+}
+
+// Lt returns a condition value that matches rows where the column is less than value.
+func Lt(value any) ComparisonCondition {
+	return ComparisonCondition{operator: "<", Value: value}
+}
+
+// Lte returns a condition value that matches rows where the column is less than or equal to value.
+func Lte(value any) ComparisonCondition {
+	return ComparisonCondition{operator: "<=", Value: value}
+}
+
+// Ne returns a condition value that matches rows where the column is not equal to value. As in SQL a row where the
+// column is NULL is not matched. Ne(nil) is written as is not null.
+func Ne(value any) ComparisonCondition {
+	return ComparisonCondition{operator: "!=", Value: value}
+}
+
+// Like returns a condition value that matches rows where the column matches the like pattern. e.g.
+// map[string]any{"name": pgxrecord.Like("A%")} is written as "name" like $1.
+func Like(pattern string) ComparisonCondition {
+	return ComparisonCondition{operator: "like", Value: pattern}
+}
+
+// ILike returns a condition value that matches rows where the column matches the like pattern ignoring case.
+func ILike(pattern string) ComparisonCondition {
+	return ComparisonCondition{operator: "ilike", Value: pattern}
+}
+
+// BetweenCondition is a condition value that matches rows where the column is between Low and High inclusive. It is
+// created by Between.
+type BetweenCondition struct {
+	Low  any
+	High any
+}
+
+// Between returns a condition value that matches rows where the column is between low and high inclusive. e.g.
+// map[string]any{"age": pgxrecord.Between(18, 65)} is written as "age" between $1 and $2.
+func Between(low, high any) BetweenCondition {
+	return BetweenCondition{Low: low, High: high}
+}
+
+// isValueList returns true if value is a slice that is used as a list of values in a condition. []byte is a single
+// value.
+func isValueList(value any) bool {
+	v := reflect.ValueOf(value)
+	return v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8
+}
+
+// RowToRecord is a pgx.RowToFunc that returns a *Record. e.g. pgx.CollectRows(rows, table.RowToRecord) or
+// SelectRows(ctx, db, sql, args, table.RowToRecord). The fields of the row are matched to the columns of the table by
+// name so the row can have its columns in any order. Columns that are not in the row are not loaded as with
+// Query.Select. It returns an error if the row has a field that is not a column. It must be called after Finalize.
+func (t *Table) RowToRecord(row pgx.CollectableRow) (*Record, error) {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	record := t.NewRecord()
+	var err error
+	if t.fieldsMatchColumns(row.FieldDescriptions()) {
+		err = t.scanRecord(row, record, make([]any, len(record.attributes)))
+	} else {
+		err = t.scanRecordByName(row, record)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("pgxrecord.Table (%s): RowToRecord: %w", t.quotedQualifiedName, err)
+	}
+
+	return record, nil
+}
+
+// fieldsMatchColumns returns true if fields are the columns of the table in order.
+func (t *Table) fieldsMatchColumns(fields []pgconn.FieldDescription) bool {
+	if len(fields) != len(t.Columns) {
+		return false
+	}
+
+	for i, fd := range fields {
+		if fd.Name != t.Columns[i].Name {
+			return false
+		}
+	}
+
+	return true
+}
+
+// scanRecordByName scans row into the attributes of the new record whose columns have the names of the fields of row.
+// The other attributes are unloaded.
+func (t *Table) scanRecordByName(row pgx.CollectableRow, record *Record) error {
+	fields := row.FieldDescriptions()
+	record.unloaded = make([]bool, len(t.Columns))
+	for i := range record.unloaded {
+		record.unloaded[i] = true
+	}
+
+	allTargets := make([]any, len(t.Columns))
+	t.setScanTargets(allTargets, record.attributes)
+	scanTargets := make([]any, len(fields))
+	for i, fd := range fields {
+		idx, ok := t.nameToColumnIndex[fd.Name]
+		if !ok {
+			return fmt.Errorf("column %q is not found", fd.Name)
+		}
+		if !record.unloaded[idx] {
+			return fmt.Errorf("column %q is returned more than once", fd.Name)
+		}
+		record.unloaded[idx] = false
+		scanTargets[i] = allTargets[idx]
+	}
+
+	err := row.Scan(scanTargets...)
+	if err != nil {
+		return err
+	}
+	t.convertScanned(record.attributes)
+
+	if len(fields) == len(t.Columns) {
+		record.unloaded = nil
+	}
+	record.originalAttributes = make([]any, len(record.attributes))
+	copy(record.originalAttributes, record.attributes)
+
+	return nil
+}
+
+// scanRecord scans row into record and marks it as persisted with no assigned attributes. ptrsToAttributes is a
+// scratch buffer with the same length as the record's attributes.
+func (t *Table) scanRecord(row pgx.CollectableRow, record *Record, ptrsToAttributes []any) error {
+	t.setScanTargets(ptrsToAttributes, record.attributes)
+
+	err := row.Scan(ptrsToAttributes...)
+	if err != nil {
+		return err
+	}
+	t.convertScanned(record.attributes)
+	record.unloaded = nil
+
+	if record.originalAttributes == nil {
+		record.originalAttributes = make([]any, len(record.attributes))
+	}
+	copy(record.originalAttributes, record.attributes)
+	for i := range record.assigned {
+		record.assigned[i] = false
+	}
+
+	return nil
+}
+
+// setScanTargets sets scanTargets to the targets to scan a row into attributes.
+func (t *Table) setScanTargets(scanTargets []any, attributes []any) {
+	for i := range attributes {
+		if ptrType, ok := t.registeredTypes[t.Columns[i].OID]; ok {
+			// The attribute temporarily holds a pointer to a nil pointer. pgx leaves it nil for NULL and allocates a
+			// value to scan into otherwise. convertScanned replaces it with the value.
+			attributes[i] = reflect.New(ptrType).Interface()
+			scanTargets[i] = attributes[i]
+		} else if c := t.Columns[i]; c.EnumLabels != nil || c.CompositeFields != nil {
+			// Enum and composite types are usually not registered with pgx so they cannot be scanned into *any.
+			scanTargets[i] = textAttributeScanner{dst: &attributes[i]}
+		} else {
+			scanTargets[i] = &attributes[i]
+		}
+	}
+}
+
+// convertScanned converts attributes scanned with the targets from setScanTargets to the values stored in a record.
+func (t *Table) convertScanned(attributes []any) {
+	if t.registeredTypes != nil {
+		for i, c := range t.Columns {
+			ptrType, ok := t.registeredTypes[c.OID]
+			if !ok {
+				continue
+			}
+
+			v := reflect.ValueOf(attributes[i])
+			if !v.IsValid() || v.Type() != reflect.PointerTo(ptrType) {
+				continue
+			}
+			if v.Elem().IsNil() {
+				attributes[i] = nil
+			} else {
+				attributes[i] = v.Elem().Elem().Interface()
+			}
+		}
+	}
+
+	t.convertArrays(attributes)
+}
+
+// RegisterType causes columns of the type with oid to be scanned into the type of the pointer returned by newValue.
+// The value it points to is stored as the attribute. e.g. RegisterType(moneyOID, func() any { return new(Money) })
+// stores a Money for a money column. NULL is stored as nil. The type must be scannable by pgx for the type of the
+// column and the attribute is written back with pgx's encoding of the value. This allows records to use types
+// registered with the pgtype.Map of the connection such as domain or extension types. It must be called before
+// Finalize.
+func (t *Table) RegisterType(oid uint32, newValue func() any) {
+	if t.finalized {
+		panic("cannot call after table finalized")
+	}
+
+	ptrType := reflect.TypeOf(newValue())
+	if ptrType == nil || ptrType.Kind() != reflect.Pointer {
+		panic("newValue must return a pointer")
+	}
+
+	if t.registeredTypes == nil {
+		t.registeredTypes = make(map[uint32]reflect.Type)
+	}
+	t.registeredTypes[oid] = ptrType
+}
+
+// textAttributeScanner scans a value in the text format into an attribute as a string or nil.
+type textAttributeScanner struct {
+	dst *any
+}
+
+func (s textAttributeScanner) ScanText(v pgtype.Text) error {
+	if v.Valid {
+		*s.dst = v.String
+	} else {
+		*s.dst = nil
+	}
+	return nil
+}
+
+// InsertMany inserts records with the copy protocol and returns the number of rows copied. It is much faster than
+// saving each record individually. The columns copied are those assigned in any of the records. Columns not assigned in
+// any record are omitted so the database supplies their default values. Attributes assigned in some records but not
+// others are copied as NULL.
+//
+// Unlike Save, the inserted rows are not read back. Server generated values such as identity columns and defaults will
+// not be populated and the records are not marked as persisted. It is an error if a record is already persisted or if
+// no attribute is assigned in any record. Validations, callbacks, the not null check, and created at and updated at
+// timestamps are not run. It must be called after Finalize.
+func (t *Table) InsertMany(ctx context.Context, db CopyFromer, records []*Record) (int64, error) {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	err := t.checkRecords(records)
+	if err != nil {
+		return 0, fmt.Errorf("pgxrecord.Table (%s): InsertMany: %w", t.quotedQualifiedName, err)
+	}
+
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	for i, r := range records {
+		if r.originalAttributes != nil {
+			return 0, fmt.Errorf("pgxrecord.Table (%s): InsertMany: record %d is already persisted", t.quotedQualifiedName, i)
+		}
+	}
+
+	columnIndexes := make([]int, 0, len(t.Columns))
+	for i := range t.Columns {
+		for _, r := range records {
+			if r.assigned[i] {
+				columnIndexes = append(columnIndexes, i)
+				break
+			}
+		}
+	}
+
+	// The copy protocol requires at least one column.
+	if len(columnIndexes) == 0 {
+		return 0, fmt.Errorf("pgxrecord.Table (%s): InsertMany: no attributes assigned", t.quotedQualifiedName)
+	}
+
+	columnNames := make([]string, len(columnIndexes))
+	for i, idx := range columnIndexes {
+		columnNames[i] = t.Columns[idx].Name
+	}
+
+	rows := make([][]any, len(records))
+	for i, r := range records {
+		values := make([]any, len(columnIndexes))
+		for j, idx := range columnIndexes {
+			values[j] = r.attributes[idx]
+		}
+		rows[i] = values
+	}
+
+	tableName := t.Name
+	if t.OmitSchema {
+		tableName = tableName[len(tableName)-1:]
+	}
+
+	n, err := db.CopyFrom(ctx, tableName, columnNames, pgx.CopyFromRows(rows))
+	if err != nil {
+		return n, fmt.Errorf("pgxrecord.Table (%s): InsertMany: %w", t.quotedQualifiedName, err)
+	}
+
+	return n, nil
+}
+
+// InsertFromSelect inserts the rows selected by sourceQuery with a single insert ... select statement and returns the
+// number of rows inserted. The rows are not read into Go. columnMapping maps the names of columns of t to the names of
+// the columns of the source query table that supply their values. e.g. map[string]string{"id": "id", "archived_name":
+// "name"}. Columns of t that are not mapped insert their defaults except for the created at and updated at columns
+// which are set to now(). The select and order by of sourceQuery are ignored. Validations and callbacks are not run.
+// It must be called after Finalize.
+func (t *Table) InsertFromSelect(ctx context.Context, db DB, sourceQuery *Query, columnMapping map[string]string) (int64, error) {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	err := t.checkWritable()
+	if err != nil {
+		return 0, fmt.Errorf("pgxrecord.Table (%s): InsertFromSelect: %w", t.quotedQualifiedName, err)
+	}
+
+	if len(columnMapping) == 0 {
+		return 0, fmt.Errorf("pgxrecord.Table (%s): InsertFromSelect: column mapping must not be empty", t.quotedQualifiedName)
+	}
+
+	// Go maps are iterated in random order. The generated SQL should be stable so the columns are written in table order.
+	source := sourceQuery.table
+	insertColumns := &strings.Builder{}
+	selectList := &strings.Builder{}
+	mapped := 0
+	for i, c := range t.Columns {
+		var expr string
+		if sourceName, ok := columnMapping[c.Name]; ok {
+			if c.readOnly() {
+				return 0, fmt.Errorf("pgxrecord.Table (%s): InsertFromSelect: column %q cannot be set", t.quotedQualifiedName, c.Name)
+			}
+			sourceIdx, ok := source.nameToColumnIndex[sourceName]
+			if !ok {
+				return 0, fmt.Errorf("pgxrecord.Table (%s): InsertFromSelect: source column %q is not found in %s", t.quotedQualifiedName, sourceName, source.quotedQualifiedName)
+			}
+			expr = source.quotedName + "." + source.Columns[sourceIdx].quotedName
+			mapped++
+		} else if i == t.createdAtIndex || i == t.updatedAtIndex {
+			expr = "now()"
+		} else {
+			continue
+		}
+
+		if insertColumns.Len() > 0 {
+			insertColumns.WriteString(", ")
+			selectList.WriteString(", ")
+		}
+		insertColumns.WriteString(c.quotedName)
+		selectList.WriteString(expr)
+	}
+
+	if mapped < len(columnMapping) {
+		for name := range columnMapping {
+			if _, ok := t.nameToColumnIndex[name]; !ok {
+				return 0, fmt.Errorf("pgxrecord.Table (%s): InsertFromSelect: column %q is not found", t.quotedQualifiedName, name)
+			}
+		}
+	}
+
+	b := &strings.Builder{}
+	b.WriteString("insert into ")
+	b.WriteString(t.quotedQualifiedName)
+	b.WriteString(" (")
+	b.WriteString(insertColumns.String())
+	b.WriteString(") ")
+	args, err := sourceQuery.writeSubquerySQL(b, selectList.String(), nil)
+	if err != nil {
+		return 0, fmt.Errorf("pgxrecord.Table (%s): InsertFromSelect: %w", t.quotedQualifiedName, err)
+	}
+
+	ct, err := exec(ctx, t.db(db, "insert"), b.String(), args)
+	if err != nil {
+		return 0, fmt.Errorf("pgxrecord.Table (%s): InsertFromSelect: %w", t.quotedQualifiedName, err)
+	}
+
+	return ct.RowsAffected(), nil
+}
+
+// maxInsertParameters is the maximum number of parameters in a statement built by InsertReturning and UpsertMany. It
+// is the limit PostgreSQL places on the number of parameters of a statement.
+const maxInsertParameters = 65535
+
+// InsertReturning inserts new records with a single multi-row insert statement and reads every inserted row back into
+// its record as with Save. The columns inserted are those assigned in any of the records. A record that did not
+// assign one of those columns inserts its default. The returned rows are matched to the records in order. Validations
+// and save callbacks are run for each record.
+//
+// PostgreSQL allows at most 65535 parameters in a statement. If the records need more they are inserted with multiple
+// statements. These should be run in a transaction so a failure of a later statement rolls back the earlier ones. The
+// records are only changed if every statement succeeds. It must be called after Finalize.
+func (t *Table) InsertReturning(ctx context.Context, db DB, records []*Record) error {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	err := t.checkRecords(records)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Table (%s): InsertReturning: %w", t.quotedQualifiedName, err)
+	}
+
+	for i, r := range records {
+		if r.originalAttributes != nil {
+			return fmt.Errorf("pgxrecord.Table (%s): InsertReturning: record %d is already persisted", t.quotedQualifiedName, i)
+		}
+
+		err := r.validate(ctx, db, "insert", nil)
+		if err == nil {
+			err = r.runCallbacks(ctx, db, t.beforeSave, "insert")
+		}
+		if err != nil {
+			return fmt.Errorf("pgxrecord.Table (%s): InsertReturning: record %d: %w", t.quotedQualifiedName, i, err)
+		}
+	}
+
+	_, err = t.insertRows(ctx, db, "insert", records, nil, nil)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Table (%s): InsertReturning: %w", t.quotedQualifiedName, err)
+	}
+
+	for i, r := range records {
+		err := r.runCallbacks(ctx, db, t.afterSave, "insert")
+		if err != nil {
+			return fmt.Errorf("pgxrecord.Table (%s): InsertReturning: record %d: %w", t.quotedQualifiedName, i, err)
+		}
+	}
+
+	return nil
+}
+
+// UpsertMany inserts records with a single multi-row insert statement or, for each row that conflicts with target,
+// updates the existing row. Every row is read back into its record. The columns inserted are those assigned in any of
+// the records. The update sets those columns to their excluded values except for the primary key, the conflict target
+// columns, and the created at column. A record that did not assign an inserted column inserts its default, and the
+// update of a conflicting row sets the column to that default too, so the records should assign the same columns. Rows
+// are chunked into multiple statements as with InsertReturning. With SortByKey the rows are inserted in the order of
+// the conflict target columns, or of the primary key if target is a constraint. Validations and callbacks are not run.
+//
+// If target.UpdateWhere excludes the existing rows of some records those records are unchanged and a *NotUpdatedError
+// listing them is returned after the other records are read back. The returned rows are matched to the records by the
+// conflict target columns, or by the primary key if target is a constraint, so every record must assign them. It must
+// be called after Finalize.
+func (t *Table) UpsertMany(ctx context.Context, db DB, records []*Record, target ConflictTarget, options ...BatchOption) error {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	err := t.checkRecords(records)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Table (%s): UpsertMany: %w", t.quotedQualifiedName, err)
+	}
+
+	if (len(target.Columns) == 0) == (target.Constraint == "") {
+		return fmt.Errorf("pgxrecord.Table (%s): UpsertMany: conflict target must have exactly one of columns or constraint", t.quotedQualifiedName)
+	}
+
+	var o batchOptions
+	for _, option := range options {
+		option(&o)
+	}
+
+	keyIndexes := t.pkIndexes
+	if len(target.Columns) > 0 {
+		keyIndexes = make([]int, 0, len(target.Columns))
+		for _, name := range target.Columns {
+			// An unknown column is reported when the conflict target is written.
+			if idx, ok := t.nameToColumnIndex[name]; ok {
+				keyIndexes = append(keyIndexes, idx)
+			}
+		}
+	}
+
+	// Rows excluded by the update predicate are not returned so the returned rows must be matched to the records by key.
+	var matchIndexes []int
+	if target.UpdateWhere != "" {
+		if len(keyIndexes) == 0 {
+			return fmt.Errorf("pgxrecord.Table (%s): UpsertMany: update where requires conflict target columns or a primary key", t.quotedQualifiedName)
+		}
+		for i, r := range records {
+			for _, idx := range keyIndexes {
+				if !r.assigned[idx] {
+					return fmt.Errorf("pgxrecord.Table (%s): UpsertMany: record %d: update where requires %q to be set", t.quotedQualifiedName, i, t.Columns[idx].Name)
+				}
+			}
+		}
+		matchIndexes = keyIndexes
+	}
+
+	// The records are matched to the returned rows by position so sort a copy.
+	order := o.order(records, keyIndexes)
+	if o.sortByKey {
+		sorted := make([]*Record, len(records))
+		for i, idx := range order {
+			sorted[i] = records[idx]
+		}
+		records = sorted
+	}
+
+	writeConflict := func(b *strings.Builder, columnIndexes []int) error {
+		b.WriteString(" on conflict ")
+		conflictIndexes, err := t.writeConflictTarget(b, target)
+		if err != nil {
+			return err
+		}
+
+		b.WriteString(" do update set ")
+		setCount := 0
+		for _, idx := range columnIndexes {
+			c := t.Columns[idx]
+			if _, ok := conflictIndexes[idx]; ok || c.PrimaryKey || idx == t.createdAtIndex || t.isImmutable(idx) {
+				continue
+			}
+			if setCount > 0 {
+				b.WriteString(", ")
+			}
+			setCount++
+			b.WriteString(c.quotedName)
+			b.WriteString(" = excluded.")
+			b.WriteString(c.quotedName)
+		}
+
+		// do update must set at least one column for the returning clause to return the existing row. Setting the
+		// conflict columns to their own values is a no-op.
+		if setCount == 0 {
+			if len(target.Columns) == 0 {
+				return fmt.Errorf("no columns to update")
+			}
+			for i, name := range target.Columns {
+				if i > 0 {
+					b.WriteString(", ")
+				}
+				quotedName := t.quoteIdentifier(name)
+				b.WriteString(quotedName)
+				b.WriteString(" = excluded.")
+				b.WriteString(quotedName)
+			}
+		}
+
+		if target.UpdateWhere != "" {
+			b.WriteString(" where ")
+			b.WriteString(target.UpdateWhere)
+		}
+
+		return nil
+	}
+
+	notReturned, err := t.insertRows(ctx, db, "upsert", records, writeConflict, matchIndexes)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Table (%s): UpsertMany: %w", t.quotedQualifiedName, err)
+	}
+
+	if len(notReturned) > 0 {
+		indexes := make([]int, len(notReturned))
+		for i, j := range notReturned {
+			indexes[i] = order[j]
+		}
+		sort.Ints(indexes)
+		return fmt.Errorf("pgxrecord.Table (%s): UpsertMany: %w", t.quotedQualifiedName, &NotUpdatedError{Indexes: indexes})
+	}
+
+	return nil
+}
+
+// BatchOption is an option for SaveBatch and UpsertMany.
+type BatchOption func(*batchOptions)
+
+type batchOptions struct {
+	sortByKey bool
+}
+
+// SortByKey sends the statements of SaveBatch and the rows of UpsertMany in key order instead of the order of the
+// records. Concurrent transactions that write overlapping rows in different orders can deadlock because each holds a
+// row lock the other is waiting for. When every writer uses SortByKey the locks are taken in the same order, which
+// avoids most such deadlocks. It is a mitigation rather than a guarantee, since triggers, foreign keys, and other
+// statements in the transaction also take locks, so high contention workloads should still retry with WithRetry.
+//
+// Keys are compared column by column. NULL, such as the primary key of a new record, sorts first. Integers and floats
+// are compared numerically, strings lexically, and byte slices and arrays such as a [16]byte uuid bytewise. Other types
+// are compared by their fmt.Sprint text. The records should use the same Go types for their keys so the order is the
+// same for every writer. Records with equal keys keep their relative order.
+func SortByKey() BatchOption {
+	return func(o *batchOptions) {
+		o.sortByKey = true
+	}
+}
+
+// order returns the indexes of records in the order they should be written. Without SortByKey this is the order of
+// records. Otherwise they are sorted by the attributes at keyIndexes.
+func (o *batchOptions) order(records []*Record, keyIndexes []int) []int {
+	order := make([]int, len(records))
+	for i := range order {
+		order[i] = i
+	}
+
+	if o.sortByKey {
+		sort.SliceStable(order, func(a, b int) bool {
+			ra, rb := records[order[a]], records[order[b]]
+			for _, idx := range keyIndexes {
+				c := compareKeyValues(ra.attributes[idx], rb.attributes[idx])
+				if c != 0 {
+					return c < 0
+				}
+			}
+			return false
+		})
+	}
+
+	return order
+}
+
+// compareKeyValues returns -1, 0, or 1 as a is less than, equal to, or greater than b. See SortByKey.
+func compareKeyValues(a, b any) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		default:
+			return 1
+		}
+	}
+
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	switch {
+	case isIntKind(va.Kind()) && isIntKind(vb.Kind()):
+		return compareOrdered(va.Int(), vb.Int())
+	case isUintKind(va.Kind()) && isUintKind(vb.Kind()):
+		return compareOrdered(va.Uint(), vb.Uint())
+	case isNumberKind(va.Kind()) && isNumberKind(vb.Kind()):
+		return compareOrdered(numberAsFloat(va), numberAsFloat(vb))
+	case va.Kind() == reflect.String && vb.Kind() == reflect.String:
+		return strings.Compare(va.String(), vb.String())
+	}
+
+	if ab, ok := keyBytes(va); ok {
+		if bb, ok := keyBytes(vb); ok {
+			return bytes.Compare(ab, bb)
+		}
+	}
+
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func compareOrdered[T int64 | uint64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func isIntKind(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Int64
+}
+
+func isUintKind(k reflect.Kind) bool {
+	return k >= reflect.Uint && k <= reflect.Uintptr
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	return isIntKind(k) || isUintKind(k) || k == reflect.Float32 || k == reflect.Float64
+}
+
+func numberAsFloat(v reflect.Value) float64 {
+	switch {
+	case isIntKind(v.Kind()):
+		return float64(v.Int())
+	case isUintKind(v.Kind()):
+		return float64(v.Uint())
+	default:
+		return v.Float()
+	}
+}
+
+// keyBytes returns the bytes of a byte slice or byte array.
+func keyBytes(v reflect.Value) ([]byte, bool) {
+	if (v.Kind() != reflect.Slice && v.Kind() != reflect.Array) || v.Type().Elem().Kind() != reflect.Uint8 {
+		return nil, false
+	}
+
+	b := make([]byte, v.Len())
+	reflect.Copy(reflect.ValueOf(b), v)
+	return b, true
+}
+
+// checkRecords returns an error if t is not writable or any of records does not belong to t.
+func (t *Table) checkRecords(records []*Record) error {
+	err := t.checkWritable()
+	if err != nil {
+		return err
+	}
+
+	for i, r := range records {
+		if r.table != t {
+			return fmt.Errorf("record %d belongs to table %s", i, r.table.quotedQualifiedName)
+		}
+	}
+
+	return nil
+}
+
+// insertRows inserts records with multi-row insert statements of at most maxInsertParameters parameters and reads the
+// returned rows back into the records. writeConflict is called with the inserted columns to write an on conflict clause
+// if it is not nil. The returned rows are matched to the records in order, or by the values of the columns at
+// matchIndexes if it is not nil. In that case a record may not have a returned row. The indexes of those records are
+// returned and the records are unchanged. The records are only changed if every statement succeeds.
+func (t *Table) insertRows(ctx context.Context, db DB, op string, records []*Record, writeConflict func(b *strings.Builder, columnIndexes []int) error, matchIndexes []int) ([]int, error) {
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columnIndexes := make([]int, 0, len(t.Columns))
+	for i := range t.Columns {
+		for _, r := range records {
+			if r.assigned[i] || r.insertsNow(i) {
+				columnIndexes = append(columnIndexes, i)
+				break
+			}
+		}
+	}
+
+	// A multi-row insert needs at least one column. Every row inserts its default for it.
+	if len(columnIndexes) == 0 {
+		for i, c := range t.Columns {
+			if !c.readOnly() {
+				columnIndexes = append(columnIndexes, i)
+				break
+			}
+		}
+		if len(columnIndexes) == 0 {
+			return nil, fmt.Errorf("table has no insertable columns")
+		}
+	}
+
+	var typeMap *pgtype.Map
+	if matchIndexes != nil {
+		typeMap = typeMapPool.Get().(*pgtype.Map)
+		defer typeMapPool.Put(typeMap)
+	}
+
+	// Read every row before changing any record so a failure leaves all records unchanged.
+	attributes := make([][]any, len(records))
+	chunkSize := maxInsertParameters / len(columnIndexes)
+	for start := 0; start < len(records); start += chunkSize {
+		end := start + chunkSize
+		if end > len(records) {
+			end = len(records)
+		}
+
+		b := &strings.Builder{}
+		args := t.writeMultiRowInsert(b, records[start:end], columnIndexes)
+		if writeConflict != nil {
+			err := writeConflict(b, columnIndexes)
+			if err != nil {
+				return nil, err
+			}
+		}
+		b.WriteByte(' ')
+		b.WriteString(t.returningClause)
+
+		rows, err := t.db(db, op).Query(ctx, b.String(), args...)
+		if err != nil {
+			return nil, err
+		}
+
+		chunkAttributes, err := collectRows(ctx, rows, func(row pgx.CollectableRow) ([]any, error) {
+			values := make([]any, len(t.Columns))
+			scanTargets := make([]any, len(t.Columns))
+			t.setScanTargets(scanTargets, values)
+			err := row.Scan(scanTargets...)
+			return values, err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if matchIndexes == nil {
+			if len(chunkAttributes) != end-start {
+				return nil, fmt.Errorf("returned %d rows but expected %d", len(chunkAttributes), end-start)
+			}
+			copy(attributes[start:end], chunkAttributes)
+			continue
+		}
+
+		keyToRecord := make(map[string]int, end-start)
+		for i := start; i < end; i++ {
+			keyToRecord[t.keyText(typeMap, records[i].attributes, matchIndexes)] = i
+		}
+		for _, values := range chunkAttributes {
+			i, ok := keyToRecord[t.keyText(typeMap, values, matchIndexes)]
+			if !ok {
+				return nil, fmt.Errorf("returned row does not match a record")
+			}
+			attributes[i] = values
+		}
+	}
+
+	var notReturned []int
+	for i, r := range records {
+		if attributes[i] == nil {
+			notReturned = append(notReturned, i)
+			continue
+		}
+		t.convertScanned(attributes[i])
+		r.attributes = attributes[i]
+		r.unloaded = nil
+		r.markPersisted()
+	}
+
+	return notReturned, nil
+}
+
+// keyText returns the values at keyIndexes in the PostgreSQL text format so values of different Go types that encode
+// the same value such as an int and an int32 have the same key.
+func (t *Table) keyText(typeMap *pgtype.Map, values []any, keyIndexes []int) string {
+	b := &strings.Builder{}
+	for _, idx := range keyIndexes {
+		// NULL is distinguished from an empty string by the prefix. The text format cannot contain a zero byte.
+		if values[idx] == nil {
+			b.WriteString("n\x00")
+			continue
+		}
+		b.WriteByte('v')
+		b.WriteString(formatText(typeMap, t.Columns[idx].OID, values[idx]))
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// writeMultiRowInsert writes an insert statement without a returning clause of the columns at columnIndexes for
+// records to b and returns the arguments.
+func (t *Table) writeMultiRowInsert(b *strings.Builder, records []*Record, columnIndexes []int) []any {
+	b.WriteString("insert into ")
+	b.WriteString(t.quotedQualifiedName)
+	b.WriteString(" (")
+	for i, idx := range columnIndexes {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(t.Columns[idx].quotedName)
+	}
+	b.WriteString(") values ")
+
+	args := make([]any, 0, len(records)*len(columnIndexes))
+	for i, r := range records {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for j, idx := range columnIndexes {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			switch {
+			case r.assigned[idx]:
+				args = append(args, r.attributes[idx])
+				b.WriteByte('$')
+				b.WriteString(strconv.FormatInt(int64(len(args)), 10))
+			case r.insertsNow(idx):
+				b.WriteString("now()")
+			default:
+				b.WriteString("default")
+			}
+		}
+		b.WriteByte(')')
+	}
+
+	return args
+}
+
+// SaveBatch saves records in a single round trip with a pgx.Batch. New records are inserted and dirty persisted records
+// are updated. Each returned row is read back into its record as with Save. Clean persisted records are skipped.
+//
+// If any statement fails the error reports the index of the failing record and no record is changed. Outside of a
+// transaction the batch runs in an implicit transaction so a failure rolls back every statement. An update of a stale
+// record fails with ErrStaleObject but does not roll back the other statements, so SaveBatch should be called in a
+// transaction when the table has a VersionColumn. With SortByKey the statements are sent in primary key order. It must
+// be called after Finalize.
+func (t *Table) SaveBatch(ctx context.Context, db BatchDB, records []*Record, options ...BatchOption) error {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	err := t.checkWritable()
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Table (%s): SaveBatch: %w", t.quotedQualifiedName, err)
+	}
+
+	for i, r := range records {
+		if r.table != t {
+			return fmt.Errorf("pgxrecord.Table (%s): SaveBatch: record %d belongs to table %s", t.quotedQualifiedName, i, r.table.quotedQualifiedName)
+		}
+	}
+
+	var o batchOptions
+	for _, option := range options {
+		option(&o)
+	}
+
+	batch := &pgx.Batch{}
+	var ops []string
+	var queued []int
+	for _, i := range o.order(records, t.pkIndexes) {
+		r := records[i]
+		op := "insert"
+		if r.originalAttributes != nil {
+			_, hasUpdate, err := r.updateColumns()
+			if err != nil {
+				return fmt.Errorf("pgxrecord.Table (%s): SaveBatch: record %d: %w", t.quotedQualifiedName, i, err)
+			}
+			if !hasUpdate {
+				continue
+			}
+			op = "update"
+		}
+
+		err := r.validate(ctx, db, op, nil)
+		if err == nil {
+			err = r.runCallbacks(ctx, db, t.beforeSave, op)
+		}
+		if err != nil {
+			return fmt.Errorf("pgxrecord.Table (%s): SaveBatch: record %d: %w", t.quotedQualifiedName, i, err)
+		}
+
+		var sql string
+		var args []any
+		if op == "insert" {
+			sql, args = r.insert(t.returningClause, nil)
+		} else {
+			sql, args = r.update(t.returningClause)
+		}
+
+		batch.Queue(t.rewriteSQL(op, sql), args...)
+		ops = append(ops, op)
+		queued = append(queued, i)
+	}
+
+	if len(queued) == 0 {
+		return nil
+	}
+
+	// Read every row before changing any record so a failure leaves all records unchanged.
+	results := db.SendBatch(ctx, batch)
+	resultsDB := batchResultsDB{results: results}
+	attributes := make([][]any, len(queued))
+	commandTags := make([]pgconn.CommandTag, len(queued))
+	for j, i := range queued {
+		attributes[j] = make([]any, len(t.Columns))
+		scanTargets := make([]any, len(t.Columns))
+		t.setScanTargets(scanTargets, attributes[j])
+
+		var err error
+		commandTags[j], err = queryRow(ctx, resultsDB, "", nil, scanTargets)
+		if err != nil {
+			results.Close()
+			if ops[j] == "update" && t.versionIndex >= 0 && errors.Is(err, pgx.ErrNoRows) {
+				err = ErrStaleObject
+			}
+			return fmt.Errorf("pgxrecord.Table (%s): SaveBatch: record %d: %w", t.quotedQualifiedName, i, err)
+		}
+	}
+
+	err = results.Close()
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Table (%s): SaveBatch: %w", t.quotedQualifiedName, err)
+	}
+
+	for j, i := range queued {
+		t.convertScanned(attributes[j])
+		records[i].attributes = attributes[j]
+		records[i].unloaded = nil
+		records[i].markPersisted()
+		records[i].lastCommandTag = commandTags[j]
+	}
+
+	for j, i := range queued {
+		err := records[i].runCallbacks(ctx, db, t.afterSave, ops[j])
+		if err != nil {
+			return fmt.Errorf("pgxrecord.Table (%s): SaveBatch: record %d: %w", t.quotedQualifiedName, i, err)
+		}
+	}
+
+	return nil
+}
+
+// batchResultsDB is a DB that reads the next result of a batch for each query. The sql and arguments are ignored as
+// they were queued with the batch.
+type batchResultsDB struct {
+	results pgx.BatchResults
+}
+
+func (bdb batchResultsDB) Query(ctx context.Context, sql string, optionsAndArgs ...interface{}) (pgx.Rows, error) {
+	return bdb.results.Query()
+}
+
+// Set sets a attribute to a value.
+//
+// If the attribute is a bytea column value may be an io.Reader. The PostgreSQL protocol does not support streaming
+// parameters so the reader is read into memory immediately. It must not exceed the 1GB PostgreSQL limit for bytea
+// values.
+func (r *Record) Set(attribute string, value any) error {
+	idx, ok := r.table.nameToColumnIndex[attribute]
+	if !ok {
+		return fmt.Errorf("pgxrecord.Record (%s): Set: attribute %q is not found", r.table.quotedQualifiedName, attribute)
+	}
+
+	err := r.setAttribute(idx, value)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Record (%s): Set: attribute %q: %w", r.table.quotedQualifiedName, attribute, err)
+	}
+
+	return nil
+}
+
+// setAttribute sets the attribute at index idx to value and marks it as assigned.
+func (r *Record) setAttribute(idx int, value any) error {
+	c := r.table.Columns[idx]
+	if c.Generated {
+		return fmt.Errorf("generated column cannot be set")
+	}
+	if c.Identity == "always" {
+		return fmt.Errorf("generated always identity column cannot be set")
+	}
+
+	if s, ok := value.(string); ok && r.table.ValidateEnums && c.EnumLabels != nil && !containsString(c.EnumLabels, s) {
+		return fmt.Errorf("invalid enum value %q: must be one of %s", s, strings.Join(c.EnumLabels, ", "))
+	}
+
+	if reader, ok := value.(io.Reader); ok && c.OID == pgtype.ByteaOID {
+		buf, err := io.ReadAll(io.LimitReader(reader, maxByteaSize+1))
+		if err != nil {
+			return err
+		}
+		if len(buf) > maxByteaSize {
+			return fmt.Errorf("bytea value exceeds %d bytes", maxByteaSize)
+		}
+		value = buf
+	}
+
+	if s, ok := value.(string); ok && r.table.CoerceStrings {
+		var err error
+		value, err = coerceString(c.OID, s)
+		if err != nil {
+			return err
+		}
+	}
+
+	if r.table.ValidateTypes && value != nil {
+		err := checkType(c.OID, value)
+		if err != nil {
+			return fmt.Errorf("invalid value of type %T: %w", value, err)
+		}
+	}
+
+	r.attributes[idx] = value
+	r.assigned[idx] = true
+
+	return nil
+}
+
+// MustSet sets a attribute to a value. It panics on failure.
+func (r *Record) MustSet(attribute string, value any) {
+	err := r.Set(attribute, value)
+	if err != nil {
+		panic(err.Error())
+	}
+}
+
+// Unset undoes any Set of attribute since the record was created or last read from or written to the database. The
+// attribute returns to its value from the database or to nil for a new record. An unset attribute is omitted from an
+// insert so the database supplies its default and is not written by an update. This differs from setting the attribute
+// to nil which writes NULL.
+func (r *Record) Unset(attribute string) error {
+	idx, ok := r.table.nameToColumnIndex[attribute]
+	if !ok {
+		return fmt.Errorf("pgxrecord.Record (%s): Unset: attribute %q is not found", r.table.quotedQualifiedName, attribute)
+	}
+
+	if r.originalAttributes == nil {
+		r.attributes[idx] = nil
+	} else {
+		r.attributes[idx] = r.originalAttributes[idx]
+	}
+	r.assigned[idx] = false
+
+	return nil
+}
+
+// IsSet returns true if attribute has been set since the record was created or last read from or written to the
+// database. An attribute set to nil is set. It returns false if attribute is not found.
+func (r *Record) IsSet(attribute string) bool {
+	idx, ok := r.table.nameToColumnIndex[attribute]
+	return ok && r.assigned[idx]
+}
+
+// Get returns the value of attribute. It returns an error if the attribute was not selected when the record was read
+// and has not been set. See Query.Select. It also returns the values of expressions selected with Query.SelectExpr.
+func (r *Record) Get(attribute string) (any, error) {
+	idx, ok := r.table.nameToColumnIndex[attribute]
+	if !ok {
+		if value, ok := r.computed[attribute]; ok {
+			return value, nil
+		}
+		return nil, fmt.Errorf("pgxrecord.Record (%s): Get: attribute %q is not found", r.table.quotedQualifiedName, attribute)
+	}
+
+	if !r.isLoaded(idx) {
+		return nil, fmt.Errorf("pgxrecord.Record (%s): Get: attribute %q is not loaded", r.table.quotedQualifiedName, attribute)
+	}
+
+	return r.attributes[idx], nil
+}
+
+// systemColumnNames are the names of the system columns every table has.
+var systemColumnNames = map[string]struct{}{
+	"tableoid": {},
+	"xmin":     {},
+	"cmin":     {},
+	"xmax":     {},
+	"cmax":     {},
+	"ctid":     {},
+}
+
+// SystemColumn returns the value of the system column name read back by the last Save with Returning. e.g. xmin is a
+// uint32 that changes whenever the row is written so it can be used as a cheap version token. ctid is a pgtype.TID. It
+// returns an error if name is not a system column or it was not returned. The values are discarded when the record is
+// read or saved again.
+func (r *Record) SystemColumn(name string) (any, error) {
+	if _, ok := systemColumnNames[name]; !ok {
+		return nil, fmt.Errorf("pgxrecord.Record (%s): SystemColumn: %q is not a system column", r.table.quotedQualifiedName, name)
+	}
+
+	value, ok := r.systemColumns[name]
+	if !ok {
+		return nil, fmt.Errorf("pgxrecord.Record (%s): SystemColumn: %q was not returned", r.table.quotedQualifiedName, name)
+	}
+
+	return value, nil
+}
+
+// MustGet returns the value of attribute. It panics on failure.
+func (r *Record) MustGet(attribute string) any {
+	value, err := r.Get(attribute)
+	if err != nil {
+		panic(err.Error())
+	}
+	return value
+}
+
+// GetReader returns an io.Reader for the value of a bytea attribute. The value is already in memory. The reader is
+// empty if the value is NULL.
+func (r *Record) GetReader(attribute string) (io.Reader, error) {
+	idx, ok := r.table.nameToColumnIndex[attribute]
+	if !ok {
+		return nil, fmt.Errorf("pgxrecord.Record (%s): GetReader: attribute %q is not found", r.table.quotedQualifiedName, attribute)
+	}
+
+	switch value := r.attributes[idx].(type) {
+	case nil:
+		return bytes.NewReader(nil), nil
+	case []byte:
+		return bytes.NewReader(value), nil
+	default:
+		return nil, fmt.Errorf("pgxrecord.Record (%s): GetReader: attribute %q is %T not []byte", r.table.quotedQualifiedName, attribute, value)
+	}
+}
+
+// SetAttributes sets attributes.
+func (r *Record) SetAttributes(attributes map[string]any) error {
+	for k, v := range attributes {
+		idx, ok := r.table.nameToColumnIndex[k]
+		if !ok {
+			return fmt.Errorf("pgxrecord.Record (%s): Set: attribute %q is not found", r.table.quotedQualifiedName, k)
+		}
+
+		err := r.setAttribute(idx, v)
+		if err != nil {
+			return fmt.Errorf("pgxrecord.Record (%s): Set: attribute %q: %w", r.table.quotedQualifiedName, k, err)
+		}
+	}
+
+	return nil
+}
+
+// SetAttributesPermitted sets the attributes permitted by PermitAttributes. Other attributes, including attributes that
+// are not found, are silently ignored. It is intended for untrusted input such as a decoded request body.
+func (r *Record) SetAttributesPermitted(attributes map[string]any) error {
+	for k, v := range attributes {
+		if _, ok := r.table.permittedAttributes[k]; !ok {
+			continue
+		}
+
+		idx, ok := r.table.nameToColumnIndex[k]
+		if !ok {
+			continue
+		}
+
+		err := r.setAttribute(idx, v)
+		if err != nil {
+			return fmt.Errorf("pgxrecord.Record (%s): SetAttributesPermitted: attribute %q: %w", r.table.quotedQualifiedName, k, err)
+		}
+	}
+
+	return nil
+}
+
+// Clone returns a new record with a copy of the loaded attributes of r. The primary key, version, generated, and
+// generated always identity columns are left unset so a Save of the clone inserts a new row. Every copied attribute is
+// assigned. r is not changed.
+func (r *Record) Clone() *Record {
+	clone := r.table.NewRecord()
+	for i, c := range r.table.Columns {
+		if c.PrimaryKey || i == r.table.versionIndex || c.readOnly() || !r.isLoaded(i) {
+			continue
+		}
+
+		clone.attributes[i] = cloneValue(r.attributes[i])
+		clone.assigned[i] = true
+	}
+
+	return clone
+}
+
+// cloneValue returns a deep copy of value if it is a byte slice or a value decoded from JSON. Other values are returned
+// unchanged.
+func cloneValue(value any) any {
+	switch value := value.(type) {
+	case []byte:
+		if value == nil {
+			return value
+		}
+		return append([]byte{}, value...)
+	case map[string]any:
+		if value == nil {
+			return value
+		}
+		m := make(map[string]any, len(value))
+		for k, v := range value {
+			m[k] = cloneValue(v)
+		}
+		return m
+	case []any:
+		if value == nil {
+			return value
+		}
+		s := make([]any, len(value))
+		for i, v := range value {
+			s[i] = cloneValue(v)
+		}
+		return s
+	default:
+		return value
+	}
+}
+
+// Attributes returns all attributes. Attributes that are not loaded are omitted. An attribute of a new record that has
+// not been set is nil just like an attribute explicitly set to NULL. Use IsSet to distinguish them. Values read with
+// Query.SelectExpr are not columns so they are not included. Use Get to read them.
+func (r *Record) Attributes() map[string]any {
+	m := make(map[string]any, len(r.attributes))
+	for i := range r.table.Columns {
+		if r.isLoaded(i) {
+			m[r.table.Columns[i].Name] = r.attributes[i]
+		}
+	}
+
+	return m
+}
+
+// ChangedAttributes returns the attributes that would be written by Save. For a new record these are all assigned
+// attributes. For a persisted record these are the assigned attributes whose values differ from the values last read
+// from the database.
+func (r *Record) ChangedAttributes() map[string]any {
+	m := make(map[string]any)
+	for i := range r.attributes {
+		if r.changed(i) {
+			m[r.table.Columns[i].Name] = r.attributes[i]
+		}
+	}
+
+	return m
+}
+
+// IsDirty returns true if the record has any changed attributes.
+func (r *Record) IsDirty() bool {
+	for i := range r.attributes {
+		if r.changed(i) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Diff returns the attributes that differ between r and other as a map of column name to the value in r and the value
+// in other. e.g. before.Diff(after) returns the old and new values of each changed attribute. Values are compared by
+// their PostgreSQL text format for the column type so e.g. int32(1) and int(1) are equal. Attributes that are not loaded
+// in either record are not compared. other must be a record of the same table.
+func (r *Record) Diff(other *Record) map[string][2]any {
+	if r.table != other.table {
+		panic("cannot diff records of different tables")
+	}
+
+	typeMap := typeMapPool.Get().(*pgtype.Map)
+	defer typeMapPool.Put(typeMap)
+
+	diff := make(map[string][2]any)
+	for i, c := range r.table.Columns {
+		if !r.isLoaded(i) || !other.isLoaded(i) {
+			continue
+		}
+
+		if !valuesEqual(typeMap, c.OID, r.attributes[i], other.attributes[i]) {
+			diff[c.Name] = [2]any{r.attributes[i], other.attributes[i]}
+		}
+	}
+
+	return diff
+}
+
+// Equal returns true if r and other are records of the same table and Diff returns no differences.
+func (r *Record) Equal(other *Record) bool {
+	return r.table == other.table && len(r.Diff(other)) == 0
+}
+
+// valuesEqual returns true if a and b are equal values of the type with oid. Values of different Go types are equal if
+// they have the same text format.
+func valuesEqual(typeMap *pgtype.Map, oid uint32, a, b any) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	if a == nil || b == nil {
+		return false
+	}
+
+	return formatText(typeMap, oid, a) == formatText(typeMap, oid, b)
+}
+
+func (r *Record) changed(i int) bool {
+	if !r.assigned[i] {
+		return false
+	}
+
+	// The value in the database of an unloaded attribute is unknown.
+	if r.originalAttributes == nil || (r.unloaded != nil && r.unloaded[i]) {
+		return true
+	}
+
+	return !reflect.DeepEqual(r.originalAttributes[i], r.attributes[i])
+}
+
+// SaveOption is an option for Save.
+type SaveOption func(*saveOptions)
+
+type saveOptions struct {
+	customReturning   bool
+	returning         []returningAttribute
+	insertColumns     []string
+	pgErrorTranslator func(*pgconn.PgError) error
+}
+
+// returningAttribute is an attribute read back by Save with the SQL expression that is returned for it. An empty expr
+// returns the column.
+type returningAttribute struct {
+	name string
+	expr string
+}
+
+// Returning limits the attributes read back by Save to attributes instead of every column. Other attributes keep their
+// in memory values except those whose values were supplied by the database, such as a column left to its default on
+// insert or a generated column. They are not loaded as with Query.Select so a later Save does not write them. A new
+// record should return its primary key unless it was assigned or the record cannot be updated later. Returning with no
+// attributes skips the returning clause entirely. If the table has a VersionColumn the version column is always
+// returned so optimistic locking keeps working.
+//
+// The attribute "*" returns every column. The system columns tableoid, xmin, cmin, xmax, cmax, and ctid can also be
+// returned. e.g. Returning("*", "xmin"). Their values are read with SystemColumn instead of Get because they are not
+// columns of the table.
+func Returning(attributes ...string) SaveOption {
+	return func(so *saveOptions) {
+		so.customReturning = true
+		for _, name := range attributes {
+			so.returning = append(so.returning, returningAttribute{name: name})
+		}
+	}
+}
+
+// ReturningExpr adds the SQL expression expr to the attributes read back by Save. Its value is stored in attribute. e.g.
+// ReturningExpr("name", "upper(name)"). expr is not escaped so it must not contain user input. It implies Returning
+// so only the attributes given to Returning and ReturningExpr are read back.
+func ReturningExpr(attribute string, expr string) SaveOption {
+	return func(so *saveOptions) {
+		so.customReturning = true
+		so.returning = append(so.returning, returningAttribute{name: attribute, expr: expr})
+	}
+}
+
+// TranslatePgError causes Save to translate a database error with translate instead of the PgErrorTranslator of the
+// table. e.g. an API handler and a background job can present the same unique violation differently.
+func TranslatePgError(translate func(*pgconn.PgError) error) SaveOption {
+	return func(so *saveOptions) {
+		so.pgErrorTranslator = translate
+	}
+}
+
+// SaveResult is the result of SaveWithResult.
+type SaveResult struct {
+	// Op is "insert" or "update". It is empty if nothing was saved because the record had no changes.
+	Op string
+
+	// RowsAffected is the number of rows inserted or updated from the command tag. It is 0 if nothing was saved or if
+	// an update matched no row.
+	RowsAffected int64
+
+	// Columns are the names of the attributes of the record that were written. Columns that are set by the database
+	// such as automatic timestamps and the version column are not included.
+	Columns []string
+}
+
+// InsertColumns limits the columns inserted by Save to those of columns that would otherwise be inserted. Other
+// assigned attributes are not written and the database supplies their values such as with a default or a trigger. The
+// values read back replace them. The not null check treats the omitted columns as not set. It does not affect updates.
+func InsertColumns(columns ...string) SaveOption {
+	return func(so *saveOptions) {
+		so.insertColumns = append(so.insertColumns, columns...)
+	}
+}
+
+// Save saves the record using db. A new record is inserted. A persisted record is updated with only its changed
+// attributes. If a persisted record has no changed attributes other than ImmutableColumns Save does nothing. By default
+// every column is read back into the record. See Returning and SaveNoReturning to change that.
+func (r *Record) Save(ctx context.Context, db DB, options ...SaveOption) error {
+	err := r.saveRow(ctx, db, options)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Record (%s): Save: %w", r.table.quotedQualifiedName, err)
+	}
+
+	return nil
+}
+
+// SaveWithResult is like Save but it also returns what was saved. e.g. SaveResult.Op is empty when a persisted record
+// had no changes to save. When the update of a record of a table without a VersionColumn matches no row, such as when
+// the row was deleted, Save returns pgx.ErrNoRows but SaveWithResult returns a SaveResult with RowsAffected of 0 and no
+// error. The record is unchanged.
+func (r *Record) SaveWithResult(ctx context.Context, db DB, options ...SaveOption) (SaveResult, error) {
+	result, err := r.save(ctx, db, options)
+	if err != nil {
+		return SaveResult{}, fmt.Errorf("pgxrecord.Record (%s): SaveWithResult: %w", r.table.quotedQualifiedName, err)
+	}
+
+	return result, nil
+}
+
+// LastCommandTag returns the command tag of the most recent write of the record such as by Save, Delete, Upsert, or
+// SoftDelete. e.g. LastCommandTag().Insert() is true after a Save that inserted the record. It is empty if the record
+// has not been written. An upsert reports an insert even if it updated an existing row.
+func (r *Record) LastCommandTag() pgconn.CommandTag {
+	return r.lastCommandTag
+}
+
+// SaveNoReturning is like Save but the insert or update has no returning clause and nothing is read back. It is faster
+// when the values generated by the database are not needed. Columns set by the database such as an identity primary key
+// or a column left to its default are not loaded afterward as with Returning. A column changed by a trigger keeps its
+// in memory value. A new record without an assigned primary key therefore cannot be updated or deleted later. An update
+// that affects no row is an error where errors.Is(pgx.ErrNoRows) is true. If the table has a VersionColumn the version
+// column is still returned so optimistic locking keeps working. Returning and ReturningExpr options are ignored.
+func (r *Record) SaveNoReturning(ctx context.Context, db DB, options ...SaveOption) error {
+	options = append(options[:len(options):len(options)], func(so *saveOptions) {
+		so.customReturning = true
+		so.returning = nil
+	})
+
+	err := r.saveRow(ctx, db, options)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Record (%s): SaveNoReturning: %w", r.table.quotedQualifiedName, err)
+	}
+
+	return nil
+}
+
+// saveRow is like save but an update that matches no row is an error where errors.Is(pgx.ErrNoRows) is true.
+func (r *Record) saveRow(ctx context.Context, db DB, options []SaveOption) error {
+	result, err := r.save(ctx, db, options)
+	if err == nil && result.Op == "update" && result.RowsAffected == 0 {
+		err = pgx.ErrNoRows
+	}
+	return err
+}
+
+func (r *Record) save(ctx context.Context, db DB, options []SaveOption) (SaveResult, error) {
+	err := r.table.checkWritable()
+	if err != nil {
+		return SaveResult{}, err
+	}
+
+	var so saveOptions
+	for _, o := range options {
+		o(&so)
+	}
+
+	returningClause := r.table.returningClause
+	var returningIndexes []int
+	var returningSystem []string
+	if so.customReturning {
+		returningClause, returningIndexes, returningSystem, err = r.table.buildCustomReturning(so.returning)
+		if err != nil {
+			return SaveResult{}, err
+		}
+	}
+
+	// omitted is true for the columns excluded by InsertColumns. It is nil if every column can be inserted.
+	var omitted []bool
+	if so.insertColumns != nil && r.originalAttributes == nil {
+		omitted = make([]bool, len(r.table.Columns))
+		for i := range omitted {
+			omitted[i] = true
+		}
+		for _, name := range so.insertColumns {
+			idx, ok := r.table.nameToColumnIndex[name]
+			if !ok {
+				return SaveResult{}, fmt.Errorf("insert column %q is not found", name)
+			}
+			omitted[idx] = false
+		}
+	}
+
+	result := SaveResult{Op: "insert"}
+	if r.originalAttributes != nil {
+		var hasUpdate bool
+		result.Columns, hasUpdate, err = r.updateColumns()
+		if err != nil {
+			return SaveResult{}, err
+		}
+		if !hasUpdate {
+			return SaveResult{}, nil
+		}
+
+		result.Op = "update"
+	} else {
+		for i := range r.attributes {
+			if r.assigned[i] && !isOmitted(omitted, i) {
+				result.Columns = append(result.Columns, r.table.Columns[i].Name)
+			}
+		}
+	}
+	op := result.Op
+
+	err = r.validate(ctx, db, op, omitted)
+	if err != nil {
+		return SaveResult{}, err
+	}
+
+	err = r.runCallbacks(ctx, db, r.table.beforeSave, op)
+	if err != nil {
+		return SaveResult{}, err
+	}
+
+	var sql string
+	var args []any
+	if op == "insert" {
+		sql, args = r.insert(returningClause, omitted)
+	} else {
+		sql, args = r.update(returningClause)
+	}
+
+	if so.customReturning {
+		err = r.queryRowIntoReturning(ctx, db, op, sql, args, returningIndexes, returningSystem)
+	} else {
+		err = r.queryRowIntoAttributes(ctx, db, op, sql, args)
+	}
+	if err != nil {
+		if op == "update" && errors.Is(err, pgx.ErrNoRows) {
+			if r.table.versionIndex >= 0 {
+				return SaveResult{}, ErrStaleObject
+			}
+			// The row no longer exists. The record is unchanged.
+			return result, nil
+		}
+		return SaveResult{}, r.table.translatePgError(err, so.pgErrorTranslator)
+	}
+	result.RowsAffected = r.lastCommandTag.RowsAffected()
+
+	err = r.runCallbacks(ctx, db, r.table.afterSave, op)
+	if err != nil {
+		return SaveResult{}, err
+	}
+
+	return result, nil
+}
+
+// updateColumns returns the names of the changed columns an update of r would set. A change to the version column is
+// not included as it only causes the column to be incremented. hasUpdate is false if there is nothing to update
+// because no column or only immutable columns changed. It returns an error for a changed immutable column if
+// StrictImmutableColumns is set.
+func (r *Record) updateColumns() (columns []string, hasUpdate bool, err error) {
+	for i := range r.attributes {
+		if !r.changed(i) {
+			continue
+		}
+		if r.table.isImmutable(i) {
+			if r.table.StrictImmutableColumns {
+				return nil, false, fmt.Errorf("column %q is immutable", r.table.Columns[i].Name)
+			}
+			continue
+		}
+		hasUpdate = true
+		if i != r.table.versionIndex {
+			columns = append(columns, r.table.Columns[i].Name)
+		}
+	}
+
+	return columns, hasUpdate, nil
+}
+
+// buildCustomReturning builds the returning clause for the attributes in returning and returns it with the index of
+// the attribute each returned value is stored in and the names of the system columns returned after them. The version
+// column is added if it is not present. The returning clause is empty if there are no attributes to return.
+func (t *Table) buildCustomReturning(returning []returningAttribute) (string, []int, []string, error) {
+	indexes := make([]int, 0, len(returning)+1)
+	exprs := make([]string, 0, len(returning)+1)
+	var system []string
+	for _, ra := range returning {
+		if ra.name == "*" && ra.expr == "" {
+			for i, c := range t.Columns {
+				if !containsInt(indexes, i) {
+					indexes = append(indexes, i)
+					exprs = append(exprs, c.quotedName)
+				}
+			}
+			continue
+		}
+
+		idx, ok := t.nameToColumnIndex[ra.name]
+		if !ok {
+			if _, ok := systemColumnNames[ra.name]; ok && ra.expr == "" {
+				system = append(system, ra.name)
+				continue
+			}
+			return "", nil, nil, fmt.Errorf("returning attribute %q is not found", ra.name)
+		}
+
+		expr := ra.expr
+		if expr == "" {
+			expr = t.Columns[idx].quotedName
+		}
+		indexes = append(indexes, idx)
+		exprs = append(exprs, expr)
+	}
+
+	if t.versionIndex >= 0 && !containsInt(indexes, t.versionIndex) {
+		indexes = append(indexes, t.versionIndex)
+		exprs = append(exprs, t.Columns[t.versionIndex].quotedName)
+	}
+
+	// System columns are always named with their reserved names so they never need quotes.
+	exprs = append(exprs, system...)
+
+	if len(exprs) == 0 {
+		return "", nil, nil, nil
+	}
+
+	return "returning " + strings.Join(exprs, ", "), indexes, system, nil
+}
+
+// queryRowIntoReturning is like queryRowIntoAttributes but only the attributes at indexes are read from the returned
+// row followed by the system columns named by system. If both are empty sql has no returning clause and it is only
+// executed.
+func (r *Record) queryRowIntoReturning(ctx context.Context, db DB, op string, sql string, args []any, indexes []int, system []string) error {
+	if len(indexes) == 0 && len(system) == 0 {
+		commandTag, err := exec(ctx, r.table.db(db, op), sql, args)
+		if err != nil {
+			return err
+		}
+		if commandTag.RowsAffected() == 0 {
+			return pgx.ErrNoRows
+		}
+		r.markNotReturnedUnloaded(op, indexes)
+		r.markPersisted()
+		r.lastCommandTag = commandTag
+		return nil
+	}
+
+	returned := make([]any, len(r.attributes))
+	allTargets := make([]any, len(r.attributes))
+	r.table.setScanTargets(allTargets, returned)
+	scanTargets := make([]any, len(indexes), len(indexes)+len(system))
+	for i, idx := range indexes {
+		scanTargets[i] = allTargets[idx]
+	}
+	systemValues := make([]any, len(system))
+	for i := range systemValues {
+		scanTargets = append(scanTargets, &systemValues[i])
+	}
+
+	commandTag, err := queryRow(ctx, r.table.db(db, op), sql, args, scanTargets)
+	if err != nil {
+		return err
+	}
+	r.table.convertScanned(returned)
+
+	r.markNotReturnedUnloaded(op, indexes)
+	for _, idx := range indexes {
+		r.attributes[idx] = returned[idx]
+		if r.unloaded != nil {
+			r.unloaded[idx] = false
+		}
+	}
+	r.markPersisted()
+	r.lastCommandTag = commandTag
+	if len(system) > 0 {
+		r.systemColumns = make(map[string]any, len(system))
+		for i, name := range system {
+			r.systemColumns[name] = systemValues[i]
+		}
+	}
+
+	return nil
+}
+
+// markNotReturnedUnloaded marks the attributes that were written by the database with op but not read back because
+// they are not at indexes as unloaded. Their values are unknown so they are not read or written until they are loaded
+// or set. For an insert these are the attributes that were not set as the database supplies their values. For an update
+// these are the generated columns and the updated at column if it was set to now(). It must be called before
+// markPersisted.
+func (r *Record) markNotReturnedUnloaded(op string, indexes []int) {
+	for i, c := range r.table.Columns {
+		if containsInt(indexes, i) {
+			continue
+		}
+
+		var unknown bool
+		if op == "insert" {
+			unknown = !r.assigned[i]
+		} else {
+			unknown = c.Generated || (i == r.table.updatedAtIndex && !r.changed(i))
+		}
+		if !unknown {
+			continue
+		}
+
+		if r.unloaded == nil {
+			r.unloaded = make([]bool, len(r.table.Columns))
+		}
+		r.unloaded[i] = true
+	}
+}
+
+// ConflictTarget is the conflict target of an upsert. Exactly one of Columns or Constraint must be set.
+type ConflictTarget struct {
+	// Columns are the names of the columns that make up a unique index. If the table has a soft delete column the
+	// conflict target only matches rows that are not soft deleted.
+	Columns []string
+
+	// Constraint is the name of a unique or exclusion constraint.
+	Constraint string
+
+	// Where is the predicate of a partial unique index on Columns such as "not archived". PostgreSQL only infers a
+	// partial index as the arbiter when the conflict target has a predicate that implies the index predicate. The
+	// predicate of a loaded index is UniqueConstraint.Predicate. Where is not escaped so it must not contain user input.
+	// It requires Columns.
+	Where string
+
+	// UpdateWhere is a predicate such as "excluded.updated_at > t.updated_at" that the existing row must satisfy to be
+	// updated by an upsert. The proposed row is referenced as excluded and the existing row by the table name. When it
+	// excludes the existing row nothing is changed. UpdateWhere is not escaped so it must not contain user input.
+	UpdateWhere string
+}
+
+// Upsert inserts the record or, if the insert conflicts with target, updates the existing row. The update sets all
+// assigned columns that are not part of the primary key or the conflict target to their excluded values. The resulting
+// row is read back into the record. If target.UpdateWhere excludes the existing row it returns ErrNotUpdated and the
+// record is unchanged. Validations, callbacks, and the not null check are not run.
+func (r *Record) Upsert(ctx context.Context, db DB, target ConflictTarget) error {
+	err := r.table.checkWritable()
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Record (%s): Upsert: %w", r.table.quotedQualifiedName, err)
+	}
+
+	sql, args, err := r.upsert(target)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Record (%s): Upsert: %w", r.table.quotedQualifiedName, err)
+	}
+
+	err = r.queryRowIntoAttributes(ctx, db, "upsert", sql, args)
+	if target.UpdateWhere != "" && errors.Is(err, pgx.ErrNoRows) {
+		err = ErrNotUpdated
+	}
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Record (%s): Upsert: %w", r.table.quotedQualifiedName, err)
+	}
+
+	return nil
+}
+
+// InsertIgnore inserts the record unless the insert conflicts with target, in which case nothing is done. It returns
+// true if the record was inserted. The inserted row is read back into the record. A skipped record is unchanged and
+// still new. target may be empty to skip a conflict with any unique or exclusion constraint. Validations and callbacks
+// are not run.
+func (r *Record) InsertIgnore(ctx context.Context, db DB, target ConflictTarget) (bool, error) {
+	err := r.table.checkWritable()
+	if err != nil {
+		return false, fmt.Errorf("pgxrecord.Record (%s): InsertIgnore: %w", r.table.quotedQualifiedName, err)
+	}
+
+	if len(target.Columns) > 0 && target.Constraint != "" {
+		return false, fmt.Errorf("pgxrecord.Record (%s): InsertIgnore: conflict target must not have both columns and constraint", r.table.quotedQualifiedName)
+	}
+	if target.UpdateWhere != "" {
+		return false, fmt.Errorf("pgxrecord.Record (%s): InsertIgnore: conflict target must not have update where", r.table.quotedQualifiedName)
+	}
+
+	b := &strings.Builder{}
+	args := r.writeInsert(b, nil)
+	b.WriteString(" on conflict ")
+	_, err = r.table.writeConflictTarget(b, target)
+	if err != nil {
+		return false, fmt.Errorf("pgxrecord.Record (%s): InsertIgnore: %w", r.table.quotedQualifiedName, err)
+	}
+	if len(target.Columns) > 0 || target.Constraint != "" {
+		b.WriteByte(' ')
+	}
+	b.WriteString("do nothing ")
+	b.WriteString(r.table.returningClause)
+
+	err = r.queryRowIntoAttributes(ctx, db, "insert", b.String(), args)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("pgxrecord.Record (%s): InsertIgnore: %w", r.table.quotedQualifiedName, err)
+	}
+
+	return true, nil
+}
+
+// Reload reads the record from the database again by its primary key and replaces its attributes. Afterward the record
+// has no changed attributes. The record must have been read from or saved to the database. If the row no longer exists
+// it returns an error where errors.Is(pgx.ErrNoRows) is true.
+func (r *Record) Reload(ctx context.Context, db DB) error {
+	if r.originalAttributes == nil {
+		return fmt.Errorf("pgxrecord.Record (%s): Reload: record is not persisted", r.table.quotedQualifiedName)
+	}
+
+	err := r.queryRowIntoAttributes(ctx, db, "select", r.table.selectByPKQuery, r.pkArgs(len(r.table.pkIndexes)))
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Record (%s): Reload: %w", r.table.quotedQualifiedName, err)
+	}
+
+	return nil
+}
+
+// Delete deletes the record from the database. The record must have been read from or saved to the database. If the
+// table has a version column and the row was changed since it was read Delete returns ErrStaleObject. Afterward the
+// record is considered new.
+func (r *Record) Delete(ctx context.Context, db DB) error {
+	err := r.table.checkWritable()
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Record (%s): Delete: %w", r.table.quotedQualifiedName, err)
+	}
+
+	if r.originalAttributes == nil {
+		return fmt.Errorf("pgxrecord.Record (%s): Delete: record is not persisted", r.table.quotedQualifiedName)
+	}
+
+	err = r.runCallbacks(ctx, db, r.table.beforeDelete, "delete")
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Record (%s): Delete: %w", r.table.quotedQualifiedName, err)
+	}
+
+	sql, args := r.delete()
+	ct, err := exec(ctx, r.table.db(db, "delete"), sql, args)
+	if err == nil && ct.RowsAffected() == 0 {
+		err = pgx.ErrNoRows
+		if r.table.versionIndex >= 0 {
+			err = ErrStaleObject
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Record (%s): Delete: %w", r.table.quotedQualifiedName, err)
+	}
+
+	r.originalAttributes = nil
+	r.lastCommandTag = ct
+
+	err = r.runCallbacks(ctx, db, r.table.afterDelete, "delete")
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Record (%s): Delete: %w", r.table.quotedQualifiedName, err)
+	}
+
+	return nil
+}
+
+// DeleteReturning deletes the record from the database like Delete and reads the deleted row back into the record. This
+// returns the attributes the row had when it was deleted without a separate select that could race with other
+// changes. If no row was deleted it returns an error where errors.Is(ErrNotFound) is true, or ErrStaleObject if the
+// table has a version column. Afterward the record is considered new.
+func (r *Record) DeleteReturning(ctx context.Context, db DB) error {
+	err := r.table.checkWritable()
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Record (%s): DeleteReturning: %w", r.table.quotedQualifiedName, err)
+	}
+
+	if r.originalAttributes == nil {
+		return fmt.Errorf("pgxrecord.Record (%s): DeleteReturning: record is not persisted", r.table.quotedQualifiedName)
+	}
+
+	err = r.runCallbacks(ctx, db, r.table.beforeDelete, "delete")
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Record (%s): DeleteReturning: %w", r.table.quotedQualifiedName, err)
+	}
+
+	err = r.queryRowIntoAttributes(ctx, db, "delete", r.table.deleteReturningQuery, r.pkAndVersionArgs())
+	if err != nil {
+		if r.table.versionIndex >= 0 && errors.Is(err, pgx.ErrNoRows) {
+			err = ErrStaleObject
+		}
+		return fmt.Errorf("pgxrecord.Record (%s): DeleteReturning: %w", r.table.quotedQualifiedName, err)
+	}
+
+	r.originalAttributes = nil
+
+	err = r.runCallbacks(ctx, db, r.table.afterDelete, "delete")
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Record (%s): DeleteReturning: %w", r.table.quotedQualifiedName, err)
+	}
+
+	return nil
+}
+
+// SoftDelete marks the record as deleted by setting the table's soft delete column to now(). The resulting row is read
+// back into the record. If the table does not have a soft delete column SoftDelete deletes the record with Delete.
+func (r *Record) SoftDelete(ctx context.Context, db DB) error {
+	if r.table.softDeleteIndex < 0 {
+		return r.Delete(ctx, db)
+	}
+
+	err := r.table.checkWritable()
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Record (%s): SoftDelete: %w", r.table.quotedQualifiedName, err)
+	}
+
+	if r.originalAttributes == nil {
+		return fmt.Errorf("pgxrecord.Record (%s): SoftDelete: record is not persisted", r.table.quotedQualifiedName)
+	}
+
+	err = r.runCallbacks(ctx, db, r.table.beforeDelete, "soft delete")
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Record (%s): SoftDelete: %w", r.table.quotedQualifiedName, err)
+	}
+
+	sql, args := r.softDelete()
+	err = r.queryRowIntoAttributes(ctx, db, "update", sql, args)
+	if err != nil {
+		if r.table.versionIndex >= 0 && errors.Is(err, pgx.ErrNoRows) {
+			err = ErrStaleObject
+		}
+		return fmt.Errorf("pgxrecord.Record (%s): SoftDelete: %w", r.table.quotedQualifiedName, err)
 	}
 
-	record := &Record{
-		table:      t,
-		attributes: make([]any, len(t.Columns)),
-		assigned:   make([]bool, len(t.Columns)),
+	err = r.runCallbacks(ctx, db, r.table.afterDelete, "soft delete")
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Record (%s): SoftDelete: %w", r.table.quotedQualifiedName, err)
 	}
 
-	return record
+	return nil
 }
 
-// SelectQuery returns the SQL query to select all rows from the table. It must be called after Finalize.
-func (t *Table) SelectQuery() string {
+// InsertSQL returns the SQL and arguments Save would use to insert r. RewriteSQL is applied. r must be a record of t.
+// Nothing is sent to the database and validations and callbacks are not run. It must be called after Finalize.
+func (t *Table) InsertSQL(r *Record) (string, []any) {
 	if !t.finalized {
 		panic("cannot call until table finalized")
 	}
 
-	return t.selectQuery
+	sql, args := r.insert(t.returningClause, nil)
+	return t.rewriteSQL("insert", sql), args
 }
 
-// FindByPK finds a record by primary key. It must be called after Finalize.
-func (t *Table) FindByPK(ctx context.Context, db DB, pk ...any) (*Record, error) {
+// UpdateSQL returns the SQL and arguments Save would use to update r with its changed attributes. RewriteSQL is
+// applied. r must be a persisted record of t. The SQL is empty if Save would not update r because no column or only
+// immutable columns changed. Nothing is sent to the database and validations, callbacks, and StrictImmutableColumns
+// are not run. It must be called after Finalize.
+func (t *Table) UpdateSQL(r *Record) (string, []any) {
 	if !t.finalized {
 		panic("cannot call until table finalized")
 	}
 
-	rows, _ := db.Query(ctx, t.selectByPKQuery, pk...)
-	record, err := pgx.CollectOneRow(rows, t.RowToRecord)
-	if err != nil {
-		return nil, fmt.Errorf("pgxrecord.Table (%s): FindByPK (%v): %w", t.quotedQualifiedName, pk, err)
+	if _, hasUpdate, _ := r.updateColumns(); !hasUpdate {
+		return "", nil
 	}
 
-	return record, nil
+	sql, args := r.update(t.returningClause)
+	return t.rewriteSQL("update", sql), args
 }
 
-// RowToRecord is a pgx.RowToFunc that returns a *Record. It must be called after Finalize.
-func (t *Table) RowToRecord(row pgx.CollectableRow) (*Record, error) {
+// DeleteSQL returns the SQL and arguments Delete would use to delete r. RewriteSQL is applied. r must be a persisted
+// record of t. Nothing is sent to the database and callbacks are not run. It must be called after Finalize.
+func (t *Table) DeleteSQL(r *Record) (string, []any) {
 	if !t.finalized {
 		panic("cannot call until table finalized")
 	}
 
-	record := t.NewRecord()
-
-	ptrsToAttributes := make([]any, len(record.attributes))
-	for i := range record.attributes {
-		ptrsToAttributes[i] = &record.attributes[i]
-	}
+	sql, args := r.delete()
+	return t.rewriteSQL("delete", sql), args
+}
 
-	err := row.Scan(ptrsToAttributes...)
-	if err != nil {
-		return nil, fmt.Errorf("pgxrecord.Table (%s): RowToRecord: %w", t.quotedQualifiedName, err)
+// rewriteSQL returns sql rewritten by RewriteSQL for op if it is set.
+func (t *Table) rewriteSQL(op string, sql string) string {
+	if t.RewriteSQL != nil {
+		return t.RewriteSQL(op, sql)
 	}
+	return sql
+}
 
-	record.originalAttributes = make([]any, len(record.attributes))
-	copy(record.originalAttributes, record.attributes)
+func (r *Record) delete() (string, []any) {
+	return r.table.deleteQuery, r.pkAndVersionArgs()
+}
 
-	return record, nil
+func (r *Record) softDelete() (string, []any) {
+	return r.table.softDeleteQuery, r.pkAndVersionArgs()
 }
 
-// Set sets a attribute to a value.
-func (r *Record) Set(attribute string, value any) error {
-	idx, ok := r.table.nameToColumnIndex[attribute]
-	if !ok {
-		return fmt.Errorf("pgxrecord.Record (%s): Set: attribute %q is not found", r.table.quotedQualifiedName, attribute)
+// pkAndVersionArgs returns the primary key values the record was read with followed by the version if the table has a
+// version column. These are the arguments for the table's delete queries.
+func (r *Record) pkAndVersionArgs() []any {
+	args := r.pkArgs(len(r.table.pkIndexes) + 1)
+	if versionIndex := r.table.versionIndex; versionIndex >= 0 {
+		args = append(args, r.originalAttributes[versionIndex])
 	}
 
-	r.attributes[idx] = value
-	r.assigned[idx] = true
-
-	return nil
+	return args
 }
 
-// MustSet sets a attribute to a value. It panics on failure.
-func (r *Record) MustSet(attribute string, value any) {
-	err := r.Set(attribute, value)
-	if err != nil {
-		panic(err.Error())
+// pkArgs returns a slice with the capacity for at least n arguments containing the primary key values the record was
+// read with. These are the arguments for the table's primary key where clause.
+func (r *Record) pkArgs(n int) []any {
+	args := make([]any, 0, n)
+	for _, pkIdx := range r.table.pkIndexes {
+		args = append(args, r.originalAttributes[pkIdx])
 	}
+
+	return args
 }
 
-// Get returns the value of attribute.
-func (r *Record) Get(attribute string) (any, error) {
-	idx, ok := r.table.nameToColumnIndex[attribute]
-	if !ok {
-		return nil, fmt.Errorf("pgxrecord.Record (%s): Get: attribute %q is not found", r.table.quotedQualifiedName, attribute)
+// writeVersionCondition writes the optimistic locking condition to b if the table has a version column. It returns args
+// with the version value the record was read with appended.
+func (r *Record) writeVersionCondition(b *strings.Builder, args []any) []any {
+	versionIndex := r.table.versionIndex
+	if versionIndex < 0 {
+		return args
 	}
 
-	return r.attributes[idx], nil
+	c := r.table.Columns[versionIndex]
+	args = append(args, r.originalAttributes[versionIndex])
+	b.WriteString(" and ")
+	b.WriteString(c.quotedName)
+	b.WriteString(" = ")
+	r.table.writeParameter(b, c, len(args))
+
+	return args
 }
 
-// MustGet returns the value of attribute. It panics on failure.
-func (r *Record) MustGet(attribute string) any {
-	value, err := r.Get(attribute)
+// queryRowIntoAttributes executes sql with args on db and scans the returned row into the record's attributes. On
+// success the record is considered persisted with no assigned attributes.
+func (r *Record) queryRowIntoAttributes(ctx context.Context, db DB, op string, sql string, args []any) error {
+	// The row is scanned into a separate slice so the attributes are unchanged if the query fails.
+	values := make([]any, len(r.attributes))
+	scanTargets := make([]any, len(r.attributes))
+	r.table.setScanTargets(scanTargets, values)
+
+	commandTag, err := queryRow(ctx, r.table.db(db, op), sql, args, scanTargets)
 	if err != nil {
-		panic(err.Error())
+		return err
 	}
-	return value
+	r.table.convertScanned(values)
+	copy(r.attributes, values)
+	r.unloaded = nil
+	r.markPersisted()
+	if op != "select" {
+		r.lastCommandTag = commandTag
+	}
+
+	return nil
 }
 
-// SetAttributes sets attributes.
-func (r *Record) SetAttributes(attributes map[string]any) error {
-	for k, v := range attributes {
-		idx, ok := r.table.nameToColumnIndex[k]
-		if !ok {
-			return fmt.Errorf("pgxrecord.Record (%s): Set: attribute %q is not found", r.table.quotedQualifiedName, k)
-		}
+// isLoaded returns true if the attribute at idx was read from the database or has been set.
+func (r *Record) isLoaded(idx int) bool {
+	return r.unloaded == nil || !r.unloaded[idx] || r.assigned[idx]
+}
 
-		r.attributes[idx] = v
-		r.assigned[idx] = true
+// markPersisted records the current attributes as the persisted state of the record with no assigned attributes.
+func (r *Record) markPersisted() {
+	if r.unloaded != nil {
+		for i := range r.assigned {
+			if r.assigned[i] {
+				r.unloaded[i] = false
+			}
+		}
 	}
 
-	return nil
+	r.originalAttributes = make([]any, len(r.attributes))
+	copy(r.originalAttributes, r.attributes)
+	for i := range r.assigned {
+		r.assigned[i] = false
+	}
+	r.systemColumns = nil
 }
 
-// Attributes returns all attributes.
-func (r *Record) Attributes() map[string]any {
-	m := make(map[string]any, len(r.attributes))
-	for i := range r.table.Columns {
-		m[r.table.Columns[i].Name] = r.attributes[i]
+func (r *Record) insert(returningClause string, omitted []bool) (string, []any) {
+	b := &strings.Builder{}
+	args := r.writeInsert(b, omitted)
+	if returningClause != "" {
+		b.WriteByte(' ')
+		b.WriteString(returningClause)
 	}
 
-	return m
+	return b.String(), args
 }
 
-// Save saves the record using db.
-func (r *Record) Save(ctx context.Context, db DB) error {
-	var sql string
-	var args []any
+func (r *Record) upsert(target ConflictTarget) (string, []any, error) {
+	if (len(target.Columns) == 0) == (target.Constraint == "") {
+		return "", nil, fmt.Errorf("conflict target must have exactly one of columns or constraint")
+	}
 
-	if r.originalAttributes == nil {
-		sql, args = r.insert(ctx, db)
-	} else {
-		sql, args = r.update(ctx, db)
+	b := &strings.Builder{}
+	args := r.writeInsert(b, nil)
+
+	b.WriteString(" on conflict ")
+	conflictIndexes, err := r.table.writeConflictTarget(b, target)
+	if err != nil {
+		return "", nil, err
 	}
 
-	ptrsToAttributes := make([]any, len(r.attributes))
-	for i := range r.attributes {
-		ptrsToAttributes[i] = &r.attributes[i]
+	b.WriteString(" do update set ")
+	setCount := 0
+	for i, c := range r.table.Columns {
+		if i == r.table.createdAtIndex && !r.assigned[i] {
+			continue
+		}
+		if _, ok := conflictIndexes[i]; !(r.assigned[i] || r.insertsNow(i)) || c.PrimaryKey || ok || r.table.isImmutable(i) {
+			continue
+		}
+		if setCount > 0 {
+			b.WriteString(", ")
+		}
+		setCount++
+		b.WriteString(c.quotedName)
+		b.WriteString(" = excluded.")
+		b.WriteString(c.quotedName)
 	}
 
-	err := queryRow(ctx, db, sql, args, ptrsToAttributes)
-	if err != nil {
-		return fmt.Errorf("pgxrecord.Record (%s): Save: %w", r.table.quotedQualifiedName, err)
+	// do update must set at least one column for the returning clause to return the existing row. Setting the conflict
+	// columns to their own values is a no-op.
+	if setCount == 0 {
+		if len(target.Columns) == 0 {
+			return "", nil, fmt.Errorf("no columns to update")
+		}
+		for i, name := range target.Columns {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			quotedName := r.table.quoteIdentifier(name)
+			b.WriteString(quotedName)
+			b.WriteString(" = excluded.")
+			b.WriteString(quotedName)
+		}
 	}
 
-	r.originalAttributes = make([]any, len(r.attributes))
-	copy(r.originalAttributes, r.attributes)
-	for i := range r.assigned {
-		r.assigned[i] = false
+	if target.UpdateWhere != "" {
+		b.WriteString(" where ")
+		b.WriteString(target.UpdateWhere)
 	}
 
-	return nil
+	b.WriteByte(' ')
+	b.WriteString(r.table.returningClause)
+
+	return b.String(), args, nil
 }
 
-func (r *Record) insert(ctx context.Context, db DB) (string, []any) {
-	b := &strings.Builder{}
+// writeConflictTarget writes target to b and returns the indexes of its columns. It writes nothing for an empty target.
+func (t *Table) writeConflictTarget(b *strings.Builder, target ConflictTarget) (map[int]struct{}, error) {
+	if target.Where != "" && len(target.Columns) == 0 {
+		return nil, fmt.Errorf("conflict target where requires columns")
+	}
+
+	conflictIndexes := make(map[int]struct{}, len(target.Columns))
+	for _, name := range target.Columns {
+		idx, ok := t.nameToColumnIndex[name]
+		if !ok {
+			return nil, fmt.Errorf("conflict target column %q is not found", name)
+		}
+		conflictIndexes[idx] = struct{}{}
+	}
+
+	if target.Constraint != "" {
+		b.WriteString("on constraint ")
+		b.WriteString(t.quoteIdentifier(target.Constraint))
+	} else if len(target.Columns) > 0 {
+		b.WriteByte('(')
+		for i, name := range target.Columns {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(t.quoteIdentifier(name))
+		}
+		b.WriteByte(')')
+
+		// Unique indexes on soft deleted tables are usually partial indexes that ignore deleted rows. Such an index can only
+		// be inferred when the predicate is given. An index that is not partial still satisfies the predicate.
+		if t.softDeleteIndex >= 0 {
+			b.WriteString(" where ")
+			b.WriteString(t.Columns[t.softDeleteIndex].quotedName)
+			b.WriteString(" is null")
+			if target.Where != "" {
+				b.WriteString(" and (")
+				b.WriteString(target.Where)
+				b.WriteByte(')')
+			}
+		} else if target.Where != "" {
+			b.WriteString(" where ")
+			b.WriteString(target.Where)
+		}
+	}
+
+	return conflictIndexes, nil
+}
+
+// writeInsert writes an insert statement without a returning clause for the assigned attributes to b and returns the
+// arguments. Columns that are omitted are not inserted. omitted may be nil.
+func (r *Record) writeInsert(b *strings.Builder, omitted []bool) []any {
 	b.WriteString("insert into ")
 	b.WriteString(r.table.quotedQualifiedName)
-	b.WriteString(" (")
 
-	assignedCount := 0
+	// Columns that are not assigned are omitted so the database supplies their defaults.
+	columnCount := 0
 	for i := range r.assigned {
-		if r.assigned[i] {
-			if assignedCount > 0 {
+		if r.inserts(i, omitted) {
+			if columnCount == 0 {
+				b.WriteString(" (")
+			} else {
 				b.WriteString(", ")
 			}
-			assignedCount++
+			columnCount++
 			b.WriteString(r.table.Columns[i].quotedName)
 		}
 	}
 
+	if columnCount == 0 {
+		b.WriteString(" default values")
+		return nil
+	}
+
 	b.WriteString(") values (")
-	args := make([]any, assignedCount)
-	assignedCount = 0
+	args := make([]any, 0, columnCount)
+	columnCount = 0
 	for i := range r.assigned {
-		if r.assigned[i] {
-			if assignedCount > 0 {
+		if r.inserts(i, omitted) {
+			if columnCount > 0 {
 				b.WriteString(", ")
 			}
-			args[assignedCount] = r.attributes[i]
-			assignedCount++
-			b.WriteByte('$')
-			b.WriteString(strconv.FormatInt(int64(assignedCount), 10))
+			columnCount++
+			if r.assigned[i] {
+				args = append(args, r.attributes[i])
+				b.WriteByte('$')
+				b.WriteString(strconv.FormatInt(int64(len(args)), 10))
+			} else {
+				b.WriteString("now()")
+			}
 		}
 	}
 
-	b.WriteString(") ")
-	b.WriteString(r.table.returningClause)
+	b.WriteByte(')')
 
-	return b.String(), args
+	return args
+}
+
+// inserts returns true if the column at index i is written by an insert. omitted may be nil.
+func (r *Record) inserts(i int, omitted []bool) bool {
+	return !isOmitted(omitted, i) && (r.assigned[i] || r.insertsNow(i))
 }
 
-func (r *Record) update(ctx context.Context, db DB) (string, []any) {
+// isOmitted returns true if omitted is not nil and the column at index i is omitted.
+func isOmitted(omitted []bool, i int) bool {
+	return omitted != nil && omitted[i]
+}
+
+// insertsNow returns true if the column at index i is an automatic timestamp that will be set to now() on insert.
+func (r *Record) insertsNow(i int) bool {
+	return !r.assigned[i] && (i == r.table.createdAtIndex || i == r.table.updatedAtIndex)
+}
+
+func (r *Record) update(returningClause string) (string, []any) {
 	b := &strings.Builder{}
 	b.WriteString("update ")
 	b.WriteString(r.table.quotedQualifiedName)
 	b.WriteString(" set ")
 
-	args := make([]any, 0, len(r.attributes))
-	for _, pkIdx := range r.table.pkIndexes {
-		args = append(args, r.attributes[pkIdx])
-	}
+	args := r.pkArgs(len(r.attributes))
+	versionIndex := r.table.versionIndex
 
-	assignedCount := 0
-	for i := range r.assigned {
-		if r.assigned[i] {
-			if assignedCount > 0 {
+	changedCount := 0
+	for i := range r.attributes {
+		if r.changed(i) && i != versionIndex && !r.table.isImmutable(i) {
+			if changedCount > 0 {
 				b.WriteString(", ")
 			}
 			args = append(args, r.attributes[i])
-			assignedCount++
+			changedCount++
 			b.WriteString(r.table.Columns[i].quotedName)
 			b.WriteString(" = $")
 			b.WriteString(strconv.FormatInt(int64(len(args)), 10))
 		}
 	}
 
+	if versionIndex >= 0 {
+		c := r.table.Columns[versionIndex]
+		if changedCount > 0 {
+			b.WriteString(", ")
+		}
+		changedCount++
+		b.WriteString(c.quotedName)
+		b.WriteString(" = ")
+		b.WriteString(c.quotedName)
+		b.WriteString(" + 1")
+	}
+
+	if updatedAtIndex := r.table.updatedAtIndex; updatedAtIndex >= 0 && !r.changed(updatedAtIndex) {
+		if changedCount > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(r.table.Columns[updatedAtIndex].quotedName)
+		b.WriteString(" = now()")
+	}
+
 	b.WriteByte(' ')
 	b.WriteString(r.table.pkWhereClause)
+	args = r.writeVersionCondition(b, args)
 
-	b.WriteByte(' ')
-	b.WriteString(r.table.returningClause)
+	if returningClause != "" {
+		b.WriteByte(' ')
+		b.WriteString(returningClause)
+	}
 
 	return b.String(), args
 }
 
-// Select executes sql with args on db and returns the []T produced by scanFn.
+// Select executes sql with args on db and returns the []T produced by scanFn. args can be a single pgx.NamedArgs to
+// use named arguments such as @name in sql.
 func Select[T any](ctx context.Context, db DB, sql string, args []any, scanFn pgx.RowToFunc[T]) ([]T, error) {
+	err := checkNamedArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
 	rows, _ := db.Query(ctx, sql, args...)
-	collectedRows, err := pgx.CollectRows(rows, scanFn)
+	collectedRows, err := collectRows(ctx, rows, scanFn)
 	if err != nil {
 		return nil, err
 	}
@@ -451,22 +4666,45 @@ func Select[T any](ctx context.Context, db DB, sql string, args []any, scanFn pg
 
 // SelectRow executes sql with args on db and returns the T produced by scanFn. The query should return one row. If no
 // rows are found returns an error where errors.Is(pgx.ErrNoRows) is true. Returns an error if more than one row is
-// returned.
+// returned. args can be a single pgx.NamedArgs to use named arguments such as @name in sql.
 func SelectRow[T any](ctx context.Context, db DB, sql string, args []any, scanFn pgx.RowToFunc[T]) (T, error) {
+	err := checkNamedArgs(args)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
 	rows, _ := db.Query(ctx, sql, args...)
-	collectedRow, err := pgx.CollectOneRow(rows, scanFn)
+	collectedRow, err := collectOneRow(ctx, rows, scanFn)
 	if err != nil {
 		var zero T
 		return zero, err
 	}
 
 	if rows.CommandTag().RowsAffected() > 1 {
-		return collectedRow, errTooManyRows
+		return collectedRow, ErrMultipleRows
 	}
 
 	return collectedRow, nil
 }
 
+// SelectRows executes sql with args on db and returns the []T produced by scanFn for each row. It is the plural
+// counterpart of SelectRow. If no rows are found it returns an empty slice that is not nil. args can be a single
+// pgx.NamedArgs to use named arguments such as @name in sql.
+func SelectRows[T any](ctx context.Context, db DB, sql string, args []any, scanFn pgx.RowToFunc[T]) ([]T, error) {
+	err := checkNamedArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectRows(ctx, rows, scanFn)
+}
+
 // Insert inserts rows into tableName.
 func Insert(ctx context.Context, db DB, tableName pgx.Identifier, rows []map[string]any) (pgconn.CommandTag, error) {
 	if len(rows) == 0 {
@@ -474,7 +4712,8 @@ func Insert(ctx context.Context, db DB, tableName pgx.Identifier, rows []map[str
 	}
 
 	sql, args := insertSQL(tableName, rows, "")
-	return exec(ctx, db, sql, args)
+	ct, err := exec(ctx, db, sql, args)
+	return ct, wrapTableError("insert", tableName, err)
 }
 
 // InsertReturning inserts rows into tableName with returningClause and returns the []T produced by scanFn.
@@ -484,7 +4723,8 @@ func InsertReturning[T any](ctx context.Context, db DB, tableName pgx.Identifier
 	}
 
 	sql, args := insertSQL(tableName, rows, returningClause)
-	return Select(ctx, db, sql, args, scanFn)
+	results, err := Select(ctx, db, sql, args, scanFn)
+	return results, wrapTableError("insert", tableName, err)
 }
 
 // insertSQL builds an insert statement that inserts rows into tableName with returningClause. len(rows) must be > 0.
@@ -547,13 +4787,48 @@ func insertSQL(tableName pgx.Identifier, rows []map[string]any, returningClause
 func InsertRow(ctx context.Context, db DB, tableName pgx.Identifier, values map[string]any) error {
 	sql, args := insertRowSQL(tableName, values, "")
 	_, err := exec(ctx, db, sql, args)
-	return err
+	return wrapTableError("insert", tableName, err)
 }
 
 // InsertRowReturning inserts values into tableName with returningClause and returns the T produced by scanFn.
 func InsertRowReturning[T any](ctx context.Context, db DB, tableName pgx.Identifier, values map[string]any, returningClause string, scanFn pgx.RowToFunc[T]) (T, error) {
 	sql, args := insertRowSQL(tableName, values, returningClause)
-	return SelectRow(ctx, db, sql, args, scanFn)
+	result, err := SelectRow(ctx, db, sql, args, scanFn)
+	return result, wrapTableError("insert", tableName, err)
+}
+
+// wrapTableError wraps a non-nil err with op and tableName so the failed operation is identified. nil is returned
+// unchanged.
+func wrapTableError(op string, tableName pgx.Identifier, err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("pgxrecord: %s %s: %w", op, tableName.Sanitize(), err)
+}
+
+// quoteIdentifier returns s quoted as an identifier unless UnquotedIdentifiers is set.
+func (t *Table) quoteIdentifier(s string) string {
+	if t.UnquotedIdentifiers {
+		return s
+	}
+	return sanitizeIdentifier(s)
+}
+
+// quoteQualifiedName returns name quoted as a qualified name. The schema is omitted if OmitSchema is set.
+func (t *Table) quoteQualifiedName(name pgx.Identifier) string {
+	if t.OmitSchema {
+		name = name[len(name)-1:]
+	}
+	return t.quoteIdentifiers(name)
+}
+
+// quoteIdentifiers returns the parts of name quoted as identifiers and joined with dots unless UnquotedIdentifiers is
+// set.
+func (t *Table) quoteIdentifiers(name pgx.Identifier) string {
+	if t.UnquotedIdentifiers {
+		return strings.Join(name, ".")
+	}
+	return name.Sanitize()
 }
 
 func sanitizeIdentifier(s string) string {
@@ -616,7 +4891,7 @@ func ExecRow(ctx context.Context, db DB, sql string, args ...any) (pgconn.Comman
 	if rowsAffected == 0 {
 		return ct, pgx.ErrNoRows
 	} else if rowsAffected > 1 {
-		return ct, errTooManyRows
+		return ct, ErrMultipleRows
 	}
 
 	return ct, nil
@@ -626,14 +4901,16 @@ func ExecRow(ctx context.Context, db DB, sql string, args ...any) (pgconn.Comman
 // produced by scanFn.
 func Update(ctx context.Context, db DB, tableName pgx.Identifier, setValues, whereValues map[string]any) (pgconn.CommandTag, error) {
 	sql, args := updateSQL(tableName, setValues, whereValues, "")
-	return exec(ctx, db, sql, args)
+	ct, err := exec(ctx, db, sql, args)
+	return ct, wrapTableError("update", tableName, err)
 }
 
 // UpdateReturning updates rows matching whereValues in tableName with setValues. It includes returningClause and returns the []T
 // produced by scanFn.
 func UpdateReturning[T any](ctx context.Context, db DB, tableName pgx.Identifier, setValues, whereValues map[string]any, returningClause string, scanFn pgx.RowToFunc[T]) ([]T, error) {
 	sql, args := updateSQL(tableName, setValues, whereValues, returningClause)
-	return Select(ctx, db, sql, args, scanFn)
+	results, err := Select(ctx, db, sql, args, scanFn)
+	return results, wrapTableError("update", tableName, err)
 }
 
 // UpdateRow updates a row matching whereValues in tableName with setValues. Returns an error unless exactly one row is
@@ -641,14 +4918,15 @@ func UpdateReturning[T any](ctx context.Context, db DB, tableName pgx.Identifier
 func UpdateRow(ctx context.Context, db DB, tableName pgx.Identifier, setValues, whereValues map[string]any) error {
 	sql, args := updateSQL(tableName, setValues, whereValues, "")
 	_, err := ExecRow(ctx, db, sql, args...)
-	return err
+	return wrapTableError("update", tableName, err)
 }
 
 // UpdateRowReturning updates a row matching whereValues in tableName with setValues. It includes returningClause and returns the
 // T produced by scanFn. Returns an error unless exactly one row is updated.
 func UpdateRowReturning[T any](ctx context.Context, db DB, tableName pgx.Identifier, setValues, whereValues map[string]any, returningClause string, scanFn pgx.RowToFunc[T]) (T, error) {
 	sql, args := updateSQL(tableName, setValues, whereValues, returningClause)
-	return SelectRow(ctx, db, sql, args, scanFn)
+	result, err := SelectRow(ctx, db, sql, args, scanFn)
+	return result, wrapTableError("update", tableName, err)
 }
 
 func updateSQL(tableName pgx.Identifier, setValues, whereValues map[string]any, returningClause string) (sql string, args []any) {
@@ -710,36 +4988,118 @@ func updateSQL(tableName pgx.Identifier, setValues, whereValues map[string]any,
 	return b.String(), args
 }
 
+// checkNamedArgs returns an error if args mixes pgx.NamedArgs with other arguments. pgx only uses named arguments when
+// they are the first argument and would otherwise silently bind the remaining arguments positionally.
+func checkNamedArgs(args []any) error {
+	if len(args) < 2 {
+		return nil
+	}
+
+	for _, arg := range args {
+		if _, ok := arg.(pgx.NamedArgs); ok {
+			return fmt.Errorf("pgx.NamedArgs cannot be mixed with other arguments")
+		}
+	}
+
+	return nil
+}
+
+// collectRows is like pgx.CollectRows but it stops with ctx.Err() as soon as ctx is done. pgx only checks ctx when it
+// reads from the connection so rows that have already been received would otherwise still be iterated.
+func collectRows[T any](ctx context.Context, rows pgx.Rows, fn pgx.RowToFunc[T]) ([]T, error) {
+	defer rows.Close()
+
+	slice := []T{}
+	for rows.Next() {
+		err := ctx.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := fn(rows)
+		if err != nil {
+			return nil, err
+		}
+		slice = append(slice, value)
+	}
+
+	err := rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return slice, nil
+}
+
+// collectOneRow is like pgx.CollectOneRow but it returns ctx.Err() if ctx is done before the row is read. See
+// collectRows.
+func collectOneRow[T any](ctx context.Context, rows pgx.Rows, fn pgx.RowToFunc[T]) (T, error) {
+	defer rows.Close()
+
+	var value T
+	if !rows.Next() {
+		err := rows.Err()
+		if err != nil {
+			return value, err
+		}
+		return value, pgx.ErrNoRows
+	}
+
+	err := ctx.Err()
+	if err != nil {
+		return value, err
+	}
+
+	value, err = fn(rows)
+	if err != nil {
+		return value, err
+	}
+
+	rows.Close()
+	return value, rows.Err()
+}
+
 // queryRow builds QueryRow-like functionality on top of DB. This allows pgxrecord to have the convenience of QueryRow
-// without needing it as part of the DB interface.
-func queryRow(ctx context.Context, db DB, sql string, args []any, scanTargets []any) error {
+// without needing it as part of the DB interface. It also returns the command tag of the query.
+func queryRow(ctx context.Context, db DB, sql string, args []any, scanTargets []any) (pgconn.CommandTag, error) {
 	rows, err := db.Query(ctx, sql, args...)
 	if err != nil {
-		return err
+		return pgconn.CommandTag{}, err
 	}
 	defer rows.Close()
 
-	if rows.Next() {
-		rows.Scan(scanTargets...)
-	} else {
-		return pgx.ErrNoRows
+	if !rows.Next() {
+		err = rows.Err()
+		if err != nil {
+			return pgconn.CommandTag{}, err
+		}
+		return rows.CommandTag(), pgx.ErrNoRows
+	}
+
+	err = rows.Scan(scanTargets...)
+	if err != nil {
+		return pgconn.CommandTag{}, err
 	}
 
 	if rows.Next() {
-		return errTooManyRows
+		return pgconn.CommandTag{}, ErrMultipleRows
 	}
 
 	err = rows.Err()
 	if err != nil {
-		return err
+		return pgconn.CommandTag{}, err
 	}
 
-	return nil
+	return rows.CommandTag(), nil
 }
 
 // exec builds Exec-like functionality on top of DB. This allows pgxrecord to have the convenience of Exec with needing
-// it as part of the DB interface.
+// it as part of the DB interface. If db implements Execer its Exec is used directly.
 func exec(ctx context.Context, db DB, sql string, args []any) (pgconn.CommandTag, error) {
+	if execer, ok := db.(Execer); ok {
+		return execer.Exec(ctx, sql, args...)
+	}
+
 	rows, err := db.Query(ctx, sql, args...)
 	if err != nil {
 		return pgconn.CommandTag{}, err
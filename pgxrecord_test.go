@@ -1,12 +1,25 @@
 package pgxrecord_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/url"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jackc/pgx/v5/pgxtest"
 	"github.com/jackc/pgxrecord"
 	"github.com/stretchr/testify/assert"
@@ -18,12 +31,62 @@ var defaultConnTestRunner pgxtest.ConnTestRunner
 func init() {
 	defaultConnTestRunner = pgxtest.DefaultConnTestRunner()
 	defaultConnTestRunner.CreateConfig = func(ctx context.Context, t testing.TB) *pgx.ConnConfig {
-		config, err := pgx.ParseConfig(os.Getenv("PGXRECORD_TEST_DATABASE"))
+		config, err := pgx.ParseConfig(testDatabaseConnString(t))
 		require.NoError(t, err)
 		return config
 	}
 }
 
+// testDatabaseConnString returns the connection string of the test database. It skips the test in short mode so the
+// tests that do not need a database can be run with go test -short.
+func testDatabaseConnString(t testing.TB) string {
+	if testing.Short() {
+		t.Skip("skipping test that requires a database in short mode")
+	}
+	return os.Getenv("PGXRECORD_TEST_DATABASE")
+}
+
+var errRecordingDB = errors.New("recordingDB does not execute queries")
+
+// recordingDB is a pgxrecord.DB and pgxrecord.CopyFromer that records the SQL and copy table names it is asked to
+// execute and then fails.
+type recordingDB struct {
+	sqls       []string
+	args       [][]any
+	copyTables []pgx.Identifier
+}
+
+func (db *recordingDB) Query(ctx context.Context, sql string, optionsAndArgs ...any) (pgx.Rows, error) {
+	db.sqls = append(db.sqls, sql)
+	db.args = append(db.args, optionsAndArgs)
+	return nil, errRecordingDB
+}
+
+func (db *recordingDB) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
+	db.copyTables = append(db.copyTables, tableName)
+	return 0, errRecordingDB
+}
+
+// *pgx.Conn, pgx.Tx, and *pgxpool.Pool must implement every database interface.
+var (
+	_ pgxrecord.DB         = (*pgx.Conn)(nil)
+	_ pgxrecord.DB         = (pgx.Tx)(nil)
+	_ pgxrecord.DB         = (*pgxpool.Pool)(nil)
+	_ pgxrecord.Execer     = (*pgx.Conn)(nil)
+	_ pgxrecord.Execer     = (pgx.Tx)(nil)
+	_ pgxrecord.Execer     = (*pgxpool.Pool)(nil)
+	_ pgxrecord.Beginner   = (*pgx.Conn)(nil)
+	_ pgxrecord.Beginner   = (pgx.Tx)(nil)
+	_ pgxrecord.Beginner   = (*pgxpool.Pool)(nil)
+	_ pgxrecord.BatchDB    = (*pgx.Conn)(nil)
+	_ pgxrecord.BatchDB    = (pgx.Tx)(nil)
+	_ pgxrecord.BatchDB    = (*pgxpool.Pool)(nil)
+	_ pgxrecord.CopyFromer = (*pgx.Conn)(nil)
+	_ pgxrecord.CopyFromer = (pgx.Tx)(nil)
+	_ pgxrecord.CopyFromer = (*pgxpool.Pool)(nil)
+	_ pgxrecord.CopyToer   = (*pgx.Conn)(nil)
+)
+
 func TestTableLoadAllColumns(t *testing.T) {
 	t.Parallel()
 
@@ -44,20 +107,123 @@ func TestTableLoadAllColumns(t *testing.T) {
 
 		require.Len(t, table.Columns, 3)
 		expectedColumns := []pgxrecord.Column{
-			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
-			{Name: "name", OID: pgtype.TextOID, NotNull: true, PrimaryKey: false},
-			{Name: "age", OID: pgtype.Int4OID, NotNull: false, PrimaryKey: false},
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true, TypeName: "integer"},
+			{Name: "name", OID: pgtype.TextOID, NotNull: true, PrimaryKey: false, TypeName: "text"},
+			{Name: "age", OID: pgtype.Int4OID, NotNull: false, PrimaryKey: false, TypeName: "integer"},
 		}
 		for i := range expectedColumns {
 			assert.Equalf(t, expectedColumns[i].Name, table.Columns[i].Name, "Column %d name", i+1)
 			assert.Equalf(t, expectedColumns[i].OID, table.Columns[i].OID, "Column %d OID", i+1)
 			assert.Equalf(t, expectedColumns[i].NotNull, table.Columns[i].NotNull, "Column %d not null", i+1)
 			assert.Equalf(t, expectedColumns[i].PrimaryKey, table.Columns[i].PrimaryKey, "Column %d primary key", i+1)
+			assert.Equalf(t, expectedColumns[i].TypeName, table.Columns[i].TypeName, "Column %d type name", i+1)
 		}
 	})
 }
 
-func TestTableSelectQuery(t *testing.T) {
+func TestTableLoadAllColumnsLengthPrecisionScale(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key,
+	code varchar(10),
+	country char(2),
+	name text,
+	price numeric(10, 2),
+	amount numeric
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+
+		type lengthPrecisionScale struct{ maxLength, precision, scale int }
+		actual := make(map[string]lengthPrecisionScale, len(table.Columns))
+		for _, c := range table.Columns {
+			actual[c.Name] = lengthPrecisionScale{c.MaxLength, c.Precision, c.Scale}
+		}
+		require.Equal(t, map[string]lengthPrecisionScale{
+			"id":      {},
+			"code":    {maxLength: 10},
+			"country": {maxLength: 2},
+			"name":    {},
+			"price":   {precision: 10, scale: 2},
+			"amount":  {},
+		}, actual)
+	})
+}
+
+func TestTableLoadAllColumnsOrder(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		// Names that do not sort in DDL order, a dropped column, and a column added after the drop.
+		_, err := conn.Exec(ctx, `create temporary table t (
+	zeta int primary key,
+	alpha text,
+	mike text,
+	bravo int,
+	yankee date,
+	charlie bool,
+	xray text,
+	delta numeric,
+	whiskey text,
+	echo text,
+	victor int,
+	foxtrot text
+);
+alter table t drop column mike;
+alter table t add column golf text;`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		names := make([]string, len(table.Columns))
+		for i, c := range table.Columns {
+			names[i] = c.Name
+		}
+		require.Equal(t, []string{"zeta", "alpha", "bravo", "yankee", "charlie", "xray", "delta", "whiskey", "echo", "victor", "foxtrot", "golf"}, names)
+		require.Equal(t,
+			`select "t"."zeta", "t"."alpha", "t"."bravo", "t"."yankee", "t"."charlie", "t"."xray", "t"."delta", "t"."whiskey", "t"."echo", "t"."victor", "t"."foxtrot", "t"."golf" from "t"`,
+			table.SelectQuery(),
+		)
+	})
+}
+
+func TestTableLoadAllColumnsComments(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null
+);
+comment on table t is 'People';
+comment on column t.name is 'Full name';`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+
+		require.Equal(t, "People", table.Comment)
+		require.Equal(t, "", table.Columns[0].Comment)
+		require.Equal(t, "Full name", table.Columns[1].Comment)
+	})
+}
+
+func TestTableLoadAllColumnsView(t *testing.T) {
 	t.Parallel()
 
 	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
@@ -65,6 +231,111 @@ func TestTableSelectQuery(t *testing.T) {
 	id int primary key generated by default as identity,
 	name text not null,
 	age int
+);
+insert into t (name, age) values ('John', 42), ('Jane', 17);
+create temporary view adults as select id, name from t where age >= 18;`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, "table", table.RelationKind)
+
+		view := &pgxrecord.Table{
+			Name: pgx.Identifier{"adults"},
+		}
+		err = view.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		view.Finalize()
+
+		require.Equal(t, "view", view.RelationKind)
+		require.Len(t, view.Columns, 2)
+		require.False(t, view.Columns[0].PrimaryKey)
+		require.Equal(t, `select "adults"."id", "adults"."name" from "adults"`, view.SelectQuery())
+
+		records, err := view.FindAll(ctx, conn, nil)
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+		require.Equal(t, map[string]any{"id": int32(1), "name": "John"}, records[0].Attributes())
+
+		err = records[0].Delete(ctx, conn)
+		require.ErrorContains(t, err, `"adults" is a view and is not writable`)
+
+		record := view.NewRecord()
+		record.MustSet("name", "Bill")
+		err = record.Save(ctx, conn)
+		require.ErrorContains(t, err, `"adults" is a view and is not writable`)
+	})
+}
+
+func TestTableMaterializedViewNotWritable(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"mv"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID},
+			{Name: "name", OID: pgtype.TextOID},
+		},
+		RelationKind: "materialized view",
+	}
+	table.Finalize()
+
+	db := &recordingDB{}
+	record := table.NewRecord()
+	record.MustSet("name", "John")
+	err := record.Save(context.Background(), db)
+	require.EqualError(t, err, `pgxrecord.Record ("mv"): Save: "mv" is a materialized view and is not writable`)
+
+	err = table.SaveBatch(context.Background(), nil, []*pgxrecord.Record{record})
+	require.ErrorContains(t, err, "is not writable")
+
+	_, err = table.Query().All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+	require.Equal(t, []string{`select "mv"."id", "mv"."name" from "mv"`}, db.sqls)
+}
+
+func TestTableLoadAllColumnsAutoIncrement(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id serial primary key,
+	code int generated always as identity,
+	name text not null,
+	position int not null default 0
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		require.True(t, table.Columns[0].AutoIncrement)
+		require.True(t, table.Columns[1].AutoIncrement)
+		require.False(t, table.Columns[2].AutoIncrement)
+		require.False(t, table.Columns[3].AutoIncrement)
+
+		record := table.NewRecord()
+		record.MustSet("name", "John")
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(1), "code": int32(1), "name": "John", "position": int32(0)}, record.Attributes())
+	})
+}
+
+func TestTableReload(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null
 )`)
 		require.NoError(t, err)
 
@@ -74,12 +345,277 @@ func TestTableSelectQuery(t *testing.T) {
 		err = table.LoadAllColumns(ctx, conn)
 		require.NoError(t, err)
 		table.Finalize()
+		require.Equal(t, `select "t"."id", "t"."name" from "t"`, table.SelectQuery())
 
+		_, err = conn.Exec(ctx, `alter table t add column age int`)
+		require.NoError(t, err)
+
+		err = table.Reload(ctx, conn)
+		require.NoError(t, err)
 		require.Equal(t, `select "t"."id", "t"."name", "t"."age" from "t"`, table.SelectQuery())
+
+		record := table.NewRecord()
+		record.SetAttributes(map[string]any{"name": "John", "age": 42})
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+
+		record, err = table.FindByPK(ctx, conn, record.MustGet("id"))
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(1), "name": "John", "age": int32(42)}, record.Attributes())
 	})
 }
 
-func TestTableNewRecord(t *testing.T) {
+func TestTableLoadAllColumnsCached(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		name := pgx.Identifier{"pgxrecord_cached"}
+		defer pgxrecord.InvalidateTableCache(name)
+
+		_, err := conn.Exec(ctx, `create temporary table pgxrecord_cached (
+	id int primary key generated by default as identity,
+	name text not null
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{Name: name}
+		err = table.LoadAllColumnsCached(ctx, conn)
+		require.NoError(t, err)
+		require.Len(t, table.Columns, 2)
+		table.Finalize()
+
+		_, err = conn.Exec(ctx, `alter table pgxrecord_cached add column age int`)
+		require.NoError(t, err)
+
+		table = &pgxrecord.Table{Name: name}
+		err = table.LoadAllColumnsCached(ctx, conn)
+		require.NoError(t, err)
+		require.Len(t, table.Columns, 2)
+		require.Equal(t, "id", table.Columns[0].Name)
+		require.Equal(t, "name", table.Columns[1].Name)
+
+		pgxrecord.InvalidateTableCache(name)
+
+		table = &pgxrecord.Table{Name: name}
+		err = table.LoadAllColumnsCached(ctx, conn)
+		require.NoError(t, err)
+		require.Len(t, table.Columns, 3)
+		require.Equal(t, "age", table.Columns[2].Name)
+	})
+}
+
+func TestTableLoadAllColumnsCachedCopiesEnumLabels(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		name := pgx.Identifier{"pgxrecord_cached_enum"}
+		defer pgxrecord.InvalidateTableCache(name)
+
+		_, err := conn.Exec(ctx, `create type pgxrecord_cached_mood as enum ('sad', 'happy');
+create temporary table pgxrecord_cached_enum (
+	id int primary key,
+	mood pgxrecord_cached_mood
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{Name: name}
+		err = table.LoadAllColumnsCached(ctx, conn)
+		require.NoError(t, err)
+		table.Columns[1].EnumLabels[0] = "changed"
+
+		table = &pgxrecord.Table{Name: name}
+		err = table.LoadAllColumnsCached(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, []string{"sad", "happy"}, table.Columns[1].EnumLabels)
+		table.Columns[1].EnumLabels[0] = "changed"
+
+		table = &pgxrecord.Table{Name: name}
+		err = table.LoadAllColumnsCached(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, []string{"sad", "happy"}, table.Columns[1].EnumLabels)
+	})
+}
+
+func TestTableLoadForeignKeys(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table accounts (
+	id int primary key
+);
+create temporary table products (
+	account_id int,
+	code text,
+	primary key (account_id, code)
+);
+create temporary table t (
+	id int primary key generated by default as identity,
+	account_id int not null references accounts,
+	product_account_id int,
+	product_code text,
+	constraint t_product_fkey foreign key (product_code, product_account_id) references products (code, account_id)
+)`)
+		require.NoError(t, err)
+
+		var schemaName string
+		err = conn.QueryRow(ctx, "select nspname from pg_namespace where oid = pg_my_temp_schema()").Scan(&schemaName)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadForeignKeys(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, []pgxrecord.ForeignKey{
+			{
+				Name:              "t_account_id_fkey",
+				Columns:           []string{"account_id"},
+				ReferencedTable:   pgx.Identifier{schemaName, "accounts"},
+				ReferencedColumns: []string{"id"},
+			},
+			{
+				Name:              "t_product_fkey",
+				Columns:           []string{"product_code", "product_account_id"},
+				ReferencedTable:   pgx.Identifier{schemaName, "products"},
+				ReferencedColumns: []string{"code", "account_id"},
+			},
+		}, table.ForeignKeys)
+	})
+}
+
+func TestTableLoadCheckConstraints(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int check (age >= 0),
+	min_price int,
+	max_price int,
+	constraint t_price_range check (min_price <= max_price)
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadCheckConstraints(ctx, conn)
+		require.NoError(t, err)
+
+		require.Equal(t, []pgxrecord.CheckConstraint{
+			{Name: "t_age_check", Expression: "age >= 0", Columns: []string{"age"}},
+			{Name: "t_price_range", Expression: "min_price <= max_price", Columns: []string{"min_price", "max_price"}},
+		}, table.CheckConstraints)
+	})
+}
+
+func TestTableLoadUniqueConstraints(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	account_id int not null,
+	email text not null,
+	code text,
+	deleted_at timestamptz,
+	constraint t_account_id_code_key unique (account_id, code)
+);
+create unique index t_email_idx on t (lower(email)) where deleted_at is null;`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadUniqueConstraints(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, []pgxrecord.UniqueConstraint{
+			{
+				Name:    "t_account_id_code_key",
+				Columns: []string{"account_id", "code"},
+			},
+			{
+				Name:      "t_email_idx",
+				Columns:   []string{"lower(email)"},
+				Partial:   true,
+				Predicate: "deleted_at IS NULL",
+			},
+			{
+				Name:       "t_pkey",
+				Columns:    []string{"id"},
+				PrimaryKey: true,
+			},
+		}, table.UniqueConstraints)
+
+		uc, ok := table.UniqueConstraintByName("t_account_id_code_key")
+		require.True(t, ok)
+		require.Equal(t, []string{"account_id", "code"}, uc.Columns)
+
+		_, ok = table.UniqueConstraintByName("missing")
+		require.False(t, ok)
+	})
+}
+
+func TestTableLoadSchema(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table accounts (
+	id int primary key
+);
+create temporary table t (
+	id int primary key generated by default as identity,
+	account_id int not null references accounts,
+	email text not null unique,
+	age int check (age >= 0)
+);
+comment on table t is 'People';
+comment on column t.email is 'Login';`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadSchema(ctx, conn)
+		require.NoError(t, err)
+		require.Len(t, table.Columns, 4)
+		require.True(t, table.Columns[0].PrimaryKey)
+		require.Equal(t, "Login", table.Columns[2].Comment)
+		require.Equal(t, "People", table.Comment)
+		require.Equal(t, "table", table.RelationKind)
+		require.Len(t, table.ForeignKeys, 1)
+		require.Equal(t, []string{"account_id"}, table.ForeignKeys[0].Columns)
+		require.Len(t, table.UniqueConstraints, 2)
+		require.Len(t, table.CheckConstraints, 1)
+		require.Equal(t, []string{"age"}, table.CheckConstraints[0].Columns)
+
+		record := table.NewRecord()
+		record.SetAttributes(map[string]any{"account_id": int32(1), "email": "a@example.com"})
+		require.True(t, record.IsDirty())
+
+		table = &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadSchema(ctx, conn, pgxrecord.SkipComments(), pgxrecord.SkipForeignKeys(), pgxrecord.SkipUniqueConstraints(), pgxrecord.SkipCheckConstraints())
+		require.NoError(t, err)
+		require.Len(t, table.Columns, 4)
+		require.Equal(t, "", table.Columns[2].Comment)
+		require.Equal(t, "", table.Comment)
+		require.Nil(t, table.ForeignKeys)
+		require.Nil(t, table.UniqueConstraints)
+		require.Nil(t, table.CheckConstraints)
+
+		table = &pgxrecord.Table{
+			Name: pgx.Identifier{"missing"},
+		}
+		err = table.LoadSchema(ctx, conn)
+		require.ErrorContains(t, err, "failed to find table")
+		require.Panics(t, func() { table.NewRecord() })
+	})
+}
+
+func TestTableEnsureColumns(t *testing.T) {
 	t.Parallel()
 
 	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
@@ -93,33 +629,6433 @@ func TestTableNewRecord(t *testing.T) {
 		table := &pgxrecord.Table{
 			Name: pgx.Identifier{"t"},
 		}
-		err = table.LoadAllColumns(ctx, conn)
+
+		err = table.EnsureColumns(ctx, conn, []pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true},
+			{Name: "name", OID: pgtype.TextOID, NotNull: true},
+			{Name: "age", OID: pgtype.Int4OID},
+		})
 		require.NoError(t, err)
-		table.Finalize()
 
-		record := table.NewRecord()
-		require.Equal(t, map[string]any{"id": nil, "name": nil, "age": nil}, record.Attributes())
+		err = table.EnsureColumns(ctx, conn, []pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true},
+			{Name: "name", OID: pgtype.VarcharOID, NotNull: true},
+			{Name: "email", OID: pgtype.TextOID, NotNull: true},
+		})
+		var mismatchErr *pgxrecord.ColumnMismatchError
+		require.ErrorAs(t, err, &mismatchErr)
+		require.Equal(t, []string{"email"}, mismatchErr.Missing)
+		require.Equal(t, []string{"age"}, mismatchErr.Extra)
+		require.Equal(t, []string{"name expected OID 1043 but was 25 (text)"}, mismatchErr.Mismatched)
+	})
+}
+
+func TestTableSelectQuery(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		require.Equal(t, `select "t"."id", "t"."name", "t"."age" from "t"`, table.SelectQuery())
+	})
+}
+
+func TestTableNotFinalized(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+		},
+	}
+
+	ctx := context.Background()
+	db := &recordingDB{}
+	const msg = "cannot call until table finalized"
+	require.PanicsWithValue(t, msg, func() { table.SelectQuery() })
+	require.PanicsWithValue(t, msg, func() { table.NewRecord() })
+	require.PanicsWithValue(t, msg, func() { table.Query() })
+	require.PanicsWithValue(t, msg, func() { table.FindByPK(ctx, db, 1) })
+	require.PanicsWithValue(t, msg, func() { table.FindAll(ctx, db, nil) })
+	require.PanicsWithValue(t, msg, func() { table.Count(ctx, db, nil) })
+	require.PanicsWithValue(t, msg, func() { table.Pluck(ctx, db, "id", nil) })
+	require.PanicsWithValue(t, msg, func() { table.DeleteAll(ctx, db, nil) })
+	require.Empty(t, db.sqls)
+
+	require.PanicsWithValue(t, "cannot finalize table without a name", func() {
+		(&pgxrecord.Table{Columns: table.Columns}).Finalize()
+	})
+	require.PanicsWithValue(t, `cannot finalize table "t" without columns`, func() {
+		(&pgxrecord.Table{Name: pgx.Identifier{"t"}}).Finalize()
+	})
+}
+
+func TestTableFinalizeTwice(t *testing.T) {
+	t.Parallel()
+
+	newTable := func() *pgxrecord.Table {
+		return &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+			Columns: []*pgxrecord.Column{
+				{Name: "tenant_id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+				{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+				{Name: "name", OID: pgtype.TextOID},
+				{Name: "deleted_at", OID: pgtype.TimestamptzOID},
+			},
+			SoftDeleteColumn: "deleted_at",
+		}
+	}
+
+	once := newTable()
+	once.Finalize()
+
+	twice := newTable()
+	twice.Finalize()
+	twice.Finalize()
+
+	require.Equal(t, once.SelectQuery(), twice.SelectQuery())
+	require.Equal(t, once.PrimaryKeyColumns(), twice.PrimaryKeyColumns())
+	require.Len(t, twice.PrimaryKeyColumns(), 2)
+	for _, c := range once.Columns {
+		onceColumn, _ := once.ColumnByName(c.Name)
+		twiceColumn, ok := twice.ColumnByName(c.Name)
+		require.True(t, ok)
+		require.Equal(t, onceColumn, twiceColumn)
+	}
+	require.Equal(t, pgxrecord.Private_selectByPKQuery(once), pgxrecord.Private_selectByPKQuery(twice))
+
+	onceDelete, onceSoftDelete := pgxrecord.Private_deleteQueries(once)
+	twiceDelete, twiceSoftDelete := pgxrecord.Private_deleteQueries(twice)
+	require.Equal(t, onceDelete, twiceDelete)
+	require.Equal(t, onceSoftDelete, twiceSoftDelete)
+
+	twice.SoftDeleteColumn = ""
+	twice.Finalize()
+	require.Contains(t, once.SelectQuery(), `"deleted_at" is null`)
+	require.NotContains(t, twice.SelectQuery(), `"deleted_at" is null`)
+}
+
+func TestTableValidate(t *testing.T) {
+	t.Parallel()
+
+	newTable := func() *pgxrecord.Table {
+		return &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+			Columns: []*pgxrecord.Column{
+				{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+				{Name: "lock_version", OID: pgtype.Int4OID, NotNull: true},
+				{Name: "created_at", OID: pgtype.TimestamptzOID},
+				{Name: "deleted_at", OID: pgtype.TimestamptzOID},
+			},
+			VersionColumn:    "lock_version",
+			Timestamps:       true,
+			SoftDeleteColumn: "deleted_at",
+			ImmutableColumns: []string{"created_at"},
+		}
+	}
+
+	table := newTable()
+	require.NoError(t, table.Validate())
+	table.Finalize()
+	require.NoError(t, table.Validate())
+
+	for _, tt := range []struct {
+		modify func(table *pgxrecord.Table)
+		err    string
+	}{
+		{func(table *pgxrecord.Table) { table.Columns = nil }, "table has no columns"},
+		{func(table *pgxrecord.Table) { table.Columns[1].Name = "id" }, `column "id" is defined more than once`},
+		{func(table *pgxrecord.Table) { table.Columns[0].PrimaryKey = false }, "table has no primary key"},
+		{func(table *pgxrecord.Table) { table.Columns[0].NotNull = false }, `primary key column "id" must be not null`},
+		{func(table *pgxrecord.Table) { table.VersionColumn = "version" }, `version column "version" is not found`},
+		{func(table *pgxrecord.Table) { table.VersionColumn = "created_at" }, `version column "created_at" must be an integer`},
+		{func(table *pgxrecord.Table) { table.SoftDeleteColumn = "removed_at" }, `soft delete column "removed_at" is not found`},
+		{func(table *pgxrecord.Table) { table.CreatedAtColumn = "inserted_at" }, `created at column "inserted_at" is not found`},
+		{func(table *pgxrecord.Table) { table.UpdatedAtColumn = "modified_at" }, `updated at column "modified_at" is not found`},
+		{func(table *pgxrecord.Table) { table.ImmutableColumns = []string{"created_by"} }, `immutable column "created_by" is not found`},
+	} {
+		table := newTable()
+		tt.modify(table)
+		require.EqualError(t, table.Validate(), `pgxrecord.Table ("t"): Validate: `+tt.err)
+	}
+
+	view := newTable()
+	view.RelationKind = "view"
+	view.Columns[0].PrimaryKey = false
+	require.NoError(t, view.Validate())
+}
+
+func TestTableCastParameters(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "created_at", OID: pgtype.TimestamptzOID, NotNull: true, PrimaryKey: true, TypeName: "timestamp with time zone"},
+			{Name: "name", OID: pgtype.TextOID, NotNull: true, TypeName: "character varying(100)"},
+		},
+		CastParameters: true,
+	}
+	table.Finalize()
+
+	require.Equal(t,
+		`select "t"."created_at", "t"."name" from "t" where "created_at" = $1::timestamp with time zone`,
+		pgxrecord.Private_selectByPKQuery(table),
+	)
+
+	table.Columns[0].TypeName = "timestamp without time zone"
+	table.Finalize()
+	require.Equal(t,
+		`select "t"."created_at", "t"."name" from "t" where "created_at" = $1::timestamp without time zone`,
+		pgxrecord.Private_selectByPKQuery(table),
+	)
+}
+
+func TestTableDeleteQueries(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "version", OID: pgtype.Int4OID, NotNull: true},
+			{Name: "updated_at", OID: pgtype.TimestamptzOID},
+			{Name: "deleted_at", OID: pgtype.TimestamptzOID},
+		},
+		VersionColumn:    "version",
+		Timestamps:       true,
+		SoftDeleteColumn: "deleted_at",
+	}
+	table.Finalize()
+
+	deleteQuery, softDeleteQuery := pgxrecord.Private_deleteQueries(table)
+	require.Equal(t, `delete from "t" where "id" = $1 and "version" = $2`, deleteQuery)
+	require.Equal(t,
+		`update "t" set "deleted_at" = now(), "updated_at" = now(), "version" = "version" + 1 where "id" = $1 and "version" = $2 returning "id", "version", "updated_at", "deleted_at"`,
+		softDeleteQuery,
+	)
+}
+
+func TestTableSpecialIdentifiers(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"My Schema", `weird"name`},
+		Columns: []*pgxrecord.Column{
+			{Name: "select", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "Mixed Case", OID: pgtype.TextOID},
+			{Name: `quote"col`, OID: pgtype.TextOID},
+		},
+	}
+	table.Finalize()
+
+	db := &recordingDB{}
+	record := table.NewRecord()
+	record.MustSet("select", int32(1))
+	record.MustSet("Mixed Case", "a")
+	record.MustSet(`quote"col`, "b")
+	err := record.Save(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+
+	err = record.Upsert(context.Background(), db, pgxrecord.ConflictTarget{Constraint: `weird"name_pkey`})
+	require.ErrorIs(t, err, errRecordingDB)
+
+	_, err = table.Query().Where(map[string]any{`quote"col`: "b"}).OrderBy("Mixed Case", pgxrecord.Asc).All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+
+	require.Equal(t, []string{
+		`insert into "My Schema"."weird""name" ("select", "Mixed Case", "quote""col") values ($1, $2, $3) returning "select", "Mixed Case", "quote""col"`,
+		`insert into "My Schema"."weird""name" ("select", "Mixed Case", "quote""col") values ($1, $2, $3) on conflict on constraint "weird""name_pkey" do update set "Mixed Case" = excluded."Mixed Case", "quote""col" = excluded."quote""col" returning "select", "Mixed Case", "quote""col"`,
+		`select "weird""name"."select", "weird""name"."Mixed Case", "weird""name"."quote""col" from "My Schema"."weird""name" where "weird""name"."quote""col" = $1 order by "weird""name"."Mixed Case" asc`,
+	}, db.sqls)
+
+	require.Equal(t, `select "weird""name"."select", "weird""name"."Mixed Case", "weird""name"."quote""col" from "My Schema"."weird""name" where "select" = $1`, pgxrecord.Private_selectByPKQuery(table))
+	deleteQuery, _ := pgxrecord.Private_deleteQueries(table)
+	require.Equal(t, `delete from "My Schema"."weird""name" where "select" = $1`, deleteQuery)
+}
+
+func TestRecordSpecialIdentifiers(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table "weird""name" (
+	"select" int primary key generated by default as identity,
+	"Mixed Case" text not null,
+	"quote""col" text
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{`weird"name`},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		record := table.NewRecord()
+		record.MustSet("Mixed Case", "a")
+		record.MustSet(`quote"col`, "b")
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+
+		record.MustSet(`quote"col`, "c")
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+
+		record, err = table.FindByPK(ctx, conn, record.MustGet("select"))
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"select": int32(1), "Mixed Case": "a", `quote"col`: "c"}, record.Attributes())
+
+		records, err := table.Query().Where(map[string]any{"Mixed Case": "a"}).OrderBy(`quote"col`, pgxrecord.Desc).All(ctx, conn)
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+
+		err = record.Delete(ctx, conn)
+		require.NoError(t, err)
+	})
+}
+
+func TestTableRewriteSQL(t *testing.T) {
+	t.Parallel()
+
+	var ops []string
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true, HasDefault: true},
+			{Name: "name", OID: pgtype.TextOID, NotNull: true},
+		},
+		RewriteSQL: func(op string, sql string) string {
+			ops = append(ops, op)
+			return "/*+ SeqScan(t) */ " + sql
+		},
+	}
+	table.Finalize()
+
+	db := &recordingDB{}
+	record := table.NewRecord()
+	record.MustSet("name", "John")
+	err := record.Save(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+
+	var records []*pgxrecord.Record
+	err = table.FindAllInto(context.Background(), db, &records, map[string]any{"name": "John"})
+	require.ErrorIs(t, err, errRecordingDB)
+
+	require.Equal(t, []string{"insert", "select"}, ops)
+	require.Equal(t, []string{
+		`/*+ SeqScan(t) */ insert into "t" ("name") values ($1) returning "id", "name"`,
+		`/*+ SeqScan(t) */ select "t"."id", "t"."name" from "t" where "t"."name" = $1`,
+	}, db.sqls)
+}
+
+func TestTableQueryTracer(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null
+);`)
+		require.NoError(t, err)
+
+		type trace struct {
+			op   string
+			sql  string
+			args []any
+			err  error
+		}
+		var traces []trace
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+			QueryTracer: func(ctx context.Context, op string, sql string, args []any, elapsed time.Duration, err error) {
+				require.Greater(t, elapsed, time.Duration(0))
+				traces = append(traces, trace{op: op, sql: sql, args: args, err: err})
+			},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		record := table.NewRecord()
+		record.MustSet("name", "John")
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+
+		_, err = table.FindAll(ctx, conn, map[string]any{"name": "Jane"})
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err = table.FindAll(ctx, conn, map[string]any{"name": "Jane"})
+		require.Error(t, err)
+
+		require.Len(t, traces, 3)
+		require.Equal(t, trace{op: "insert", sql: `insert into "t" ("name") values ($1) returning "id", "name"`, args: []any{"John"}}, traces[0])
+		require.Equal(t, trace{op: "select", sql: `select "t"."id", "t"."name" from "t" where "t"."name" = $1`, args: []any{"Jane"}}, traces[1])
+		require.Equal(t, "select", traces[2].op)
+		require.ErrorIs(t, traces[2].err, context.Canceled)
+	})
+}
+
+func TestTableQueryTracerRowsExhausted(t *testing.T) {
+	t.Parallel()
+
+	var errs []error
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+		},
+		QueryTracer: func(ctx context.Context, op string, sql string, args []any, elapsed time.Duration, err error) {
+			errs = append(errs, err)
+		},
+	}
+	table.Finalize()
+
+	rowsErr := errors.New("rows failed")
+	db := pgxrecord.Private_tableDB(table, &failingRowsDB{err: rowsErr}, "select")
+	rows, err := db.Query(context.Background(), `select 1`)
+	require.NoError(t, err)
+	for rows.Next() {
+	}
+	require.Equal(t, []error{rowsErr}, errs)
+
+	rows.Close()
+	require.Len(t, errs, 1)
+}
+
+func TestTableColumnByName(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "a", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "name", OID: pgtype.TextOID},
+			{Name: "b", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+		},
+	}
+	table.Finalize()
+
+	c, ok := table.ColumnByName("name")
+	require.True(t, ok)
+	require.Same(t, table.Columns[1], c)
+
+	_, ok = table.ColumnByName("missing")
+	require.False(t, ok)
+
+	require.Equal(t, []*pgxrecord.Column{table.Columns[0], table.Columns[2]}, table.PrimaryKeyColumns())
+}
+
+func TestTableWithSchema(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"public", "t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true, HasDefault: true},
+			{Name: "name", OID: pgtype.TextOID, NotNull: true},
+		},
+	}
+	table.Finalize()
+
+	tenant := table.WithSchema("tenant_42")
+	require.Equal(t, pgx.Identifier{"tenant_42", "t"}, tenant.Name)
+	require.Equal(t, pgx.Identifier{"public", "t"}, table.Name)
+
+	db := &recordingDB{}
+	record := tenant.NewRecord()
+	record.MustSet("name", "John")
+	err := record.Save(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+
+	_, err = tenant.Query().Where(map[string]any{"name": "John"}).All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+
+	_, err = table.Query().Where(map[string]any{"name": "John"}).All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+
+	require.Equal(t, []string{
+		`insert into "tenant_42"."t" ("name") values ($1) returning "id", "name"`,
+		`select "t"."id", "t"."name" from "tenant_42"."t" where "t"."name" = $1`,
+		`select "t"."id", "t"."name" from "public"."t" where "t"."name" = $1`,
+	}, db.sqls)
+
+	deleteQuery, _ := pgxrecord.Private_deleteQueries(tenant)
+	require.Equal(t, `delete from "tenant_42"."t" where "id" = $1`, deleteQuery)
+}
+
+func TestTableAcquireWait(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	config, err := pgxpool.ParseConfig(testDatabaseConnString(t))
+	require.NoError(t, err)
+	config.MaxConns = 1
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	var ops []string
+	var waits []time.Duration
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"pg_catalog", "pg_namespace"},
+		Columns: []*pgxrecord.Column{
+			{Name: "oid", OID: pgtype.OIDOID, NotNull: true, PrimaryKey: true},
+			{Name: "nspname", OID: pgtype.NameOID, NotNull: true},
+		},
+		AcquireWait: func(ctx context.Context, op string, wait time.Duration) {
+			ops = append(ops, op)
+			waits = append(waits, wait)
+		},
+	}
+	table.Finalize()
+
+	conn, err := pool.Acquire(ctx)
+	require.NoError(t, err)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		conn.Release()
+	}()
+
+	records, err := table.FindAll(ctx, pool, map[string]any{"nspname": "pg_catalog"})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+
+	require.Equal(t, []string{"select"}, ops)
+	require.GreaterOrEqual(t, waits[0], 40*time.Millisecond)
+
+	// The connection must have been released back to the pool.
+	conn, err = pool.Acquire(ctx)
+	require.NoError(t, err)
+	conn.Release()
+}
+
+func TestTableCreateTableSQL(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int generated by default as identity,
+	code varchar(10),
+	name text not null,
+	price numeric(10, 2),
+	primary key (id, code)
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		copyTable := &pgxrecord.Table{
+			Name:    pgx.Identifier{"pg_temp", "t_copy"},
+			Columns: make([]*pgxrecord.Column, len(table.Columns)),
+		}
+		for i, c := range table.Columns {
+			copyTable.Columns[i] = &pgxrecord.Column{Name: c.Name, OID: c.OID, NotNull: c.NotNull, PrimaryKey: c.PrimaryKey, TypeName: c.TypeName}
+		}
+		copyTable.Finalize()
+
+		sql := copyTable.CreateTableSQL()
+		require.Equal(t, `create table "pg_temp"."t_copy" (
+	"id" integer not null,
+	"code" character varying(10) not null,
+	"name" text not null,
+	"price" numeric(10,2),
+	primary key ("id", "code")
+)`, sql)
+
+		_, err = conn.Exec(ctx, sql)
+		require.NoError(t, err)
+
+		reloadedTable := &pgxrecord.Table{
+			Name: pgx.Identifier{"t_copy"},
+		}
+		err = reloadedTable.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+
+		require.Len(t, reloadedTable.Columns, len(table.Columns))
+		for i := range table.Columns {
+			assert.Equalf(t, table.Columns[i].Name, reloadedTable.Columns[i].Name, "Column %d name", i+1)
+			assert.Equalf(t, table.Columns[i].OID, reloadedTable.Columns[i].OID, "Column %d OID", i+1)
+			assert.Equalf(t, table.Columns[i].NotNull, reloadedTable.Columns[i].NotNull, "Column %d not null", i+1)
+			assert.Equalf(t, table.Columns[i].PrimaryKey, reloadedTable.Columns[i].PrimaryKey, "Column %d primary key", i+1)
+			assert.Equalf(t, table.Columns[i].TypeName, reloadedTable.Columns[i].TypeName, "Column %d type name", i+1)
+		}
+	})
+}
+
+func TestTableNewRecord(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		record := table.NewRecord()
+		require.Equal(t, map[string]any{"id": nil, "name": nil, "age": nil}, record.Attributes())
+
+		record.SetAttributes(map[string]any{"name": "John", "age": 42})
+		require.Equal(t, map[string]any{"id": nil, "name": "John", "age": 42}, record.Attributes())
+	})
+}
+
+func TestTableFindByPK(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int
+)`)
+		require.NoError(t, err)
+
+		var id int32
+		err = conn.QueryRow(ctx, `insert into t (name, age) values ('John', 42) returning id`).Scan(&id)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		record, err := table.FindByPK(ctx, conn, id)
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(1), "name": "John", "age": int32(42)}, record.Attributes())
+	})
+}
+
+type celsius int32
+
+func TestTableRegisterType(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	temperature int4
+);
+insert into t (temperature) values (20), (null);`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.RegisterType(pgtype.Int4OID, func() any { return new(celsius) })
+		table.Finalize()
+
+		record, err := table.FindByPK(ctx, conn, 1)
+		require.NoError(t, err)
+		require.Equal(t, celsius(1), record.MustGet("id"))
+		require.Equal(t, celsius(20), record.MustGet("temperature"))
+
+		record, err = table.FindByPK(ctx, conn, 2)
+		require.NoError(t, err)
+		require.Nil(t, record.MustGet("temperature"))
+
+		record.MustSet("temperature", celsius(25))
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, celsius(25), record.MustGet("temperature"))
+
+		maps, err := table.Query().OrderBy("id", pgxrecord.Asc).AllMaps(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, []map[string]any{
+			{"id": celsius(1), "temperature": celsius(20)},
+			{"id": celsius(2), "temperature": celsius(25)},
+		}, maps)
+	})
+}
+
+func TestTableRegisterTypeRequiresPointer(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{Name: pgx.Identifier{"t"}}
+	require.PanicsWithValue(t, "newValue must return a pointer", func() {
+		table.RegisterType(pgtype.Int4OID, func() any { return celsius(0) })
+	})
+}
+
+func TestTableFindByPKNonIntegerPrimaryKey(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table uuid_pk (
+	id uuid primary key,
+	name text not null
+);
+insert into uuid_pk (id, name) values ('b7e2e6a4-3a5c-4d8e-9f10-2a3b4c5d6e7f', 'John');
+
+create temporary table text_pk (
+	code text primary key,
+	name text not null
+);
+insert into text_pk (code, name) values ('us', 'United States');`)
+		require.NoError(t, err)
+
+		uuidTable := &pgxrecord.Table{
+			Name: pgx.Identifier{"uuid_pk"},
+		}
+		err = uuidTable.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		uuidTable.Finalize()
+
+		record, err := uuidTable.FindByPK(ctx, conn, "b7e2e6a4-3a5c-4d8e-9f10-2a3b4c5d6e7f")
+		require.NoError(t, err)
+		require.Equal(t, [16]byte{0xb7, 0xe2, 0xe6, 0xa4, 0x3a, 0x5c, 0x4d, 0x8e, 0x9f, 0x10, 0x2a, 0x3b, 0x4c, 0x5d, 0x6e, 0x7f}, record.MustGet("id"))
+		require.Equal(t, "John", record.MustGet("name"))
+
+		record, err = uuidTable.FindByPK(ctx, conn, record.MustGet("id"))
+		require.NoError(t, err)
+		require.Equal(t, "John", record.MustGet("name"))
+
+		_, err = uuidTable.FindByPK(ctx, conn, "00000000-0000-0000-0000-000000000000")
+		require.ErrorIs(t, err, pgx.ErrNoRows)
+
+		textTable := &pgxrecord.Table{
+			Name: pgx.Identifier{"text_pk"},
+		}
+		err = textTable.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		textTable.Finalize()
+
+		record, err = textTable.FindByPK(ctx, conn, "us")
+		require.NoError(t, err)
+		require.Equal(t, "United States", record.MustGet("name"))
+
+		_, err = textTable.FindByPK(ctx, conn, "ca")
+		require.ErrorIs(t, err, pgx.ErrNoRows)
+	})
+}
+
+func TestTableFindByPKArgumentCount(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "code", OID: pgtype.TextOID, NotNull: true, PrimaryKey: true},
+			{Name: "name", OID: pgtype.TextOID, NotNull: true},
+		},
+	}
+	table.Finalize()
+
+	db := &recordingDB{}
+	_, err := table.FindByPK(context.Background(), db)
+	require.ErrorContains(t, err, "expected 1 primary key values but got 0")
+	_, err = table.FindByPK(context.Background(), db, "us", "ca")
+	require.ErrorContains(t, err, "expected 1 primary key values but got 2")
+	require.Empty(t, db.sqls)
+}
+
+func TestTableFindByPKs(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null
+);
+insert into t (name) values ('John'), ('Jane'), ('Bob');`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		records, err := table.FindByPKs(ctx, conn, 3, 1, 42)
+		require.NoError(t, err)
+		require.Len(t, records, 2)
+		require.Equal(t, map[string]any{"id": int32(1), "name": "John"}, records[0].Attributes())
+		require.Equal(t, map[string]any{"id": int32(3), "name": "Bob"}, records[1].Attributes())
+
+		records, err = table.FindByPKs(ctx, conn)
+		require.NoError(t, err)
+		require.Empty(t, records)
+	})
+}
+
+func TestTableFindByPKsSQL(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true, TypeName: "integer"},
+			{Name: "name", OID: pgtype.TextOID, NotNull: true, TypeName: "text"},
+		},
+		CastParameters: true,
+	}
+	table.Finalize()
+
+	db := &recordingDB{}
+	_, err := table.FindByPKs(context.Background(), db, 1, 2)
+	require.ErrorIs(t, err, errRecordingDB)
+	require.Equal(t, []string{`select "t"."id", "t"."name" from "t" where "t"."id" = any($1::integer[]) order by "t"."id"`}, db.sqls)
+
+	composite := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "a", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "b", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+		},
+	}
+	composite.Finalize()
+
+	_, err = composite.FindByPKs(context.Background(), db, 1)
+	require.ErrorContains(t, err, "table must have a single column primary key")
+}
+
+func TestTableFindByPKMapSQL(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"order_lines"},
+		Columns: []*pgxrecord.Column{
+			{Name: "order_id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "line_no", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "quantity", OID: pgtype.Int4OID, NotNull: true},
+		},
+	}
+	table.Finalize()
+
+	db := &recordingDB{}
+	_, err := table.FindByPK(context.Background(), db, 7, 3)
+	require.ErrorIs(t, err, errRecordingDB)
+
+	_, err = table.FindByPKMap(context.Background(), db, map[string]any{"line_no": 3, "order_id": 7})
+	require.ErrorIs(t, err, errRecordingDB)
+
+	require.Len(t, db.sqls, 2)
+	require.Equal(t, db.sqls[0], db.sqls[1])
+	require.Equal(t, db.args[0], db.args[1])
+	require.Equal(t, []any{7, 3}, db.args[1])
+
+	_, err = table.FindByPKMap(context.Background(), db, map[string]any{"order_id": 7})
+	require.ErrorContains(t, err, `primary key column "line_no" is missing`)
+
+	_, err = table.FindByPKMap(context.Background(), db, map[string]any{"order_id": 7, "line_no": 3, "quantity": 1})
+	require.ErrorContains(t, err, `"quantity" is not a primary key column`)
+
+	require.Len(t, db.sqls, 2)
+}
+
+func TestTableFirstOrCreate(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	email text not null unique,
+	name text not null
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		record, created, err := table.FirstOrCreate(ctx, conn, map[string]any{"email": "john@example.com"}, map[string]any{"name": "John"})
+		require.NoError(t, err)
+		require.True(t, created)
+		require.Equal(t, map[string]any{"id": int32(1), "email": "john@example.com", "name": "John"}, record.Attributes())
+
+		record, created, err = table.FirstOrCreate(ctx, conn, map[string]any{"email": "john@example.com"}, map[string]any{"name": "Johnny"})
+		require.NoError(t, err)
+		require.False(t, created)
+		require.Equal(t, map[string]any{"id": int32(1), "email": "john@example.com", "name": "John"}, record.Attributes())
+
+		// The find does not match but the insert conflicts. In a transaction the savepoint lets it continue.
+		tx, err := conn.Begin(ctx)
+		require.NoError(t, err)
+		defer tx.Rollback(ctx)
+
+		_, _, err = table.FirstOrCreate(ctx, tx, map[string]any{"email": "john@example.com", "name": "Jane"}, nil)
+		require.True(t, pgxrecord.IsUniqueViolation(err, "t_email_key"))
+
+		record, created, err = table.FirstOrCreate(ctx, tx, map[string]any{"email": "jane@example.com"}, map[string]any{"name": "Jane"})
+		require.NoError(t, err)
+		require.True(t, created)
+		require.Equal(t, "Jane", record.MustGet("name"))
+	})
+}
+
+func TestTableFindOrInitialize(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	email text not null unique,
+	name text
+);
+insert into t (email, name) values ('john@example.com', 'John');`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		record, found, err := table.FindOrInitialize(ctx, conn, map[string]any{"email": "john@example.com"})
+		require.NoError(t, err)
+		require.True(t, found)
+		require.Equal(t, map[string]any{"id": int32(1), "email": "john@example.com", "name": "John"}, record.Attributes())
+
+		record, found, err = table.FindOrInitialize(ctx, conn, map[string]any{"email": "jane@example.com"})
+		require.NoError(t, err)
+		require.False(t, found)
+		require.Equal(t, "jane@example.com", record.MustGet("email"))
+
+		n, err := table.Count(ctx, conn, nil)
+		require.NoError(t, err)
+		require.EqualValues(t, 1, n)
+
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, int32(2), record.MustGet("id"))
+	})
+}
+
+func TestTableDeleteByPKs(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null
+);
+insert into t (name) values ('John'), ('Jane'), ('Bob');`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		n, err := table.DeleteByPKs(ctx, conn)
+		require.NoError(t, err)
+		require.EqualValues(t, 0, n)
+
+		n, err = table.DeleteByPKs(ctx, conn, 1, 3, 42)
+		require.NoError(t, err)
+		require.EqualValues(t, 2, n)
+
+		names, err := pgxrecord.PluckInto[string](ctx, conn, table, "name", nil)
+		require.NoError(t, err)
+		require.Equal(t, []string{"Jane"}, names)
+	})
+}
+
+func TestTableDeleteByPKsSQL(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "deleted_at", OID: pgtype.TimestamptzOID},
+		},
+		SoftDeleteColumn: "deleted_at",
+	}
+	table.Finalize()
+
+	db := &recordingDB{}
+	_, err := table.DeleteByPKs(context.Background(), db, 1, 2)
+	require.ErrorIs(t, err, errRecordingDB)
+	require.Equal(t, []string{`update "t" set "deleted_at" = now() where "t"."id" = any($1) and "t"."deleted_at" is null`}, db.sqls)
+}
+
+func TestTableUpdateAllAndDeleteAll(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int
+);
+insert into t (name, age) values ('John', 40), ('Jane', 40), ('Bob', 50);`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		_, err = table.UpdateAll(ctx, conn, map[string]any{"age": 41}, nil)
+		require.Error(t, err)
+
+		_, err = table.UpdateAll(ctx, conn, map[string]any{"missing": 41}, map[string]any{"age": 40})
+		require.Error(t, err)
+
+		var ct pgconn.CommandTag
+		n, err := table.UpdateAll(ctx, conn, map[string]any{"age": 41}, map[string]any{"age": 40}, pgxrecord.StoreCommandTag(&ct))
+		require.NoError(t, err)
+		require.EqualValues(t, 2, n)
+		require.True(t, ct.Update())
+		require.EqualValues(t, 2, ct.RowsAffected())
+
+		n, err = table.UpdateAll(ctx, conn, map[string]any{"name": "Alice"}, nil, pgxrecord.Everything())
+		require.NoError(t, err)
+		require.EqualValues(t, 3, n)
+
+		_, err = table.DeleteAll(ctx, conn, nil)
+		require.Error(t, err)
+
+		n, err = table.DeleteAll(ctx, conn, map[string]any{"age": 41}, pgxrecord.StoreCommandTag(&ct))
+		require.NoError(t, err)
+		require.EqualValues(t, 2, n)
+		require.True(t, ct.Delete())
+
+		ages, err := pgxrecord.PluckInto[int32](ctx, conn, table, "age", nil)
+		require.NoError(t, err)
+		require.Equal(t, []int32{50}, ages)
+
+		n, err = table.DeleteAll(ctx, conn, nil, pgxrecord.Everything())
+		require.NoError(t, err)
+		require.EqualValues(t, 1, n)
+	})
+}
+
+func TestTableUpdateAllAndDeleteAllSQL(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "name", OID: pgtype.TextOID},
+			{Name: "deleted_at", OID: pgtype.TimestamptzOID},
+		},
+		SoftDeleteColumn: "deleted_at",
+	}
+	table.Finalize()
+
+	db := &recordingDB{}
+	_, err := table.UpdateAll(context.Background(), db, map[string]any{"name": "Bob"}, map[string]any{"name": "John"})
+	require.ErrorIs(t, err, errRecordingDB)
+	_, err = table.DeleteAll(context.Background(), db, map[string]any{"name": "John"})
+	require.ErrorIs(t, err, errRecordingDB)
+	require.Equal(t, []string{
+		`update "t" set "name" = $1 where "t"."deleted_at" is null and "t"."name" = $2`,
+		`update "t" set "deleted_at" = now() where "t"."deleted_at" is null and "t"."name" = $1`,
+	}, db.sqls)
+}
+
+func TestTableAssociations(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table orders (
+	id int primary key generated by default as identity,
+	name text not null
+);
+create temporary table items (
+	id int primary key generated by default as identity,
+	order_id bigint references orders,
+	name text not null
+);
+insert into orders (name) values ('a'), ('b'), ('c');
+insert into items (order_id, name) values (1, 'x'), (2, 'y'), (1, 'z'), (null, 'w');`)
+		require.NoError(t, err)
+
+		orders := &pgxrecord.Table{Name: pgx.Identifier{"orders"}}
+		err = orders.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		items := &pgxrecord.Table{Name: pgx.Identifier{"items"}}
+		err = items.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+
+		orders.HasMany("items", items, "order_id")
+		items.BelongsTo("order", orders, "order_id")
+		orders.Finalize()
+		items.Finalize()
+
+		allOrders, err := orders.FindAll(ctx, conn, nil)
+		require.NoError(t, err)
+		require.Len(t, allOrders, 3)
+
+		err = orders.LoadAssociation(ctx, conn, allOrders, "items")
+		require.NoError(t, err)
+
+		itemNames := func(records []*pgxrecord.Record) []string {
+			names := []string{}
+			for _, r := range records {
+				names = append(names, r.MustGet("name").(string))
+			}
+			return names
+		}
+		require.Equal(t, []string{"x", "z"}, itemNames(allOrders[0].Associated("items")))
+		require.Equal(t, []string{"y"}, itemNames(allOrders[1].Associated("items")))
+		require.Equal(t, []string{}, itemNames(allOrders[2].Associated("items")))
+
+		item, err := items.FindByPK(ctx, conn, 2)
+		require.NoError(t, err)
+		require.Nil(t, item.Associated("order"))
+		err = item.Load(ctx, conn, "order")
+		require.NoError(t, err)
+		require.Equal(t, []string{"b"}, itemNames(item.Associated("order")))
+
+		item, err = items.FindByPK(ctx, conn, 4)
+		require.NoError(t, err)
+		err = item.Load(ctx, conn, "order")
+		require.NoError(t, err)
+		require.Empty(t, item.Associated("order"))
+
+		err = item.Load(ctx, conn, "missing")
+		require.Error(t, err)
+	})
+}
+
+func TestTableLoadAssociationSQL(t *testing.T) {
+	t.Parallel()
+
+	items := &pgxrecord.Table{
+		Name: pgx.Identifier{"items"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "order_id", OID: pgtype.Int4OID},
+		},
+	}
+	orders := &pgxrecord.Table{
+		Name: pgx.Identifier{"orders"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+		},
+	}
+	orders.HasMany("items", items, "order_id")
+	items.Finalize()
+	orders.Finalize()
+
+	order := orders.NewRecord()
+	order.MustSet("id", int32(1))
+
+	db := &recordingDB{}
+	err := orders.LoadAssociation(context.Background(), db, []*pgxrecord.Record{order}, "items")
+	require.ErrorIs(t, err, errRecordingDB)
+	require.Equal(t, []string{`select "items"."id", "items"."order_id" from "items" where "items"."order_id" = any($1) order by "items"."id"`}, db.sqls)
+}
+
+func TestTableInsertReturning(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int default 18
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		john := table.NewRecord()
+		john.MustSet("name", "John")
+		jane := table.NewRecord()
+		jane.MustSet("name", "Jane")
+		jane.MustSet("age", 40)
+
+		err = table.InsertReturning(ctx, conn, []*pgxrecord.Record{john, jane})
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(1), "name": "John", "age": int32(18)}, john.Attributes())
+		require.Equal(t, map[string]any{"id": int32(2), "name": "Jane", "age": int32(40)}, jane.Attributes())
+		require.False(t, john.IsDirty())
+
+		err = table.InsertReturning(ctx, conn, []*pgxrecord.Record{john})
+		require.ErrorContains(t, err, "record 0 is already persisted")
+
+		// Enough records to exceed the parameter limit of a single statement.
+		records := make([]*pgxrecord.Record, 40000)
+		for i := range records {
+			records[i] = table.NewRecord()
+			records[i].MustSet("name", "Bob")
+			records[i].MustSet("age", i)
+		}
+		err = table.InsertReturning(ctx, conn, records)
+		require.NoError(t, err)
+		require.Equal(t, int32(3), records[0].MustGet("id"))
+		require.Equal(t, int32(40002), records[39999].MustGet("id"))
+		require.Equal(t, int32(39999), records[39999].MustGet("age"))
+	})
+}
+
+func TestTableInsertReturningSQL(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true, HasDefault: true},
+			{Name: "name", OID: pgtype.TextOID},
+			{Name: "age", OID: pgtype.Int4OID},
+		},
+	}
+	table.Finalize()
+
+	john := table.NewRecord()
+	john.MustSet("name", "John")
+	jane := table.NewRecord()
+	jane.MustSet("name", "Jane")
+	jane.MustSet("age", 40)
+
+	db := &recordingDB{}
+	err := table.InsertReturning(context.Background(), db, []*pgxrecord.Record{john, jane})
+	require.ErrorIs(t, err, errRecordingDB)
+	require.Equal(t, []string{`insert into "t" ("name", "age") values ($1, default), ($2, $3) returning "id", "name", "age"`}, db.sqls)
+	require.Equal(t, [][]any{{"John", "Jane", 40}}, db.args)
+}
+
+func TestTableInsertMany(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		records := make([]*pgxrecord.Record, 3)
+		for i := range records {
+			records[i] = table.NewRecord()
+			records[i].SetAttributes(map[string]any{"name": "John", "age": 40 + i})
+		}
+
+		n, err := table.InsertMany(ctx, conn, records)
+		require.NoError(t, err)
+		require.EqualValues(t, 3, n)
+
+		record, err := table.FindByPK(ctx, conn, 3)
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(3), "name": "John", "age": int32(42)}, record.Attributes())
+
+		_, err = table.InsertMany(ctx, conn, []*pgxrecord.Record{record})
+		require.ErrorContains(t, err, "record 0 is already persisted")
+
+		_, err = table.InsertMany(ctx, conn, []*pgxrecord.Record{table.NewRecord()})
+		require.ErrorContains(t, err, "no attributes assigned")
+
+		_, err = conn.Exec(ctx, `create temporary table other (id int primary key)`)
+		require.NoError(t, err)
+
+		other := &pgxrecord.Table{Name: pgx.Identifier{"other"}}
+		err = other.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		other.Finalize()
+
+		otherRecord := other.NewRecord()
+		require.NoError(t, otherRecord.Set("id", 1))
+		_, err = table.InsertMany(ctx, conn, []*pgxrecord.Record{records[0], otherRecord})
+		require.ErrorContains(t, err, "record 1 belongs to table")
+	})
+}
+
+func TestTableInsertFromSelect(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table live (
+	id int primary key,
+	name text not null,
+	active bool not null
+);
+create temporary table archive (
+	id int primary key,
+	archived_name text not null,
+	archived_at timestamptz not null default now()
+);
+insert into live (id, name, active) values (1, 'Alice', true), (2, 'Bob', false), (3, 'Carol', false);`)
+		require.NoError(t, err)
+
+		live := &pgxrecord.Table{Name: pgx.Identifier{"live"}}
+		err = live.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		live.Finalize()
+
+		archive := &pgxrecord.Table{Name: pgx.Identifier{"archive"}}
+		err = archive.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		archive.Finalize()
+
+		n, err := archive.InsertFromSelect(ctx, conn, live.Query().Where(map[string]any{"active": false}), map[string]string{"id": "id", "archived_name": "name"})
+		require.NoError(t, err)
+		require.EqualValues(t, 2, n)
+
+		names, err := archive.Pluck(ctx, conn, "archived_name", nil)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []any{"Bob", "Carol"}, names)
+	})
+}
+
+func TestTableInsertFromSelectSQL(t *testing.T) {
+	t.Parallel()
+
+	live := &pgxrecord.Table{
+		Name: pgx.Identifier{"live"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "name", OID: pgtype.TextOID, NotNull: true},
+			{Name: "active", OID: pgtype.BoolOID, NotNull: true},
+		},
+	}
+	live.Finalize()
+
+	archive := &pgxrecord.Table{
+		Name: pgx.Identifier{"archive"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "archived_name", OID: pgtype.TextOID, NotNull: true},
+			{Name: "total", OID: pgtype.Int4OID, Generated: true},
+			{Name: "created_at", OID: pgtype.TimestamptzOID},
+			{Name: "updated_at", OID: pgtype.TimestamptzOID},
+		},
+		Timestamps: true,
+	}
+	archive.Finalize()
+
+	db := &recordingDB{}
+	query := live.Query().Where(map[string]any{"active": false}).Limit(100)
+	_, err := archive.InsertFromSelect(context.Background(), db, query, map[string]string{"id": "id", "archived_name": "name"})
+	require.ErrorIs(t, err, errRecordingDB)
+	require.Equal(t, []string{
+		`insert into "archive" ("id", "archived_name", "created_at", "updated_at") select "live"."id", "live"."name", now(), now() from "live" where "live"."active" = $1 limit $2`,
+	}, db.sqls)
+	require.Equal(t, [][]any{{false, int64(100)}}, db.args)
+
+	_, err = archive.InsertFromSelect(context.Background(), db, query, nil)
+	require.ErrorContains(t, err, "column mapping must not be empty")
+	_, err = archive.InsertFromSelect(context.Background(), db, query, map[string]string{"missing": "id"})
+	require.ErrorContains(t, err, `column "missing" is not found`)
+	_, err = archive.InsertFromSelect(context.Background(), db, query, map[string]string{"id": "missing"})
+	require.ErrorContains(t, err, `source column "missing" is not found in "live"`)
+	_, err = archive.InsertFromSelect(context.Background(), db, query, map[string]string{"total": "id"})
+	require.ErrorContains(t, err, `column "total" cannot be set`)
+}
+
+func TestTableFindBy(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	email text not null,
+	age int
+)`)
+		require.NoError(t, err)
+
+		_, err = conn.Exec(ctx, `insert into t (email, age) values ('john@example.com', 42), ('jane@example.com', 40), ('bill@example.com', 40)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		record, err := table.FindBy(ctx, conn, "email", "jane@example.com")
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(2), "email": "jane@example.com", "age": int32(40)}, record.Attributes())
+
+		_, err = table.FindBy(ctx, conn, "email", "nobody@example.com")
+		require.ErrorIs(t, err, pgx.ErrNoRows)
+		require.ErrorIs(t, err, pgxrecord.ErrNotFound)
+
+		_, err = table.FindBy(ctx, conn, "age", 40)
+		require.ErrorIs(t, err, pgxrecord.ErrMultipleRows)
+		require.NotErrorIs(t, err, pgx.ErrNoRows)
+
+		_, err = table.FindBy(ctx, conn, "missing", 40)
+		require.ErrorContains(t, err, `"missing" is not found`)
+	})
+}
+
+func TestMultipleRowsError(t *testing.T) {
+	t.Parallel()
+
+	err := error(&pgxrecord.MultipleRowsError{Keys: []any{int32(1), []any{int32(2), "a"}}})
+	require.ErrorIs(t, err, pgxrecord.ErrMultipleRows)
+	require.EqualError(t, err, "too many rows: primary keys [1 [2 a]]")
+
+	err = &pgxrecord.MultipleRowsError{}
+	require.ErrorIs(t, err, pgxrecord.ErrMultipleRows)
+	require.EqualError(t, err, "too many rows")
+}
+
+func TestTableFindByAttributes(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	tenant_id int not null,
+	slug text not null,
+	parent_id int,
+	unique (tenant_id, slug)
+);
+insert into t (tenant_id, slug) values (1, 'a'), (1, 'b'), (2, 'a');`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		record, err := table.FindByAttributes(ctx, conn, map[string]any{"tenant_id": 2, "slug": "a"})
+		require.NoError(t, err)
+		require.EqualValues(t, 3, record.MustGet("id"))
+
+		_, err = table.FindByAttributes(ctx, conn, map[string]any{"tenant_id": 2, "slug": "b"})
+		require.ErrorIs(t, err, pgxrecord.ErrNotFound)
+
+		_, err = table.FindByAttributes(ctx, conn, map[string]any{"tenant_id": 1, "parent_id": nil})
+		require.ErrorIs(t, err, pgxrecord.ErrMultipleRows)
+		var multipleRowsErr *pgxrecord.MultipleRowsError
+		require.ErrorAs(t, err, &multipleRowsErr)
+		require.ElementsMatch(t, []any{int32(1), int32(2)}, multipleRowsErr.Keys)
+
+		_, err = table.FindByAttributes(ctx, conn, map[string]any{"missing": 1})
+		require.ErrorContains(t, err, `"missing" is not found`)
+
+		_, err = table.FindByAttributes(ctx, conn, nil)
+		require.ErrorContains(t, err, "conditions must not be empty")
+	})
+}
+
+func TestTableFindAllInAndNotIn(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	status text not null,
+	tags text[] not null default '{}'
+);
+insert into t (status, tags) values ('a', '{x}'), ('b', '{x,y}'), ('c', '{}');`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		statuses := func(records []*pgxrecord.Record) []string {
+			s := make([]string, len(records))
+			for i, r := range records {
+				s[i] = r.MustGet("status").(string)
+			}
+			sort.Strings(s)
+			return s
+		}
+
+		records, err := table.FindAll(ctx, conn, map[string]any{"status": []string{"a", "b"}})
+		require.NoError(t, err)
+		require.Equal(t, []string{"a", "b"}, statuses(records))
+
+		records, err = table.FindAll(ctx, conn, map[string]any{"status": []string{}})
+		require.NoError(t, err)
+		require.Empty(t, records)
+
+		records, err = table.FindAll(ctx, conn, map[string]any{"status": pgxrecord.NotIn([]string{"a", "b"})})
+		require.NoError(t, err)
+		require.Equal(t, []string{"c"}, statuses(records))
+
+		records, err = table.FindAll(ctx, conn, map[string]any{"status": pgxrecord.NotIn([]string{})})
+		require.NoError(t, err)
+		require.Equal(t, []string{"a", "b", "c"}, statuses(records))
+
+		// A slice for an array column is still compared with equality.
+		records, err = table.FindAll(ctx, conn, map[string]any{"tags": []string{"x", "y"}})
+		require.NoError(t, err)
+		require.Equal(t, []string{"b"}, statuses(records))
+
+		records, err = table.FindAll(ctx, conn, map[string]any{"id": pgxrecord.Gt(1), "status": pgxrecord.Like("%c")})
+		require.NoError(t, err)
+		require.Equal(t, []string{"c"}, statuses(records))
+
+		records, err = table.FindAll(ctx, conn, map[string]any{"id": pgxrecord.Between(1, 2), "status": pgxrecord.Ne("a")})
+		require.NoError(t, err)
+		require.Equal(t, []string{"b"}, statuses(records))
+	})
+}
+
+func TestConditionInAndNotInSQL(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true, TypeName: "integer"},
+			{Name: "status", OID: pgtype.TextOID, NotNull: true, TypeName: "text"},
+			{Name: "tags", OID: pgtype.TextArrayOID, NotNull: true, TypeName: "text[]"},
+			{Name: "data", OID: pgtype.ByteaOID, TypeName: "bytea"},
+		},
+	}
+	table.Finalize()
+
+	sql, args, err := table.Query().Where(map[string]any{
+		"id":     []int32{1, 2},
+		"status": pgxrecord.NotIn([]string{"a"}),
+		"tags":   []string{"x"},
+		"data":   []byte("abc"),
+	}).SQL()
+	require.NoError(t, err)
+	require.Equal(t,
+		`select "t"."id", "t"."status", "t"."tags", "t"."data" from "t" where "t"."data" = $1 and "t"."id" = any($2) and "t"."status" != all($3) and "t"."tags" = $4`,
+		sql,
+	)
+	require.Equal(t, []any{[]byte("abc"), []int32{1, 2}, []string{"a"}, []string{"x"}}, args)
+
+	_, _, err = table.Query().Where(map[string]any{"status": pgxrecord.NotIn("a")}).SQL()
+	require.ErrorContains(t, err, `condition column "status": NotIn values must be a slice`)
+
+	castTable := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true, TypeName: "integer"},
+		},
+		CastParameters: true,
+	}
+	castTable.Finalize()
+
+	sql, _, err = castTable.Query().Where(map[string]any{"id": pgxrecord.NotIn([]int32{1})}).SQL()
+	require.NoError(t, err)
+	require.Equal(t, `select "t"."id" from "t" where "t"."id" != all($1::integer[])`, sql)
+}
+
+func TestConditionComparisonSQL(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true, TypeName: "integer"},
+			{Name: "age", OID: pgtype.Int4OID, TypeName: "integer"},
+			{Name: "b_name", OID: pgtype.TextOID, TypeName: "text"},
+			{Name: "c_email", OID: pgtype.TextOID, TypeName: "text"},
+			{Name: "d_score", OID: pgtype.Int4OID, TypeName: "integer"},
+			{Name: "e_rank", OID: pgtype.Int4OID, TypeName: "integer"},
+			{Name: "f_level", OID: pgtype.Int4OID, TypeName: "integer"},
+			{Name: "g_status", OID: pgtype.TextOID, TypeName: "text"},
+			{Name: "h_parent_id", OID: pgtype.Int4OID, TypeName: "integer"},
+		},
+	}
+	table.Finalize()
+
+	sql, args, err := table.Query().Where(map[string]any{
+		"age":         pgxrecord.Between(18, 65),
+		"b_name":      pgxrecord.Like("A%"),
+		"c_email":     pgxrecord.ILike("%@example.com"),
+		"d_score":     pgxrecord.Gt(10),
+		"e_rank":      pgxrecord.Gte(1),
+		"f_level":     pgxrecord.Lt(5),
+		"g_status":    pgxrecord.Ne("deleted"),
+		"h_parent_id": pgxrecord.Ne(nil),
+		"id":          pgxrecord.Lte(100),
+	}).Where(map[string]any{"id": 7}).SQL()
+	require.NoError(t, err)
+	require.Equal(t,
+		`select "t"."id", "t"."age", "t"."b_name", "t"."c_email", "t"."d_score", "t"."e_rank", "t"."f_level", "t"."g_status", "t"."h_parent_id" from "t" `+
+			`where "t"."age" between $1 and $2 and "t"."b_name" like $3 and "t"."c_email" ilike $4 and "t"."d_score" > $5 and "t"."e_rank" >= $6 `+
+			`and "t"."f_level" < $7 and "t"."g_status" != $8 and "t"."h_parent_id" is not null and "t"."id" <= $9 and "t"."id" = $10`,
+		sql,
+	)
+	require.Equal(t, []any{18, 65, "A%", "%@example.com", 10, 1, 5, "deleted", 100, 7}, args)
+
+	_, _, err = table.Query().Where(map[string]any{"age": pgxrecord.Gt(nil)}).SQL()
+	require.ErrorContains(t, err, `condition column "age": > value must not be nil`)
+
+	_, _, err = table.Query().Where(map[string]any{"age": pgxrecord.Between(1, nil)}).SQL()
+	require.ErrorContains(t, err, `condition column "age": Between values must not be nil`)
+}
+
+func TestQueryWithSQL(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "name", OID: pgtype.TextOID, NotNull: true},
+			{Name: "parent_id", OID: pgtype.Int4OID},
+		},
+	}
+	table.Finalize()
+
+	recent := table.Query().Select("id").Where(map[string]any{"name": "a"}).Limit(5)
+	sql, args, err := table.Query().
+		With("recent", recent).
+		WithSQL("named", `select id from t where name = $1 or name = $2`, "b", "c").
+		Join("recent", `"recent"."id" = "t"."id"`).
+		Where(map[string]any{"name": "d"}).
+		SQL()
+	require.NoError(t, err)
+	require.Equal(t,
+		`with "recent" as (select "t"."id" from "t" where "t"."name" = $1 limit $2), "named" as (select id from t where name = $3 or name = $4) `+
+			`select "t"."id", "t"."name", "t"."parent_id" from "t" join "recent" on "recent"."id" = "t"."id" where "t"."name" = $5`,
+		sql,
+	)
+	require.Equal(t, []any{"a", int64(5), "b", "c", "d"}, args)
+
+	sql, args, err = table.Query().
+		WithRecursiveSQL("tree", `select id from t where id = $1 union all select t.id from t join tree on t.parent_id = tree.id`, 1).
+		WhereSQL(`"t"."id" in (select id from tree)`).
+		SQL()
+	require.NoError(t, err)
+	require.Equal(t,
+		`with recursive "tree" as (select id from t where id = $1 union all select t.id from t join tree on t.parent_id = tree.id) `+
+			`select "t"."id", "t"."name", "t"."parent_id" from "t" where ("t"."id" in (select id from tree))`,
+		sql,
+	)
+	require.Equal(t, []any{1}, args)
+
+	_, _, err = table.Query().WithSQL("bad", `select $2`, 1).SQL()
+	require.ErrorContains(t, err, "placeholder $2 does not have an argument")
+
+	_, _, err = table.Query().WithSQL("", "select 1").SQL()
+	require.ErrorContains(t, err, "with requires a name and sql")
+
+	_, _, err = table.Query().With("sub", table.Query().Select("missing")).SQL()
+	require.ErrorContains(t, err, `select column "missing" is not found`)
+}
+
+func TestQueryWith(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key,
+	name text not null,
+	parent_id int
+);
+insert into t (id, name, parent_id) values (1, 'root', null), (2, 'child', 1), (3, 'grandchild', 2), (4, 'other', null);`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		records, err := table.Query().
+			WithRecursiveSQL("tree", `select id from t where id = $1 union all select t.id from t join tree on t.parent_id = tree.id`, 2).
+			Join("tree", `"tree"."id" = "t"."id"`).
+			OrderBy("id", pgxrecord.Asc).
+			All(ctx, conn)
+		require.NoError(t, err)
+		require.Len(t, records, 2)
+		require.Equal(t, "child", records[0].MustGet("name"))
+		require.Equal(t, "grandchild", records[1].MustGet("name"))
+
+		roots := table.Query().Select("id").Where(map[string]any{"parent_id": nil})
+		sum, err := table.Query().With("roots", roots).WhereSQL(`"t"."id" in (select "id" from "roots")`).Sum(ctx, conn, "id")
+		require.NoError(t, err)
+		require.EqualValues(t, 5, sum)
+	})
+}
+
+func TestTableFindAll(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int
+)`)
+		require.NoError(t, err)
+
+		_, err = conn.Exec(ctx, `insert into t (name, age) values ('John', 42), ('Jane', 40), ('Bill', null)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		records, err := table.FindAll(ctx, conn, nil)
+		require.NoError(t, err)
+		require.Len(t, records, 3)
+
+		records, err = table.FindAll(ctx, conn, map[string]any{"name": "Jane", "age": 40})
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+		require.Equal(t, map[string]any{"id": int32(2), "name": "Jane", "age": int32(40)}, records[0].Attributes())
+
+		records, err = table.FindAll(ctx, conn, map[string]any{"age": nil})
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+		require.Equal(t, map[string]any{"id": int32(3), "name": "Bill", "age": nil}, records[0].Attributes())
+
+		records, err = table.FindAll(ctx, conn, map[string]any{"name": "Nobody"})
+		require.NoError(t, err)
+		require.Len(t, records, 0)
+
+		_, err = table.FindAll(ctx, conn, map[string]any{"missing": 1})
+		require.ErrorContains(t, err, `"missing" is not found`)
+	})
+}
+
+func TestTableFindAllInto(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int
+)`)
+		require.NoError(t, err)
+
+		_, err = conn.Exec(ctx, `insert into t (name, age) values ('John', 42), ('Jane', 40), ('Bill', null)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		var records []*pgxrecord.Record
+		err = table.FindAllInto(ctx, conn, &records, nil)
+		require.NoError(t, err)
+		require.Len(t, records, 3)
+		first := records[0]
+
+		err = table.FindAllInto(ctx, conn, &records, map[string]any{"name": "Jane"})
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+		require.Same(t, first, records[0])
+		require.Equal(t, map[string]any{"id": int32(2), "name": "Jane", "age": int32(40)}, records[0].Attributes())
+
+		err = table.FindAllInto(ctx, conn, &records, map[string]any{"age": nil})
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+		require.Equal(t, map[string]any{"id": int32(3), "name": "Bill", "age": nil}, records[0].Attributes())
+
+		err = table.FindAllInto(ctx, conn, &records, map[string]any{"missing": 1})
+		require.ErrorContains(t, err, `"missing" is not found`)
+	})
+}
+
+func TestTableCount(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int,
+	deleted_at timestamptz
+)`)
+		require.NoError(t, err)
+
+		_, err = conn.Exec(ctx, `insert into t (name, age, deleted_at) values ('John', 42, null), ('Jane', 40, null), ('Bill', 40, now())`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name:             pgx.Identifier{"t"},
+			SoftDeleteColumn: "deleted_at",
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		n, err := table.CountAll(ctx, conn)
+		require.NoError(t, err)
+		require.EqualValues(t, 2, n)
+
+		n, err = table.Count(ctx, conn, map[string]any{"age": 40})
+		require.NoError(t, err)
+		require.EqualValues(t, 1, n)
+
+		n, err = table.WithDeleted().Count(ctx, conn, map[string]any{"age": 40})
+		require.NoError(t, err)
+		require.EqualValues(t, 2, n)
+
+		n, err = table.Count(ctx, conn, map[string]any{"name": "Nobody"})
+		require.NoError(t, err)
+		require.EqualValues(t, 0, n)
+
+		_, err = table.Count(ctx, conn, map[string]any{"missing": 1})
+		require.ErrorContains(t, err, `"missing" is not found`)
+	})
+}
+
+func TestTableExists(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int
+)`)
+		require.NoError(t, err)
+
+		_, err = conn.Exec(ctx, `insert into t (name, age) values ('John', 42), ('Bill', null)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		exists, err := table.Exists(ctx, conn, map[string]any{"name": "John", "age": 42})
+		require.NoError(t, err)
+		require.True(t, exists)
+
+		exists, err = table.Exists(ctx, conn, map[string]any{"age": nil})
+		require.NoError(t, err)
+		require.True(t, exists)
+
+		exists, err = table.Exists(ctx, conn, map[string]any{"name": "Nobody"})
+		require.NoError(t, err)
+		require.False(t, exists)
+
+		_, err = table.Exists(ctx, conn, map[string]any{"missing": 1})
+		require.ErrorContains(t, err, `"missing" is not found`)
+	})
+}
+
+func TestTableEach(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int
+)`)
+		require.NoError(t, err)
+
+		_, err = conn.Exec(ctx, `insert into t (name, age) select 'John', n from generate_series(1, 100) n`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		var sum int32
+		err = table.Each(ctx, conn, map[string]any{"name": "John"}, func(r *pgxrecord.Record) error {
+			sum += r.MustGet("age").(int32)
+			return nil
+		})
+		require.NoError(t, err)
+		require.EqualValues(t, 5050, sum)
+
+		errStop := errors.New("stop")
+		n := 0
+		err = table.Each(ctx, conn, nil, func(r *pgxrecord.Record) error {
+			n++
+			if n == 10 {
+				return errStop
+			}
+			return nil
+		})
+		require.ErrorIs(t, err, errStop)
+		require.Equal(t, 10, n)
+
+		// The rows must have been closed so the connection can be used again.
+		count, err := table.CountAll(ctx, conn)
+		require.NoError(t, err)
+		require.EqualValues(t, 100, count)
+	})
+}
+
+func TestTableTruncate(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null
+);
+insert into t (name) values ('John'), ('Jane');`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		err = table.Truncate(ctx, conn, pgxrecord.RestartIdentity())
+		require.NoError(t, err)
+
+		n, err := table.CountAll(ctx, conn)
+		require.NoError(t, err)
+		require.EqualValues(t, 0, n)
+
+		record := table.NewRecord()
+		record.MustSet("name", "Bill")
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, int32(1), record.MustGet("id"))
+	})
+}
+
+func TestTableTruncateSQL(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"public", "t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+		},
+	}
+	table.Finalize()
+
+	db := &recordingDB{}
+	err := table.Truncate(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+	err = table.Truncate(context.Background(), db, pgxrecord.RestartIdentity(), pgxrecord.Cascade())
+	require.ErrorIs(t, err, errRecordingDB)
+
+	require.Equal(t, []string{
+		`truncate "public"."t"`,
+		`truncate "public"."t" restart identity cascade`,
+	}, db.sqls)
+}
+
+func TestTablePluck(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int
+)`)
+		require.NoError(t, err)
+
+		_, err = conn.Exec(ctx, `insert into t (name, age) values ('John', 42), ('Jane', 40), ('Bill', 40)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		values, err := table.Pluck(ctx, conn, "name", map[string]any{"age": 40})
+		require.NoError(t, err)
+		require.ElementsMatch(t, []any{"Jane", "Bill"}, values)
+
+		ages, err := pgxrecord.PluckInto[int32](ctx, conn, table, "age", nil)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []int32{42, 40, 40}, ages)
+
+		_, err = table.Pluck(ctx, conn, "missing", nil)
+		require.ErrorContains(t, err, `column "missing" is not found`)
+	})
+}
+
+func BenchmarkTableFindAllInto(b *testing.B) {
+	defaultConnTestRunner.RunTest(context.Background(), b, func(ctx context.Context, _ testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int
+)`)
+		require.NoError(b, err)
+
+		_, err = conn.Exec(ctx, `insert into t (name, age) select 'John', n from generate_series(1, 100) n`)
+		require.NoError(b, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(b, err)
+		table.Finalize()
+
+		b.Run("FindAll", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, err := table.FindAll(ctx, conn, nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run("FindAllInto", func(b *testing.B) {
+			b.ReportAllocs()
+			var records []*pgxrecord.Record
+			for i := 0; i < b.N; i++ {
+				err := table.FindAllInto(ctx, conn, &records, nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+}
+
+func BenchmarkTableFindByPKQueryExecMode(b *testing.B) {
+	defaultConnTestRunner.RunTest(context.Background(), b, func(ctx context.Context, _ testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int
+);
+insert into t (name, age) values ('John', 42);`)
+		require.NoError(b, err)
+
+		for _, mode := range []pgx.QueryExecMode{
+			pgx.QueryExecModeCacheStatement,
+			pgx.QueryExecModeCacheDescribe,
+			pgx.QueryExecModeDescribeExec,
+			pgx.QueryExecModeSimpleProtocol,
+		} {
+			table := &pgxrecord.Table{
+				Name:          pgx.Identifier{"t"},
+				QueryExecMode: mode,
+			}
+			err = table.LoadAllColumns(ctx, conn)
+			require.NoError(b, err)
+			table.Finalize()
+
+			b.Run(mode.String(), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					_, err := table.FindByPK(ctx, conn, 1)
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	})
+}
+
+func TestTableQueryExecMode(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null
+)`)
+		require.NoError(t, err)
+
+		for _, mode := range []pgx.QueryExecMode{pgx.QueryExecModeCacheStatement, pgx.QueryExecModeSimpleProtocol} {
+			table := &pgxrecord.Table{
+				Name:          pgx.Identifier{"t"},
+				QueryExecMode: mode,
+			}
+			err = table.LoadAllColumns(ctx, conn)
+			require.NoError(t, err)
+			table.Finalize()
+
+			record := table.NewRecord()
+			record.MustSet("name", "John")
+			err = record.Save(ctx, conn)
+			require.NoError(t, err)
+
+			for i := 0; i < 3; i++ {
+				found, err := table.FindByPK(ctx, conn, record.MustGet("id"))
+				require.NoError(t, err)
+				require.Equal(t, "John", found.MustGet("name"))
+			}
+
+			records, err := table.FindAll(ctx, conn, map[string]any{"name": "John"})
+			require.NoError(t, err)
+			require.NotEmpty(t, records)
+		}
+	})
+}
+
+func TestTableQueryExecModeSQL(t *testing.T) {
+	t.Parallel()
+
+	var tracedArgs []any
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true, HasDefault: true},
+			{Name: "name", OID: pgtype.TextOID, NotNull: true},
+		},
+		QueryExecMode: pgx.QueryExecModeCacheDescribe,
+		QueryTracer: func(ctx context.Context, op string, sql string, args []any, elapsed time.Duration, err error) {
+			tracedArgs = args
+		},
+	}
+	table.Finalize()
+
+	record := table.NewRecord()
+	record.MustSet("name", "John")
+
+	db := &recordingDB{}
+	err := record.Save(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+	require.Equal(t, [][]any{{pgx.QueryExecModeCacheDescribe, "John"}}, db.args)
+	require.Equal(t, []any{"John"}, tracedArgs)
+}
+
+func TestQueryLimitOffset(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int
+)`)
+		require.NoError(t, err)
+
+		_, err = conn.Exec(ctx, `insert into t (name, age) values ('John', 42), ('Jane', 40), ('Bill', 40)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		records, err := table.Query().Limit(0).All(ctx, conn)
+		require.NoError(t, err)
+		require.Len(t, records, 3)
+
+		records, err = table.Query().Limit(2).All(ctx, conn)
+		require.NoError(t, err)
+		require.Len(t, records, 2)
+
+		records, err = table.Query().Offset(2).All(ctx, conn)
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+
+		records, err = table.Query().Where(map[string]any{"age": 40}).Limit(5).Offset(1).All(ctx, conn)
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+
+		_, err = table.Query().Limit(-1).All(ctx, conn)
+		require.ErrorContains(t, err, "limit must not be negative")
+
+		_, err = table.Query().Offset(-1).All(ctx, conn)
+		require.ErrorContains(t, err, "offset must not be negative")
+	})
+}
+
+func TestQueryOrderBy(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int
+)`)
+		require.NoError(t, err)
+
+		_, err = conn.Exec(ctx, `insert into t (name, age) values ('John', 42), ('Jane', 40), ('Bill', 40)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		records, err := table.Query().OrderBy("age", pgxrecord.Desc).OrderBy("name", pgxrecord.Asc).All(ctx, conn)
+		require.NoError(t, err)
+		require.Len(t, records, 3)
+		require.Equal(t, "John", records[0].MustGet("name"))
+		require.Equal(t, "Bill", records[1].MustGet("name"))
+		require.Equal(t, "Jane", records[2].MustGet("name"))
+
+		_, err = table.Query().OrderBy("name; drop table t", pgxrecord.Asc).All(ctx, conn)
+		require.ErrorContains(t, err, `order by column "name; drop table t" is not found`)
+
+		records, err = table.Query().OrderBy("name", pgxrecord.Desc, pgxrecord.Collate("C")).All(ctx, conn)
+		require.NoError(t, err)
+		require.Len(t, records, 3)
+		require.Equal(t, "John", records[0].MustGet("name"))
+		require.Equal(t, "Jane", records[1].MustGet("name"))
+		require.Equal(t, "Bill", records[2].MustGet("name"))
+
+		_, err = conn.Exec(ctx, `insert into t (name, age) values ('Anna', null)`)
+		require.NoError(t, err)
+
+		records, err = table.Query().OrderBy("age", pgxrecord.Desc).All(ctx, conn)
+		require.NoError(t, err)
+		require.Len(t, records, 4)
+		require.Equal(t, "Anna", records[0].MustGet("name"))
+
+		records, err = table.Query().OrderBy("age", pgxrecord.Desc, pgxrecord.NullsLast()).All(ctx, conn)
+		require.NoError(t, err)
+		require.Len(t, records, 4)
+		require.Equal(t, "John", records[0].MustGet("name"))
+		require.Equal(t, "Anna", records[3].MustGet("name"))
+
+		records, err = table.Query().OrderBy("age", pgxrecord.Asc, pgxrecord.NullsFirst()).All(ctx, conn)
+		require.NoError(t, err)
+		require.Len(t, records, 4)
+		require.Equal(t, "Anna", records[0].MustGet("name"))
+	})
+}
+
+func TestQuerySQL(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "name", OID: pgtype.TextOID, NotNull: true},
+		},
+	}
+	table.Finalize()
+
+	db := &recordingDB{}
+	_, err := table.Query().Where(map[string]any{"name": "John"}).Limit(10).Offset(20).All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+
+	_, err = table.Query().Limit(10).All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+
+	_, err = table.Query().OrderBy("name", pgxrecord.Desc).OrderBy("id", pgxrecord.Asc).Limit(10).All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+
+	_, err = table.Query().Select().All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+
+	_, err = table.Query().OrderBy("name", pgxrecord.Asc, pgxrecord.Collate(`de-u-co-"phonebk`)).All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+
+	_, err = table.Query().OrderBy("name", pgxrecord.Asc, pgxrecord.NullsLast()).OrderBy("id", pgxrecord.Desc, pgxrecord.NullsFirst()).All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+
+	_, err = table.Query().Select("missing").All(context.Background(), db)
+	require.ErrorContains(t, err, `select column "missing" is not found`)
+
+	_, err = table.Query().Join("u", "u.t_id = t.id").LeftJoin("v", "v.id = u.v_id").Where(map[string]any{"name": "John"}).OrderBy("id", pgxrecord.Asc).All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+
+	_, err = table.Query().Join("other.u", "u.t_id = t.id").All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+
+	require.Equal(t, []string{
+		`select "t"."id", "t"."name" from "t" where "t"."name" = $1 limit $2 offset $3`,
+		`select "t"."id", "t"."name" from "t" limit $1`,
+		`select "t"."id", "t"."name" from "t" order by "t"."name" desc, "t"."id" asc limit $1`,
+		`select "t"."id" from "t"`,
+		`select "t"."id", "t"."name" from "t" order by "t"."name" collate "de-u-co-""phonebk" asc`,
+		`select "t"."id", "t"."name" from "t" order by "t"."name" asc nulls last, "t"."id" desc nulls first`,
+		`select "t"."id", "t"."name" from "t" join "u" on u.t_id = t.id left join "v" on v.id = u.v_id where "t"."name" = $1 order by "t"."id" asc`,
+		`select "t"."id", "t"."name" from "t" join "other"."u" on u.t_id = t.id`,
+	}, db.sqls)
+}
+
+func TestQueryScope(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "name", OID: pgtype.TextOID, NotNull: true},
+			{Name: "active", OID: pgtype.BoolOID, NotNull: true},
+		},
+	}
+	table.DefineScope("active", func(q *pgxrecord.Query) *pgxrecord.Query {
+		return q.Where(map[string]any{"active": true})
+	})
+	table.DefineScope("newest", func(q *pgxrecord.Query) *pgxrecord.Query {
+		return q.OrderBy("id", pgxrecord.Desc)
+	})
+	table.Finalize()
+
+	db := &recordingDB{}
+	_, err := table.Query().Scope("active").Scope("newest").Where(map[string]any{"name": "John"}).All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+
+	_, err = table.Query().Scope("active").Limit(1).All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+
+	_, err = table.Query().Scope("missing").All(context.Background(), db)
+	require.ErrorContains(t, err, `scope "missing" is not found`)
+
+	require.Equal(t, []string{
+		`select "t"."id", "t"."name", "t"."active" from "t" where "t"."active" = $1 and "t"."name" = $2 order by "t"."id" desc`,
+		`select "t"."id", "t"."name", "t"."active" from "t" where "t"."active" = $1 limit $2`,
+	}, db.sqls)
+}
+
+func TestQueryWhereSQL(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "name", OID: pgtype.TextOID, NotNull: true},
+			{Name: "age", OID: pgtype.Int4OID},
+		},
+	}
+	table.Finalize()
+
+	db := &recordingDB{}
+	_, err := table.Query().
+		Where(map[string]any{"name": "John"}).
+		WhereSQL("age between $1 and $2", 18, 65).
+		WhereSQL("name <> '$1' or age = $1", 40).
+		Limit(10).
+		Offset(20).
+		All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+	require.Equal(t, []string{
+		`select "t"."id", "t"."name", "t"."age" from "t" where "t"."name" = $1 and (age between $2 and $3) and (name <> '$1' or age = $4) limit $5 offset $6`,
+	}, db.sqls)
+	require.Equal(t, [][]any{{"John", 18, 65, 40, int64(10), int64(20)}}, db.args)
+
+	_, err = table.Query().WhereSQL("age > $2", 18).All(context.Background(), db)
+	require.ErrorContains(t, err, "placeholder $2 does not have an argument")
+
+	_, err = table.Query().WhereSQL("name = 'John").All(context.Background(), db)
+	require.ErrorContains(t, err, "unterminated quote")
+}
+
+func TestWriteRenumberedSQL(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		sql      string
+		expected string
+	}{
+		{`a = $1 and b = $2`, `(a = $3 and b = $4)`},
+		{`a = 'x$1''$2' and b = $1`, `(a = 'x$1''$2' and b = $3)`},
+		{`"a$1""b" = $2`, `("a$1""b" = $4)`},
+		{`a = E'it\'s $1' and b = $2`, `(a = E'it\'s $1' and b = $4)`},
+		{`a = e'\\' and b = $1`, `(a = e'\\' and b = $3)`},
+		{`name = 'C:\' and b = $1`, `(name = 'C:\' and b = $3)`},
+		{`a = $$ $1 ' $$ and b = $tag$ $2 $$ $tag$ and c = $1`, `(a = $$ $1 ' $$ and b = $tag$ $2 $$ $tag$ and c = $3)`},
+		{"a = $1 -- $2 '\nand b = $2", "(a = $3 -- $2 '\nand b = $4)"},
+		{"a = $1 -- $2", "(a = $3 -- $2\n)"},
+		{`a = /* $1 /* ' */ $2 */ $1`, `(a = /* $1 /* ' */ $2 */ $3)`},
+		{`a$1 = $1`, `(a$1 = $3)`},
+	} {
+		sql, err := pgxrecord.Private_writeRenumberedSQL(tt.sql, 2, 2)
+		require.NoError(t, err, tt.sql)
+		require.Equal(t, tt.expected, sql, tt.sql)
+	}
+
+	for _, tt := range []struct {
+		sql string
+		err string
+	}{
+		{`a = $3`, "placeholder $3 does not have an argument"},
+		{`a = $0`, "placeholder $0 does not have an argument"},
+		{`a = 'x`, "unterminated quote"},
+		{`a = E'x\'`, "unterminated quote"},
+		{`a = /* /* */`, "unterminated comment"},
+		{`a = $x$ $1`, "unterminated dollar-quoted string"},
+	} {
+		_, err := pgxrecord.Private_writeRenumberedSQL(tt.sql, 2, 2)
+		require.ErrorContains(t, err, tt.err, tt.sql)
+	}
+}
+
+func TestQueryWhereJSONSQL(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "name", OID: pgtype.TextOID, NotNull: true},
+			{Name: "metadata", OID: pgtype.JSONBOID},
+			{Name: "settings", OID: pgtype.JSONOID},
+		},
+	}
+	table.Finalize()
+
+	db := &recordingDB{}
+	contains := map[string]any{"tags": []any{"a"}}
+	_, err := table.Query().
+		Where(map[string]any{"name": "John"}).
+		WhereJSON("metadata", "plan", "pro").
+		WhereJSON("settings", "it's", "on").
+		WhereJSONContains("metadata", contains).
+		All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+	require.Equal(t, []string{
+		`select "t"."id", "t"."name", "t"."metadata", "t"."settings" from "t" where "t"."name" = $1 and ("t"."metadata"->>'plan' = $2) and ("t"."settings"->>'it''s' = $3) and ("t"."metadata" @> $4)`,
+	}, db.sqls)
+	require.Equal(t, [][]any{{"John", "pro", "on", contains}}, db.args)
+
+	_, err = table.Query().WhereJSON("name", "plan", "pro").All(context.Background(), db)
+	require.ErrorContains(t, err, `json condition column "name" is not json or jsonb`)
+	_, err = table.Query().WhereJSONContains("settings", contains).All(context.Background(), db)
+	require.ErrorContains(t, err, `json condition column "settings" is not jsonb`)
+	_, err = table.Query().WhereJSON("missing", "plan", "pro").All(context.Background(), db)
+	require.ErrorContains(t, err, `json condition column "missing" is not found`)
+}
+
+func TestQueryWhereJSON(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key,
+	metadata jsonb
+);
+insert into t (id, metadata) values (1, '{"plan": "pro", "tags": ["a", "b"]}'), (2, '{"plan": "free"}'), (3, null);`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		records, err := table.Query().WhereJSON("metadata", "plan", "pro").All(ctx, conn)
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+		require.EqualValues(t, 1, records[0].MustGet("id"))
+
+		records, err = table.Query().WhereJSONContains("metadata", map[string]any{"tags": []string{"b"}}).All(ctx, conn)
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+		require.EqualValues(t, 1, records[0].MustGet("id"))
+	})
+}
+
+func TestQueryForUpdateSQL(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"jobs"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "status", OID: pgtype.TextOID, NotNull: true},
+		},
+	}
+	table.Finalize()
+
+	db := &recordingDB{}
+	_, err := table.Query().Where(map[string]any{"status": "ready"}).OrderBy("id", pgxrecord.Asc).Limit(2).ForUpdateSkipLocked().All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+	_, err = table.Query().ForUpdate().All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+	_, err = table.Query().LeftJoin("workers", `"workers"."id" = "jobs"."id"`).ForShare().All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+	require.Equal(t, []string{
+		`select "jobs"."id", "jobs"."status" from "jobs" where "jobs"."status" = $1 order by "jobs"."id" asc limit $2 for update skip locked`,
+		`select "jobs"."id", "jobs"."status" from "jobs" for update`,
+		`select "jobs"."id", "jobs"."status" from "jobs" left join "workers" on "workers"."id" = "jobs"."id" for share of "jobs"`,
+	}, db.sqls)
+
+	_, err = table.Query().Distinct().ForUpdate().All(context.Background(), db)
+	require.ErrorContains(t, err, "for update cannot be used with distinct")
+}
+
+func TestQueryForUpdateSkipLocked(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	config, err := pgxpool.ParseConfig(testDatabaseConnString(t))
+	require.NoError(t, err)
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	_, err = pool.Exec(ctx, `drop table if exists pgxrecord_skip_locked_jobs;
+create table pgxrecord_skip_locked_jobs (
+	id int primary key
+);
+insert into pgxrecord_skip_locked_jobs (id) select generate_series(1, 4);`)
+	require.NoError(t, err)
+	defer pool.Exec(ctx, `drop table pgxrecord_skip_locked_jobs`)
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"pgxrecord_skip_locked_jobs"},
+	}
+	err = table.LoadAllColumns(ctx, pool)
+	require.NoError(t, err)
+	table.Finalize()
+
+	claim := func(tx pgx.Tx) []any {
+		records, err := table.Query().OrderBy("id", pgxrecord.Asc).Limit(2).ForUpdateSkipLocked().All(ctx, tx)
+		require.NoError(t, err)
+		ids := make([]any, len(records))
+		for i, r := range records {
+			ids[i] = r.MustGet("id")
+		}
+		return ids
+	}
+
+	tx1, err := pool.Begin(ctx)
+	require.NoError(t, err)
+	defer tx1.Rollback(ctx)
+	tx2, err := pool.Begin(ctx)
+	require.NoError(t, err)
+	defer tx2.Rollback(ctx)
+
+	require.Equal(t, []any{int32(1), int32(2)}, claim(tx1))
+	require.Equal(t, []any{int32(3), int32(4)}, claim(tx2))
+}
+
+func TestQueryDistinct(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "user_id", OID: pgtype.Int4OID, NotNull: true},
+			{Name: "name", OID: pgtype.TextOID, NotNull: true},
+		},
+	}
+	table.Finalize()
+
+	db := &recordingDB{}
+	_, err := table.Query().Distinct().Select("name").Where(map[string]any{"name": "John"}).Limit(10).All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+
+	_, err = table.Query().DistinctOn("user_id").OrderBy("user_id", pgxrecord.Asc).OrderBy("id", pgxrecord.Desc).All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+
+	_, err = table.Query().DistinctOn("user_id", "name").OrderBy("user_id", pgxrecord.Asc).All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+
+	_, err = table.Query().DistinctOn("user_id", "name").OrderBy("name", pgxrecord.Asc).OrderBy("user_id", pgxrecord.Asc).OrderBy("id", pgxrecord.Asc).All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+
+	_, err = table.Query().DistinctOn("user_id").OrderBy("id", pgxrecord.Desc).All(context.Background(), db)
+	require.ErrorContains(t, err, `leading order by column "t"."id" must be one of the distinct on columns`)
+
+	_, err = table.Query().DistinctOn("user_id", "name").OrderBy("user_id", pgxrecord.Asc).OrderBy("id", pgxrecord.Asc).OrderBy("name", pgxrecord.Asc).All(context.Background(), db)
+	require.ErrorContains(t, err, `leading order by column "t"."id" must be one of the distinct on columns`)
+
+	_, err = table.Query().DistinctOn("missing").All(context.Background(), db)
+	require.ErrorContains(t, err, `distinct on column "missing" is not found`)
+
+	require.Equal(t, []string{
+		`select distinct "t"."id", "t"."name" from "t" where "t"."name" = $1 limit $2`,
+		`select distinct on ("t"."user_id") "t"."id", "t"."user_id", "t"."name" from "t" order by "t"."user_id" asc, "t"."id" desc`,
+		`select distinct on ("t"."user_id", "t"."name") "t"."id", "t"."user_id", "t"."name" from "t" order by "t"."user_id" asc`,
+		`select distinct on ("t"."user_id", "t"."name") "t"."id", "t"."user_id", "t"."name" from "t" order by "t"."name" asc, "t"."user_id" asc, "t"."id" asc`,
+	}, db.sqls)
+}
+
+func TestQuerySubquery(t *testing.T) {
+	t.Parallel()
+
+	customers := &pgxrecord.Table{
+		Name: pgx.Identifier{"customers"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "region", OID: pgtype.TextOID, NotNull: true},
+		},
+	}
+	customers.Finalize()
+
+	orders := &pgxrecord.Table{
+		Name: pgx.Identifier{"orders"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "customer_id", OID: pgtype.Int4OID, NotNull: true},
+			{Name: "status", OID: pgtype.TextOID, NotNull: true},
+		},
+	}
+	orders.Finalize()
+
+	db := &recordingDB{}
+	_, err := orders.Query().
+		Where(map[string]any{
+			"status":      "open",
+			"customer_id": customers.Query().Where(map[string]any{"region": "west"}).Subquery("id"),
+		}).
+		Limit(10).
+		All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+
+	_, err = customers.Query().
+		WhereSQL("region <> $1", "east").
+		WhereExists(orders.Query().WhereSQL(`"orders"."customer_id" = "customers"."id"`).Where(map[string]any{"status": "open"})).
+		All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+
+	_, err = orders.Query().Where(map[string]any{"customer_id": customers.Query().Subquery("id")}).All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+
+	_, err = orders.Query().Where(map[string]any{"customer_id": customers.Query().Subquery("missing")}).All(context.Background(), db)
+	require.ErrorContains(t, err, `subquery column "missing" is not found`)
+
+	require.Equal(t, []string{
+		`select "orders"."id", "orders"."customer_id", "orders"."status" from "orders" where "orders"."customer_id" in (select "customers"."id" from "customers" where "customers"."region" = $1) and "orders"."status" = $2 limit $3`,
+		`select "customers"."id", "customers"."region" from "customers" where (region <> $1) and exists (select 1 from "orders" where ("orders"."customer_id" = "customers"."id") and "orders"."status" = $2)`,
+		`select "orders"."id", "orders"."customer_id", "orders"."status" from "orders" where "orders"."customer_id" in (select "customers"."id" from "customers")`,
+	}, db.sqls)
+	require.Equal(t, []any{"west", "open", int64(10)}, db.args[0])
+}
+
+func TestTableGeneratedSQL(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true, HasDefault: true},
+			{Name: "name", OID: pgtype.TextOID, NotNull: true},
+		},
+		RewriteSQL: func(op string, sql string) string {
+			return "/* " + op + " */ " + sql
+		},
+	}
+	table.Finalize()
+
+	record := table.NewRecord()
+	record.MustSet("name", "John")
+	sql, args := table.InsertSQL(record)
+	require.Equal(t, `/* insert */ insert into "t" ("name") values ($1) returning "id", "name"`, sql)
+	require.Equal(t, []any{"John"}, args)
+
+	db := &recordingDB{}
+	err := record.Save(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+	require.Equal(t, []string{sql}, db.sqls)
+
+	sql, args, err = table.Query().Where(map[string]any{"name": "John"}).Limit(1).SQL()
+	require.NoError(t, err)
+	require.Equal(t, `/* select */ select "t"."id", "t"."name" from "t" where "t"."name" = $1 limit $2`, sql)
+	require.Equal(t, []any{"John", int64(1)}, args)
+
+	_, _, err = table.Query().OrderBy("missing", pgxrecord.Asc).SQL()
+	require.ErrorContains(t, err, `order by column "missing" is not found`)
+}
+
+func TestQueryExplain(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		plan, err := table.Query().Where(map[string]any{"name": "John"}).Explain(ctx, conn)
+		require.NoError(t, err)
+		require.Contains(t, plan, "Seq Scan on t")
+		require.NotContains(t, plan, "actual time")
+
+		plan, err = table.Query().Where(map[string]any{"id": 1}).Explain(ctx, conn, pgxrecord.ExplainAnalyze(), pgxrecord.ExplainFormatJSON())
+		require.NoError(t, err)
+		var jsonPlan []map[string]any
+		err = json.Unmarshal([]byte(plan), &jsonPlan)
+		require.NoError(t, err)
+		require.Len(t, jsonPlan, 1)
+		require.Contains(t, jsonPlan[0], "Execution Time")
+	})
+}
+
+func TestTableUnquotedIdentifiersAndOmitSchema(t *testing.T) {
+	t.Parallel()
+
+	newTable := func(unquoted, omitSchema bool) *pgxrecord.Table {
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"public", "users"},
+			Columns: []*pgxrecord.Column{
+				{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+				{Name: "name", OID: pgtype.TextOID, NotNull: true},
+			},
+			UnquotedIdentifiers: unquoted,
+			OmitSchema:          omitSchema,
+		}
+		table.Finalize()
+		return table
+	}
+
+	for _, tt := range []struct {
+		unquoted   bool
+		omitSchema bool
+		sql        string
+	}{
+		{false, false, `select "users"."id", "users"."name" from "public"."users" where "users"."name" = $1`},
+		{true, false, `select users.id, users.name from public.users where users.name = $1`},
+		{false, true, `select "users"."id", "users"."name" from "users" where "users"."name" = $1`},
+		{true, true, `select users.id, users.name from users where users.name = $1`},
+	} {
+		sql, _, err := newTable(tt.unquoted, tt.omitSchema).Query().Where(map[string]any{"name": "John"}).SQL()
+		require.NoError(t, err)
+		require.Equal(t, tt.sql, sql)
+	}
+
+	table := newTable(true, true)
+	record := table.NewRecord()
+	record.MustSet("id", 1)
+	record.MustSet("name", "John")
+
+	db := &recordingDB{}
+	err := record.Upsert(context.Background(), db, pgxrecord.ConflictTarget{Columns: []string{"id"}})
+	require.ErrorIs(t, err, errRecordingDB)
+	err = record.Save(context.Background(), db, pgxrecord.Returning("id"))
+	require.ErrorIs(t, err, errRecordingDB)
+	require.Equal(t, []string{
+		`insert into users (id, name) values ($1, $2) on conflict (id) do update set name = excluded.name returning id, name`,
+		`insert into users (id, name) values ($1, $2) returning id`,
+	}, db.sqls)
+
+	qualifiedTable := newTable(false, false)
+	for _, table := range []*pgxrecord.Table{table, qualifiedTable} {
+		record := table.NewRecord()
+		record.MustSet("id", 2)
+		_, err = table.InsertMany(context.Background(), db, []*pgxrecord.Record{record})
+		require.ErrorIs(t, err, errRecordingDB)
+	}
+	require.Equal(t, []pgx.Identifier{{"users"}, {"public", "users"}}, db.copyTables)
+
+	sql, _, err := table.WithSchema("tenant").Query().SQL()
+	require.NoError(t, err)
+	require.Equal(t, `select users.id, users.name from tenant.users`, sql)
+
+	sql, _, err = table.Query().
+		WithSQL("recent", "select user_id from public.orders").
+		Join("public.orders", "orders.user_id = users.id").
+		OrderBy("name", pgxrecord.Asc, pgxrecord.Collate("C")).
+		SQL()
+	require.NoError(t, err)
+	require.Equal(t, `with recent as (select user_id from public.orders) select users.id, users.name from users join public.orders on orders.user_id = users.id order by users.name collate C asc`, sql)
+}
+
+func TestQuerySelect(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int
+);
+insert into t (name, age) values ('John', 42);`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		records, err := table.Query().Select("name").All(ctx, conn)
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+
+		record := records[0]
+		require.Equal(t, map[string]any{"id": int32(1), "name": "John"}, record.Attributes())
+		_, err = record.Get("age")
+		require.ErrorContains(t, err, `attribute "age" is not loaded`)
+		require.False(t, record.IsDirty())
+
+		record.MustSet("age", nil)
+		require.True(t, record.IsDirty())
+		require.Nil(t, record.MustGet("age"))
+
+		record.MustSet("name", "Bill")
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(1), "name": "Bill", "age": nil}, record.Attributes())
+	})
+}
+
+func TestQuerySelectExpr(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int
+);
+insert into t (name, age) values ('John', 42);`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		records, err := table.Query().SelectExpr("double_age", "age * 2").All(ctx, conn)
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+
+		record := records[0]
+		require.Equal(t, int32(84), record.MustGet("double_age"))
+		require.Equal(t, map[string]any{"id": int32(1), "name": "John", "age": int32(42)}, record.Attributes())
+		require.False(t, record.IsDirty())
+		require.Error(t, record.Set("double_age", 1))
+
+		record.MustSet("name", "Bill")
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, "Bill", record.MustGet("name"))
+
+		records, err = table.Query().Select("name").SelectExpr("upper_name", "upper(name)").All(ctx, conn)
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+		require.Equal(t, map[string]any{"id": int32(1), "name": "Bill"}, records[0].Attributes())
+		require.Equal(t, "BILL", records[0].MustGet("upper_name"))
+
+		maps, err := table.Query().Select("name").SelectExpr("upper_name", "upper(name)").AllMaps(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, []map[string]any{{"id": int32(1), "name": "Bill", "upper_name": "BILL"}}, maps)
+	})
+}
+
+func TestQuerySelectExprSQL(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "name", OID: pgtype.TextOID, NotNull: true},
+			{Name: "age", OID: pgtype.Int4OID},
+		},
+	}
+	table.Finalize()
+
+	db := &recordingDB{}
+	_, err := table.Query().SelectExpr("double_age", "age * 2").All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+	_, err = table.Query().Select("name").SelectExpr("upper_name", "upper(name)").All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+	require.Equal(t, []string{
+		`select "t"."id", "t"."name", "t"."age", age * 2 as "double_age" from "t"`,
+		`select "t"."id", "t"."name", upper(name) as "upper_name" from "t"`,
+	}, db.sqls)
+
+	// A view has no primary key so selecting no columns leaves only the expressions.
+	view := &pgxrecord.Table{
+		Name: pgx.Identifier{"v"},
+		Columns: []*pgxrecord.Column{
+			{Name: "name", OID: pgtype.TextOID},
+		},
+		RelationKind: "view",
+	}
+	view.Finalize()
+
+	db = &recordingDB{}
+	_, err = view.Query().Select().SelectExpr("n", "count(*)").SelectExpr("m", "max(name)").All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+	require.Equal(t, []string{`select count(*) as "n", max(name) as "m" from "v"`}, db.sqls)
+
+	_, err = table.Query().SelectExpr("age", "age * 2").All(context.Background(), db)
+	require.ErrorContains(t, err, `select expression attribute "age" is a column`)
+	_, err = table.Query().SelectExpr("x", "1").SelectExpr("x", "2").All(context.Background(), db)
+	require.ErrorContains(t, err, `select expression attribute "x" is duplicated`)
+}
+
+func TestQuerySelectSaveKeepsUnloadedColumns(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int,
+	status text not null default 'new'
+);
+insert into t (name, age) values ('John', 42);`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		records, err := table.Query().Select("id", "name").All(ctx, conn)
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+
+		record := records[0]
+		record.MustSet("name", "Bill")
+		err = record.Save(ctx, conn, pgxrecord.Returning("id"))
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(1), "name": "Bill"}, record.Attributes())
+
+		var name string
+		var age int32
+		err = conn.QueryRow(ctx, "select name, age from t where id = 1").Scan(&name, &age)
+		require.NoError(t, err)
+		require.Equal(t, "Bill", name)
+		require.EqualValues(t, 42, age)
+
+		// The columns supplied by the database on insert are not loaded when they are not returned.
+		record = table.NewRecord()
+		record.MustSet("name", "Jane")
+		err = record.Save(ctx, conn, pgxrecord.Returning("id"))
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(2), "name": "Jane"}, record.Attributes())
+		_, err = record.Get("status")
+		require.ErrorContains(t, err, `attribute "status" is not loaded`)
+
+		record.MustSet("age", int32(30))
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(2), "name": "Jane", "age": int32(30), "status": "new"}, record.Attributes())
+	})
+}
+
+func TestQueryAllMaps(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int,
+	created_at timestamptz not null default '2022-01-02 03:04:05Z'
+);
+insert into t (name, age) values ('John', 42), ('Jane', null);`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		maps, err := table.Query().OrderBy("id", pgxrecord.Asc).AllMaps(ctx, conn)
+		require.NoError(t, err)
+		require.Len(t, maps, 2)
+		require.Equal(t, int32(1), maps[0]["id"])
+		require.Equal(t, "John", maps[0]["name"])
+		require.Equal(t, int32(42), maps[0]["age"])
+		require.True(t, time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC).Equal(maps[0]["created_at"].(time.Time)))
+		require.Nil(t, maps[1]["age"])
+
+		maps, err = table.Query().Select("name").Where(map[string]any{"name": "Jane"}).AllMaps(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, []map[string]any{{"id": int32(2), "name": "Jane"}}, maps)
+	})
+}
+
+func TestQueryJoin(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table customers (
+	id int primary key,
+	region text not null
+);
+create temporary table orders (
+	id int primary key,
+	customer_id int references customers
+);
+insert into customers (id, region) values (1, 'EU'), (2, 'US');
+insert into orders (id, customer_id) values (1, 1), (2, 2), (3, 1), (4, null);`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"orders"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		records, err := table.Query().
+			Join("customers", "orders.customer_id = customers.id and customers.region = 'EU'").
+			Where(map[string]any{"customer_id": 1}).
+			OrderBy("id", pgxrecord.Asc).
+			All(ctx, conn)
+		require.NoError(t, err)
+		require.Len(t, records, 2)
+		require.Equal(t, map[string]any{"id": int32(1), "customer_id": int32(1)}, records[0].Attributes())
+		require.Equal(t, map[string]any{"id": int32(3), "customer_id": int32(1)}, records[1].Attributes())
+
+		records, err = table.Query().
+			LeftJoin("customers", "orders.customer_id = customers.id").
+			OrderBy("id", pgxrecord.Desc).
+			All(ctx, conn)
+		require.NoError(t, err)
+		require.Len(t, records, 4)
+		require.Equal(t, map[string]any{"id": int32(4), "customer_id": nil}, records[0].Attributes())
+	})
+}
+
+func TestQueryAggregateSQL(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "status", OID: pgtype.TextOID, NotNull: true},
+			{Name: "amount", OID: pgtype.NumericOID},
+		},
+	}
+	table.Finalize()
+
+	db := &recordingDB{}
+	_, err := table.Query().Where(map[string]any{"status": "paid"}).Sum(context.Background(), db, "amount")
+	require.ErrorIs(t, err, errRecordingDB)
+
+	_, err = table.Query().Where(map[string]any{"status": "paid"}).GroupBy("status").Count(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+
+	_, err = table.Query().WhereSQL("amount > $1", 10).GroupBy("status").Having("count(*) > $1", 100).Having("sum(amount) < $1", 1000).Count(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+	require.Equal(t, []any{10, 100, 1000}, db.args[len(db.args)-1])
+
+	_, err = table.Query().Max(context.Background(), db, "amount")
+	require.ErrorIs(t, err, errRecordingDB)
+
+	_, err = table.Query().Max(context.Background(), db, "missing")
+	require.ErrorContains(t, err, `max column "missing" is not found`)
+
+	_, err = table.Query().GroupBy("missing").Count(context.Background(), db)
+	require.ErrorContains(t, err, `group by column "missing" is not found`)
+
+	require.Equal(t, []string{
+		`select sum("t"."amount")::float8 from "t" where "t"."status" = $1`,
+		`select "t"."status", count(*) from "t" where "t"."status" = $1 group by "t"."status"`,
+		`select "t"."status", count(*) from "t" where (amount > $1) group by "t"."status" having (count(*) > $2) and (sum(amount) < $3)`,
+		`select max("t"."amount") from "t"`,
+	}, db.sqls)
+}
+
+func TestQueryAggregates(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	status text,
+	amount numeric not null,
+	big bigint not null default 9007199254740993,
+	paid_at timestamptz
+);
+insert into t (status, amount, paid_at) values ('paid', 10, '2022-01-02 00:00:00Z'), ('paid', 20.5, '2022-01-03 00:00:00Z'), ('open', 4, null), (null, 1, null);`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		paid := map[string]any{"status": "paid"}
+
+		sum, err := table.Query().Where(paid).Sum(ctx, conn, "amount")
+		require.NoError(t, err)
+		require.Equal(t, 30.5, sum)
+
+		avg, err := table.Query().Where(paid).Avg(ctx, conn, "amount")
+		require.NoError(t, err)
+		require.Equal(t, 15.25, avg)
+
+		maxAmount, err := table.Query().Max(ctx, conn, "amount")
+		require.NoError(t, err)
+		require.IsType(t, pgtype.Numeric{}, maxAmount)
+		maxFloat, err := maxAmount.(pgtype.Numeric).Float64Value()
+		require.NoError(t, err)
+		require.Equal(t, 20.5, maxFloat.Float64)
+
+		minID, err := table.Query().Min(ctx, conn, "id")
+		require.NoError(t, err)
+		require.Equal(t, int32(1), minID)
+
+		// A bigint above 2^53 cannot be represented exactly by a float64.
+		maxBig, err := table.Query().Max(ctx, conn, "big")
+		require.NoError(t, err)
+		require.Equal(t, int64(9007199254740993), maxBig)
+
+		maxStatus, err := table.Query().Max(ctx, conn, "status")
+		require.NoError(t, err)
+		require.Equal(t, "paid", maxStatus)
+
+		maxPaidAt, err := table.Query().Max(ctx, conn, "paid_at")
+		require.NoError(t, err)
+		require.True(t, time.Date(2022, 1, 3, 0, 0, 0, 0, time.UTC).Equal(maxPaidAt.(time.Time)))
+
+		minPaidAt, err := table.Query().Where(map[string]any{"status": "void"}).Min(ctx, conn, "paid_at")
+		require.NoError(t, err)
+		require.Nil(t, minPaidAt)
+
+		sum, err = table.Query().Where(map[string]any{"status": "void"}).Sum(ctx, conn, "amount")
+		require.NoError(t, err)
+		require.Equal(t, 0.0, sum)
+
+		counts, err := table.Query().GroupBy("status").Count(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, map[any]int64{"paid": 2, "open": 1, nil: 1}, counts)
+	})
+}
+
+func TestRecordSetAndGet(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		record := table.NewRecord()
+
+		err = record.Set("name", "John")
+		require.NoError(t, err)
+
+		name, err := record.Get("name")
+		require.NoError(t, err)
+		require.Equal(t, "John", name)
+	})
+}
+
+func TestRecordTypedGetters(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int8OID, NotNull: true, PrimaryKey: true},
+			{Name: "name", OID: pgtype.TextOID},
+			{Name: "active", OID: pgtype.BoolOID},
+			{Name: "age", OID: pgtype.Int4OID},
+			{Name: "born_on", OID: pgtype.DateOID},
+			{Name: "mood", OID: 99999},
+		},
+	}
+	table.Finalize()
+
+	bornOn := time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC)
+	record := table.NewRecord()
+	record.SetAttributes(map[string]any{"id": int64(1), "name": "John", "active": true, "age": 42, "born_on": bornOn, "mood": "happy"})
+
+	active, ok, err := record.GetBool("active")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.True(t, active)
+
+	age, ok := record.MustGetInt64("age")
+	require.True(t, ok)
+	require.EqualValues(t, 42, age)
+
+	name, ok := record.MustGetString("name")
+	require.True(t, ok)
+	require.Equal(t, "John", name)
+
+	mood, ok := record.MustGetString("mood")
+	require.True(t, ok)
+	require.Equal(t, "happy", mood)
+
+	born, ok := record.MustGetTime("born_on")
+	require.True(t, ok)
+	require.Equal(t, bornOn, born)
+
+	record.MustSet("active", nil)
+	active, ok = record.MustGetBool("active")
+	require.False(t, ok)
+	require.False(t, active)
+
+	_, ok, err = table.NewRecord().GetString("name")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	_, _, err = record.GetInt64("name")
+	require.ErrorContains(t, err, `GetInt64: attribute "name" is a text column, not integer`)
+	_, _, err = record.GetTime("missing")
+	require.ErrorContains(t, err, `attribute "missing" is not found`)
+
+	record.MustSet("age", "42")
+	_, _, err = record.GetInt64("age")
+	require.ErrorContains(t, err, `attribute "age" has a string value, not int64`)
+	require.PanicsWithValue(t, `pgxrecord.Record ("t"): GetInt64: attribute "age" has a string value, not int64`, func() {
+		record.MustGetInt64("age")
+	})
+}
+
+func TestRecordSetReader(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	data bytea
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		blob := make([]byte, 5*1024*1024)
+		for i := range blob {
+			blob[i] = byte(i)
+		}
+
+		record := table.NewRecord()
+		err = record.Set("data", bytes.NewReader(blob))
+		require.NoError(t, err)
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+
+		record, err = table.FindByPK(ctx, conn, record.MustGet("id"))
+		require.NoError(t, err)
+
+		r, err := record.GetReader("data")
+		require.NoError(t, err)
+		buf, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.Equal(t, blob, buf)
+
+		_, err = record.GetReader("id")
+		require.Error(t, err)
+	})
+}
+
+func TestRecordValues(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "name", OID: pgtype.TextOID, NotNull: true},
+			{Name: "age", OID: pgtype.Int4OID},
+			{Name: "active", OID: pgtype.BoolOID, NotNull: true},
+			{Name: "born", OID: pgtype.DateOID},
+		},
+	}
+	table.Finalize()
+
+	record := table.NewRecord()
+	err := record.FromValues(url.Values{
+		"name":   {"John"},
+		"age":    {"42"},
+		"active": {"t"},
+		"born":   {"2000-01-02"},
+		"other":  {"ignored"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{
+		"id":     nil,
+		"name":   "John",
+		"age":    int32(42),
+		"active": true,
+		"born":   time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC),
+	}, record.Attributes())
+
+	values := record.ToValues()
+	require.Equal(t, url.Values{
+		"id":     {""},
+		"name":   {"John"},
+		"age":    {"42"},
+		"active": {"t"},
+		"born":   {"2000-01-02"},
+	}, values)
+
+	// id is not null so its empty string would not be parsed as NULL.
+	values.Del("id")
+	roundTripped := table.NewRecord()
+	err = roundTripped.FromValues(values)
+	require.NoError(t, err)
+	require.Equal(t, record.Attributes(), roundTripped.Attributes())
+
+	err = record.FromValues(url.Values{
+		"age":    {""},
+		"active": {"maybe"},
+		"born":   {"not a date"},
+	})
+	var validationErr *pgxrecord.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	byField := validationErr.ByField()
+	require.Len(t, byField, 2)
+	require.Contains(t, byField, "active")
+	require.Contains(t, byField, "born")
+	require.Nil(t, record.MustGet("age"))
+	require.Equal(t, true, record.MustGet("active"))
+}
+
+func TestRecordJSON(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "name", OID: pgtype.TextOID, NotNull: true},
+			{Name: "age", OID: pgtype.Int4OID},
+			{Name: "score", OID: pgtype.Float8OID},
+			{Name: "active", OID: pgtype.BoolOID, NotNull: true},
+			{Name: "born", OID: pgtype.DateOID},
+			{Name: "data", OID: pgtype.JSONBOID},
+			{Name: "external_id", OID: pgtype.UUIDOID},
+		},
+	}
+	table.Finalize()
+
+	record := table.NewRecord()
+	record.SetAttributes(map[string]any{
+		"id":          int32(1),
+		"name":        "John",
+		"age":         nil,
+		"score":       1.5,
+		"active":      true,
+		"born":        time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC),
+		"data":        map[string]any{"tags": []any{"a", "b"}},
+		"external_id": [16]byte{0x1a, 0x2b, 0x3c, 0x4d, 0x5e, 0x6f, 0x70, 0x81, 0x92, 0xa3, 0xb4, 0xc5, 0xd6, 0xe7, 0xf8, 0x09},
+	})
+
+	buf, err := json.Marshal(record)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"id": 1,
+		"name": "John",
+		"age": null,
+		"score": 1.5,
+		"active": true,
+		"born": "2000-01-02T00:00:00Z",
+		"data": {"tags": ["a", "b"]},
+		"external_id": "1a2b3c4d-5e6f-7081-92a3-b4c5d6e7f809"
+	}`, string(buf))
+
+	roundTripped := table.NewRecord()
+	err = json.Unmarshal(buf, roundTripped)
+	require.NoError(t, err)
+	require.Equal(t, record.Attributes(), roundTripped.Attributes())
+
+	err = json.Unmarshal([]byte(`{"name": "Bill", "unknown": 1}`), roundTripped)
+	require.NoError(t, err)
+	require.Equal(t, "Bill", roundTripped.MustGet("name"))
+
+	err = json.Unmarshal([]byte(`{"age": "old"}`), roundTripped)
+	require.ErrorContains(t, err, `attribute "age"`)
+
+	strictTable := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "name", OID: pgtype.TextOID, NotNull: true},
+		},
+		DisallowUnknownJSONFields: true,
+	}
+	strictTable.Finalize()
+
+	err = json.Unmarshal([]byte(`{"name": "Bill", "unknown": 1}`), strictTable.NewRecord())
+	require.ErrorContains(t, err, `unknown field "unknown"`)
+}
+
+func TestRecordJSONColumns(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	metadata jsonb
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		type Metadata struct {
+			Color string `json:"color"`
+			Size  int    `json:"size"`
+		}
+
+		record := table.NewRecord()
+		record.MustSet("name", "John")
+		err = record.SetJSON("metadata", Metadata{Color: "red", Size: 3})
+		require.NoError(t, err)
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+
+		record, err = table.FindByPK(ctx, conn, record.MustGet("id"))
+		require.NoError(t, err)
+
+		var metadata Metadata
+		err = record.GetJSON("metadata", &metadata)
+		require.NoError(t, err)
+		require.Equal(t, Metadata{Color: "red", Size: 3}, metadata)
+
+		err = record.SetJSON("metadata", Metadata{Color: "red", Size: 3})
+		require.NoError(t, err)
+		require.False(t, record.IsDirty())
+
+		err = record.SetJSON("metadata", nil)
+		require.NoError(t, err)
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		require.Nil(t, record.MustGet("metadata"))
+
+		metadataPtr := &Metadata{}
+		err = record.GetJSON("metadata", &metadataPtr)
+		require.NoError(t, err)
+		require.Nil(t, metadataPtr)
+
+		err = record.SetJSON("name", "John")
+		require.ErrorContains(t, err, "is not json or jsonb")
+
+		err = record.GetJSON("name", &metadata)
+		require.ErrorContains(t, err, "is not json or jsonb")
+	})
+}
+
+func TestRecordSetAttributesPermitted(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "name", OID: pgtype.TextOID},
+			{Name: "age", OID: pgtype.Int4OID},
+			{Name: "is_admin", OID: pgtype.BoolOID},
+		},
+	}
+	table.PermitAttributes("name", "age", "missing")
+	table.Finalize()
+
+	record := table.NewRecord()
+	err := record.SetAttributesPermitted(map[string]any{
+		"id":       int32(1),
+		"name":     "John",
+		"age":      int32(42),
+		"is_admin": true,
+		"missing":  "ignored",
+		"unknown":  "ignored",
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"id": nil, "name": "John", "age": int32(42), "is_admin": nil}, record.Attributes())
+
+	unrestricted := &pgxrecord.Table{Name: pgx.Identifier{"t"}, Columns: table.Columns}
+	unrestricted.Finalize()
+	record = unrestricted.NewRecord()
+	err = record.SetAttributesPermitted(map[string]any{"name": "John"})
+	require.NoError(t, err)
+	require.Nil(t, record.MustGet("name"))
+}
+
+func TestRecordUnsetAndIsSet(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true, HasDefault: true},
+			{Name: "name", OID: pgtype.TextOID},
+			{Name: "age", OID: pgtype.Int4OID, HasDefault: true},
+		},
+	}
+	table.Finalize()
+
+	record := table.NewRecord()
+	require.False(t, record.IsSet("name"))
+	record.MustSet("name", nil)
+	record.MustSet("age", 42)
+	require.True(t, record.IsSet("name"))
+	require.True(t, record.IsSet("age"))
+	require.False(t, record.IsSet("missing"))
+
+	err := record.Unset("age")
+	require.NoError(t, err)
+	require.False(t, record.IsSet("age"))
+	require.Nil(t, record.MustGet("age"))
+
+	err = record.Unset("missing")
+	require.ErrorContains(t, err, `attribute "missing" is not found`)
+
+	db := &recordingDB{}
+	err = record.Save(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+	require.Equal(t, []string{`insert into "t" ("name") values ($1) returning "id", "name", "age"`}, db.sqls)
+}
+
+func TestRecordValidate(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true, HasDefault: true},
+			{Name: "code", OID: pgtype.VarcharOID, NotNull: true, MaxLength: 3},
+			{Name: "age", OID: pgtype.Int4OID},
+			{Name: "price", OID: pgtype.NumericOID, Precision: 5, Scale: 2},
+			{Name: "mood", OID: 100000, EnumLabels: []string{"happy", "sad"}},
+			{Name: "name", OID: pgtype.TextOID, NotNull: true},
+		},
+	}
+	table.Finalize()
+
+	record := table.NewRecord()
+	record.MustSet("code", "ab  ")
+	record.MustSet("age", "forty")
+	record.MustSet("price", "1000.5")
+	record.MustSet("mood", "angry")
+	err := record.Validate()
+	var validationErr *pgxrecord.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	require.Equal(t, map[string][]string{
+		"name":  {"must be set"},
+		"age":   {`is invalid: strconv.ParseInt: parsing "forty": invalid syntax`},
+		"price": {"is invalid: is out of range for numeric(5,2)"},
+		"mood":  {"is invalid: must be one of happy, sad"},
+	}, validationErr.ByField())
+
+	record.MustSet("code", "日本語語")
+	record.MustSet("age", int32(40))
+	record.MustSet("price", pgtype.Numeric{Int: big.NewInt(99999), Exp: -2, Valid: true})
+	record.MustSet("mood", "happy")
+	record.MustSet("name", nil)
+	err = record.Validate()
+	require.ErrorAs(t, err, &validationErr)
+	require.Equal(t, map[string][]string{
+		"code": {"is invalid: is too long (maximum is 3 characters)"},
+		"name": {"can't be null"},
+	}, validationErr.ByField())
+
+	record.MustSet("code", "日本語")
+	record.MustSet("price", 999.994)
+	record.MustSet("name", "John")
+	require.NoError(t, record.Validate())
+
+	record.MustSet("price", 1000)
+	err = record.Validate()
+	require.ErrorAs(t, err, &validationErr)
+	require.Equal(t, map[string][]string{"price": {"is invalid: is out of range for numeric(5,2)"}}, validationErr.ByField())
+}
+
+func TestRecordSetCoerceStrings(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "name", OID: pgtype.TextOID},
+			{Name: "count", OID: pgtype.Int8OID},
+			{Name: "score", OID: pgtype.Float8OID},
+			{Name: "price", OID: pgtype.NumericOID},
+			{Name: "active", OID: pgtype.BoolOID},
+			{Name: "birthday", OID: pgtype.DateOID},
+			{Name: "created_at", OID: pgtype.TimestamptzOID},
+			{Name: "duration", OID: pgtype.IntervalOID},
+		},
+		CoerceStrings: true,
+	}
+	table.Finalize()
+
+	record := table.NewRecord()
+	require.NoError(t, record.SetAttributes(map[string]any{
+		"id":         "42",
+		"name":       "42",
+		"count":      " 7 ",
+		"score":      "1.5",
+		"price":      "12.34",
+		"active":     "true",
+		"birthday":   "2000-01-02",
+		"created_at": "2022-01-02T03:04:05Z",
+		"duration":   "1 day 02:00:00",
+	}))
+	require.Equal(t, int32(42), record.MustGet("id"))
+	require.Equal(t, "42", record.MustGet("name"))
+	require.Equal(t, int64(7), record.MustGet("count"))
+	require.Equal(t, 1.5, record.MustGet("score"))
+	require.IsType(t, pgtype.Numeric{}, record.MustGet("price"))
+	require.Equal(t, true, record.MustGet("active"))
+	require.Equal(t, time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC), record.MustGet("birthday"))
+	require.True(t, time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC).Equal(record.MustGet("created_at").(time.Time)))
+	require.Equal(t, pgtype.Interval{Days: 1, Microseconds: 2 * 60 * 60 * 1000000, Valid: true}, record.MustGet("duration"))
+
+	require.NoError(t, record.Set("created_at", "2022-01-02 03:04:05+00"))
+	require.True(t, time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC).Equal(record.MustGet("created_at").(time.Time)))
+
+	require.NoError(t, record.Set("id", 1))
+	require.Equal(t, 1, record.MustGet("id"))
+
+	err := record.Set("id", "abc")
+	require.ErrorContains(t, err, `"id"`)
+	require.ErrorContains(t, err, `invalid integer "abc"`)
+	require.Error(t, record.Set("active", "maybe"))
+	require.Error(t, record.Set("created_at", "yesterday"))
+}
+
+func TestRecordTypeRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	price numeric,
+	duration interval,
+	birthday date,
+	created_at timestamptz
+);`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		price := pgtype.Numeric{Int: big.NewInt(123456789012345), Exp: -4, Valid: true}
+		duration := pgtype.Interval{Months: 14, Days: 3, Microseconds: 4*60*60*1000000 + 5, Valid: true}
+		birthday := time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC)
+		createdAt := time.Date(2022, 1, 2, 3, 4, 5, 678901000, time.Local)
+
+		record := table.NewRecord()
+		record.MustSet("price", price)
+		record.MustSet("duration", duration)
+		record.MustSet("birthday", birthday)
+		record.MustSet("created_at", createdAt)
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+
+		check := func(record *pgxrecord.Record) {
+			// A numeric may be read with a different but equal Int and Exp so compare the text representation.
+			require.IsType(t, pgtype.Numeric{}, record.MustGet("price"))
+			expectedPrice, err := price.Value()
+			require.NoError(t, err)
+			actualPrice, err := record.MustGet("price").(pgtype.Numeric).Value()
+			require.NoError(t, err)
+			require.Equal(t, expectedPrice, actualPrice)
+
+			require.Equal(t, duration, record.MustGet("duration"))
+			require.Equal(t, birthday, record.MustGet("birthday"))
+
+			require.IsType(t, time.Time{}, record.MustGet("created_at"))
+			require.True(t, createdAt.Equal(record.MustGet("created_at").(time.Time)))
+			require.Equal(t, time.Local, record.MustGet("created_at").(time.Time).Location())
+		}
+		check(record)
+
+		found, err := table.FindByPK(ctx, conn, record.MustGet("id"))
+		require.NoError(t, err)
+		check(found)
+
+		// Saving the read values again does not change them.
+		found.MustSet("price", found.MustGet("price"))
+		err = found.Save(ctx, conn)
+		require.NoError(t, err)
+		check(found)
+	})
+}
+
+func TestRecordDiffAndEqual(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "name", OID: pgtype.TextOID},
+			{Name: "age", OID: pgtype.Int4OID},
+			{Name: "created_at", OID: pgtype.TimestamptzOID},
+		},
+	}
+	table.Finalize()
+
+	createdAt := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	before := table.NewRecord()
+	require.NoError(t, before.SetAttributes(map[string]any{"id": int32(1), "name": "John", "age": int32(40), "created_at": createdAt}))
+
+	after := table.NewRecord()
+	require.NoError(t, after.SetAttributes(map[string]any{"id": 1, "name": "Johnny", "age": nil, "created_at": createdAt.In(time.FixedZone("", 3600))}))
+
+	require.Equal(t, map[string][2]any{
+		"name": {"John", "Johnny"},
+		"age":  {int32(40), nil},
+	}, before.Diff(after))
+	require.False(t, before.Equal(after))
+
+	after.MustSet("name", "John")
+	after.MustSet("age", int64(40))
+	require.Empty(t, before.Diff(after))
+	require.True(t, before.Equal(after))
+
+	other := &pgxrecord.Table{Name: pgx.Identifier{"t"}, Columns: table.Columns}
+	other.Finalize()
+	require.False(t, before.Equal(other.NewRecord()))
+}
+
+func TestRecordSetValidateTypes(t *testing.T) {
+	t.Parallel()
+
+	columns := []*pgxrecord.Column{
+		{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+		{Name: "name", OID: pgtype.TextOID},
+		{Name: "active", OID: pgtype.BoolOID},
+		{Name: "mood", OID: 100000},
+	}
+
+	permissive := &pgxrecord.Table{Name: pgx.Identifier{"t"}, Columns: columns}
+	permissive.Finalize()
+	record := permissive.NewRecord()
+	require.NoError(t, record.Set("id", "not-a-number"))
+
+	strict := &pgxrecord.Table{Name: pgx.Identifier{"t"}, Columns: columns, ValidateTypes: true}
+	strict.Finalize()
+	record = strict.NewRecord()
+
+	for _, tt := range []struct {
+		attribute string
+		value     any
+	}{
+		{"id", int32(1)},
+		{"id", 1},
+		{"id", int64(1)},
+		{"id", "42"},
+		{"id", nil},
+		{"name", "John"},
+		{"active", true},
+		{"active", "t"},
+		{"active", "yes"},
+		{"mood", 1},
+	} {
+		require.NoErrorf(t, record.Set(tt.attribute, tt.value), "%s: %v", tt.attribute, tt.value)
+	}
+
+	for _, tt := range []struct {
+		attribute string
+		value     any
+	}{
+		{"id", "not-a-number"},
+		{"id", int64(1) << 40},
+		{"name", 5},
+		{"active", "maybe"},
+		{"active", 1},
+	} {
+		require.Errorf(t, record.Set(tt.attribute, tt.value), "%s: %v", tt.attribute, tt.value)
+	}
+
+	err := record.Set("id", "not-a-number")
+	require.ErrorContains(t, err, "invalid value of type string")
+}
+
+func TestRecordCompositeValues(t *testing.T) {
+	t.Parallel()
+
+	type Address struct {
+		Street string
+		Zip    int32
+	}
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "address", OID: 100000, TypeName: "address", CompositeFields: []pgxrecord.CompositeField{
+				{Name: "street", OID: pgtype.TextOID},
+				{Name: "zip", OID: pgtype.Int4OID},
+			}},
+			{Name: "addresses", OID: 100001, TypeName: "address[]", ElementOID: 100000, CompositeFields: []pgxrecord.CompositeField{
+				{Name: "street", OID: pgtype.TextOID},
+				{Name: "zip", OID: pgtype.Int4OID},
+			}},
+			{Name: "name", OID: pgtype.TextOID},
+		},
+	}
+	table.Finalize()
+
+	record := table.NewRecord()
+	err := record.SetComposite("address", Address{Street: "1 Main St, Apt 2", Zip: 12345})
+	require.NoError(t, err)
+	require.Equal(t, `("1 Main St, Apt 2",12345)`, record.MustGet("address"))
+
+	var address Address
+	err = record.GetComposite("address", &address)
+	require.NoError(t, err)
+	require.Equal(t, Address{Street: "1 Main St, Apt 2", Zip: 12345}, address)
+
+	err = record.SetComposite("address", nil)
+	require.NoError(t, err)
+	require.Nil(t, record.MustGet("address"))
+
+	var ptr *Address
+	err = record.GetComposite("address", &ptr)
+	require.NoError(t, err)
+	require.Nil(t, ptr)
+
+	err = record.SetComposite("addresses", []Address{{Street: "1 Main St, Apt 2", Zip: 12345}, {Street: "2 Elm St", Zip: 54321}})
+	require.NoError(t, err)
+	require.Equal(t, `{"(\"1 Main St, Apt 2\",12345)","(2 Elm St,54321)"}`, record.MustGet("addresses"))
+
+	var addresses []Address
+	err = record.GetComposite("addresses", &addresses)
+	require.NoError(t, err)
+	require.Equal(t, []Address{{Street: "1 Main St, Apt 2", Zip: 12345}, {Street: "2 Elm St", Zip: 54321}}, addresses)
+
+	err = record.SetComposite("name", Address{})
+	require.ErrorContains(t, err, `attribute "name" is not a composite type`)
+}
+
+func TestRecordCompositeColumns(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create type pg_temp.address as (street text, zip int4);
+create temporary table t (
+	id int primary key generated by default as identity,
+	address pg_temp.address,
+	addresses pg_temp.address[],
+	name text
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		require.Nil(t, table.Columns[0].CompositeFields)
+		require.Equal(t, []pgxrecord.CompositeField{{Name: "street", OID: pgtype.TextOID}, {Name: "zip", OID: pgtype.Int4OID}}, table.Columns[1].CompositeFields)
+		require.Equal(t, table.Columns[1].OID, table.Columns[2].ElementOID)
+		require.Equal(t, table.Columns[1].CompositeFields, table.Columns[2].CompositeFields)
+
+		type Address struct {
+			Street string
+			Zip    int32
+		}
+
+		record := table.NewRecord()
+		err = record.SetComposite("address", Address{Street: "1 Main St", Zip: 12345})
+		require.NoError(t, err)
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+
+		record, err = table.FindByPK(ctx, conn, record.MustGet("id"))
+		require.NoError(t, err)
+
+		var address Address
+		err = record.GetComposite("address", &address)
+		require.NoError(t, err)
+		require.Equal(t, Address{Street: "1 Main St", Zip: 12345}, address)
+
+		addresses := []Address{{Street: "1 Main St, Apt 2", Zip: 12345}, {Street: "2 Elm St", Zip: 54321}}
+		err = record.SetComposite("addresses", addresses)
+		require.NoError(t, err)
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+
+		record, err = table.FindByPK(ctx, conn, record.MustGet("id"))
+		require.NoError(t, err)
+		require.IsType(t, "", record.Attributes()["addresses"])
+
+		var readAddresses []Address
+		err = record.GetComposite("addresses", &readAddresses)
+		require.NoError(t, err)
+		require.Equal(t, addresses, readAddresses)
+
+		// A value that was read can be saved back unchanged.
+		record.MustSet("addresses", record.MustGet("addresses"))
+		record.MustSet("name", "home")
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+
+		readAddresses = nil
+		err = record.GetComposite("addresses", &readAddresses)
+		require.NoError(t, err)
+		require.Equal(t, addresses, readAddresses)
+	})
+}
+
+func TestRecordEnumColumns(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create type pg_temp.pgxrecord_mood as enum ('sad', 'ok', 'happy');
+create temporary table t (
+	id int primary key generated by default as identity,
+	mood pg_temp.pgxrecord_mood
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name:          pgx.Identifier{"t"},
+			ValidateEnums: true,
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		require.Nil(t, table.Columns[0].EnumLabels)
+		require.Equal(t, []string{"sad", "ok", "happy"}, table.Columns[1].EnumLabels)
+
+		record := table.NewRecord()
+		err = record.Set("mood", "angry")
+		require.EqualError(t, err, `pgxrecord.Record ("t"): Set: attribute "mood": invalid enum value "angry": must be one of sad, ok, happy`)
+
+		err = record.Set("mood", "happy")
+		require.NoError(t, err)
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, "happy", record.MustGet("mood"))
+	})
+}
+
+func TestRecordSaveInsert(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		record := table.NewRecord()
+		record.SetAttributes(map[string]any{"name": "John", "age": 42})
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+
+		require.Equal(t, map[string]any{"id": int32(1), "name": "John", "age": int32(42)}, record.Attributes())
+	})
+}
+
+func TestRecordClone(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	data jsonb,
+	version int not null default 1
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name:          pgx.Identifier{"t"},
+			VersionColumn: "version",
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		record := table.NewRecord()
+		record.SetAttributes(map[string]any{"name": "John", "data": map[string]any{"color": "red"}})
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+
+		clone := record.Clone()
+		require.Equal(t, map[string]any{"name": "John", "data": map[string]any{"color": "red"}}, clone.ChangedAttributes())
+		clone.MustGet("data").(map[string]any)["color"] = "blue"
+		require.Equal(t, map[string]any{"color": "red"}, record.MustGet("data"))
+
+		err = clone.Save(ctx, conn)
+		require.NoError(t, err)
+
+		require.Equal(t, map[string]any{"id": int32(2), "name": "John", "data": map[string]any{"color": "blue"}, "version": int32(1)}, clone.Attributes())
+		require.Equal(t, map[string]any{"id": int32(1), "name": "John", "data": map[string]any{"color": "red"}, "version": int32(1)}, record.Attributes())
+	})
+}
+
+func TestRecordSnapshotRollback(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		record := table.NewRecord()
+		err = record.Rollback()
+		require.ErrorContains(t, err, "record does not have a snapshot")
+
+		record.SetAttributes(map[string]any{"name": "John", "age": 42})
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+
+		record.Snapshot()
+		record.MustSet("name", "Jane")
+		record.MustSet("age", 30)
+		require.True(t, record.IsDirty())
+
+		err = record.Rollback()
+		require.NoError(t, err)
+		require.False(t, record.IsDirty())
+		require.Equal(t, map[string]any{"id": int32(1), "name": "John", "age": int32(42)}, record.Attributes())
+
+		record.MustSet("name", "Jane")
+		record.Snapshot()
+		record.MustSet("name", "Bob")
+		err = record.Rollback()
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"name": "Jane"}, record.ChangedAttributes())
+
+		// A Save between Snapshot and Rollback leaves the rolled back values to be saved again.
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		record.Snapshot()
+		record.MustSet("age", 50)
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		err = record.Rollback()
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"age": int32(42)}, record.ChangedAttributes())
+
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		var age int32
+		err = conn.QueryRow(ctx, `select age from t where id = $1`, record.MustGet("id")).Scan(&age)
+		require.NoError(t, err)
+		require.EqualValues(t, 42, age)
+	})
+}
+
+func TestSnakeCase(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		s        string
+		expected string
+	}{
+		{"Name", "name"},
+		{"FirstName", "first_name"},
+		{"ID", "id"},
+		{"UserID", "user_id"},
+		{"HTTPServer", "http_server"},
+		{"Address2", "address2"},
+		{"Address2Line", "address2_line"},
+	} {
+		require.Equal(t, tt.expected, pgxrecord.Private_snakeCase(tt.s), tt.s)
+	}
+}
+
+func TestInsertStructZeroValues(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id serial primary key,
+	active boolean not null default true,
+	score int not null default 10,
+	nickname text default 'none',
+	created_at timestamptz not null default now()
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		type Account struct {
+			ID        int32
+			Active    bool
+			Score     int32
+			Nickname  *string
+			CreatedAt time.Time
+		}
+
+		account := Account{}
+		err = pgxrecord.InsertStruct(ctx, conn, table, &account)
+		require.NoError(t, err)
+		require.EqualValues(t, 1, account.ID)
+		require.False(t, account.Active)
+		require.EqualValues(t, 0, account.Score)
+		require.Equal(t, "none", *account.Nickname)
+		require.False(t, account.CreatedAt.IsZero())
+
+		var active bool
+		var score int32
+		err = conn.QueryRow(ctx, `select active, score from t where id = $1`, account.ID).Scan(&active, &score)
+		require.NoError(t, err)
+		require.False(t, active)
+		require.EqualValues(t, 0, score)
+	})
+}
+
+func TestInsertStructAndSelectStruct(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	first_name text not null,
+	age int,
+	created_at timestamptz not null default now()
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		type Timestamps struct {
+			CreatedAt time.Time
+		}
+		type Person struct {
+			ID        int64
+			FirstName string
+			Years     *int `db:"age"`
+			Nickname  string
+			Ignored   string `db:"-"`
+			Timestamps
+		}
+
+		age := 42
+		person := Person{FirstName: "John", Years: &age, Nickname: "Johnny"}
+		err = pgxrecord.InsertStruct(ctx, conn, table, &person)
+		require.NoError(t, err)
+		require.EqualValues(t, 1, person.ID)
+		require.Equal(t, 42, *person.Years)
+		require.False(t, person.CreatedAt.IsZero())
+		require.Equal(t, "Johnny", person.Nickname)
+
+		err = pgxrecord.InsertStruct(ctx, conn, table, &Person{FirstName: "Jane"})
+		require.NoError(t, err)
+
+		err = pgxrecord.InsertStruct(ctx, conn, table, &Person{FirstName: "Bill"}, pgxrecord.DisallowUnknownFields())
+		require.ErrorContains(t, err, `struct field "Nickname" does not map to a column`)
+
+		people, err := pgxrecord.SelectStruct[Person](ctx, conn, table, map[string]any{"first_name": "John"})
+		require.NoError(t, err)
+		require.Len(t, people, 1)
+		require.EqualValues(t, 1, people[0].ID)
+		require.Equal(t, "John", people[0].FirstName)
+		require.Equal(t, 42, *people[0].Years)
+		require.True(t, person.CreatedAt.Equal(people[0].CreatedAt))
+
+		people, err = pgxrecord.SelectStruct[Person](ctx, conn, table, map[string]any{"first_name": "Jane"})
+		require.NoError(t, err)
+		require.Len(t, people, 1)
+		require.Nil(t, people[0].Years)
+
+		type Name struct {
+			FirstName string
+		}
+		names, err := pgxrecord.SelectStruct[Name](ctx, conn, table, nil)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []Name{{"John"}, {"Jane"}}, names)
+	})
+}
+
+func TestQueryStruct(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	first_name text not null,
+	age int,
+	active bool not null
+);
+insert into t (first_name, age, active) values ('John', 42, true), ('Jane', 35, true), ('Bob', 20, false);`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.DefineScope("active", func(q *pgxrecord.Query) *pgxrecord.Query {
+			return q.Where(map[string]any{"active": true})
+		})
+		table.Finalize()
+
+		type Person struct {
+			FirstName string
+			Age       int
+		}
+
+		people, err := pgxrecord.QueryStruct[Person](ctx, conn, table.Query().Scope("active").OrderBy("first_name", pgxrecord.Asc))
+		require.NoError(t, err)
+		require.Equal(t, []Person{{FirstName: "Jane", Age: 35}, {FirstName: "John", Age: 42}}, people)
+
+		people, err = pgxrecord.QueryStruct[Person](ctx, conn, table.Query().Select("first_name").Where(map[string]any{"active": false}))
+		require.NoError(t, err)
+		require.Equal(t, []Person{{FirstName: "Bob"}}, people)
+	})
+}
+
+func TestQueryStructErrors(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "name", OID: pgtype.TextOID, NotNull: true},
+		},
+	}
+	table.Finalize()
+
+	type Person struct {
+		Name     string
+		Nickname string
+	}
+
+	db := &recordingDB{}
+	_, err := pgxrecord.QueryStruct[Person](context.Background(), db, table.Query().Where(map[string]any{"name": "John"}))
+	require.ErrorIs(t, err, errRecordingDB)
+	require.ErrorContains(t, err, `pgxrecord.Query ("t"): QueryStruct:`)
+	require.Equal(t, []string{`select "t"."id", "t"."name" from "t" where "t"."name" = $1`}, db.sqls)
+
+	_, err = pgxrecord.QueryStruct[Person](context.Background(), db, table.Query(), pgxrecord.DisallowUnknownFields())
+	require.ErrorContains(t, err, `struct field "Nickname" does not map to a column`)
+
+	_, err = pgxrecord.QueryStruct[Person](context.Background(), db, table.Query().OrderBy("missing", pgxrecord.Asc))
+	require.ErrorContains(t, err, `order by column "missing" is not found`)
+	require.Len(t, db.sqls, 1)
+}
+
+func TestRowToStructByColumn(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	first_name text not null,
+	age int
+);
+insert into t (first_name, age) values ('John', 42);`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		type Person struct {
+			FirstName string
+			Years     int32 `db:"age"`
+		}
+
+		person, err := pgxrecord.SelectRow(ctx, conn, table.SelectQuery(), nil, pgxrecord.RowToStructByColumn[Person](table))
+		require.NoError(t, err)
+		require.Equal(t, Person{FirstName: "John", Years: 42}, person)
+
+		person, err = pgxrecord.SelectRow(ctx, conn, `select age, 'x' as other, first_name from t`, nil, pgxrecord.RowToStructByColumn[Person](table))
+		require.NoError(t, err)
+		require.Equal(t, Person{FirstName: "John", Years: 42}, person)
+
+		type Unknown struct {
+			Nickname string
+		}
+		_, err = pgxrecord.SelectRow(ctx, conn, table.SelectQuery(), nil, pgxrecord.RowToStructByColumn[Unknown](table, pgxrecord.DisallowUnknownFields()))
+		require.ErrorContains(t, err, `struct field "Nickname" does not map to a column`)
+	})
+}
+
+func TestRecordScanInto(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "first_name", OID: pgtype.TextOID, NotNull: true},
+			{Name: "age", OID: pgtype.Int4OID},
+			{Name: "created_at", OID: pgtype.TimestamptzOID},
+		},
+	}
+	table.Finalize()
+
+	createdAt := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	record := table.NewRecord()
+	record.MustSet("id", int32(1))
+	record.MustSet("first_name", "John")
+	record.MustSet("age", nil)
+	record.MustSet("created_at", createdAt)
+
+	type Person struct {
+		ID        int
+		FirstName string
+		Years     *int64 `db:"age"`
+		CreatedAt pgtype.Timestamptz
+		Nickname  string
+	}
+
+	person := Person{Nickname: "Johnny"}
+	err := record.ScanInto(&person)
+	require.NoError(t, err)
+	require.True(t, person.CreatedAt.Valid)
+	require.True(t, createdAt.Equal(person.CreatedAt.Time))
+	person.CreatedAt = pgtype.Timestamptz{}
+	require.Equal(t, Person{ID: 1, FirstName: "John", Nickname: "Johnny"}, person)
+
+	record.MustSet("age", int32(42))
+	err = record.ScanInto(&person)
+	require.NoError(t, err)
+	require.EqualValues(t, 42, *person.Years)
+
+	type Name struct {
+		FirstName string
+	}
+	var name Name
+	err = record.ScanInto(&name)
+	require.NoError(t, err)
+	require.Equal(t, Name{FirstName: "John"}, name)
+
+	err = record.ScanInto(&name, pgxrecord.DisallowUnknownColumns())
+	require.ErrorContains(t, err, `attribute "id" does not map to a struct field`)
+
+	err = record.ScanInto(&person, pgxrecord.DisallowUnknownFields())
+	require.ErrorContains(t, err, `struct field "Nickname" does not map to a column`)
+
+	type Invalid struct {
+		FirstName int
+	}
+	err = record.ScanInto(&Invalid{})
+	require.ErrorContains(t, err, `attribute "first_name"`)
+
+	err = record.ScanInto(name)
+	require.ErrorContains(t, err, "dst must be a non-nil pointer to a struct")
+}
+
+func TestRecordSaveReturningSQL(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true, HasDefault: true},
+			{Name: "name", OID: pgtype.TextOID, NotNull: true},
+			{Name: "version", OID: pgtype.Int4OID, NotNull: true, HasDefault: true},
+		},
+		VersionColumn: "version",
+	}
+	table.Finalize()
+
+	db := &recordingDB{}
+	record := table.NewRecord()
+	record.MustSet("name", "John")
+	err := record.Save(context.Background(), db, pgxrecord.Returning("id"), pgxrecord.ReturningExpr("name", "upper(name)"))
+	require.ErrorIs(t, err, errRecordingDB)
+
+	err = record.Save(context.Background(), db, pgxrecord.Returning())
+	require.ErrorIs(t, err, errRecordingDB)
+
+	err = record.Save(context.Background(), db, pgxrecord.Returning("missing"))
+	require.ErrorContains(t, err, `returning attribute "missing" is not found`)
+
+	err = record.Save(context.Background(), db, pgxrecord.Returning("*", "xmin", "ctid"))
+	require.ErrorIs(t, err, errRecordingDB)
+
+	require.Equal(t, []string{
+		`insert into "t" ("name") values ($1) returning "id", upper(name), "version"`,
+		`insert into "t" ("name") values ($1) returning "version"`,
+		`insert into "t" ("name") values ($1) returning "id", "name", "version", xmin, ctid`,
+	}, db.sqls)
+}
+
+func TestRecordSaveReturningSystemColumns(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		record := table.NewRecord()
+		record.MustSet("name", "John")
+		err = record.Save(ctx, conn, pgxrecord.Returning("*", "xmin", "ctid"))
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(1), "name": "John"}, record.Attributes())
+
+		xmin, err := record.SystemColumn("xmin")
+		require.NoError(t, err)
+		require.IsType(t, uint32(0), xmin)
+
+		var expected uint32
+		err = conn.QueryRow(ctx, "select xmin::text::bigint from t where id = 1").Scan(&expected)
+		require.NoError(t, err)
+		require.Equal(t, expected, xmin)
+
+		ctid, err := record.SystemColumn("ctid")
+		require.NoError(t, err)
+		require.IsType(t, pgtype.TID{}, ctid)
+
+		_, err = record.SystemColumn("name")
+		require.ErrorContains(t, err, `"name" is not a system column`)
+		_, err = record.SystemColumn("xmax")
+		require.ErrorContains(t, err, `"xmax" was not returned`)
+
+		record.MustSet("name", "Bill")
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		_, err = record.SystemColumn("xmin")
+		require.ErrorContains(t, err, `"xmin" was not returned`)
+	})
+}
+
+func TestRecordSaveReturning(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int not null default 30
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		record := table.NewRecord()
+		record.MustSet("name", "John")
+		err = record.Save(ctx, conn, pgxrecord.Returning("id"), pgxrecord.ReturningExpr("name", "upper(name)"))
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(1), "name": "JOHN"}, record.Attributes())
+		require.False(t, record.IsDirty())
+
+		record.MustSet("age", int32(42))
+		err = record.Save(ctx, conn, pgxrecord.Returning())
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(1), "name": "JOHN", "age": int32(42)}, record.Attributes())
+		require.False(t, record.IsDirty())
+
+		err = record.Reload(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(1), "name": "John", "age": int32(42)}, record.Attributes())
+	})
+}
+
+func TestRecordSaveNoReturningSQL(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true, HasDefault: true},
+			{Name: "name", OID: pgtype.TextOID, NotNull: true},
+		},
+	}
+	table.Finalize()
+
+	db := &recordingDB{}
+	record := table.NewRecord()
+	record.MustSet("name", "John")
+	err := record.SaveNoReturning(context.Background(), db, pgxrecord.Returning("id"))
+	require.ErrorIs(t, err, errRecordingDB)
+	require.ErrorContains(t, err, "SaveNoReturning")
+	require.Equal(t, []string{`insert into "t" ("name") values ($1)`}, db.sqls)
+}
+
+func TestRecordSaveNoReturning(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key,
+	name text not null,
+	age int not null default 30
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		record := table.NewRecord()
+		record.MustSet("id", int32(1))
+		record.MustSet("name", "John")
+		err = record.SaveNoReturning(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(1), "name": "John"}, record.Attributes())
+		require.False(t, record.IsDirty())
+
+		record.MustSet("name", "Jane")
+		err = record.SaveNoReturning(ctx, conn)
+		require.NoError(t, err)
+		require.False(t, record.IsDirty())
+
+		found, err := table.FindByPK(ctx, conn, int32(1))
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(1), "name": "Jane", "age": int32(30)}, found.Attributes())
+
+		_, err = conn.Exec(ctx, "delete from t")
+		require.NoError(t, err)
+
+		found.MustSet("name", "Bill")
+		err = found.SaveNoReturning(ctx, conn)
+		require.ErrorIs(t, err, pgx.ErrNoRows)
+	})
+}
+
+func TestRecordSaveInsertDefaults(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text,
+	status text not null default 'pending'
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		require.False(t, table.Columns[1].HasDefault)
+		require.True(t, table.Columns[2].HasDefault)
+
+		record := table.NewRecord()
+		record.MustSet("name", "John")
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(1), "name": "John", "status": "pending"}, record.Attributes())
+
+		record = table.NewRecord()
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(2), "name": nil, "status": "pending"}, record.Attributes())
+
+		record = table.NewRecord()
+		record.MustSet("status", "active")
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(3), "name": nil, "status": "active"}, record.Attributes())
+	})
+}
+
+func TestRecordSaveIdentityColumns(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated always as identity,
+	seq int not null generated by default as identity,
+	name text not null
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		require.Equal(t, "always", table.Columns[0].Identity)
+		require.Equal(t, "by default", table.Columns[1].Identity)
+		require.Equal(t, "", table.Columns[2].Identity)
+
+		record := table.NewRecord()
+		record.MustSet("name", "John")
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(1), "seq": int32(1), "name": "John"}, record.Attributes())
+
+		record = table.NewRecord()
+		record.SetAttributes(map[string]any{"seq": 100, "name": "Jane"})
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(2), "seq": int32(100), "name": "Jane"}, record.Attributes())
+
+		err = record.Set("id", 5)
+		require.ErrorContains(t, err, "generated always identity column cannot be set")
+	})
+}
+
+func TestRecordArrayColumns(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	tags text[],
+	scores int[],
+	grid int[][]
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		require.EqualValues(t, 0, table.Columns[0].ElementOID)
+		require.EqualValues(t, pgtype.TextOID, table.Columns[1].ElementOID)
+		require.Equal(t, 1, table.Columns[1].Dimensions)
+		require.EqualValues(t, pgtype.Int4OID, table.Columns[2].ElementOID)
+		require.Equal(t, 2, table.Columns[3].Dimensions)
+
+		record := table.NewRecord()
+		record.SetAttributes(map[string]any{"tags": []string{"a", "b"}, "scores": []int32{}})
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, []string{"a", "b"}, record.MustGet("tags"))
+		require.Equal(t, []int32{}, record.MustGet("scores"))
+		require.Nil(t, record.MustGet("grid"))
+
+		record, err = table.FindByPK(ctx, conn, record.MustGet("id"))
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(1), "tags": []string{"a", "b"}, "scores": []int32{}, "grid": nil}, record.Attributes())
+
+		record.MustSet("tags", []string{"c"})
+		require.Equal(t, map[string]any{"tags": []string{"c"}}, record.ChangedAttributes())
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, []string{"c"}, record.MustGet("tags"))
+
+		record.MustSet("tags", []any{"d", nil})
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, []any{"d", nil}, record.MustGet("tags"))
+	})
+}
+
+func TestRecordSaveUpdate(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int
+)`)
+		require.NoError(t, err)
+
+		var id int32
+		err = conn.QueryRow(ctx, `insert into t (name, age) values ('John', 42) returning id`).Scan(&id)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		record, err := table.FindByPK(ctx, conn, id)
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(1), "name": "John", "age": int32(42)}, record.Attributes())
+
+		record.MustSet("name", "Bill")
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+
+		record, err = table.FindByPK(ctx, conn, id)
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(1), "name": "Bill", "age": int32(42)}, record.Attributes())
+	})
+}
+
+func TestRecordSaveGeneratedColumn(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	price int not null,
+	qty int not null,
+	total int generated always as (price * qty) stored
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		require.False(t, table.Columns[2].Generated)
+		require.True(t, table.Columns[3].Generated)
+
+		record := table.NewRecord()
+		record.SetAttributes(map[string]any{"price": 3, "qty": 4})
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, int32(12), record.MustGet("total"))
+
+		record.MustSet("qty", 5)
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, int32(15), record.MustGet("total"))
+
+		err = record.Set("total", 100)
+		require.ErrorContains(t, err, "generated column cannot be set")
+	})
+}
+
+func TestRecordSaveNotNullCheck(t *testing.T) {
+	t.Parallel()
+
+	columns := []*pgxrecord.Column{
+		{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true, Identity: "by default"},
+		{Name: "name", OID: pgtype.TextOID, NotNull: true},
+		{Name: "status", OID: pgtype.TextOID, NotNull: true, HasDefault: true},
+		{Name: "name_upper", OID: pgtype.TextOID, NotNull: true, Generated: true},
+		{Name: "created_at", OID: pgtype.TimestamptzOID, NotNull: true},
+		{Name: "age", OID: pgtype.Int4OID},
+	}
+
+	table := &pgxrecord.Table{Name: pgx.Identifier{"t"}, Columns: columns, Timestamps: true}
+	table.Finalize()
+
+	db := &recordingDB{}
+	record := table.NewRecord()
+	err := record.Save(context.Background(), db)
+	var validationErr *pgxrecord.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	require.Equal(t, map[string][]string{"name": {"must be set"}}, validationErr.ByField())
+
+	record.MustSet("name", "John")
+	record.MustSet("status", nil)
+	err = record.Save(context.Background(), db)
+	require.ErrorAs(t, err, &validationErr)
+	require.Equal(t, map[string][]string{"status": {"can't be null"}}, validationErr.ByField())
+	require.Empty(t, db.sqls)
+
+	record.MustSet("status", "active")
+	err = record.Save(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+
+	skipping := &pgxrecord.Table{Name: pgx.Identifier{"t"}, Columns: columns, SkipNotNullCheck: true}
+	skipping.Finalize()
+	err = skipping.NewRecord().Save(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+}
+
+func TestRecordSaveAddValidation(t *testing.T) {
+	t.Parallel()
+
+	var calls []string
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true, HasDefault: true},
+			{Name: "name", OID: pgtype.TextOID, NotNull: true},
+		},
+	}
+	table.AddValidation(func(r *pgxrecord.Record, op string) error {
+		calls = append(calls, "first "+op)
+		if r.MustGet("name") == "" {
+			return pgxrecord.FieldErrorf("name", "can't be blank")
+		}
+		return nil
+	})
+	table.AddValidation(func(r *pgxrecord.Record, op string) error {
+		calls = append(calls, "second "+op)
+		return nil
+	})
+	table.Finalize()
+
+	db := &recordingDB{}
+	record := table.NewRecord()
+	record.MustSet("name", "")
+	err := record.Save(context.Background(), db)
+	var fieldErr *pgxrecord.FieldError
+	require.ErrorAs(t, err, &fieldErr)
+	require.Equal(t, []string{"first insert"}, calls)
+	require.Empty(t, db.sqls)
+
+	calls = nil
+	record.MustSet("name", "John")
+	err = record.Save(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+	require.Equal(t, []string{"first insert", "second insert"}, calls)
+	require.Len(t, db.sqls, 1)
+}
+
+func TestRecordSaveValidatesWithQuery(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table categories (
+	id int primary key,
+	active bool not null
+);
+insert into categories (id, active) values (1, true), (2, false);
+create temporary table t (
+	id int primary key generated by default as identity,
+	category_id int not null,
+	name text not null
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.ValidatesWithQuery(
+			"select exists(select 1 from categories where id = $1 and active)",
+			func(r *pgxrecord.Record) []any { return []any{r.MustGet("category_id")} },
+			"category must exist and be active",
+		)
+		table.Finalize()
+
+		record := table.NewRecord()
+		record.SetAttributes(map[string]any{"category_id": 2, "name": "John"})
+		err = record.Save(ctx, conn)
+		var validationErr *pgxrecord.ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		require.Equal(t, map[string][]string{"": {"category must exist and be active"}}, validationErr.ByField())
+
+		record.MustSet("category_id", 3)
+		err = record.Save(ctx, conn)
+		require.ErrorAs(t, err, &validationErr)
+
+		record.MustSet("category_id", 1)
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, int32(1), record.MustGet("id"))
+	})
+}
+
+func TestRecordUpsert(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	external_id text not null unique,
+	name text not null
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		record := table.NewRecord()
+		record.SetAttributes(map[string]any{"external_id": "abc", "name": "John"})
+		err = record.Upsert(ctx, conn, pgxrecord.ConflictTarget{Columns: []string{"external_id"}})
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(1), "external_id": "abc", "name": "John"}, record.Attributes())
+
+		record = table.NewRecord()
+		record.SetAttributes(map[string]any{"external_id": "abc", "name": "Bill"})
+		err = record.Upsert(ctx, conn, pgxrecord.ConflictTarget{Columns: []string{"external_id"}})
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(1), "external_id": "abc", "name": "Bill"}, record.Attributes())
+
+		record = table.NewRecord()
+		record.SetAttributes(map[string]any{"external_id": "abc", "name": "Jane"})
+		err = record.Upsert(ctx, conn, pgxrecord.ConflictTarget{Constraint: "t_external_id_key"})
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(1), "external_id": "abc", "name": "Jane"}, record.Attributes())
+
+		err = record.Upsert(ctx, conn, pgxrecord.ConflictTarget{})
+		require.Error(t, err)
+	})
+}
+
+func TestRecordInsertIgnore(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	event_id text not null unique,
+	name text not null
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		record := table.NewRecord()
+		record.MustSet("event_id", "a")
+		record.MustSet("name", "John")
+		inserted, err := record.InsertIgnore(ctx, conn, pgxrecord.ConflictTarget{Columns: []string{"event_id"}})
+		require.NoError(t, err)
+		require.True(t, inserted)
+		require.Equal(t, int32(1), record.MustGet("id"))
+
+		duplicate := table.NewRecord()
+		duplicate.MustSet("event_id", "a")
+		duplicate.MustSet("name", "Jane")
+		inserted, err = duplicate.InsertIgnore(ctx, conn, pgxrecord.ConflictTarget{Constraint: "t_event_id_key"})
+		require.NoError(t, err)
+		require.False(t, inserted)
+		require.Nil(t, duplicate.MustGet("id"))
+		require.True(t, duplicate.IsDirty())
+
+		inserted, err = duplicate.InsertIgnore(ctx, conn, pgxrecord.ConflictTarget{})
+		require.NoError(t, err)
+		require.False(t, inserted)
+
+		duplicate.MustSet("id", 1)
+		duplicate.MustSet("event_id", "b")
+		_, err = duplicate.InsertIgnore(ctx, conn, pgxrecord.ConflictTarget{Columns: []string{"event_id"}})
+		require.True(t, pgxrecord.IsUniqueViolation(err, "t_pkey"))
+	})
+}
+
+func TestRecordInsertIgnoreSQL(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true, HasDefault: true},
+			{Name: "event_id", OID: pgtype.TextOID, NotNull: true},
+		},
+	}
+	table.Finalize()
+
+	record := table.NewRecord()
+	record.MustSet("event_id", "a")
+
+	db := &recordingDB{}
+	_, err := record.InsertIgnore(context.Background(), db, pgxrecord.ConflictTarget{Columns: []string{"event_id"}})
+	require.ErrorIs(t, err, errRecordingDB)
+	_, err = record.InsertIgnore(context.Background(), db, pgxrecord.ConflictTarget{})
+	require.ErrorIs(t, err, errRecordingDB)
+	_, err = record.InsertIgnore(context.Background(), db, pgxrecord.ConflictTarget{Columns: []string{"event_id"}, Constraint: "t_event_id_key"})
+	require.ErrorContains(t, err, "must not have both columns and constraint")
+
+	require.Equal(t, []string{
+		`insert into "t" ("event_id") values ($1) on conflict ("event_id") do nothing returning "id", "event_id"`,
+		`insert into "t" ("event_id") values ($1) on conflict do nothing returning "id", "event_id"`,
+	}, db.sqls)
+}
+
+func TestTableUpsertMany(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	code text not null unique,
+	name text not null
+);
+insert into t (code, name) values ('a', 'Old');`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		a := table.NewRecord()
+		a.SetAttributes(map[string]any{"code": "a", "name": "New"})
+		b := table.NewRecord()
+		b.SetAttributes(map[string]any{"code": "b", "name": "Bob"})
+
+		err = table.UpsertMany(ctx, conn, []*pgxrecord.Record{a, b}, pgxrecord.ConflictTarget{Columns: []string{"code"}})
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(1), "code": "a", "name": "New"}, a.Attributes())
+		require.Equal(t, map[string]any{"id": int32(3), "code": "b", "name": "Bob"}, b.Attributes())
+		require.False(t, a.IsDirty())
+
+		n, err := table.Count(ctx, conn, nil)
+		require.NoError(t, err)
+		require.EqualValues(t, 2, n)
+	})
+}
+
+func TestTableUpsertManySQL(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true, HasDefault: true},
+			{Name: "code", OID: pgtype.TextOID, NotNull: true},
+			{Name: "name", OID: pgtype.TextOID},
+			{Name: "created_at", OID: pgtype.TimestamptzOID},
+			{Name: "updated_at", OID: pgtype.TimestamptzOID},
+		},
+		Timestamps: true,
+	}
+	table.Finalize()
+
+	a := table.NewRecord()
+	a.SetAttributes(map[string]any{"code": "a", "name": "Alice"})
+	b := table.NewRecord()
+	b.SetAttributes(map[string]any{"code": "b", "name": "Bob"})
+
+	db := &recordingDB{}
+	err := table.UpsertMany(context.Background(), db, []*pgxrecord.Record{a, b}, pgxrecord.ConflictTarget{Columns: []string{"code"}})
+	require.ErrorIs(t, err, errRecordingDB)
+	err = table.UpsertMany(context.Background(), db, []*pgxrecord.Record{a}, pgxrecord.ConflictTarget{})
+	require.ErrorContains(t, err, "exactly one of columns or constraint")
+
+	require.Equal(t, []string{
+		`insert into "t" ("code", "name", "created_at", "updated_at") values ($1, $2, now(), now()), ($3, $4, now(), now()) on conflict ("code") do update set "name" = excluded."name", "updated_at" = excluded."updated_at" returning "id", "code", "name", "created_at", "updated_at"`,
+	}, db.sqls)
+}
+
+func TestRecordUpsertPartialIndex(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table events (
+	id int primary key generated by default as identity,
+	external_id text not null,
+	name text not null,
+	archived bool not null default false
+);
+create unique index events_external_id_idx on events (external_id) where not archived;
+insert into events (external_id, name, archived) values ('a', 'Archived', true), ('a', 'Old', false);`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"events"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		err = table.LoadUniqueConstraints(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		uc, ok := table.UniqueConstraintByName("events_external_id_idx")
+		require.True(t, ok)
+
+		record := table.NewRecord()
+		record.MustSet("external_id", "a")
+		record.MustSet("name", "New")
+		err = record.Upsert(ctx, conn, pgxrecord.ConflictTarget{Columns: uc.Columns, Where: uc.Predicate})
+		require.NoError(t, err)
+		require.EqualValues(t, 2, record.MustGet("id"))
+		require.Equal(t, "New", record.MustGet("name"))
+
+		count, err := table.CountAll(ctx, conn)
+		require.NoError(t, err)
+		require.EqualValues(t, 2, count)
+	})
+}
+
+func TestRecordUpsertPartialIndexSQL(t *testing.T) {
+	t.Parallel()
+
+	newTable := func(softDeleteColumn string) *pgxrecord.Table {
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"events"},
+			Columns: []*pgxrecord.Column{
+				{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true, HasDefault: true},
+				{Name: "external_id", OID: pgtype.TextOID, NotNull: true},
+				{Name: "deleted_at", OID: pgtype.TimestamptzOID},
+			},
+			SoftDeleteColumn: softDeleteColumn,
+		}
+		table.Finalize()
+		return table
+	}
+
+	db := &recordingDB{}
+	target := pgxrecord.ConflictTarget{Columns: []string{"external_id"}, Where: "not archived"}
+
+	for _, table := range []*pgxrecord.Table{newTable(""), newTable("deleted_at")} {
+		record := table.NewRecord()
+		record.MustSet("external_id", "a")
+		err := record.Upsert(context.Background(), db, target)
+		require.ErrorIs(t, err, errRecordingDB)
+	}
+
+	require.Equal(t, []string{
+		`insert into "events" ("external_id") values ($1) on conflict ("external_id") where not archived do update set "external_id" = excluded."external_id" returning "id", "external_id", "deleted_at"`,
+		`insert into "events" ("external_id") values ($1) on conflict ("external_id") where "deleted_at" is null and (not archived) do update set "external_id" = excluded."external_id" returning "id", "external_id", "deleted_at"`,
+	}, db.sqls)
+
+	record := newTable("").NewRecord()
+	record.MustSet("external_id", "a")
+	err := record.Upsert(context.Background(), db, pgxrecord.ConflictTarget{Constraint: "events_external_id_key", Where: "not archived"})
+	require.ErrorContains(t, err, "conflict target where requires columns")
+}
+
+func TestRecordUpsertUpdateWhere(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key,
+	name text not null,
+	version int not null
+);
+insert into t (id, name, version) values (1, 'Current', 2);`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		target := pgxrecord.ConflictTarget{Columns: []string{"id"}, UpdateWhere: "excluded.version > t.version"}
+
+		record := table.NewRecord()
+		record.SetAttributes(map[string]any{"id": int32(1), "name": "Older", "version": int32(1)})
+		err = record.Upsert(ctx, conn, target)
+		require.ErrorIs(t, err, pgxrecord.ErrNotUpdated)
+		require.True(t, record.IsDirty())
+
+		record = table.NewRecord()
+		record.SetAttributes(map[string]any{"id": int32(1), "name": "Newer", "version": int32(3)})
+		err = record.Upsert(ctx, conn, target)
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(1), "name": "Newer", "version": int32(3)}, record.Attributes())
+
+		record = table.NewRecord()
+		record.SetAttributes(map[string]any{"id": int32(2), "name": "New", "version": int32(1)})
+		err = record.Upsert(ctx, conn, target)
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(2), "name": "New", "version": int32(1)}, record.Attributes())
+
+		records := make([]*pgxrecord.Record, 4)
+		for i, attributes := range []map[string]any{
+			{"id": 3, "name": "Inserted", "version": 1},
+			{"id": 1, "name": "Stale", "version": 2},
+			{"id": 2, "name": "Updated", "version": 2},
+			{"id": 4, "name": "Inserted", "version": 1},
+		} {
+			records[i] = table.NewRecord()
+			records[i].SetAttributes(attributes)
+		}
+
+		err = table.UpsertMany(ctx, conn, records, target, pgxrecord.SortByKey())
+		require.ErrorIs(t, err, pgxrecord.ErrNotUpdated)
+		var notUpdatedErr *pgxrecord.NotUpdatedError
+		require.ErrorAs(t, err, &notUpdatedErr)
+		require.Equal(t, []int{1}, notUpdatedErr.Indexes)
+
+		require.True(t, records[1].IsDirty())
+		require.Equal(t, "Stale", records[1].MustGet("name"))
+		for _, i := range []int{0, 2, 3} {
+			require.False(t, records[i].IsDirty())
+		}
+		require.Equal(t, map[string]any{"id": int32(2), "name": "Updated", "version": int32(2)}, records[2].Attributes())
+
+		names, err := pgxrecord.Select(ctx, conn, `select name from t order by id`, nil, pgx.RowTo[string])
+		require.NoError(t, err)
+		require.Equal(t, []string{"Newer", "Updated", "Inserted", "Inserted"}, names)
+	})
+}
+
+func TestRecordUpsertUpdateWhereSQL(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "name", OID: pgtype.TextOID, NotNull: true},
+		},
+	}
+	table.Finalize()
+
+	record := table.NewRecord()
+	record.SetAttributes(map[string]any{"id": int32(1), "name": "a"})
+
+	db := &recordingDB{}
+	target := pgxrecord.ConflictTarget{Columns: []string{"id"}, UpdateWhere: "t.name <> excluded.name"}
+	err := record.Upsert(context.Background(), db, target)
+	require.ErrorIs(t, err, errRecordingDB)
+	require.Equal(t, []string{
+		`insert into "t" ("id", "name") values ($1, $2) on conflict ("id") do update set "name" = excluded."name" where t.name <> excluded.name returning "id", "name"`,
+	}, db.sqls)
+
+	err = table.UpsertMany(context.Background(), db, []*pgxrecord.Record{record}, target)
+	require.ErrorIs(t, err, errRecordingDB)
+	require.Equal(t, `insert into "t" ("id", "name") values ($1, $2) on conflict ("id") do update set "name" = excluded."name" where t.name <> excluded.name returning "id", "name"`, db.sqls[1])
+
+	unkeyed := table.NewRecord()
+	unkeyed.MustSet("name", "b")
+	err = table.UpsertMany(context.Background(), db, []*pgxrecord.Record{record, unkeyed}, target)
+	require.ErrorContains(t, err, `record 1: update where requires "id" to be set`)
+
+	_, err = record.InsertIgnore(context.Background(), db, target)
+	require.ErrorContains(t, err, "must not have update where")
+}
+
+func TestRecordUpsertSoftDelete(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	email text not null,
+	name text not null,
+	deleted_at timestamptz
+);
+create unique index on t (email) where deleted_at is null;`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name:             pgx.Identifier{"t"},
+			SoftDeleteColumn: "deleted_at",
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		record := table.NewRecord()
+		record.SetAttributes(map[string]any{"email": "john@example.com", "name": "John"})
+		err = record.Upsert(ctx, conn, pgxrecord.ConflictTarget{Columns: []string{"email"}})
+		require.NoError(t, err)
+		require.Equal(t, int32(1), record.MustGet("id"))
+
+		err = record.SoftDelete(ctx, conn)
+		require.NoError(t, err)
+
+		record = table.NewRecord()
+		record.SetAttributes(map[string]any{"email": "john@example.com", "name": "Johnny"})
+		err = record.Upsert(ctx, conn, pgxrecord.ConflictTarget{Columns: []string{"email"}})
+		require.NoError(t, err)
+		require.Equal(t, int32(2), record.MustGet("id"))
+
+		record = table.NewRecord()
+		record.SetAttributes(map[string]any{"email": "john@example.com", "name": "Jonathan"})
+		err = record.Upsert(ctx, conn, pgxrecord.ConflictTarget{Columns: []string{"email"}})
+		require.NoError(t, err)
+		require.Equal(t, int32(2), record.MustGet("id"))
+		require.Equal(t, "Jonathan", record.MustGet("name"))
+
+		n, err := table.WithDeleted().CountAll(ctx, conn)
+		require.NoError(t, err)
+		require.EqualValues(t, 2, n)
+	})
+}
+
+func TestRecordDirtyTracking(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		record := table.NewRecord()
+		record.SetAttributes(map[string]any{"name": "John", "age": int32(42)})
+		require.True(t, record.IsDirty())
+		require.Equal(t, map[string]any{"name": "John", "age": int32(42)}, record.ChangedAttributes())
+
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		require.False(t, record.IsDirty())
+		require.Equal(t, map[string]any{}, record.ChangedAttributes())
+
+		record, err = table.FindByPK(ctx, conn, 1)
+		require.NoError(t, err)
+		require.False(t, record.IsDirty())
+
+		record.MustSet("age", int32(42))
+		require.False(t, record.IsDirty())
+
+		record.MustSet("name", "Bill")
+		require.True(t, record.IsDirty())
+		require.Equal(t, map[string]any{"name": "Bill"}, record.ChangedAttributes())
+
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		require.False(t, record.IsDirty())
+
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+
+		record, err = table.FindByPK(ctx, conn, 1)
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(1), "name": "Bill", "age": int32(42)}, record.Attributes())
+	})
+}
+
+func TestRecordSaveVersionColumn(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	lock_version int not null default 1
+)`)
+		require.NoError(t, err)
+
+		_, err = conn.Exec(ctx, `insert into t (name) values ('John')`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name:          pgx.Identifier{"t"},
+			VersionColumn: "lock_version",
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		record1, err := table.FindByPK(ctx, conn, 1)
+		require.NoError(t, err)
+		record2, err := table.FindByPK(ctx, conn, 1)
+		require.NoError(t, err)
+
+		record1.MustSet("name", "Bill")
+		err = record1.Save(ctx, conn)
+		require.NoError(t, err)
+		require.EqualValues(t, 2, record1.MustGet("lock_version"))
+
+		record2.MustSet("name", "Jane")
+		err = record2.Save(ctx, conn)
+		require.ErrorIs(t, err, pgxrecord.ErrStaleObject)
+
+		record2, err = table.FindByPK(ctx, conn, 1)
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(1), "name": "Bill", "lock_version": int32(2)}, record2.Attributes())
+	})
+}
+
+func TestRecordSaveTimestamps(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	created_at timestamptz not null,
+	updated_at timestamptz not null
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name:       pgx.Identifier{"t"},
+			Timestamps: true,
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		longAgo := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		record := table.NewRecord()
+		record.SetAttributes(map[string]any{"name": "John", "updated_at": longAgo})
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		createdAt := record.MustGet("created_at").(time.Time)
+		require.True(t, createdAt.After(longAgo))
+		require.True(t, longAgo.Equal(record.MustGet("updated_at").(time.Time)))
+
+		record.MustSet("name", "Bill")
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		require.True(t, createdAt.Equal(record.MustGet("created_at").(time.Time)))
+		require.True(t, record.MustGet("updated_at").(time.Time).After(longAgo))
+	})
+}
+
+func TestRecordReload(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		record := table.NewRecord()
+		record.MustSet("name", "John")
+		err = record.Reload(ctx, conn)
+		require.ErrorContains(t, err, "record is not persisted")
+
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+
+		_, err = conn.Exec(ctx, `update t set age = 42 where id = $1`, record.MustGet("id"))
+		require.NoError(t, err)
+
+		record.MustSet("name", "Bill")
+		require.True(t, record.IsDirty())
+
+		err = record.Reload(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(1), "name": "John", "age": int32(42)}, record.Attributes())
+		require.False(t, record.IsDirty())
+
+		_, err = conn.Exec(ctx, `delete from t`)
+		require.NoError(t, err)
+
+		err = record.Reload(ctx, conn)
+		require.ErrorIs(t, err, pgx.ErrNoRows)
+	})
+}
+
+func TestTableSaveBatch(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null unique,
+	age int
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		existing := table.NewRecord()
+		existing.MustSet("name", "John")
+		err = existing.Save(ctx, conn)
+		require.NoError(t, err)
+
+		clean := table.NewRecord()
+		clean.MustSet("name", "Jane")
+		err = clean.Save(ctx, conn)
+		require.NoError(t, err)
+
+		existing.MustSet("age", 42)
+		inserted := table.NewRecord()
+		inserted.MustSet("name", "Bill")
+
+		err = table.SaveBatch(ctx, conn, []*pgxrecord.Record{existing, clean, inserted})
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(1), "name": "John", "age": int32(42)}, existing.Attributes())
+		require.Equal(t, map[string]any{"id": int32(3), "name": "Bill", "age": nil}, inserted.Attributes())
+		require.False(t, existing.IsDirty())
+		require.False(t, inserted.IsDirty())
+
+		ok := table.NewRecord()
+		ok.MustSet("name", "Ann")
+		duplicate := table.NewRecord()
+		duplicate.MustSet("name", "John")
+
+		err = table.SaveBatch(ctx, conn, []*pgxrecord.Record{ok, duplicate})
+		var pgErr *pgconn.PgError
+		require.ErrorAs(t, err, &pgErr)
+		require.Equal(t, "23505", pgErr.Code)
+		require.ErrorContains(t, err, "record 1")
+		require.Nil(t, ok.MustGet("id"))
+
+		var n int64
+		err = conn.QueryRow(ctx, `select count(*) from t`).Scan(&n)
+		require.NoError(t, err)
+		require.EqualValues(t, 3, n)
+	})
+}
+
+func TestTableSaveBatchSortByKey(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key,
+	name text not null
+);
+create temporary table write_log (
+	n serial primary key,
+	id int not null
+);
+create function pg_temp.log_write() returns trigger language plpgsql as $$
+begin
+	insert into write_log (id) values (new.id);
+	return new;
+end
+$$;
+create trigger log_write before insert or update on t for each row execute function pg_temp.log_write();
+insert into t (id, name) values (1, 'a'), (2, 'b'), (3, 'c');`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		records, err := table.FindAll(ctx, conn, nil)
+		require.NoError(t, err)
+		_, err = conn.Exec(ctx, "truncate write_log")
+		require.NoError(t, err)
+
+		records = []*pgxrecord.Record{records[2], records[0], records[1]}
+		for _, r := range records {
+			r.MustSet("name", fmt.Sprintf("updated %v", r.MustGet("id")))
+		}
+		inserted := table.NewRecord()
+		inserted.SetAttributes(map[string]any{"id": int32(0), "name": "new"})
+		records = append(records, inserted)
+
+		err = table.SaveBatch(ctx, conn, records, pgxrecord.SortByKey())
+		require.NoError(t, err)
+		for _, r := range records {
+			require.False(t, r.IsDirty())
+		}
+		require.Equal(t, "updated 3", records[0].MustGet("name"))
+		require.Equal(t, "new", inserted.MustGet("name"))
+
+		ids, err := pgxrecord.SelectRows(ctx, conn, "select id from write_log order by n", nil, pgx.RowTo[int32])
+		require.NoError(t, err)
+		require.Equal(t, []int32{0, 1, 2, 3}, ids)
+	})
+}
+
+func TestTableUpsertManySortByKeySQL(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "code", OID: pgtype.TextOID, NotNull: true},
+			{Name: "n", OID: pgtype.Int4OID, NotNull: true},
+		},
+	}
+	table.Finalize()
+
+	newRecord := func(id int32, code string, n int32) *pgxrecord.Record {
+		r := table.NewRecord()
+		r.SetAttributes(map[string]any{"id": id, "code": code, "n": n})
+		return r
+	}
+	records := []*pgxrecord.Record{newRecord(1, "b", 1), newRecord(2, "a", 2), newRecord(3, "a", 1)}
+
+	db := &recordingDB{}
+	err := table.UpsertMany(context.Background(), db, records, pgxrecord.ConflictTarget{Columns: []string{"code", "n"}}, pgxrecord.SortByKey())
+	require.ErrorIs(t, err, errRecordingDB)
+	err = table.UpsertMany(context.Background(), db, records, pgxrecord.ConflictTarget{Constraint: "t_code_n_key"}, pgxrecord.SortByKey())
+	require.ErrorIs(t, err, errRecordingDB)
+	require.Equal(t, [][]any{
+		{int32(3), "a", int32(1), int32(2), "a", int32(2), int32(1), "b", int32(1)},
+		{int32(1), "b", int32(1), int32(2), "a", int32(2), int32(3), "a", int32(1)},
+	}, db.args)
+	require.Equal(t, int32(1), records[0].MustGet("id"))
+}
+
+func TestCompareKeyValues(t *testing.T) {
+	t.Parallel()
+
+	for i, tt := range []struct {
+		a, b     any
+		expected int
+	}{
+		{nil, nil, 0},
+		{nil, int32(1), -1},
+		{int32(1), nil, 1},
+		{int32(2), int64(10), -1},
+		{int64(-1), uint8(1), -1},
+		{uint64(5), uint32(5), 0},
+		{1.5, int32(1), 1},
+		{"b", "a", 1},
+		{"a", "a", 0},
+		{[16]byte{1}, [16]byte{2}, -1},
+		{[]byte{2}, [16]byte{1}, 1},
+		{true, false, 1},
+	} {
+		require.Equalf(t, tt.expected, pgxrecord.Private_compareKeyValues(tt.a, tt.b), "%d", i)
+	}
+}
+
+func TestRecordCallbacks(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	version int not null default 1
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name:          pgx.Identifier{"t"},
+			VersionColumn: "version",
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+
+		var calls []string
+		callback := func(name string) pgxrecord.Callback {
+			return func(ctx context.Context, db pgxrecord.DB, r *pgxrecord.Record, op string) error {
+				calls = append(calls, fmt.Sprintf("%s %s %v %v", name, op, r.MustGet("name"), r.MustGet("version")))
+				return nil
+			}
+		}
+		table.AddValidation(func(r *pgxrecord.Record, op string) error {
+			calls = append(calls, "validate "+op)
+			return nil
+		})
+		table.AddBeforeSave(callback("before save"))
+		table.AddBeforeSave(func(ctx context.Context, db pgxrecord.DB, r *pgxrecord.Record, op string) error {
+			if r.MustGet("name") == "abort" {
+				return errors.New("aborted")
+			}
+			return r.Set("name", strings.TrimSpace(r.MustGet("name").(string)))
+		})
+		table.AddAfterSave(callback("after save"))
+		table.AddBeforeDelete(callback("before delete"))
+		table.AddAfterDelete(callback("after delete"))
+		table.Finalize()
+
+		record := table.NewRecord()
+		record.MustSet("name", " John ")
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, "John", record.MustGet("name"))
+
+		record.MustSet("name", "Bill")
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+
+		err = record.Delete(ctx, conn)
+		require.NoError(t, err)
+
+		require.Equal(t, []string{
+			"validate insert",
+			"before save insert  John  <nil>",
+			"after save insert John 1",
+			"validate update",
+			"before save update Bill 1",
+			"after save update Bill 2",
+			"before delete delete Bill 2",
+			"after delete delete Bill 2",
+		}, calls)
+
+		record = table.NewRecord()
+		record.MustSet("name", "abort")
+		err = record.Save(ctx, conn)
+		require.ErrorContains(t, err, "aborted")
+
+		n, err := table.CountAll(ctx, conn)
+		require.NoError(t, err)
+		require.EqualValues(t, 0, n)
+	})
+}
+
+func TestRecordLastCommandTag(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		record := table.NewRecord()
+		require.Equal(t, pgconn.CommandTag{}, record.LastCommandTag())
+
+		record.MustSet("name", "John")
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, "INSERT 0 1", record.LastCommandTag().String())
+
+		record.MustSet("name", "Jane")
+		err = record.Save(ctx, conn, pgxrecord.Returning())
+		require.NoError(t, err)
+		require.Equal(t, "UPDATE 1", record.LastCommandTag().String())
+
+		err = record.Reload(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, "UPDATE 1", record.LastCommandTag().String())
+
+		err = record.Delete(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, "DELETE 1", record.LastCommandTag().String())
+	})
+}
+
+func TestRecordDelete(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int
+)`)
+		require.NoError(t, err)
+
+		_, err = conn.Exec(ctx, `insert into t (name, age) values ('John', 42)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		record, err := table.FindByPK(ctx, conn, 1)
+		require.NoError(t, err)
+
+		err = record.Delete(ctx, conn)
+		require.NoError(t, err)
+
+		_, err = table.FindByPK(ctx, conn, 1)
+		require.ErrorIs(t, err, pgx.ErrNoRows)
+
+		err = record.Delete(ctx, conn)
+		require.ErrorContains(t, err, "not persisted")
+	})
+}
+
+func TestRecordSaveInsertColumns(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int,
+	note text not null default 'none'
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		record := table.NewRecord()
+		record.MustSet("name", "John")
+		record.MustSet("age", 42)
+		record.MustSet("note", "ignored")
+		err = record.Save(ctx, conn, pgxrecord.InsertColumns("name", "age"))
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"id": int32(1), "name": "John", "age": int32(42), "note": "none"}, record.Attributes())
+
+		// Updates are not affected.
+		record.MustSet("note", "updated")
+		err = record.Save(ctx, conn, pgxrecord.InsertColumns("name"))
+		require.NoError(t, err)
+		require.Equal(t, "updated", record.MustGet("note"))
+
+		record = table.NewRecord()
+		record.MustSet("name", "Jane")
+		record.MustSet("age", 35)
+		err = record.Save(ctx, conn, pgxrecord.InsertColumns("age"))
+		var validationErr *pgxrecord.ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		require.Equal(t, map[string][]string{"name": {"must be set"}}, validationErr.ByField())
+
+		err = record.Save(ctx, conn, pgxrecord.InsertColumns("missing"))
+		require.ErrorContains(t, err, `insert column "missing" is not found`)
+	})
+}
+
+func TestRecordSaveInsertColumnsSQL(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true, HasDefault: true},
+			{Name: "name", OID: pgtype.TextOID, NotNull: true},
+			{Name: "note", OID: pgtype.TextOID},
+			{Name: "created_at", OID: pgtype.TimestamptzOID},
+		},
+		Timestamps: true,
+	}
+	table.Finalize()
+
+	record := table.NewRecord()
+	record.MustSet("name", "John")
+	record.MustSet("note", "ignored")
+
+	db := &recordingDB{}
+	err := record.Save(context.Background(), db, pgxrecord.InsertColumns("name"))
+	require.ErrorIs(t, err, errRecordingDB)
+	err = record.Save(context.Background(), db, pgxrecord.InsertColumns("name", "created_at"))
+	require.ErrorIs(t, err, errRecordingDB)
+
+	require.Equal(t, []string{
+		`insert into "t" ("name") values ($1) returning "id", "name", "note", "created_at"`,
+		`insert into "t" ("name", "created_at") values ($1, now()) returning "id", "name", "note", "created_at"`,
+	}, db.sqls)
+	require.Equal(t, [][]any{{"John"}, {"John"}}, db.args)
+}
+
+func TestRecordSaveWithResult(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		record := table.NewRecord()
+		record.MustSet("name", "John")
+		result, err := record.SaveWithResult(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, pgxrecord.SaveResult{Op: "insert", RowsAffected: 1, Columns: []string{"name"}}, result)
+
+		result, err = record.SaveWithResult(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, pgxrecord.SaveResult{}, result)
+
+		record.MustSet("name", "John")
+		record.MustSet("age", 42)
+		result, err = record.SaveWithResult(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, pgxrecord.SaveResult{Op: "update", RowsAffected: 1, Columns: []string{"age"}}, result)
+
+		_, err = conn.Exec(ctx, `delete from t`)
+		require.NoError(t, err)
+
+		record.MustSet("age", 43)
+		result, err = record.SaveWithResult(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, pgxrecord.SaveResult{Op: "update", RowsAffected: 0, Columns: []string{"age"}}, result)
+		require.True(t, record.IsDirty())
+
+		err = record.Save(ctx, conn)
+		require.ErrorIs(t, err, pgx.ErrNoRows)
+	})
+}
+
+func TestRecordSaveWithResultError(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true, HasDefault: true},
+			{Name: "name", OID: pgtype.TextOID, NotNull: true},
+		},
+	}
+	table.Finalize()
+
+	record := table.NewRecord()
+	record.MustSet("name", "John")
+
+	result, err := record.SaveWithResult(context.Background(), &recordingDB{})
+	require.ErrorIs(t, err, errRecordingDB)
+	require.ErrorContains(t, err, `pgxrecord.Record ("t"): SaveWithResult:`)
+	require.Equal(t, pgxrecord.SaveResult{}, result)
+}
+
+func TestTableImmutableColumns(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null unique,
+	created_by text not null
+)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name:             pgx.Identifier{"t"},
+			ImmutableColumns: []string{"created_by"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		record := table.NewRecord()
+		record.MustSet("name", "John")
+		record.MustSet("created_by", "alice")
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+
+		record.MustSet("name", "Jane")
+		record.MustSet("created_by", "mallory")
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, "Jane", record.MustGet("name"))
+		require.Equal(t, "alice", record.MustGet("created_by"))
+
+		record.MustSet("created_by", "mallory")
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+
+		var createdBy string
+		err = conn.QueryRow(ctx, `select created_by from t where id = $1`, record.MustGet("id")).Scan(&createdBy)
+		require.NoError(t, err)
+		require.Equal(t, "alice", createdBy)
+
+		upserted := table.NewRecord()
+		upserted.MustSet("name", "Jane")
+		upserted.MustSet("created_by", "mallory")
+		err = upserted.Upsert(ctx, conn, pgxrecord.ConflictTarget{Columns: []string{"name"}})
+		require.NoError(t, err)
+		require.Equal(t, "alice", upserted.MustGet("created_by"))
+
+		strictTable := &pgxrecord.Table{
+			Name:                   pgx.Identifier{"t"},
+			ImmutableColumns:       []string{"created_by"},
+			StrictImmutableColumns: true,
+		}
+		err = strictTable.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		strictTable.Finalize()
+
+		strictRecord, err := strictTable.FindByPK(ctx, conn, record.MustGet("id"))
+		require.NoError(t, err)
+		strictRecord.MustSet("name", "Bob")
+		strictRecord.MustSet("created_by", "mallory")
+		err = strictRecord.Save(ctx, conn)
+		require.ErrorContains(t, err, `column "created_by" is immutable`)
+
+		err = strictTable.SaveBatch(ctx, conn, []*pgxrecord.Record{strictRecord})
+		require.ErrorContains(t, err, `column "created_by" is immutable`)
+
+		// A record whose only change is to an immutable column is not updated.
+		record.MustSet("created_by", "mallory")
+		sql, _ := table.UpdateSQL(record)
+		require.Equal(t, "", sql)
+		err = table.SaveBatch(ctx, conn, []*pgxrecord.Record{record})
+		require.NoError(t, err)
+		require.Equal(t, "mallory", record.MustGet("created_by"))
+
+		err = conn.QueryRow(ctx, `select created_by from t where id = $1`, record.MustGet("id")).Scan(&createdBy)
+		require.NoError(t, err)
+		require.Equal(t, "alice", createdBy)
+
+		_, err = table.UpdateAll(ctx, conn, map[string]any{"created_by": "mallory"}, nil, pgxrecord.Everything())
+		require.ErrorContains(t, err, `column "created_by" is immutable`)
+	})
+}
+
+func TestRecordDeleteReturning(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int
+)`)
+		require.NoError(t, err)
+
+		_, err = conn.Exec(ctx, `insert into t (name, age) values ('John', 42)`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		record, err := table.FindByPK(ctx, conn, 1)
+		require.NoError(t, err)
+
+		other, err := table.FindByPK(ctx, conn, 1)
+		require.NoError(t, err)
+
+		_, err = conn.Exec(ctx, `update t set age = 43 where id = 1`)
+		require.NoError(t, err)
+
+		record.MustSet("name", "Jane")
+		err = record.DeleteReturning(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, "John", record.MustGet("name"))
+		require.EqualValues(t, 43, record.MustGet("age"))
+
+		_, err = table.FindByPK(ctx, conn, 1)
+		require.ErrorIs(t, err, pgx.ErrNoRows)
+
+		err = record.DeleteReturning(ctx, conn)
+		require.ErrorContains(t, err, "not persisted")
+
+		err = other.DeleteReturning(ctx, conn)
+		require.ErrorIs(t, err, pgxrecord.ErrNotFound)
+		require.EqualValues(t, 42, other.MustGet("age"))
+	})
+}
+
+func TestRecordSoftDelete(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	deleted_at timestamptz
+)`)
+		require.NoError(t, err)
+
+		_, err = conn.Exec(ctx, `insert into t (name) values ('John'), ('Jane')`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name:             pgx.Identifier{"t"},
+			SoftDeleteColumn: "deleted_at",
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		record, err := table.FindByPK(ctx, conn, 1)
+		require.NoError(t, err)
+
+		err = record.SoftDelete(ctx, conn)
+		require.NoError(t, err)
+		require.NotNil(t, record.MustGet("deleted_at"))
+
+		_, err = table.FindByPK(ctx, conn, 1)
+		require.ErrorIs(t, err, pgx.ErrNoRows)
+
+		var records []*pgxrecord.Record
+		err = table.FindAllInto(ctx, conn, &records, nil)
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+		require.EqualValues(t, 2, records[0].MustGet("id"))
+
+		record, err = table.WithDeleted().FindByPK(ctx, conn, 1)
+		require.NoError(t, err)
+		require.NotNil(t, record.MustGet("deleted_at"))
+
+		err = table.WithDeleted().FindAllInto(ctx, conn, &records, nil)
+		require.NoError(t, err)
+		require.Len(t, records, 2)
+	})
+}
+
+func TestValidationErrorByField(t *testing.T) {
+	t.Parallel()
+
+	var err error = &pgxrecord.ValidationError{
+		Errors: []error{
+			pgxrecord.FieldErrorf("name", "can't be blank"),
+			pgxrecord.FieldErrorf("age", "must be greater than %d", 0),
+			pgxrecord.FieldErrorf("name", "is too short"),
+			errors.New("something else is wrong"),
+		},
+	}
+
+	var validationErr *pgxrecord.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	require.Equal(t, map[string][]string{
+		"name": {"can't be blank", "is too short"},
+		"age":  {"must be greater than 0"},
+		"":     {"something else is wrong"},
+	}, validationErr.ByField())
+	require.EqualError(t, err, "validation failed: name can't be blank; age must be greater than 0; name is too short; something else is wrong")
+}
+
+func TestConvertPgError(t *testing.T) {
+	t.Parallel()
+
+	pgErr := &pgconn.PgError{Code: "23505", ConstraintName: "t_a_b_key", Detail: "Key (a, b)=(1, 2) already exists."}
+	err := fmt.Errorf("save failed: %w", pgxrecord.ConvertPgError(pgErr))
+	var uniqueErr *pgxrecord.UniqueViolationError
+	require.ErrorAs(t, err, &uniqueErr)
+	require.Equal(t, "t_a_b_key", uniqueErr.ConstraintName)
+	require.Equal(t, []string{"a", "b"}, uniqueErr.Columns)
+	require.ErrorIs(t, err, pgErr)
+
+	pgErr = &pgconn.PgError{Code: "23503", ConstraintName: "t_user_id_fkey", Detail: `Key (user_id)=(5) is not present in table "users".`}
+	var fkErr *pgxrecord.ForeignKeyViolationError
+	require.ErrorAs(t, pgxrecord.ConvertPgError(pgErr), &fkErr)
+	require.Equal(t, "t_user_id_fkey", fkErr.ConstraintName)
+	require.Equal(t, []string{"user_id"}, fkErr.Columns)
+
+	pgErr = &pgconn.PgError{Code: "23502", ColumnName: "name"}
+	var notNullErr *pgxrecord.NotNullViolationError
+	require.ErrorAs(t, pgxrecord.ConvertPgError(pgErr), &notNullErr)
+	require.Equal(t, []string{"name"}, notNullErr.Columns)
+
+	pgErr = &pgconn.PgError{Code: "23514", ConstraintName: "t_age_check"}
+	var checkErr *pgxrecord.CheckViolationError
+	require.ErrorAs(t, pgxrecord.ConvertPgError(pgErr), &checkErr)
+	require.Equal(t, "t_age_check", checkErr.ConstraintName)
+	require.Nil(t, checkErr.Columns)
+
+	pgErr = &pgconn.PgError{Code: "42P01"}
+	require.Equal(t, error(pgErr), pgxrecord.ConvertPgError(pgErr))
+
+	require.NoError(t, pgxrecord.ConvertPgError(nil))
+}
+
+func TestRecordSaveTranslatePgError(t *testing.T) {
+	t.Parallel()
+
+	errTaken := errors.New("email is taken")
+	errConflict := errors.New("conflict")
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "email", OID: pgtype.TextOID, NotNull: true},
+		},
+		PgErrorTranslator: func(pgErr *pgconn.PgError) error {
+			if pgErr.Code == "23505" {
+				return errTaken
+			}
+			return nil
+		},
+	}
+	table.Finalize()
+
+	pgErr := &pgconn.PgError{Code: "23505", ConstraintName: "t_email_key"}
+	db := &failingRowsDB{err: pgErr}
+
+	record := table.NewRecord()
+	record.SetAttributes(map[string]any{"id": int32(1), "email": "john@example.com"})
+
+	err := record.Save(context.Background(), db)
+	require.ErrorIs(t, err, errTaken)
+	require.NotErrorIs(t, err, pgErr)
+
+	err = record.Save(context.Background(), db, pgxrecord.TranslatePgError(func(pgErr *pgconn.PgError) error { return errConflict }))
+	require.ErrorIs(t, err, errConflict)
+	require.NotErrorIs(t, err, errTaken)
+
+	err = record.Save(context.Background(), db, pgxrecord.TranslatePgError(func(pgErr *pgconn.PgError) error { return nil }))
+	require.ErrorIs(t, err, pgErr)
+
+	otherErr := &pgconn.PgError{Code: "23514"}
+	err = record.Save(context.Background(), &failingRowsDB{err: otherErr})
+	require.ErrorIs(t, err, otherErr)
+}
+
+func TestTableConstraintValidationError(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"users"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true, HasDefault: true},
+			{Name: "account_id", OID: pgtype.Int4OID, NotNull: true},
+			{Name: "email", OID: pgtype.TextOID, NotNull: true},
+			{Name: "age", OID: pgtype.Int4OID},
+		},
+		UniqueConstraints: []pgxrecord.UniqueConstraint{
+			{Name: "users_pkey", Columns: []string{"id"}, PrimaryKey: true},
+			{Name: "users_email_key", Columns: []string{"email"}},
+			{Name: "users_account_id_email_key", Columns: []string{"account_id", "email"}},
+			{Name: "users_lower_email_idx", Columns: []string{"lower(email)"}},
+		},
+		CheckConstraints: []pgxrecord.CheckConstraint{
+			{Name: "users_age_check", Expression: "age >= 0", Columns: []string{"age"}},
+		},
+		ConstraintMessages: map[string]string{
+			"users_account_id_email_key": "is already used in this account",
+		},
+	}
+	table.Finalize()
+
+	toByField := func(err error) map[string][]string {
+		var validationErr *pgxrecord.ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		return validationErr.ByField()
+	}
+
+	err := fmt.Errorf("save failed: %w", &pgconn.PgError{Code: "23505", ConstraintName: "users_email_key"})
+	require.Equal(t, map[string][]string{"email": {"has already been taken"}}, toByField(table.ConstraintValidationError(err)))
+
+	err = &pgconn.PgError{Code: "23505", ConstraintName: "users_account_id_email_key"}
+	require.Equal(t, map[string][]string{
+		"account_id": {"is already used in this account"},
+		"email":      {"is already used in this account"},
+	}, toByField(table.ConstraintValidationError(err)))
+
+	err = &pgconn.PgError{Code: "23505", ConstraintName: "users_lower_email_idx"}
+	require.Equal(t, map[string][]string{"": {"has already been taken"}}, toByField(table.ConstraintValidationError(err)))
+
+	err = &pgconn.PgError{Code: "23514", ConstraintName: "users_age_check"}
+	require.Equal(t, map[string][]string{"age": {"is invalid"}}, toByField(table.ConstraintValidationError(err)))
+
+	err = &pgconn.PgError{Code: "23505", ConstraintName: "unknown_key"}
+	require.Equal(t, err, table.ConstraintValidationError(err))
+
+	err = &pgconn.PgError{Code: "23503", ConstraintName: "users_account_id_fkey"}
+	require.Equal(t, err, table.ConstraintValidationError(err))
+
+	err = errors.New("other")
+	require.Equal(t, err, table.ConstraintValidationError(err))
+}
+
+func TestIsConstraintViolation(t *testing.T) {
+	t.Parallel()
+
+	uniqueErr := fmt.Errorf("save failed: %w", pgxrecord.ConvertPgError(&pgconn.PgError{Code: "23505", ConstraintName: "users_email_key"}))
+	require.True(t, pgxrecord.IsUniqueViolation(uniqueErr, "users_email_key"))
+	require.True(t, pgxrecord.IsUniqueViolation(uniqueErr, ""))
+	require.False(t, pgxrecord.IsUniqueViolation(uniqueErr, "users_name_key"))
+	require.False(t, pgxrecord.IsForeignKeyViolation(uniqueErr, ""))
+
+	fkErr := fmt.Errorf("save failed: %w", &pgconn.PgError{Code: "23503", ConstraintName: "posts_user_id_fkey"})
+	require.True(t, pgxrecord.IsForeignKeyViolation(fkErr, "posts_user_id_fkey"))
+	require.True(t, pgxrecord.IsForeignKeyViolation(fkErr, ""))
+	require.False(t, pgxrecord.IsForeignKeyViolation(fkErr, "other_fkey"))
+	require.False(t, pgxrecord.IsUniqueViolation(fkErr, ""))
+
+	require.False(t, pgxrecord.IsUniqueViolation(errors.New("unique"), ""))
+	require.False(t, pgxrecord.IsUniqueViolation(nil, ""))
+}
+
+func TestSelectNamedArgs(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		sql := `select n from generate_series(1, 10) n where n >= @min and n <= @max order by n`
+		args := []any{pgx.NamedArgs{"min": 3, "max": 5}}
+
+		ns, err := pgxrecord.SelectRows(ctx, conn, sql, args, pgx.RowTo[int32])
+		require.NoError(t, err)
+		require.Equal(t, []int32{3, 4, 5}, ns)
+
+		ns, err = pgxrecord.Select(ctx, conn, sql, args, pgx.RowTo[int32])
+		require.NoError(t, err)
+		require.Equal(t, []int32{3, 4, 5}, ns)
+
+		n, err := pgxrecord.SelectRow(ctx, conn, `select @n::int4`, []any{pgx.NamedArgs{"n": 7}}, pgx.RowTo[int32])
+		require.NoError(t, err)
+		require.EqualValues(t, 7, n)
+	})
+}
+
+func TestSelectNamedArgsMixed(t *testing.T) {
+	t.Parallel()
+
+	db := &recordingDB{}
+	args := []any{pgx.NamedArgs{"min": 3}, 5}
+
+	_, err := pgxrecord.SelectRows(context.Background(), db, `select 1`, args, pgx.RowTo[int32])
+	require.EqualError(t, err, "pgx.NamedArgs cannot be mixed with other arguments")
+
+	_, err = pgxrecord.Select(context.Background(), db, `select 1`, args, pgx.RowTo[int32])
+	require.EqualError(t, err, "pgx.NamedArgs cannot be mixed with other arguments")
+
+	_, err = pgxrecord.SelectRow(context.Background(), db, `select 1`, []any{5, pgx.NamedArgs{"min": 3}}, pgx.RowTo[int32])
+	require.EqualError(t, err, "pgx.NamedArgs cannot be mixed with other arguments")
+
+	require.Empty(t, db.sqls)
+}
+
+func TestSelectRowsContextCanceled(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		n := 0
+		_, err := pgxrecord.SelectRows(ctx, conn, `select n from generate_series(1, 1000000) n`, nil, func(row pgx.CollectableRow) (int32, error) {
+			n++
+			if n == 10 {
+				cancel()
+			}
+			var value int32
+			err := row.Scan(&value)
+			return value, err
+		})
+		require.ErrorIs(t, err, context.Canceled)
+		require.Equal(t, 10, n)
+	})
+}
+
+func TestSelectRowContextCanceled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
 
-		record.SetAttributes(map[string]any{"name": "John", "age": 42})
-		require.Equal(t, map[string]any{"id": nil, "name": "John", "age": 42}, record.Attributes())
-	})
+	// The row is already received so only the context check can stop it from being read.
+	db := &failingRowsDB{scanErr: errors.New("row should not be read")}
+	_, err := pgxrecord.SelectRow(ctx, db, `select 1`, nil, pgx.RowTo[int32])
+	require.ErrorIs(t, err, context.Canceled)
+	require.True(t, db.rows[0].closed)
 }
 
-func TestTableFindByPK(t *testing.T) {
+func TestWithTx(t *testing.T) {
 	t.Parallel()
 
 	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
 		_, err := conn.Exec(ctx, `create temporary table t (
 	id int primary key generated by default as identity,
-	name text not null,
-	age int
+	name text not null
 )`)
 		require.NoError(t, err)
 
-		var id int32
-		err = conn.QueryRow(ctx, `insert into t (name, age) values ('John', 42) returning id`).Scan(&id)
-		require.NoError(t, err)
-
 		table := &pgxrecord.Table{
 			Name: pgx.Identifier{"t"},
 		}
@@ -127,20 +7063,44 @@ func TestTableFindByPK(t *testing.T) {
 		require.NoError(t, err)
 		table.Finalize()
 
-		record, err := table.FindByPK(ctx, conn, id)
+		save := func(tx pgx.Tx) error {
+			record := table.NewRecord()
+			record.MustSet("name", "John")
+			return record.Save(ctx, tx)
+		}
+
+		err = pgxrecord.WithTx(ctx, conn, save)
 		require.NoError(t, err)
-		require.Equal(t, map[string]any{"id": int32(1), "name": "John", "age": int32(42)}, record.Attributes())
+
+		errRollback := errors.New("rollback")
+		err = pgxrecord.WithTx(ctx, conn, func(tx pgx.Tx) error {
+			err := save(tx)
+			require.NoError(t, err)
+			return errRollback
+		})
+		require.ErrorIs(t, err, errRollback)
+
+		require.PanicsWithValue(t, "boom", func() {
+			pgxrecord.WithTx(ctx, conn, func(tx pgx.Tx) error {
+				err := save(tx)
+				require.NoError(t, err)
+				panic("boom")
+			})
+		})
+
+		n, err := table.CountAll(ctx, conn)
+		require.NoError(t, err)
+		require.EqualValues(t, 1, n)
 	})
 }
 
-func TestRecordSetAndGet(t *testing.T) {
+func TestWithSavepoint(t *testing.T) {
 	t.Parallel()
 
 	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
 		_, err := conn.Exec(ctx, `create temporary table t (
 	id int primary key generated by default as identity,
-	name text not null,
-	age int
+	name text not null unique
 )`)
 		require.NoError(t, err)
 
@@ -151,59 +7111,107 @@ func TestRecordSetAndGet(t *testing.T) {
 		require.NoError(t, err)
 		table.Finalize()
 
-		record := table.NewRecord()
+		save := func(tx pgx.Tx, name string) error {
+			record := table.NewRecord()
+			record.MustSet("name", name)
+			return record.Save(ctx, tx)
+		}
 
-		err = record.Set("name", "John")
+		err = pgxrecord.WithTx(ctx, conn, func(tx pgx.Tx) error {
+			err := save(tx, "John")
+			require.NoError(t, err)
+
+			err = pgxrecord.WithSavepoint(ctx, tx, "duplicate \"name\"", func() error {
+				return save(tx, "John")
+			})
+			var pgErr *pgconn.PgError
+			require.ErrorAs(t, err, &pgErr)
+			require.Equal(t, "23505", pgErr.Code)
+
+			return pgxrecord.WithSavepoint(ctx, tx, "", func() error {
+				err := save(tx, "Jane")
+				require.NoError(t, err)
+
+				err = pgxrecord.WithSavepoint(ctx, tx, "", func() error {
+					err := save(tx, "Bill")
+					require.NoError(t, err)
+					return errors.New("rollback")
+				})
+				require.EqualError(t, err, "rollback")
+
+				return nil
+			})
+		})
 		require.NoError(t, err)
 
-		name, err := record.Get("name")
+		names, err := pgxrecord.SelectRows(ctx, conn, `select name from t order by id`, nil, pgx.RowTo[string])
 		require.NoError(t, err)
-		require.Equal(t, "John", name)
+		require.Equal(t, []string{"John", "Jane"}, names)
 	})
 }
 
-func TestRecordSaveInsert(t *testing.T) {
+func TestWithRetry(t *testing.T) {
 	t.Parallel()
 
-	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
-		_, err := conn.Exec(ctx, `create temporary table t (
-	id int primary key generated by default as identity,
-	name text not null,
-	age int
-)`)
-		require.NoError(t, err)
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "name", OID: pgtype.TextOID},
+		},
+	}
+	table.Finalize()
 
-		table := &pgxrecord.Table{
-			Name: pgx.Identifier{"t"},
+	record := table.NewRecord()
+	record.MustSet("name", "John")
+
+	serializationFailure := &pgconn.PgError{Code: "40001"}
+	attempts := 0
+	var waits []int
+	err := pgxrecord.WithRetry(context.Background(), 5, func(attempt int) time.Duration {
+		waits = append(waits, attempt)
+		return time.Millisecond
+	}, func() error {
+		attempts++
+		require.Equal(t, "John", record.MustGet("name"))
+		record.MustSet("name", "Jane")
+		if attempts < 3 {
+			return fmt.Errorf("commit: %w", serializationFailure)
 		}
-		err = table.LoadAllColumns(ctx, conn)
-		require.NoError(t, err)
-		table.Finalize()
+		return nil
+	}, record)
+	require.NoError(t, err)
+	require.Equal(t, 3, attempts)
+	require.Equal(t, []int{1, 2}, waits)
+	require.Equal(t, "Jane", record.MustGet("name"))
 
-		record := table.NewRecord()
-		record.SetAttributes(map[string]any{"name": "John", "age": 42})
-		err = record.Save(ctx, conn)
-		require.NoError(t, err)
+	attempts = 0
+	err = pgxrecord.WithRetry(context.Background(), 2, nil, func() error {
+		attempts++
+		return &pgconn.PgError{Code: "40P01"}
+	})
+	require.True(t, pgxrecord.IsRetryable(err))
+	require.Equal(t, 2, attempts)
 
-		require.Equal(t, map[string]any{"id": int32(1), "name": "John", "age": int32(42)}, record.Attributes())
+	attempts = 0
+	err = pgxrecord.WithRetry(context.Background(), 5, nil, func() error {
+		attempts++
+		return &pgconn.PgError{Code: "23505"}
 	})
+	require.False(t, pgxrecord.IsRetryable(err))
+	require.Equal(t, 1, attempts)
 }
 
-func TestRecordSaveUpdate(t *testing.T) {
+func TestWithTxOptions(t *testing.T) {
 	t.Parallel()
 
 	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
 		_, err := conn.Exec(ctx, `create temporary table t (
 	id int primary key generated by default as identity,
-	name text not null,
-	age int
+	name text not null
 )`)
 		require.NoError(t, err)
 
-		var id int32
-		err = conn.QueryRow(ctx, `insert into t (name, age) values ('John', 42) returning id`).Scan(&id)
-		require.NoError(t, err)
-
 		table := &pgxrecord.Table{
 			Name: pgx.Identifier{"t"},
 		}
@@ -211,17 +7219,35 @@ func TestRecordSaveUpdate(t *testing.T) {
 		require.NoError(t, err)
 		table.Finalize()
 
-		record, err := table.FindByPK(ctx, conn, id)
-		require.NoError(t, err)
-		require.Equal(t, map[string]any{"id": int32(1), "name": "John", "age": int32(42)}, record.Attributes())
+		err = pgxrecord.WithTxOptions(ctx, conn, pgx.TxOptions{AccessMode: pgx.ReadOnly}, func(tx pgx.Tx) error {
+			var isolationLevel string
+			err := tx.QueryRow(ctx, "show transaction_isolation").Scan(&isolationLevel)
+			require.NoError(t, err)
+			require.Equal(t, "read committed", isolationLevel)
 
-		record.MustSet("name", "Bill")
-		err = record.Save(ctx, conn)
+			record := table.NewRecord()
+			record.MustSet("name", "John")
+			return record.Save(ctx, tx)
+		})
+		var pgErr *pgconn.PgError
+		require.ErrorAs(t, err, &pgErr)
+		require.Equal(t, "25006", pgErr.Code) // read_only_sql_transaction
+
+		err = pgxrecord.WithTxOptions(ctx, conn, pgx.TxOptions{IsoLevel: pgx.Serializable}, func(tx pgx.Tx) error {
+			var isolationLevel string
+			err := tx.QueryRow(ctx, "show transaction_isolation").Scan(&isolationLevel)
+			require.NoError(t, err)
+			require.Equal(t, "serializable", isolationLevel)
+
+			record := table.NewRecord()
+			record.MustSet("name", "John")
+			return record.Save(ctx, tx)
+		})
 		require.NoError(t, err)
 
-		record, err = table.FindByPK(ctx, conn, id)
+		n, err := table.CountAll(ctx, conn)
 		require.NoError(t, err)
-		require.Equal(t, map[string]any{"id": int32(1), "name": "Bill", "age": int32(42)}, record.Attributes())
+		require.EqualValues(t, 1, n)
 	})
 }
 
@@ -250,6 +7276,163 @@ func TestSelect(t *testing.T) {
 	})
 }
 
+// failingRowsDB is a pgxrecord.DB whose rows return one row that fails to scan with scanErr, or no rows and err if
+// scanErr is nil.
+type failingRowsDB struct {
+	scanErr error
+	err     error
+	rows    []*failingRows
+}
+
+func (db *failingRowsDB) Query(ctx context.Context, sql string, optionsAndArgs ...any) (pgx.Rows, error) {
+	rows := &failingRows{scanErr: db.scanErr, err: db.err}
+	db.rows = append(db.rows, rows)
+	return rows, nil
+}
+
+type failingRows struct {
+	scanErr error
+	err     error
+	read    bool
+	closed  bool
+}
+
+func (rows *failingRows) Close()                                       { rows.closed = true }
+func (rows *failingRows) Err() error                                   { return rows.err }
+func (rows *failingRows) CommandTag() pgconn.CommandTag                { return pgconn.CommandTag{} }
+func (rows *failingRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (rows *failingRows) Scan(dest ...any) error                       { return rows.scanErr }
+func (rows *failingRows) Values() ([]any, error)                       { return nil, rows.scanErr }
+func (rows *failingRows) RawValues() [][]byte                          { return nil }
+func (rows *failingRows) Conn() *pgx.Conn                              { return nil }
+
+func (rows *failingRows) Next() bool {
+	if rows.read || rows.scanErr == nil {
+		return false
+	}
+	rows.read = true
+	return true
+}
+
+func TestQueryRowScanError(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "name", OID: pgtype.TextOID, NotNull: true},
+		},
+	}
+	table.Finalize()
+
+	scanErr := errors.New("scan failed")
+	db := &failingRowsDB{scanErr: scanErr}
+
+	record := table.NewRecord()
+	record.SetAttributes(map[string]any{"id": int32(1), "name": "John"})
+	err := record.Save(context.Background(), db)
+	require.ErrorIs(t, err, scanErr)
+	require.True(t, record.IsDirty())
+	require.Equal(t, pgconn.CommandTag{}, record.LastCommandTag())
+
+	err = record.Upsert(context.Background(), db, pgxrecord.ConflictTarget{Columns: []string{"id"}})
+	require.ErrorIs(t, err, scanErr)
+	require.True(t, record.IsDirty())
+
+	for _, rows := range db.rows {
+		require.True(t, rows.closed)
+	}
+
+	// An error reading the rows is returned instead of pgx.ErrNoRows.
+	queryErr := errors.New("query failed")
+	db = &failingRowsDB{err: queryErr}
+	err = record.Save(context.Background(), db)
+	require.ErrorIs(t, err, queryErr)
+	require.NotErrorIs(t, err, pgx.ErrNoRows)
+
+	for _, rows := range db.rows {
+		require.True(t, rows.closed)
+	}
+}
+
+func TestSelectScanErrorReleasesConnection(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	config, err := pgxpool.ParseConfig(testDatabaseConnString(t))
+	require.NoError(t, err)
+	config.MaxConns = 1
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	scanErr := errors.New("scan failed")
+	rowCount := 0
+	_, err = pgxrecord.Select(ctx, pool, `select n from generate_series(1,3) n`, nil, func(row pgx.CollectableRow) (int32, error) {
+		rowCount++
+		if rowCount == 2 {
+			return 0, scanErr
+		}
+		var n int32
+		err := row.Scan(&n)
+		return n, err
+	})
+	require.ErrorIs(t, err, scanErr)
+
+	// The connection must have been released back to the pool.
+	acquireCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	conn, err := pool.Acquire(acquireCtx)
+	require.NoError(t, err)
+	conn.Release()
+}
+
+func TestSelectScanErrorDoesNotExhaustPool(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	config, err := pgxpool.ParseConfig(testDatabaseConnString(t))
+	require.NoError(t, err)
+	config.MaxConns = 2
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	scanErr := errors.New("scan failed")
+	scanFn := func(row pgx.CollectableRow) (int32, error) {
+		return 0, scanErr
+	}
+
+	// Far more failing queries than connections. A leaked connection would block Acquire until ctx times out.
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_, err := pgxrecord.Select(ctx, pool, `select n from generate_series(1,10) n`, nil, scanFn)
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.ErrorIs(t, err, scanErr)
+	}
+
+	stat := pool.Stat()
+	require.EqualValues(t, 0, stat.AcquiredConns())
+}
+
 func TestSelectNoRows(t *testing.T) {
 	t.Parallel()
 
@@ -266,6 +7449,79 @@ func TestSelectNoRows(t *testing.T) {
 	})
 }
 
+func TestTableRowToRecord(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	age int
+);
+insert into t (name, age) values ('John', 42), ('Jane', 35);`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		rows, _ := conn.Query(ctx, `select * from t order by id`)
+		records, err := pgx.CollectRows(rows, table.RowToRecord)
+		require.NoError(t, err)
+		require.Len(t, records, 2)
+		require.Equal(t, map[string]any{"id": int32(1), "name": "John", "age": int32(42)}, records[0].Attributes())
+
+		records, err = pgxrecord.SelectRows(ctx, conn, `select age, id, name from t where age > $1`, []any{40}, table.RowToRecord)
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+		require.Equal(t, map[string]any{"id": int32(1), "name": "John", "age": int32(42)}, records[0].Attributes())
+
+		record, err := pgxrecord.SelectRow(ctx, conn, `select name, id from t where id = $1`, []any{2}, table.RowToRecord)
+		require.NoError(t, err)
+		require.Equal(t, "Jane", record.MustGet("name"))
+		_, err = record.Get("age")
+		require.Error(t, err)
+
+		record.MustSet("name", "Janet")
+		err = record.Save(ctx, conn)
+		require.NoError(t, err)
+		require.EqualValues(t, 35, record.MustGet("age"))
+
+		_, err = pgxrecord.SelectRows(ctx, conn, `select id, 1 as other from t`, nil, table.RowToRecord)
+		require.ErrorContains(t, err, `column "other" is not found`)
+
+		_, err = pgxrecord.SelectRows(ctx, conn, `select id, id from t`, nil, table.RowToRecord)
+		require.ErrorContains(t, err, `column "id" is returned more than once`)
+	})
+}
+
+func TestSelectRows(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		type Person struct {
+			ID   int32
+			Name string
+			Age  int32
+		}
+
+		people, err := pgxrecord.SelectRows(ctx, conn, `select n as id, 'John' as name, 42 as age from generate_series(1,2) n`, nil, pgx.RowToStructByName[Person])
+		require.NoError(t, err)
+		require.Equal(t, []Person{{ID: 1, Name: "John", Age: 42}, {ID: 2, Name: "John", Age: 42}}, people)
+
+		people, err = pgxrecord.SelectRows(ctx, conn, `select 1 as id, 'John' as name, 42 as age where false`, nil, pgx.RowToStructByName[Person])
+		require.NoError(t, err)
+		require.NotNil(t, people)
+		require.Len(t, people, 0)
+
+		_, err = pgxrecord.SelectRows(ctx, conn, `select 1/0 as id, 'John' as name, 42 as age`, nil, pgx.RowToStructByName[Person])
+		require.Error(t, err)
+	})
+}
+
 func TestSelectRow(t *testing.T) {
 	t.Parallel()
 
@@ -300,6 +7556,19 @@ func TestSelectRowNoRows(t *testing.T) {
 	})
 }
 
+func TestInsertAndUpdateWrapErrors(t *testing.T) {
+	t.Parallel()
+
+	db := &recordingDB{}
+	err := pgxrecord.InsertRow(context.Background(), db, pgx.Identifier{"t"}, map[string]any{"name": "John"})
+	require.ErrorIs(t, err, errRecordingDB)
+	require.EqualError(t, err, `pgxrecord: insert "t": recordingDB does not execute queries`)
+
+	_, err = pgxrecord.Update(context.Background(), db, pgx.Identifier{"public", "t"}, map[string]any{"name": "John"}, nil)
+	require.ErrorIs(t, err, errRecordingDB)
+	require.EqualError(t, err, `pgxrecord: update "public"."t": recordingDB does not execute queries`)
+}
+
 func TestInsert(t *testing.T) {
 	t.Parallel()
 
@@ -484,6 +7753,47 @@ func TestInsertRowReturning(t *testing.T) {
 	})
 }
 
+func TestInsertRowReturningComposite(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create type pg_temp.pgxrecord_address as (
+	street text,
+	city text
+)`)
+		require.NoError(t, err)
+
+		_, err = conn.Exec(ctx, `create temporary table t (
+	id int primary key generated by default as identity,
+	name text not null,
+	address pg_temp.pgxrecord_address
+)`)
+		require.NoError(t, err)
+
+		// Composite types must be registered with the connection before they can be scanned into a struct.
+		addressType, err := conn.LoadType(ctx, "pg_temp.pgxrecord_address")
+		require.NoError(t, err)
+		conn.TypeMap().RegisterType(addressType)
+
+		type Address struct {
+			Street string
+			City   string
+		}
+
+		type Person struct {
+			ID      int32
+			Name    string
+			Address Address
+		}
+
+		person, err := pgxrecord.InsertRowReturning(ctx, conn, pgx.Identifier{"t"}, map[string]any{"name": "John", "address": Address{Street: "1 Main St", City: "Springfield"}}, "*", pgx.RowToAddrOfStructByName[Person])
+		require.NoError(t, err)
+		require.EqualValues(t, 1, person.ID)
+		require.Equal(t, "John", person.Name)
+		require.Equal(t, Address{Street: "1 Main St", City: "Springfield"}, person.Address)
+	})
+}
+
 func TestInsertRowSQL(t *testing.T) {
 	t.Parallel()
 
@@ -561,7 +7871,7 @@ func TestExecRow(t *testing.T) {
 		require.Equal(t, "UPDATE 0", ct.String())
 
 		ct, err = pgxrecord.ExecRow(ctx, conn, "update t set name = 'Bill'")
-		require.ErrorContains(t, err, "too many rows")
+		require.ErrorIs(t, err, pgxrecord.ErrMultipleRows)
 		require.Equal(t, "UPDATE 2", ct.String())
 	})
 }
@@ -729,7 +8039,7 @@ func TestUpdateRow(t *testing.T) {
 		require.NoError(t, err)
 
 		err = pgxrecord.UpdateRow(ctx, conn, pgx.Identifier{"t"}, map[string]any{"age": 70}, nil)
-		require.ErrorContains(t, err, "too many rows")
+		require.ErrorIs(t, err, pgxrecord.ErrMultipleRows)
 	})
 }
 
@@ -766,6 +8076,168 @@ func TestUpdateRowReturning(t *testing.T) {
 		require.EqualValues(t, 70, person.Age)
 
 		person, err = pgxrecord.UpdateRowReturning(ctx, conn, pgx.Identifier{"t"}, map[string]any{"age": 70}, nil, "*", pgx.RowToAddrOfStructByPos[Person])
-		require.ErrorContains(t, err, "too many rows")
+		require.ErrorIs(t, err, pgxrecord.ErrMultipleRows)
+	})
+}
+
+func TestQuerySQLPlaceholderNumbering(t *testing.T) {
+	t.Parallel()
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+			{Name: "name", OID: pgtype.TextOID},
+			{Name: "age", OID: pgtype.Int4OID},
+		},
+	}
+	table.Finalize()
+
+	db := &recordingDB{}
+	_, err := table.Query().
+		WhereSQL("age between $1 and $2", 18, 65).
+		Where(map[string]any{"name": "John"}).
+		WhereSQL("age <> $1", 40).
+		Limit(10).
+		Offset(20).
+		All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+
+	_, err = table.Query().
+		WithSQL("adults", "select id from t where age >= $1", 18).
+		With("johns", table.Query().Select("id").Where(map[string]any{"name": "John"})).
+		WhereSQL(`"t"."id" in (select id from adults) and "t"."id" in (select id from johns) and age < $1`, 65).
+		Limit(5).
+		All(context.Background(), db)
+	require.ErrorIs(t, err, errRecordingDB)
+
+	require.Equal(t, []string{
+		`select "t"."id", "t"."name", "t"."age" from "t" where (age between $1 and $2) and "t"."name" = $3 and (age <> $4) limit $5 offset $6`,
+		`with "adults" as (select id from t where age >= $1), "johns" as (select "t"."id" from "t" where "t"."name" = $2) select "t"."id", "t"."name", "t"."age" from "t" where ("t"."id" in (select id from adults) and "t"."id" in (select id from johns) and age < $3) limit $4`,
+	}, db.sqls)
+	require.Equal(t, [][]any{
+		{18, 65, "John", 40, int64(10), int64(20)},
+		{18, "John", 65, int64(5)},
+	}, db.args)
+}
+
+func TestTableUpdateAllAndDeleteAllSQLWithVersionAndSoftDelete(t *testing.T) {
+	t.Parallel()
+
+	newTable := func(softDeleteColumn string) *pgxrecord.Table {
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+			Columns: []*pgxrecord.Column{
+				{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+				{Name: "name", OID: pgtype.TextOID},
+				{Name: "version", OID: pgtype.Int4OID, NotNull: true},
+				{Name: "deleted_at", OID: pgtype.TimestamptzOID},
+			},
+			VersionColumn:    "version",
+			SoftDeleteColumn: softDeleteColumn,
+		}
+		table.Finalize()
+		return table
+	}
+
+	db := &recordingDB{}
+	_, err := newTable("deleted_at").UpdateAll(context.Background(), db, map[string]any{"name": "Bob"}, map[string]any{"name": "John", "id": []int32{1, 2}})
+	require.ErrorIs(t, err, errRecordingDB)
+	_, err = newTable("").DeleteAll(context.Background(), db, map[string]any{"name": "John", "id": nil})
+	require.ErrorIs(t, err, errRecordingDB)
+	_, err = newTable("").DeleteAll(context.Background(), db, nil, pgxrecord.Everything())
+	require.ErrorIs(t, err, errRecordingDB)
+
+	require.Equal(t, []string{
+		`update "t" set "name" = $1, "version" = "version" + 1 where "t"."deleted_at" is null and "t"."id" = any($2) and "t"."name" = $3`,
+		`delete from "t" where "t"."id" is null and "t"."name" = $1`,
+		`delete from "t"`,
+	}, db.sqls)
+	require.Equal(t, [][]any{
+		{"Bob", []int32{1, 2}, "John"},
+		{"John"},
+		nil,
+	}, db.args)
+}
+
+func TestQueryCopyToSQL(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, `'John'`, pgxrecord.Private_quoteLiteral("John"))
+	require.Equal(t, `'O''Brien'`, pgxrecord.Private_quoteLiteral("O'Brien"))
+	require.Equal(t, `E'C:\\temp ''x'''`, pgxrecord.Private_quoteLiteral(`C:\temp 'x'`))
+
+	sql, err := pgxrecord.Private_writeBoundSQL(`select "a$1" from t where name = $1 and note <> '$2' and age > $2`, []string{`'John'::text`, `18::int4`})
+	require.NoError(t, err)
+	require.Equal(t, `select "a$1" from t where name = 'John'::text and note <> '$2' and age > 18::int4`, sql)
+
+	sql, err = pgxrecord.Private_writeBoundSQL("select $1, E'\\'$2', $$ $1 $$, /* $2 */ $2 -- $1", []string{"1", "2"})
+	require.NoError(t, err)
+	require.Equal(t, "select 1, E'\\'$2', $$ $1 $$, /* $2 */ 2 -- $1\n", sql)
+
+	_, err = pgxrecord.Private_writeBoundSQL(`select $3`, []string{"1", "2"})
+	require.ErrorContains(t, err, "placeholder $3 does not have an argument")
+
+	table := &pgxrecord.Table{
+		Name: pgx.Identifier{"t"},
+		Columns: []*pgxrecord.Column{
+			{Name: "id", OID: pgtype.Int4OID, NotNull: true, PrimaryKey: true},
+		},
+	}
+	table.Finalize()
+
+	_, err = table.Query().CopyTo(context.Background(), nil, io.Discard, pgxrecord.CopyFormat("xml"))
+	require.ErrorContains(t, err, `copy format "xml" is not supported`)
+
+	_, err = table.Query().CopyTo(context.Background(), nil, io.Discard, pgxrecord.CopyBinary, pgxrecord.CopyHeader())
+	require.ErrorContains(t, err, "copy header requires csv format")
+
+	_, err = table.Query().Select("missing").CopyTo(context.Background(), nil, io.Discard, pgxrecord.CopyCSV)
+	require.ErrorContains(t, err, `select column "missing" is not found`)
+}
+
+func TestQueryCopyTo(t *testing.T) {
+	t.Parallel()
+
+	defaultConnTestRunner.RunTest(context.Background(), t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Exec(ctx, `create temporary table t (
+	id int primary key,
+	name text not null,
+	tags text[] not null
+);
+insert into t (id, name, tags) values
+	(1, 'John', '{a}'),
+	(2, 'O''Brien', '{b}'),
+	(3, 'C:\temp', '{a,b}');`)
+		require.NoError(t, err)
+
+		table := &pgxrecord.Table{
+			Name: pgx.Identifier{"t"},
+		}
+		err = table.LoadAllColumns(ctx, conn)
+		require.NoError(t, err)
+		table.Finalize()
+
+		buf := &bytes.Buffer{}
+		n, err := table.Query().
+			Select("id", "name").
+			Where(map[string]any{"name": []string{"O'Brien", `C:\temp`}}).
+			OrderBy("id", pgxrecord.Asc).
+			CopyTo(ctx, conn, buf, pgxrecord.CopyCSV, pgxrecord.CopyHeader())
+		require.NoError(t, err)
+		require.EqualValues(t, 2, n)
+		require.Equal(t, "id,name\n2,O'Brien\n3,C:\\temp\n", buf.String())
+
+		buf.Reset()
+		n, err = table.Query().WhereSQL("$1 = any(tags)", "a").OrderBy("id", pgxrecord.Asc).Limit(1).CopyTo(ctx, conn, buf, pgxrecord.CopyText)
+		require.NoError(t, err)
+		require.EqualValues(t, 1, n)
+		require.Equal(t, "1\tJohn\t{a}\n", buf.String())
+
+		buf.Reset()
+		n, err = table.Query().CopyTo(ctx, conn, buf, pgxrecord.CopyBinary)
+		require.NoError(t, err)
+		require.EqualValues(t, 3, n)
+		require.True(t, bytes.HasPrefix(buf.Bytes(), []byte("PGCOPY\n\xff\r\n\x00")))
 	})
 }
@@ -1,6 +1,8 @@
 package pgxrecord
 
 import (
+	"strings"
+
 	"github.com/jackc/pgx/v5"
 )
 
@@ -19,3 +21,39 @@ func Private_insertSQL(tableName pgx.Identifier, rows []map[string]any, returnin
 func Private_updateSQL(tableName pgx.Identifier, setValues, whereValues map[string]any, returningClause string) (sql string, args []any) {
 	return updateSQL(tableName, setValues, whereValues, returningClause)
 }
+
+func Private_selectByPKQuery(t *Table) string {
+	return t.selectByPKQuery
+}
+
+func Private_deleteQueries(t *Table) (deleteQuery, softDeleteQuery string) {
+	return t.deleteQuery, t.softDeleteQuery
+}
+
+func Private_snakeCase(s string) string {
+	return snakeCase(s)
+}
+
+func Private_compareKeyValues(a, b any) int {
+	return compareKeyValues(a, b)
+}
+
+func Private_quoteLiteral(s string) string {
+	return quoteLiteral(s)
+}
+
+func Private_writeBoundSQL(sql string, literals []string) (string, error) {
+	b := &strings.Builder{}
+	err := writeBoundSQL(b, sql, literals)
+	return b.String(), err
+}
+
+func Private_writeRenumberedSQL(sql string, offset int, argCount int) (string, error) {
+	b := &strings.Builder{}
+	err := writeRenumberedSQL(b, sql, offset, argCount)
+	return b.String(), err
+}
+
+func Private_tableDB(t *Table, db DB, op string) DB {
+	return t.db(db, op)
+}
@@ -0,0 +1,1319 @@
+package pgxrecord
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Query is a select query on a table. It is built by chaining methods and run by a method such as All. The chaining
+// methods modify and return the receiver. An error while building the query is returned when it is run.
+type Query struct {
+	table      *Table
+	selected   []bool
+	exprs      []selectExpression
+	distinct   bool
+	distinctOn []string
+	with       []commonTableExpression
+	joins      []string
+	conditions []queryCondition
+	orderBy    []orderByTerm
+	limit      int64
+	offset     int64
+	lock       rowLock
+	err        error
+}
+
+// queryCondition is a condition added by Where, WhereSQL, or WhereExists. Exactly one of conditions, sql, and exists
+// is set.
+type queryCondition struct {
+	conditions map[string]any
+	sql        string
+	args       []any
+	exists     *Query
+}
+
+// commonTableExpression is a common table expression added by With, WithSQL, or WithRecursiveSQL. Exactly one of
+// query and sql is set.
+type commonTableExpression struct {
+	name      string
+	query     *Query
+	sql       string
+	args      []any
+	recursive bool
+}
+
+// selectExpression is an SQL expression added by SelectExpr whose value is stored in attribute.
+type selectExpression struct {
+	attribute string
+	expr      string
+}
+
+// rowLock is the locking clause added by ForUpdate, ForUpdateSkipLocked, or ForShare. strength is empty if the query
+// does not lock rows.
+type rowLock struct {
+	strength   string
+	waitPolicy string
+}
+
+// orderByTerm is an order by expression and its direction and nulls ordering such as "asc nulls last".
+type orderByTerm struct {
+	expr      string
+	direction string
+}
+
+// Direction is the direction of an order by.
+type Direction int
+
+const (
+	Asc Direction = iota
+	Desc
+)
+
+// Query returns a new Query that selects all records from t. It must be called after Finalize.
+func (t *Table) Query() *Query {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	return &Query{table: t}
+}
+
+// DefineScope defines a named scope that can be applied to a query with Query.Scope. fn adds to the query such as with
+// Where and returns it. e.g. table.DefineScope("active", func(q *Query) *Query { return q.Where(map[string]any{"active":
+// true}) }). It must be called before Finalize.
+func (t *Table) DefineScope(name string, fn func(q *Query) *Query) {
+	if t.finalized {
+		panic("cannot call after table finalized")
+	}
+
+	if t.scopes == nil {
+		t.scopes = make(map[string]func(*Query) *Query)
+	}
+	t.scopes[name] = fn
+}
+
+// Scope applies the scope name defined with DefineScope to the query. Scopes compose like the methods they call so
+// conditions from multiple scopes are combined with and.
+func (q *Query) Scope(name string) *Query {
+	fn, ok := q.table.scopes[name]
+	if !ok {
+		q.setErr(fmt.Errorf("scope %q is not found", name))
+		return q
+	}
+
+	return fn(q)
+}
+
+// Select restricts the columns the query reads to columns. The records only have the selected attributes loaded. Get
+// returns an error for the others until they are set. The primary key columns and the version column are always
+// selected so the records can still be saved. Multiple calls are combined. columns must be columns of the table.
+func (q *Query) Select(columns ...string) *Query {
+	t := q.table
+	if q.selected == nil {
+		q.selected = make([]bool, len(t.Columns))
+		for _, idx := range t.pkIndexes {
+			q.selected[idx] = true
+		}
+		if t.versionIndex >= 0 {
+			q.selected[t.versionIndex] = true
+		}
+	}
+
+	for _, column := range columns {
+		idx, ok := t.nameToColumnIndex[column]
+		if !ok {
+			q.setErr(fmt.Errorf("select column %q is not found", column))
+			continue
+		}
+		q.selected[idx] = true
+	}
+
+	return q
+}
+
+// SelectExpr adds the SQL expression expr to the select list of the query. e.g. SelectExpr("double_age", "age * 2").
+// Its value is stored in attribute on each record returned by All and can be read with Get. attribute must not be a
+// column of the table. It is read-only. It is not included in Attributes and it is never written by Save. expr is not
+// escaped so it must not contain user input. AllMaps includes it. The aggregates, GroupBy, and Subquery ignore it.
+func (q *Query) SelectExpr(attribute string, expr string) *Query {
+	if _, ok := q.table.nameToColumnIndex[attribute]; ok {
+		q.setErr(fmt.Errorf("select expression attribute %q is a column", attribute))
+		return q
+	}
+	for _, se := range q.exprs {
+		if se.attribute == attribute {
+			q.setErr(fmt.Errorf("select expression attribute %q is duplicated", attribute))
+			return q
+		}
+	}
+
+	q.exprs = append(q.exprs, selectExpression{attribute: attribute, expr: expr})
+	return q
+}
+
+// Distinct makes the query select distinct rows. The aggregates and GroupBy ignore it.
+func (q *Query) Distinct() *Query {
+	q.distinct = true
+	return q
+}
+
+// DistinctOn makes the query keep only the first row of each set of rows with equal values of columns. Multiple calls
+// are combined. If the query has an OrderBy, PostgreSQL requires the leading order by columns, as many as there are
+// distinct on columns, to be distinct on columns so it is an error if they are not. The aggregates and GroupBy ignore
+// it. columns must be columns of the table.
+func (q *Query) DistinctOn(columns ...string) *Query {
+	for _, column := range columns {
+		idx, ok := q.table.nameToColumnIndex[column]
+		if !ok {
+			q.setErr(fmt.Errorf("distinct on column %q is not found", column))
+			continue
+		}
+		q.distinctOn = append(q.distinctOn, q.table.quotedName+"."+q.table.Columns[idx].quotedName)
+	}
+	return q
+}
+
+// With adds the common table expression name defined by sub to the query. e.g. q.With("recent", sub) writes with
+// "recent" as (<sub>) before the select. name is quoted as an identifier unless the table has UnquotedIdentifiers. The
+// table can be referenced with Join or WhereSQL. The placeholders of sub are numbered before the rest of the query.
+// Multiple calls are combined in call order. Records are still read from the columns of the query's own table.
+func (q *Query) With(name string, sub *Query) *Query {
+	if name == "" || sub == nil {
+		q.setErr(fmt.Errorf("with requires a name and a query"))
+		return q
+	}
+
+	q.with = append(q.with, commonTableExpression{name: name, query: sub})
+	return q
+}
+
+// WithSQL is like With but the common table expression is defined by sql. Placeholders are numbered from $1 for args
+// and are renumbered to follow the arguments of the rest of the query. sql is not escaped so it must not contain user
+// input.
+func (q *Query) WithSQL(name string, sql string, args ...any) *Query {
+	return q.withSQL(name, sql, args, false)
+}
+
+// WithRecursiveSQL is like WithSQL but the common table expression may refer to itself. If any common table expression
+// is recursive the query is written with with recursive.
+func (q *Query) WithRecursiveSQL(name string, sql string, args ...any) *Query {
+	return q.withSQL(name, sql, args, true)
+}
+
+func (q *Query) withSQL(name string, sql string, args []any, recursive bool) *Query {
+	if name == "" || strings.TrimSpace(sql) == "" {
+		q.setErr(fmt.Errorf("with requires a name and sql"))
+		return q
+	}
+
+	q.with = append(q.with, commonTableExpression{name: name, sql: sql, args: args, recursive: recursive})
+	return q
+}
+
+// writeWith writes the with clause followed by a space to b. It writes nothing if the query has no common table
+// expressions. It returns args with the arguments of the common table expressions appended.
+func (q *Query) writeWith(b *strings.Builder, args []any) ([]any, error) {
+	if len(q.with) == 0 {
+		return args, nil
+	}
+
+	b.WriteString("with ")
+	for _, cte := range q.with {
+		if cte.recursive {
+			b.WriteString("recursive ")
+			break
+		}
+	}
+
+	for i, cte := range q.with {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(q.table.quoteIdentifier(cte.name))
+		b.WriteString(" as ")
+
+		if cte.query != nil {
+			b.WriteByte('(')
+			var err error
+			args, err = cte.query.writeSelectSQL(b, args)
+			if err != nil {
+				return nil, err
+			}
+			b.WriteByte(')')
+			continue
+		}
+
+		err := writeRenumberedSQL(b, cte.sql, len(args), len(cte.args))
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, cte.args...)
+	}
+	b.WriteByte(' ')
+
+	return args, nil
+}
+
+// Join adds an inner join of table on condition. table may be schema qualified as "schema.table" and each part is
+// quoted as an identifier unless the table has UnquotedIdentifiers. condition is SQL that is not escaped so it must not
+// contain user input. The query still only reads the columns of its own table into records. A row that matches more
+// than one joined row is returned once for each match.
+func (q *Query) Join(table string, condition string) *Query {
+	return q.join("join", table, condition)
+}
+
+// LeftJoin is like Join but adds a left join.
+func (q *Query) LeftJoin(table string, condition string) *Query {
+	return q.join("left join", table, condition)
+}
+
+func (q *Query) join(joinType string, table string, condition string) *Query {
+	if table == "" || condition == "" {
+		q.setErr(fmt.Errorf("%s requires a table and a condition", joinType))
+		return q
+	}
+
+	q.joins = append(q.joins, joinType+" "+q.table.quoteIdentifiers(strings.Split(table, "."))+" on "+condition)
+	return q
+}
+
+// Where adds conditions to the query. conditions is a map of column names to values that are combined with and. A nil
+// value matches NULL. A slice matches any of its values unless the column is an array or json column. Use NotIn to match
+// none of the values. Multiple calls are combined with and.
+func (q *Query) Where(conditions map[string]any) *Query {
+	if len(conditions) > 0 {
+		q.conditions = append(q.conditions, queryCondition{conditions: conditions})
+	}
+	return q
+}
+
+// WhereSQL adds a condition written in SQL such as "age > $1" or "created_at between $1 and $2". Placeholders are
+// numbered from $1 for args and are renumbered to follow the arguments of the rest of the query. sql is not escaped so
+// it must not contain user input. Column names in sql should be qualified if the query has joins. Multiple calls and
+// calls to Where are combined with and.
+func (q *Query) WhereSQL(sql string, args ...any) *Query {
+	if strings.TrimSpace(sql) == "" {
+		q.setErr(fmt.Errorf("where sql must not be empty"))
+		return q
+	}
+
+	q.conditions = append(q.conditions, queryCondition{sql: sql, args: args})
+	return q
+}
+
+// WhereExists adds a condition that sub matches at least one row. sub is usually correlated to the query with WhereSQL.
+// e.g. customers.Query().WhereExists(orders.Query().WhereSQL(`"orders"."customer_id" = "customers"."id"`)). The order
+// by and select of sub are ignored.
+func (q *Query) WhereExists(sub *Query) *Query {
+	q.conditions = append(q.conditions, queryCondition{exists: sub})
+	return q
+}
+
+// WhereJSON adds a condition that the text of the top level key of the json or jsonb column equals value. e.g.
+// WhereJSON("metadata", "plan", "pro") is written as "t"."metadata"->>'plan' = $1. key is written as a string literal
+// so an expression index on the same expression can be used. A missing key or a JSON null never matches. Multiple calls
+// and calls to Where are combined with and.
+func (q *Query) WhereJSON(column string, key string, value string) *Query {
+	expr, ok := q.jsonColumnExpr(column, false)
+	if !ok {
+		return q
+	}
+
+	sql := expr + "->>'" + strings.ReplaceAll(key, "'", "''") + "' = $1"
+	q.conditions = append(q.conditions, queryCondition{sql: sql, args: []any{value}})
+	return q
+}
+
+// WhereJSONContains adds a condition that the jsonb column contains value. e.g. WhereJSONContains("metadata",
+// map[string]any{"plan": "pro"}) is written as "t"."metadata" @> $1. value is encoded as JSON. Containment is not
+// defined for json columns. Multiple calls and calls to Where are combined with and.
+func (q *Query) WhereJSONContains(column string, value any) *Query {
+	expr, ok := q.jsonColumnExpr(column, true)
+	if !ok {
+		return q
+	}
+
+	q.conditions = append(q.conditions, queryCondition{sql: expr + " @> $1", args: []any{value}})
+	return q
+}
+
+// jsonColumnExpr returns the qualified name of the json or jsonb column. If the column is not found or is not json, or
+// is json rather than jsonb when jsonbOnly is true, it sets the query error and returns false.
+func (q *Query) jsonColumnExpr(column string, jsonbOnly bool) (string, bool) {
+	t := q.table
+	idx, ok := t.nameToColumnIndex[column]
+	if !ok {
+		q.setErr(fmt.Errorf("json condition column %q is not found", column))
+		return "", false
+	}
+
+	c := t.Columns[idx]
+	switch {
+	case c.OID == pgtype.JSONBOID:
+	case c.OID == pgtype.JSONOID && !jsonbOnly:
+	case jsonbOnly:
+		q.setErr(fmt.Errorf("json condition column %q is not jsonb", column))
+		return "", false
+	default:
+		q.setErr(fmt.Errorf("json condition column %q is not json or jsonb", column))
+		return "", false
+	}
+
+	return t.quotedName + "." + c.quotedName, true
+}
+
+// Subquery is a query that selects a single column. It is created by Query.Subquery and used as a condition value.
+type Subquery struct {
+	query  *Query
+	column string
+}
+
+// Subquery returns the query as a subquery that selects column. When it is used as a value in the conditions of Where,
+// FindAll, or Count the condition matches rows where the condition column is in the subquery. e.g.
+// orders.Query().Where(map[string]any{"customer_id": customers.Query().Where(map[string]any{"region":
+// "west"}).Subquery("id")}). The placeholders of the subquery are numbered to follow the rest of the query. The order by
+// and select of the query are ignored. column must be one of the table's columns.
+func (q *Query) Subquery(column string) *Subquery {
+	idx, ok := q.table.nameToColumnIndex[column]
+	if !ok {
+		q.setErr(fmt.Errorf("subquery column %q is not found", column))
+	} else {
+		column = q.table.quotedName + "." + q.table.Columns[idx].quotedName
+	}
+
+	return &Subquery{query: q, column: column}
+}
+
+// writeSQL writes the SQL of the subquery to b. It returns args with the subquery arguments appended.
+func (sq *Subquery) writeSQL(b *strings.Builder, args []any) ([]any, error) {
+	return sq.query.writeSubquerySQL(b, sq.column, args)
+}
+
+// writeSubquerySQL writes a select of selectList to b for use as a subquery. It returns args with the query arguments
+// appended.
+func (q *Query) writeSubquerySQL(b *strings.Builder, selectList string, args []any) ([]any, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+
+	args, err := q.writeWith(b, args)
+	if err != nil {
+		return nil, err
+	}
+
+	b.WriteString("select ")
+	b.WriteString(selectList)
+	b.WriteString(" from ")
+	b.WriteString(q.table.quotedQualifiedName)
+
+	args, err = q.writeJoinsAndWhereClause(b, args)
+	if err != nil {
+		return nil, err
+	}
+
+	if q.limit > 0 {
+		args = append(args, q.limit)
+		b.WriteString(" limit $")
+		b.WriteString(strconv.Itoa(len(args)))
+	}
+
+	if q.offset > 0 {
+		args = append(args, q.offset)
+		b.WriteString(" offset $")
+		b.WriteString(strconv.Itoa(len(args)))
+	}
+
+	return args, nil
+}
+
+// OrderOption is an option for Query.OrderBy.
+type OrderOption func(*orderOptions)
+
+type orderOptions struct {
+	collation string
+	nulls     string
+}
+
+// Collate orders by the column in collation instead of the column's collation. e.g. Collate("de-u-co-phonebk") is
+// written as collate "de-u-co-phonebk". collation is quoted as an identifier so it is case sensitive.
+func Collate(collation string) OrderOption {
+	return func(o *orderOptions) {
+		o.collation = collation
+	}
+}
+
+// NullsFirst orders NULL values before non-NULL values. Without NullsFirst or NullsLast PostgreSQL orders NULL values
+// as if they were larger than any non-NULL value.
+func NullsFirst() OrderOption {
+	return func(o *orderOptions) {
+		o.nulls = " nulls first"
+	}
+}
+
+// NullsLast orders NULL values after non-NULL values.
+func NullsLast() OrderOption {
+	return func(o *orderOptions) {
+		o.nulls = " nulls last"
+	}
+}
+
+// OrderBy orders the query by column in direction. Multiple calls are combined in call order. column must be one of
+// the table's columns.
+func (q *Query) OrderBy(column string, direction Direction, options ...OrderOption) *Query {
+	var o orderOptions
+	for _, option := range options {
+		option(&o)
+	}
+
+	idx, ok := q.table.nameToColumnIndex[column]
+	if !ok {
+		q.setErr(fmt.Errorf("order by column %q is not found", column))
+		return q
+	}
+
+	// The column is qualified as it may be ambiguous with joined tables.
+	term := orderByTerm{expr: q.table.quotedName + "." + q.table.Columns[idx].quotedName}
+	if o.collation != "" {
+		term.expr += " collate " + q.table.quoteIdentifier(o.collation)
+	}
+	switch direction {
+	case Asc:
+		term.direction = "asc"
+	case Desc:
+		term.direction = "desc"
+	default:
+		q.setErr(fmt.Errorf("invalid order by direction: %d", direction))
+		return q
+	}
+	term.direction += o.nulls
+
+	q.orderBy = append(q.orderBy, term)
+	return q
+}
+
+// Limit limits the query to n rows. 0 means no limit.
+func (q *Query) Limit(n int64) *Query {
+	if n < 0 {
+		q.setErr(fmt.Errorf("limit must not be negative: %d", n))
+	}
+	q.limit = n
+	return q
+}
+
+// Offset skips the first n rows.
+func (q *Query) Offset(n int64) *Query {
+	if n < 0 {
+		q.setErr(fmt.Errorf("offset must not be negative: %d", n))
+	}
+	q.offset = n
+	return q
+}
+
+// ForUpdate locks the selected rows against concurrent updates and deletes until the end of the transaction. It must
+// be run in a transaction to have any effect beyond the statement. If the query has joins only the rows of the table
+// are locked. It cannot be combined with Distinct or DistinctOn. The aggregates, GroupBy, and Subquery ignore it.
+func (q *Query) ForUpdate() *Query {
+	q.lock = rowLock{strength: "update"}
+	return q
+}
+
+// ForUpdateSkipLocked is like ForUpdate but rows that are already locked by another transaction are skipped instead of
+// waited for. Combined with OrderBy and Limit it claims up to n unclaimed rows such as jobs in a queue. Concurrent
+// transactions claim disjoint rows.
+func (q *Query) ForUpdateSkipLocked() *Query {
+	q.lock = rowLock{strength: "update", waitPolicy: "skip locked"}
+	return q
+}
+
+// ForShare is like ForUpdate but takes a shared lock. Other transactions can also lock the rows for share but cannot
+// update or delete them until the end of the transaction.
+func (q *Query) ForShare() *Query {
+	q.lock = rowLock{strength: "share"}
+	return q
+}
+
+func (q *Query) setErr(err error) {
+	if q.err == nil {
+		q.err = err
+	}
+}
+
+// All runs the query and returns the records.
+func (q *Query) All(ctx context.Context, db DB) ([]*Record, error) {
+	sql, args, err := q.sql()
+	if err != nil {
+		return nil, fmt.Errorf("pgxrecord.Query (%s): All: %w", q.table.quotedQualifiedName, err)
+	}
+
+	rows, err := q.table.db(db, "select").Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("pgxrecord.Query (%s): All: %w", q.table.quotedQualifiedName, err)
+	}
+
+	rowToRecord := q.table.RowToRecord
+	if q.selected != nil || len(q.exprs) > 0 {
+		rowToRecord = q.rowToSelectedRecord
+	}
+
+	records, err := collectRows(ctx, rows, rowToRecord)
+	if err != nil {
+		return nil, fmt.Errorf("pgxrecord.Query (%s): All: %w", q.table.quotedQualifiedName, err)
+	}
+
+	return records, nil
+}
+
+// AllMaps runs the query and returns each row as a map of column name to value without creating records. Only the
+// selected columns are included if Select was used. Values have the same types as record attributes. e.g. int32 for
+// int4, time.Time for timestamptz, and pgtype.Numeric for numeric.
+func (q *Query) AllMaps(ctx context.Context, db DB) ([]map[string]any, error) {
+	sql, args, err := q.sql()
+	if err != nil {
+		return nil, fmt.Errorf("pgxrecord.Query (%s): AllMaps: %w", q.table.quotedQualifiedName, err)
+	}
+
+	rows, err := q.table.db(db, "select").Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("pgxrecord.Query (%s): AllMaps: %w", q.table.quotedQualifiedName, err)
+	}
+
+	t := q.table
+	attributes := make([]any, len(t.Columns))
+	allTargets := make([]any, len(t.Columns))
+	exprValues := make([]any, len(q.exprs))
+	scanTargets := make([]any, 0, len(t.Columns)+len(q.exprs))
+
+	maps, err := collectRows(ctx, rows, func(row pgx.CollectableRow) (map[string]any, error) {
+		for i := range attributes {
+			attributes[i] = nil
+		}
+		t.setScanTargets(allTargets, attributes)
+		scanTargets = scanTargets[:0]
+		for i := range t.Columns {
+			if q.selected == nil || q.selected[i] {
+				scanTargets = append(scanTargets, allTargets[i])
+			}
+		}
+		for i := range exprValues {
+			exprValues[i] = nil
+			scanTargets = append(scanTargets, &exprValues[i])
+		}
+
+		err := row.Scan(scanTargets...)
+		if err != nil {
+			return nil, err
+		}
+		t.convertScanned(attributes)
+
+		m := make(map[string]any, len(scanTargets))
+		for i, c := range t.Columns {
+			if q.selected == nil || q.selected[i] {
+				m[c.Name] = attributes[i]
+			}
+		}
+		for i, se := range q.exprs {
+			m[se.attribute] = exprValues[i]
+		}
+		return m, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("pgxrecord.Query (%s): AllMaps: %w", q.table.quotedQualifiedName, err)
+	}
+
+	return maps, nil
+}
+
+// ExplainOption is an option for Query.Explain.
+type ExplainOption func(*explainOptions)
+
+type explainOptions struct {
+	analyze bool
+	format  string
+}
+
+// ExplainAnalyze causes Explain to run the query and include the actual times and row counts in the plan.
+func ExplainAnalyze() ExplainOption {
+	return func(o *explainOptions) {
+		o.analyze = true
+	}
+}
+
+// ExplainFormatJSON causes Explain to return the plan in JSON format instead of text.
+func ExplainFormatJSON() ExplainOption {
+	return func(o *explainOptions) {
+		o.format = "json"
+	}
+}
+
+// Explain returns the query plan for the query as PostgreSQL's explain returns it. By default the query is not run and
+// the plan is in text format. With ExplainAnalyze the query is run so it should not be used for a query with side
+// effects such as a locking select. The lines of a text plan are joined with newlines.
+func (q *Query) Explain(ctx context.Context, db DB, options ...ExplainOption) (string, error) {
+	o := explainOptions{format: "text"}
+	for _, option := range options {
+		option(&o)
+	}
+
+	sql, args, err := q.sql()
+	if err != nil {
+		return "", fmt.Errorf("pgxrecord.Query (%s): Explain: %w", q.table.quotedQualifiedName, err)
+	}
+
+	sql = "explain (analyze " + strconv.FormatBool(o.analyze) + ", format " + o.format + ") " + sql
+	rows, err := q.table.db(db, "select").Query(ctx, sql, args...)
+	if err != nil {
+		return "", fmt.Errorf("pgxrecord.Query (%s): Explain: %w", q.table.quotedQualifiedName, err)
+	}
+
+	lines, err := collectRows(ctx, rows, pgx.RowTo[string])
+	if err != nil {
+		return "", fmt.Errorf("pgxrecord.Query (%s): Explain: %w", q.table.quotedQualifiedName, err)
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// SQL returns the SQL and arguments All would use for the query. RewriteSQL is applied. Nothing is sent to the database.
+// It returns an error if building the query failed.
+func (q *Query) SQL() (string, []any, error) {
+	sql, args, err := q.sql()
+	if err != nil {
+		return "", nil, fmt.Errorf("pgxrecord.Query (%s): SQL: %w", q.table.quotedQualifiedName, err)
+	}
+
+	return q.table.rewriteSQL("select", sql), args, nil
+}
+
+func (q *Query) sql() (string, []any, error) {
+	b := &strings.Builder{}
+	args, err := q.writeSelectSQL(b, nil)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return b.String(), args, nil
+}
+
+// writeSelectSQL writes the select statement of the query to b. It returns args with the query arguments appended.
+func (q *Query) writeSelectSQL(b *strings.Builder, args []any) ([]any, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+
+	args, err := q.writeWith(b, args)
+	if err != nil {
+		return nil, err
+	}
+
+	t := q.table
+	b.WriteString("select ")
+	err = q.writeDistinct(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if q.selected == nil && len(q.exprs) == 0 {
+		b.WriteString(strings.TrimPrefix(t.selectFromQuery, "select "))
+	} else {
+		first := true
+		for i, c := range t.Columns {
+			if q.selected != nil && !q.selected[i] {
+				continue
+			}
+			if !first {
+				b.WriteString(", ")
+			}
+			first = false
+			b.WriteString(t.quotedName)
+			b.WriteByte('.')
+			b.WriteString(c.quotedName)
+		}
+		for _, se := range q.exprs {
+			if !first {
+				b.WriteString(", ")
+			}
+			first = false
+			b.WriteString(se.expr)
+			b.WriteString(" as ")
+			b.WriteString(t.quoteIdentifier(se.attribute))
+		}
+		b.WriteString(" from ")
+		b.WriteString(t.quotedQualifiedName)
+	}
+
+	args, err = q.writeJoinsAndWhereClause(b, args)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, term := range q.orderBy {
+		if i == 0 {
+			b.WriteString(" order by ")
+		} else {
+			b.WriteString(", ")
+		}
+		b.WriteString(term.expr)
+		b.WriteByte(' ')
+		b.WriteString(term.direction)
+	}
+
+	if q.limit > 0 {
+		args = append(args, q.limit)
+		b.WriteString(" limit $")
+		b.WriteString(strconv.Itoa(len(args)))
+	}
+
+	if q.offset > 0 {
+		args = append(args, q.offset)
+		b.WriteString(" offset $")
+		b.WriteString(strconv.Itoa(len(args)))
+	}
+
+	if q.lock.strength != "" {
+		b.WriteString(" for ")
+		b.WriteString(q.lock.strength)
+		// Without `of`, the joined tables would be locked too, and an outer join would be an error.
+		if len(q.joins) > 0 {
+			b.WriteString(" of ")
+			b.WriteString(t.quotedName)
+		}
+		if q.lock.waitPolicy != "" {
+			b.WriteByte(' ')
+			b.WriteString(q.lock.waitPolicy)
+		}
+	}
+
+	return args, nil
+}
+
+// writeDistinct writes the distinct or distinct on clause followed by a space to b. It writes nothing if the query is
+// not distinct.
+func (q *Query) writeDistinct(b *strings.Builder) error {
+	if q.lock.strength != "" && (q.distinct || len(q.distinctOn) > 0) {
+		return fmt.Errorf("for %s cannot be used with distinct", q.lock.strength)
+	}
+
+	if len(q.distinctOn) > 0 {
+		// PostgreSQL requires the leading order by expressions to be distinct on expressions. Any of them may come first
+		// and there may be fewer order by expressions than distinct on expressions.
+		distinctOn := make(map[string]struct{}, len(q.distinctOn))
+		for _, column := range q.distinctOn {
+			distinctOn[column] = struct{}{}
+		}
+		for i := 0; i < len(q.distinctOn) && i < len(q.orderBy); i++ {
+			if _, ok := distinctOn[q.orderBy[i].expr]; !ok {
+				return fmt.Errorf("leading order by column %s must be one of the distinct on columns", q.orderBy[i].expr)
+			}
+		}
+
+		b.WriteString("distinct on (")
+		b.WriteString(strings.Join(q.distinctOn, ", "))
+		b.WriteString(") ")
+	} else if q.distinct {
+		b.WriteString("distinct ")
+	}
+
+	return nil
+}
+
+// writeJoinsAndWhereClause writes the joins and the where clause to b. It returns args with the condition arguments
+// appended.
+func (q *Query) writeJoinsAndWhereClause(b *strings.Builder, args []any) ([]any, error) {
+	for _, join := range q.joins {
+		b.WriteByte(' ')
+		b.WriteString(join)
+	}
+
+	return q.writeWhereClause(b, args)
+}
+
+// writeWhereClause writes the where clause for the table's soft delete condition and the query conditions to b. It
+// writes nothing if there are no conditions. It returns args with the condition arguments appended.
+func (q *Query) writeWhereClause(b *strings.Builder, args []any) ([]any, error) {
+	t := q.table
+	if t.softDeleteCondition == "" && len(q.conditions) == 0 {
+		return args, nil
+	}
+
+	b.WriteString(" where ")
+	if t.softDeleteCondition != "" {
+		b.WriteString(t.softDeleteCondition)
+	}
+
+	for i, qc := range q.conditions {
+		if i > 0 || t.softDeleteCondition != "" {
+			b.WriteString(" and ")
+		}
+
+		if qc.exists != nil {
+			b.WriteString("exists (")
+			var err error
+			args, err = qc.exists.writeSubquerySQL(b, "1", args)
+			if err != nil {
+				return nil, err
+			}
+			b.WriteByte(')')
+			continue
+		}
+
+		if qc.sql != "" {
+			err := writeRenumberedSQL(b, qc.sql, len(args), len(qc.args))
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, qc.args...)
+			continue
+		}
+
+		var err error
+		args, err = t.writeConditions(b, qc.conditions, args)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return args, nil
+}
+
+// writeRenumberedSQL writes sql in parentheses to b with each placeholder $n increased by offset. Placeholders are
+// found with replacePlaceholders. It returns an error if a placeholder is greater than argCount.
+func writeRenumberedSQL(b *strings.Builder, sql string, offset int, argCount int) error {
+	b.WriteByte('(')
+	err := replacePlaceholders(b, sql, func(n int) (string, error) {
+		if n < 1 || n > argCount {
+			return "", fmt.Errorf("placeholder $%d does not have an argument: %s", n, sql)
+		}
+		return "$" + strconv.Itoa(n+offset), nil
+	})
+	if err != nil {
+		return err
+	}
+	b.WriteByte(')')
+
+	return nil
+}
+
+// replacePlaceholders writes sql to b with each placeholder $n replaced by the result of replace. Placeholders inside
+// quoted strings, escape strings, dollar-quoted strings, quoted identifiers, and comments are not changed. A line
+// comment at the end of sql is terminated with a newline so text written to b after sql is not commented out.
+func replacePlaceholders(b *strings.Builder, sql string, replace func(n int) (string, error)) error {
+	for i := 0; i < len(sql); i++ {
+		ch := sql[i]
+		switch {
+		case ch == '\'' || ch == '"':
+			end := quotedEnd(sql, i, ch == '\'' && isEscapeStringPrefix(sql, i))
+			if end < 0 {
+				return fmt.Errorf("sql has an unterminated quote: %s", sql)
+			}
+			b.WriteString(sql[i:end])
+			i = end - 1
+		case ch == '-' && strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				b.WriteString(sql[i:])
+				b.WriteByte('\n')
+				return nil
+			}
+			b.WriteString(sql[i : i+end+1])
+			i += end
+		case ch == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end := blockCommentEnd(sql, i)
+			if end < 0 {
+				return fmt.Errorf("sql has an unterminated comment: %s", sql)
+			}
+			b.WriteString(sql[i:end])
+			i = end - 1
+		case ch == '$' && i > 0 && isIdentifierByte(sql[i-1]):
+			// $ is part of an identifier such as a$1.
+			b.WriteByte(ch)
+		case ch == '$' && i+1 < len(sql) && sql[i+1] >= '0' && sql[i+1] <= '9':
+			j := i + 1
+			for j < len(sql) && sql[j] >= '0' && sql[j] <= '9' {
+				j++
+			}
+			n, err := strconv.Atoi(sql[i+1 : j])
+			if err != nil {
+				return fmt.Errorf("placeholder %s does not have an argument: %s", sql[i:j], sql)
+			}
+			s, err := replace(n)
+			if err != nil {
+				return err
+			}
+			b.WriteString(s)
+			i = j - 1
+		case ch == '$':
+			tag := dollarQuoteTag(sql, i)
+			if tag == "" {
+				b.WriteByte(ch)
+				continue
+			}
+			end := strings.Index(sql[i+len(tag):], tag)
+			if end < 0 {
+				return fmt.Errorf("sql has an unterminated dollar-quoted string: %s", sql)
+			}
+			end += i + 2*len(tag)
+			b.WriteString(sql[i:end])
+			i = end - 1
+		default:
+			b.WriteByte(ch)
+		}
+	}
+
+	return nil
+}
+
+// quotedEnd returns the index after the closing quote of the quoted string or identifier that starts at sql[start]. A
+// doubled quote is part of the string. If escapes is true a backslash escapes the next character as in an escape
+// string. It returns -1 if the quote is not terminated.
+func quotedEnd(sql string, start int, escapes bool) int {
+	quote := sql[start]
+	for i := start + 1; i < len(sql); i++ {
+		switch sql[i] {
+		case '\\':
+			if escapes {
+				i++
+			}
+		case quote:
+			if i+1 < len(sql) && sql[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+
+	return -1
+}
+
+// isEscapeStringPrefix returns true if the quote at sql[i] starts an escape string such as E'\n'.
+func isEscapeStringPrefix(sql string, i int) bool {
+	return i > 0 && (sql[i-1] == 'E' || sql[i-1] == 'e') && (i == 1 || !isIdentifierByte(sql[i-2]))
+}
+
+// blockCommentEnd returns the index after the end of the block comment that starts at sql[start]. Block comments can
+// be nested. It returns -1 if the comment is not terminated.
+func blockCommentEnd(sql string, start int) int {
+	depth := 0
+	for i := start; i+1 < len(sql); i++ {
+		switch {
+		case sql[i] == '/' && sql[i+1] == '*':
+			depth++
+			i++
+		case sql[i] == '*' && sql[i+1] == '/':
+			depth--
+			i++
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+
+	return -1
+}
+
+// dollarQuoteTag returns the opening tag such as $$ or $body$ of the dollar-quoted string that starts at sql[start]. It
+// returns an empty string if there is not one.
+func dollarQuoteTag(sql string, start int) string {
+	for i := start + 1; i < len(sql); i++ {
+		ch := sql[i]
+		switch {
+		case ch == '$':
+			return sql[start : i+1]
+		case ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' && i > start+1:
+		default:
+			return ""
+		}
+	}
+
+	return ""
+}
+
+// isIdentifierByte returns true if ch can be part of an unquoted identifier or keyword.
+func isIdentifierByte(ch byte) bool {
+	return ch == '_' || ch == '$' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || ch >= 0x80
+}
+
+// rowToSelectedRecord is like Table.RowToRecord for a row of the selected columns followed by the select expressions.
+func (q *Query) rowToSelectedRecord(row pgx.CollectableRow) (*Record, error) {
+	t := q.table
+	record := t.NewRecord()
+
+	allTargets := make([]any, len(t.Columns))
+	t.setScanTargets(allTargets, record.attributes)
+	scanTargets := allTargets
+	if q.selected != nil {
+		record.unloaded = make([]bool, len(t.Columns))
+		scanTargets = make([]any, 0, len(t.Columns)+len(q.exprs))
+		for i, selected := range q.selected {
+			if selected {
+				scanTargets = append(scanTargets, allTargets[i])
+			} else {
+				record.unloaded[i] = true
+			}
+		}
+	}
+
+	exprValues := make([]any, len(q.exprs))
+	for i := range exprValues {
+		scanTargets = append(scanTargets, &exprValues[i])
+	}
+
+	err := row.Scan(scanTargets...)
+	if err != nil {
+		return nil, err
+	}
+	t.convertScanned(record.attributes)
+
+	if len(q.exprs) > 0 {
+		record.computed = make(map[string]any, len(q.exprs))
+		for i, se := range q.exprs {
+			record.computed[se.attribute] = exprValues[i]
+		}
+	}
+
+	record.originalAttributes = make([]any, len(record.attributes))
+	copy(record.originalAttributes, record.attributes)
+
+	return record, nil
+}
+
+// Sum returns the sum of column over the rows matched by the query. The order, limit, and offset of the query are
+// ignored. It returns 0 if no rows match.
+func (q *Query) Sum(ctx context.Context, db DB, column string) (float64, error) {
+	return q.aggregate(ctx, db, "Sum", "sum", column)
+}
+
+// Avg returns the average of column over the rows matched by the query. The order, limit, and offset of the query are
+// ignored. It returns 0 if no rows match.
+func (q *Query) Avg(ctx context.Context, db DB, column string) (float64, error) {
+	return q.aggregate(ctx, db, "Avg", "avg", column)
+}
+
+// Max returns the maximum of column over the rows matched by the query. The value has the same type as the attribute
+// of a record would. e.g. an int64 for a bigint column, a string for a text column, or a time.Time for a timestamp
+// column. The order, limit, and offset of the query are ignored. It returns nil if no rows match.
+func (q *Query) Max(ctx context.Context, db DB, column string) (any, error) {
+	return q.aggregateValue(ctx, db, "Max", "max", column)
+}
+
+// Min returns the minimum of column over the rows matched by the query. The value has the same type as the attribute
+// of a record would. The order, limit, and offset of the query are ignored. It returns nil if no rows match.
+func (q *Query) Min(ctx context.Context, db DB, column string) (any, error) {
+	return q.aggregateValue(ctx, db, "Min", "min", column)
+}
+
+// aggregateValue returns the result of the aggregate function fn of column scanned like the attribute of a record. A
+// NULL result is returned as nil.
+func (q *Query) aggregateValue(ctx context.Context, db DB, method string, fn string, column string) (any, error) {
+	sql, args, err := q.aggregateSQL(fn, column, "")
+	if err != nil {
+		return nil, fmt.Errorf("pgxrecord.Query (%s): %s: %w", q.table.quotedQualifiedName, method, err)
+	}
+
+	t := q.table
+	idx := t.nameToColumnIndex[column]
+	attributes := make([]any, len(t.Columns))
+	scanTargets := make([]any, len(t.Columns))
+	t.setScanTargets(scanTargets, attributes)
+
+	_, err = queryRow(ctx, t.db(db, "select"), sql, args, scanTargets[idx:idx+1])
+	if err != nil {
+		return nil, fmt.Errorf("pgxrecord.Query (%s): %s: %w", q.table.quotedQualifiedName, method, err)
+	}
+	t.convertScanned(attributes)
+
+	return attributes[idx], nil
+}
+
+// aggregate returns the result of the aggregate function fn of column as a float64. A NULL result is returned as 0.
+func (q *Query) aggregate(ctx context.Context, db DB, method string, fn string, column string) (float64, error) {
+	sql, args, err := q.aggregateSQL(fn, column, "float8")
+	if err != nil {
+		return 0, fmt.Errorf("pgxrecord.Query (%s): %s: %w", q.table.quotedQualifiedName, method, err)
+	}
+
+	rows, err := q.table.db(db, "select").Query(ctx, sql, args...)
+	if err != nil {
+		return 0, fmt.Errorf("pgxrecord.Query (%s): %s: %w", q.table.quotedQualifiedName, method, err)
+	}
+
+	result, err := collectOneRow(ctx, rows, pgx.RowTo[*float64])
+	if err != nil {
+		return 0, fmt.Errorf("pgxrecord.Query (%s): %s: %w", q.table.quotedQualifiedName, method, err)
+	}
+
+	if result == nil {
+		return 0, nil
+	}
+
+	return *result, nil
+}
+
+// aggregateSQL returns the SQL for the aggregate function fn of column. The result is cast to cast unless it is empty.
+func (q *Query) aggregateSQL(fn string, column string, cast string) (string, []any, error) {
+	if q.err != nil {
+		return "", nil, q.err
+	}
+
+	t := q.table
+	idx, ok := t.nameToColumnIndex[column]
+	if !ok {
+		return "", nil, fmt.Errorf("%s column %q is not found", fn, column)
+	}
+
+	b := &strings.Builder{}
+	args, err := q.writeWith(b, nil)
+	if err != nil {
+		return "", nil, err
+	}
+
+	b.WriteString("select ")
+	b.WriteString(fn)
+	b.WriteByte('(')
+	b.WriteString(t.quotedName)
+	b.WriteByte('.')
+	b.WriteString(t.Columns[idx].quotedName)
+	b.WriteByte(')')
+	if cast != "" {
+		b.WriteString("::")
+		b.WriteString(cast)
+	}
+	b.WriteString(" from ")
+	b.WriteString(t.quotedQualifiedName)
+
+	args, err = q.writeJoinsAndWhereClause(b, args)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return b.String(), args, nil
+}
+
+// GroupedQuery is a query grouped by a column. It is created by Query.GroupBy.
+type GroupedQuery struct {
+	query  *Query
+	column string
+	having []queryCondition
+}
+
+// GroupBy groups the rows matched by the query by column. column must be one of the table's columns and its values must
+// be comparable so they can be used as map keys.
+func (q *Query) GroupBy(column string) *GroupedQuery {
+	return &GroupedQuery{query: q, column: column}
+}
+
+// Having adds a condition on the groups written in SQL such as "count(*) > $1". Placeholders are numbered from $1 for
+// args and are renumbered to follow the arguments of the rest of the query. sql is not escaped so it must not contain
+// user input. Multiple calls are combined with and.
+func (gq *GroupedQuery) Having(sql string, args ...any) *GroupedQuery {
+	if strings.TrimSpace(sql) == "" {
+		gq.query.setErr(fmt.Errorf("having sql must not be empty"))
+		return gq
+	}
+
+	gq.having = append(gq.having, queryCondition{sql: sql, args: args})
+	return gq
+}
+
+// Count returns the number of rows matched by the query for each value of the grouped column. A NULL value is counted
+// under the nil key. The order, limit, and offset of the query are ignored.
+func (gq *GroupedQuery) Count(ctx context.Context, db DB) (map[any]int64, error) {
+	q := gq.query
+	t := q.table
+
+	sql, args, err := gq.countSQL()
+	if err != nil {
+		return nil, fmt.Errorf("pgxrecord.Query (%s): Count: %w", t.quotedQualifiedName, err)
+	}
+
+	rows, err := t.db(db, "select").Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("pgxrecord.Query (%s): Count: %w", t.quotedQualifiedName, err)
+	}
+
+	idx := t.nameToColumnIndex[gq.column]
+	counts := make(map[any]int64)
+	_, err = collectRows(ctx, rows, func(row pgx.CollectableRow) (struct{}, error) {
+		key := make([]any, 1)
+		scanTargets := make([]any, 2)
+		if t.Columns[idx].EnumLabels != nil {
+			scanTargets[0] = textAttributeScanner{dst: &key[0]}
+		} else {
+			scanTargets[0] = &key[0]
+		}
+		var n int64
+		scanTargets[1] = &n
+
+		err := row.Scan(scanTargets...)
+		if err != nil {
+			return struct{}{}, err
+		}
+
+		if key[0] != nil && !reflect.TypeOf(key[0]).Comparable() {
+			return struct{}{}, fmt.Errorf("group by column %q has values of type %T that cannot be map keys", gq.column, key[0])
+		}
+
+		counts[key[0]] = n
+		return struct{}{}, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("pgxrecord.Query (%s): Count: %w", t.quotedQualifiedName, err)
+	}
+
+	return counts, nil
+}
+
+func (gq *GroupedQuery) countSQL() (string, []any, error) {
+	q := gq.query
+	if q.err != nil {
+		return "", nil, q.err
+	}
+
+	t := q.table
+	idx, ok := t.nameToColumnIndex[gq.column]
+	if !ok {
+		return "", nil, fmt.Errorf("group by column %q is not found", gq.column)
+	}
+	column := t.quotedName + "." + t.Columns[idx].quotedName
+
+	b := &strings.Builder{}
+	args, err := q.writeWith(b, nil)
+	if err != nil {
+		return "", nil, err
+	}
+
+	b.WriteString("select ")
+	b.WriteString(column)
+	b.WriteString(", count(*) from ")
+	b.WriteString(t.quotedQualifiedName)
+
+	args, err = q.writeJoinsAndWhereClause(b, args)
+	if err != nil {
+		return "", nil, err
+	}
+
+	b.WriteString(" group by ")
+	b.WriteString(column)
+
+	for i, qc := range gq.having {
+		if i == 0 {
+			b.WriteString(" having ")
+		} else {
+			b.WriteString(" and ")
+		}
+
+		err := writeRenumberedSQL(b, qc.sql, len(args), len(qc.args))
+		if err != nil {
+			return "", nil, err
+		}
+		args = append(args, qc.args...)
+	}
+
+	return b.String(), args, nil
+}
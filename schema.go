@@ -0,0 +1,126 @@
+package pgxrecord
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// LoadSchemaOption is an option for LoadSchema.
+type LoadSchemaOption func(*loadSchemaOptions)
+
+type loadSchemaOptions struct {
+	skipForeignKeys       bool
+	skipUniqueConstraints bool
+	skipCheckConstraints  bool
+	skipComments          bool
+}
+
+// SkipForeignKeys makes LoadSchema leave ForeignKeys unchanged.
+func SkipForeignKeys() LoadSchemaOption {
+	return func(o *loadSchemaOptions) {
+		o.skipForeignKeys = true
+	}
+}
+
+// SkipUniqueConstraints makes LoadSchema leave UniqueConstraints unchanged.
+func SkipUniqueConstraints() LoadSchemaOption {
+	return func(o *loadSchemaOptions) {
+		o.skipUniqueConstraints = true
+	}
+}
+
+// SkipCheckConstraints makes LoadSchema leave CheckConstraints unchanged.
+func SkipCheckConstraints() LoadSchemaOption {
+	return func(o *loadSchemaOptions) {
+		o.skipCheckConstraints = true
+	}
+}
+
+// SkipComments makes LoadSchema leave the table and column comments empty.
+func SkipComments() LoadSchemaOption {
+	return func(o *loadSchemaOptions) {
+		o.skipComments = true
+	}
+}
+
+// LoadSchema queries the database for everything LoadAllColumns, LoadForeignKeys, LoadUniqueConstraints, and
+// LoadCheckConstraints load in a single round trip with a pgx.Batch and then calls Finalize. Parts that are not needed
+// can be skipped with options. If any query fails t is unchanged and not finalized. It must not be called after
+// Finalize.
+func (t *Table) LoadSchema(ctx context.Context, db BatchDB, options ...LoadSchemaOption) error {
+	if t.finalized {
+		panic("cannot call after table finalized")
+	}
+
+	var o loadSchemaOptions
+	for _, option := range options {
+		option(&o)
+	}
+
+	// The table OID cannot be read before the other queries are sent so each query resolves the name itself.
+	const tableOID = "pg_catalog.to_regclass($1)"
+	name := t.Name.Sanitize()
+	comments := !o.skipComments
+
+	batch := &pgx.Batch{}
+	batch.Queue(tableSQL(tableOID, comments), name)
+	batch.Queue(columnsSQL(tableOID, comments), name)
+	if !o.skipForeignKeys {
+		batch.Queue(foreignKeysSQL(tableOID), name)
+	}
+	if !o.skipUniqueConstraints {
+		batch.Queue(uniqueConstraintsSQL(tableOID), name)
+	}
+	if !o.skipCheckConstraints {
+		batch.Queue(checkConstraintsSQL(tableOID), name)
+	}
+
+	results := db.SendBatch(ctx, batch)
+	defer results.Close()
+
+	lt := &loadedTable{}
+	var foreignKeys []ForeignKey
+	var uniqueConstraints []UniqueConstraint
+	var checkConstraints []CheckConstraint
+
+	rows, _ := results.Query()
+	err := collectTable(rows, lt)
+	if err == nil {
+		rows, _ = results.Query()
+		lt.columns, err = collectColumns(rows)
+	}
+	if err == nil && !o.skipForeignKeys {
+		rows, _ = results.Query()
+		foreignKeys, err = collectForeignKeys(rows)
+	}
+	if err == nil && !o.skipUniqueConstraints {
+		rows, _ = results.Query()
+		uniqueConstraints, err = collectUniqueConstraints(rows)
+	}
+	if err == nil && !o.skipCheckConstraints {
+		rows, _ = results.Query()
+		checkConstraints, err = collectCheckConstraints(rows)
+	}
+	if err == nil {
+		err = results.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Table (%s): LoadSchema: %w", name, err)
+	}
+
+	t.setLoadedTable(lt)
+	if !o.skipForeignKeys {
+		t.ForeignKeys = foreignKeys
+	}
+	if !o.skipUniqueConstraints {
+		t.UniqueConstraints = uniqueConstraints
+	}
+	if !o.skipCheckConstraints {
+		t.CheckConstraints = checkConstraints
+	}
+	t.Finalize()
+
+	return nil
+}
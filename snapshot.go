@@ -0,0 +1,75 @@
+package pgxrecord
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// recordSnapshot is the in-memory state of a record saved by Snapshot.
+type recordSnapshot struct {
+	attributes []any
+	assigned   []bool
+	unloaded   []bool
+}
+
+// Snapshot saves the current attributes of the record in memory so they can be restored with Rollback. It replaces any
+// previous snapshot. It does not interact with the database or with transactions.
+func (r *Record) Snapshot() {
+	r.snapshot = r.newSnapshot()
+}
+
+// newSnapshot returns a copy of the in-memory state of the record.
+func (r *Record) newSnapshot() *recordSnapshot {
+	s := &recordSnapshot{
+		attributes: make([]any, len(r.attributes)),
+		assigned:   make([]bool, len(r.assigned)),
+	}
+	for i, v := range r.attributes {
+		s.attributes[i] = cloneValue(v)
+	}
+	copy(s.assigned, r.assigned)
+	if r.unloaded != nil {
+		s.unloaded = make([]bool, len(r.unloaded))
+		copy(s.unloaded, r.unloaded)
+	}
+
+	return s
+}
+
+// Rollback restores the attributes saved by the last Snapshot. The changed attributes are restored as well so a record
+// that was clean when the snapshot was taken is clean after Rollback. If the record was saved after the snapshot was
+// taken, the restored attributes that differ from the saved values are changed so the next Save writes them. The
+// snapshot is kept so Rollback can be called again. It returns an error if Snapshot has not been called.
+func (r *Record) Rollback() error {
+	s := r.snapshot
+	if s == nil {
+		return fmt.Errorf("pgxrecord.Record (%s): Rollback: record does not have a snapshot", r.table.quotedQualifiedName)
+	}
+
+	r.restoreSnapshot(s)
+
+	// originalAttributes is not restored as it must match the database.
+	if r.originalAttributes != nil {
+		for i := range r.attributes {
+			if !r.assigned[i] && r.isLoaded(i) && !reflect.DeepEqual(r.originalAttributes[i], r.attributes[i]) {
+				r.assigned[i] = true
+			}
+		}
+	}
+
+	return nil
+}
+
+// restoreSnapshot restores the in-memory state of the record from s.
+func (r *Record) restoreSnapshot(s *recordSnapshot) {
+	for i, v := range s.attributes {
+		r.attributes[i] = cloneValue(v)
+	}
+	copy(r.assigned, s.assigned)
+	if s.unloaded != nil {
+		r.unloaded = make([]bool, len(s.unloaded))
+		copy(r.unloaded, s.unloaded)
+	} else {
+		r.unloaded = nil
+	}
+}
@@ -0,0 +1,370 @@
+package pgxrecord
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// StructOption is an option for InsertStruct, SelectStruct, QueryStruct, RowToStructByColumn, and Record.ScanInto.
+type StructOption func(*structOptions)
+
+type structOptions struct {
+	disallowUnknownFields  bool
+	disallowUnknownColumns bool
+}
+
+// DisallowUnknownFields causes an error to be returned when a struct field does not map to a column of the table
+// instead of ignoring the field.
+func DisallowUnknownFields() StructOption {
+	return func(o *structOptions) {
+		o.disallowUnknownFields = true
+	}
+}
+
+// DisallowUnknownColumns causes Record.ScanInto to return an error when a loaded attribute does not map to a struct
+// field instead of ignoring the attribute.
+func DisallowUnknownColumns() StructOption {
+	return func(o *structOptions) {
+		o.disallowUnknownColumns = true
+	}
+}
+
+// structField is a struct field mapped to a column of a table.
+type structField struct {
+	index  []int
+	column int
+}
+
+// InsertStruct inserts v into t. The exported fields of v are mapped to columns by a db tag such as `db:"name"` or else
+// by the field name converted to snake case. A field with the tag `db:"-"` is ignored. Fields of embedded structs are
+// mapped as if they were fields of v. A field with its zero value is not inserted if its column is an identity or
+// auto-increment column or the created at or updated at column so the database supplies the value. A nil pointer,
+// slice, map, or interface field is not inserted so the column default is used. Other zero values such as false are
+// inserted. Generated columns are never inserted. After the insert every mapped field is set to the value read back
+// from the database such as a generated id. Fields that do not map to a column are ignored unless
+// DisallowUnknownFields is used. It must be called after Finalize.
+func InsertStruct[T any](ctx context.Context, db DB, t *Table, v *T, options ...StructOption) error {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	rv := reflect.ValueOf(v).Elem()
+	fields, err := t.structFields(rv.Type(), options)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Table (%s): InsertStruct: %w", t.quotedQualifiedName, err)
+	}
+
+	record := t.NewRecord()
+	for _, f := range fields {
+		c := t.Columns[f.column]
+		fv := rv.FieldByIndex(f.index)
+		if c.readOnly() || isNil(fv) || (fv.IsZero() && t.suppliesZero(f.column)) {
+			continue
+		}
+
+		err := record.setAttribute(f.column, fv.Interface())
+		if err != nil {
+			return fmt.Errorf("pgxrecord.Table (%s): InsertStruct: attribute %q: %w", t.quotedQualifiedName, c.Name, err)
+		}
+	}
+
+	err = record.Save(ctx, db)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Table (%s): InsertStruct: %w", t.quotedQualifiedName, err)
+	}
+
+	typeMap := typeMapPool.Get().(*pgtype.Map)
+	defer typeMapPool.Put(typeMap)
+
+	for _, f := range fields {
+		c := t.Columns[f.column]
+		dst := rv.FieldByIndex(f.index).Addr().Interface()
+		err := assignValue(typeMap, c.OID, record.attributes[f.column], dst)
+		if err != nil {
+			return fmt.Errorf("pgxrecord.Table (%s): InsertStruct: attribute %q: %w", t.quotedQualifiedName, c.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// suppliesZero returns true if the database supplies the value of the column at idx when InsertStruct is given a zero
+// value for it.
+func (t *Table) suppliesZero(idx int) bool {
+	c := t.Columns[idx]
+	return c.Identity != "" || c.AutoIncrement || idx == t.createdAtIndex || idx == t.updatedAtIndex
+}
+
+// isNil returns true if v is a nil pointer, slice, map, or interface.
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface:
+		return v.IsNil()
+	default:
+		return false
+	}
+}
+
+// SelectStruct finds all rows matching conditions and scans each into a T. conditions is a map of column names to values
+// that are combined with and. A nil value matches NULL. A nil or empty conditions matches all rows. Fields are mapped
+// to columns as with InsertStruct. Every column is selected and columns without a field are discarded. It must be
+// called after Finalize.
+func SelectStruct[T any](ctx context.Context, db DB, t *Table, conditions map[string]any, options ...StructOption) ([]T, error) {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	var zero T
+	fields, err := t.structFields(reflect.TypeOf(zero), options)
+	if err != nil {
+		return nil, fmt.Errorf("pgxrecord.Table (%s): SelectStruct: %w", t.quotedQualifiedName, err)
+	}
+
+	sql, args, err := t.findAllSQL(conditions)
+	if err != nil {
+		return nil, fmt.Errorf("pgxrecord.Table (%s): SelectStruct: %w", t.quotedQualifiedName, err)
+	}
+
+	rows, err := t.db(db, "select").Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("pgxrecord.Table (%s): SelectStruct: %w", t.quotedQualifiedName, err)
+	}
+
+	scanTargets := make([]any, len(t.Columns))
+	values, err := collectRows(ctx, rows, func(row pgx.CollectableRow) (T, error) {
+		var value T
+		rv := reflect.ValueOf(&value).Elem()
+		for _, f := range fields {
+			scanTargets[f.column] = rv.FieldByIndex(f.index).Addr().Interface()
+		}
+		err := row.Scan(scanTargets...)
+		return value, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("pgxrecord.Table (%s): SelectStruct: %w", t.quotedQualifiedName, err)
+	}
+
+	return values, nil
+}
+
+// QueryStruct runs q and scans each row into a T. Fields are mapped to columns as with InsertStruct and matched to the
+// selected columns by name. The columns are selected as by Query.All, so use Query.Select to limit them, and selected
+// columns without a field are discarded. It is the struct counterpart of Query.All so scopes, conditions, and ordering
+// can be combined with typed results. e.g. QueryStruct[Person](ctx, db, people.Query().Scope("active").OrderBy("name",
+// Asc)).
+func QueryStruct[T any](ctx context.Context, db DB, q *Query, options ...StructOption) ([]T, error) {
+	var zero T
+	_, err := q.table.structFields(reflect.TypeOf(zero), options)
+	if err != nil {
+		return nil, fmt.Errorf("pgxrecord.Query (%s): QueryStruct: %w", q.table.quotedQualifiedName, err)
+	}
+
+	sql, args, err := q.sql()
+	if err != nil {
+		return nil, fmt.Errorf("pgxrecord.Query (%s): QueryStruct: %w", q.table.quotedQualifiedName, err)
+	}
+
+	rows, err := q.table.db(db, "select").Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("pgxrecord.Query (%s): QueryStruct: %w", q.table.quotedQualifiedName, err)
+	}
+
+	values, err := collectRows(ctx, rows, RowToStructByColumn[T](q.table, options...))
+	if err != nil {
+		return nil, fmt.Errorf("pgxrecord.Query (%s): QueryStruct: %w", q.table.quotedQualifiedName, err)
+	}
+
+	return values, nil
+}
+
+// RowToStructByColumn returns a pgx.RowToFunc that scans a row into a T. Fields are mapped to the columns of t as with
+// InsertStruct and then matched to the result columns by name so the order of the select list does not matter. e.g.
+// SelectRow(ctx, db, table.SelectQuery(), nil, RowToStructByColumn[Person](table)). Result columns without a field are
+// skipped. It must be called after Finalize.
+func RowToStructByColumn[T any](t *Table, options ...StructOption) pgx.RowToFunc[T] {
+	if !t.finalized {
+		panic("cannot call until table finalized")
+	}
+
+	var zero T
+	fields, err := t.structFields(reflect.TypeOf(zero), options)
+	if err != nil {
+		err = fmt.Errorf("pgxrecord.Table (%s): RowToStructByColumn: %w", t.quotedQualifiedName, err)
+	}
+
+	columnToField := make(map[string][]int, len(fields))
+	for _, f := range fields {
+		columnToField[t.Columns[f.column].Name] = f.index
+	}
+
+	return func(row pgx.CollectableRow) (T, error) {
+		var value T
+		if err != nil {
+			return value, err
+		}
+
+		rv := reflect.ValueOf(&value).Elem()
+		fds := row.FieldDescriptions()
+		scanTargets := make([]any, len(fds))
+		for i, fd := range fds {
+			if index, ok := columnToField[fd.Name]; ok {
+				scanTargets[i] = rv.FieldByIndex(index).Addr().Interface()
+			}
+		}
+
+		return value, row.Scan(scanTargets...)
+	}
+}
+
+// ScanInto copies the attributes of r into the fields of the struct pointed to by dst. Fields are mapped to columns as
+// with InsertStruct. Values are converted to the type of the field where pgx can convert them. e.g. an int32 to an int
+// or a time.Time to a pgtype.Timestamptz. Fields without a column and fields of attributes that are not loaded are
+// left unchanged. Attributes without a field are ignored unless DisallowUnknownColumns is used.
+func (r *Record) ScanInto(dst any, options ...StructOption) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("pgxrecord.Record (%s): ScanInto: dst must be a non-nil pointer to a struct", r.table.quotedQualifiedName)
+	}
+	rv = rv.Elem()
+
+	fields, err := r.table.structFields(rv.Type(), options)
+	if err != nil {
+		return fmt.Errorf("pgxrecord.Record (%s): ScanInto: %w", r.table.quotedQualifiedName, err)
+	}
+
+	var o structOptions
+	for _, option := range options {
+		option(&o)
+	}
+	if o.disallowUnknownColumns {
+		mapped := make([]bool, len(r.attributes))
+		for _, f := range fields {
+			mapped[f.column] = true
+		}
+		for i, c := range r.table.Columns {
+			if !mapped[i] && r.isLoaded(i) {
+				return fmt.Errorf("pgxrecord.Record (%s): ScanInto: attribute %q does not map to a struct field", r.table.quotedQualifiedName, c.Name)
+			}
+		}
+	}
+
+	typeMap := typeMapPool.Get().(*pgtype.Map)
+	defer typeMapPool.Put(typeMap)
+
+	for _, f := range fields {
+		if !r.isLoaded(f.column) {
+			continue
+		}
+
+		c := r.table.Columns[f.column]
+		err := assignValue(typeMap, c.OID, r.attributes[f.column], rv.FieldByIndex(f.index).Addr().Interface())
+		if err != nil {
+			return fmt.Errorf("pgxrecord.Record (%s): ScanInto: attribute %q: %w", r.table.quotedQualifiedName, c.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// structFields returns the fields of typ mapped to the columns of t.
+func (t *Table) structFields(typ reflect.Type, options []StructOption) ([]structField, error) {
+	if typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%v is not a struct", typ)
+	}
+
+	var o structOptions
+	for _, option := range options {
+		option(&o)
+	}
+
+	var fields []structField
+	err := t.appendStructFields(&fields, typ, nil, o)
+	if err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+func (t *Table) appendStructFields(fields *[]structField, typ reflect.Type, index []int, o structOptions) error {
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		tag := sf.Tag.Get("db")
+		if tag == "-" {
+			continue
+		}
+
+		fieldIndex := make([]int, len(index)+1)
+		copy(fieldIndex, index)
+		fieldIndex[len(index)] = i
+
+		if sf.Anonymous && tag == "" && sf.Type.Kind() == reflect.Struct {
+			err := t.appendStructFields(fields, sf.Type, fieldIndex, o)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		name := tag
+		if name == "" {
+			name = snakeCase(sf.Name)
+		}
+
+		idx, ok := t.nameToColumnIndex[name]
+		if !ok {
+			if o.disallowUnknownFields {
+				return fmt.Errorf("struct field %q does not map to a column", sf.Name)
+			}
+			continue
+		}
+
+		*fields = append(*fields, structField{index: fieldIndex, column: idx})
+	}
+
+	return nil
+}
+
+// assignValue assigns value of the type with oid to dst by encoding it and scanning it into dst with typeMap. This
+// converts between the types pgx reads and the type of dst. e.g. an int32 to an *int.
+func assignValue(typeMap *pgtype.Map, oid uint32, value any, dst any) error {
+	if value == nil {
+		return typeMap.Scan(oid, pgtype.BinaryFormatCode, nil, dst)
+	}
+
+	if _, ok := typeMap.TypeForOID(oid); ok {
+		buf, err := typeMap.Encode(oid, pgtype.BinaryFormatCode, value, nil)
+		if err == nil {
+			return typeMap.Scan(oid, pgtype.BinaryFormatCode, buf, dst)
+		}
+	}
+
+	return typeMap.Scan(oid, pgtype.TextFormatCode, []byte(formatText(typeMap, oid, value)), dst)
+}
+
+// snakeCase converts a Go field name such as UserID to snake case such as user_id.
+func snakeCase(s string) string {
+	runes := []rune(s)
+	b := &strings.Builder{}
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
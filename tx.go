@@ -0,0 +1,145 @@
+package pgxrecord
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Beginner begins a transaction. *pgx.Conn, *pgxpool.Pool, and pgx.Tx implement it.
+type Beginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// TxBeginner begins a transaction with options. *pgx.Conn and *pgxpool.Pool implement it.
+type TxBeginner interface {
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+}
+
+// WithTx begins a transaction on db and calls fn with it. If fn returns an error or panics the transaction is rolled
+// back and the error is returned or the panic continues. Otherwise the transaction is committed and any commit error
+// is returned. If db is a pgx.Tx a savepoint is used instead of a new transaction.
+func WithTx(ctx context.Context, db Beginner, fn func(tx pgx.Tx) error) error {
+	return pgx.BeginFunc(ctx, db, fn)
+}
+
+// WithTxOptions begins a transaction on db with txOptions and calls fn with it. If fn returns an error the transaction
+// is rolled back and the error is returned. Otherwise the transaction is committed. txOptions sets the isolation level,
+// access mode, and deferrable mode.
+func WithTxOptions(ctx context.Context, db TxBeginner, txOptions pgx.TxOptions, fn func(tx pgx.Tx) error) error {
+	return pgx.BeginTxFunc(ctx, db, txOptions, fn)
+}
+
+// savepointCounter is used to generate unique savepoint names.
+var savepointCounter int64
+
+// WithSavepoint creates a savepoint in the transaction db and calls fn. If fn returns an error or panics the
+// transaction is rolled back to the savepoint and the error is returned or the panic continues. Otherwise the savepoint
+// is released. Either way the outer transaction can continue, e.g. to recover from a unique violation. Savepoints can
+// be nested by calling WithSavepoint in fn. name is quoted as an identifier. If name is empty a unique name is
+// generated.
+func WithSavepoint(ctx context.Context, db DB, name string, fn func() error) (err error) {
+	if name == "" {
+		name = "pgxrecord_savepoint_" + strconv.FormatInt(atomic.AddInt64(&savepointCounter, 1), 10)
+	}
+	quotedName := pgx.Identifier{name}.Sanitize()
+
+	_, err = exec(ctx, db, "savepoint "+quotedName, nil)
+	if err != nil {
+		return err
+	}
+
+	rollback := func() error {
+		_, err := exec(ctx, db, "rollback to savepoint "+quotedName, nil)
+		if err != nil {
+			return err
+		}
+		_, err = exec(ctx, db, "release savepoint "+quotedName, nil)
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			rollback()
+			panic(p)
+		}
+	}()
+
+	err = fn()
+	if err != nil {
+		rollbackErr := rollback()
+		if rollbackErr != nil {
+			return fmt.Errorf("%w (rollback to savepoint failed: %v)", err, rollbackErr)
+		}
+		return err
+	}
+
+	_, err = exec(ctx, db, "release savepoint "+quotedName, nil)
+	return err
+}
+
+// IsRetryable returns true if err is or wraps a serialization failure or a deadlock. A transaction that failed with
+// one of these errors can succeed if it is run again.
+func IsRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+
+	return pgErr.Code == "40001" || pgErr.Code == "40P01"
+}
+
+// WithRetry calls fn and calls it again while it fails with an error where IsRetryable is true, up to maxAttempts calls
+// in total. fn is usually a whole transaction such as a call to WithTxOptions with serializable isolation. fn must be
+// safe to run more than once. backoff returns the time to wait before the next attempt after attempt failed. Attempts
+// are numbered from 1. A nil backoff does not wait. The state of records is saved before the first attempt and is
+// restored before each retry so a record saved in a failed attempt is new or dirty again. It returns the error of the
+// last attempt or the error of ctx if it is done while waiting.
+func WithRetry(ctx context.Context, maxAttempts int, backoff func(attempt int) time.Duration, fn func() error, records ...*Record) error {
+	type recordState struct {
+		snapshot           *recordSnapshot
+		originalAttributes []any
+	}
+
+	states := make([]recordState, len(records))
+	for i, r := range records {
+		states[i].snapshot = r.newSnapshot()
+		if r.originalAttributes != nil {
+			states[i].originalAttributes = make([]any, len(r.originalAttributes))
+			copy(states[i].originalAttributes, r.originalAttributes)
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= maxAttempts || !IsRetryable(err) {
+			return err
+		}
+
+		for i, r := range records {
+			r.restoreSnapshot(states[i].snapshot)
+			if states[i].originalAttributes == nil {
+				r.originalAttributes = nil
+			} else {
+				r.originalAttributes = make([]any, len(states[i].originalAttributes))
+				copy(r.originalAttributes, states[i].originalAttributes)
+			}
+		}
+
+		if backoff != nil {
+			timer := time.NewTimer(backoff(attempt))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package pgxrecord
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// ValidationError is an error for a record that failed validation. It holds every failure rather than only the first.
+type ValidationError struct {
+	Errors []error
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+// ByField returns the failure messages grouped by column. Failures that are not a *FieldError are grouped under the
+// empty string.
+func (e *ValidationError) ByField() map[string][]string {
+	m := make(map[string][]string, len(e.Errors))
+	for _, err := range e.Errors {
+		var fieldErr *FieldError
+		if errors.As(err, &fieldErr) {
+			m[fieldErr.Column] = append(m[fieldErr.Column], fieldErr.Message)
+		} else {
+			m[""] = append(m[""], err.Error())
+		}
+	}
+	return m
+}
+
+// FieldError is a validation failure for a single column.
+type FieldError struct {
+	Column  string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s %s", e.Column, e.Message)
+}
+
+// FieldErrorf returns a *FieldError for column with a message formatted with fmt.Sprintf. It is used by validations to
+// attach the column that failed.
+func FieldErrorf(column string, format string, args ...any) error {
+	return &FieldError{Column: column, Message: fmt.Sprintf(format, args...)}
+}
+
+// AddValidation adds a validation that runs fn before each Save. op is "insert" for a new record and "update" for a
+// persisted record. Validations run in the order they are added and the first error aborts the Save. They run before
+// the validations added with ValidatesWithQuery. It must be called before Finalize.
+func (t *Table) AddValidation(fn func(r *Record, op string) error) {
+	if t.finalized {
+		panic("cannot call after table finalized")
+	}
+
+	t.validations = append(t.validations, fn)
+}
+
+// validate runs the validations for a save with op. omitted are the columns that an insert omits. It may be nil.
+func (r *Record) validate(ctx context.Context, db DB, op string, omitted []bool) error {
+	if op == "insert" && !r.table.SkipNotNullCheck {
+		err := r.checkNotNull(omitted)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, fn := range r.table.validations {
+		err := fn(r, op)
+		if err != nil {
+			return err
+		}
+	}
+
+	return r.validateWithQueries(ctx, db)
+}
+
+// checkNotNull returns a *ValidationError with a *FieldError for each not null column that would be inserted as NULL.
+// Columns that are not assigned or are omitted are not checked if the database supplies their value. omitted may be nil.
+func (r *Record) checkNotNull(omitted []bool) error {
+	var errs []error
+	for i, c := range r.table.Columns {
+		if !c.NotNull {
+			continue
+		}
+
+		if r.assigned[i] && !isOmitted(omitted, i) {
+			if r.attributes[i] == nil {
+				errs = append(errs, FieldErrorf(c.Name, "can't be null"))
+			}
+		} else if !(c.HasDefault || c.Generated || c.Identity != "" || r.inserts(i, omitted)) {
+			errs = append(errs, FieldErrorf(c.Name, "must be set"))
+		}
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+
+	return nil
+}
+
+// Validate checks the attributes of the record against the column metadata without using the database. It returns a
+// *ValidationError with a *FieldError for every violation. A new record is checked for not null columns as Save checks
+// it. Every assigned value is checked that it can be encoded as the column type, that it is one of the EnumLabels of
+// an enum column, that it does not exceed the MaxLength of a character column, and that it fits the Precision and
+// Scale of a numeric column. Validations added with AddValidation and ValidatesWithQuery are not run.
+func (r *Record) Validate() error {
+	var errs []error
+
+	if r.originalAttributes == nil {
+		err := r.checkNotNull(nil)
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) {
+			errs = append(errs, validationErr.Errors...)
+		}
+	}
+
+	for i, c := range r.table.Columns {
+		if !r.assigned[i] {
+			continue
+		}
+
+		value := r.attributes[i]
+		if value == nil {
+			if c.NotNull && r.originalAttributes != nil {
+				errs = append(errs, FieldErrorf(c.Name, "can't be null"))
+			}
+			continue
+		}
+
+		err := checkColumnValue(c, value)
+		if err != nil {
+			errs = append(errs, FieldErrorf(c.Name, "is invalid: %v", err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("pgxrecord.Record (%s): Validate: %w", r.table.quotedQualifiedName, &ValidationError{Errors: errs})
+	}
+
+	return nil
+}
+
+// checkColumnValue returns an error if value is not valid for c. value must not be nil.
+func checkColumnValue(c *Column, value any) error {
+	s, isString := value.(string)
+
+	if isString && c.EnumLabels != nil {
+		if !containsString(c.EnumLabels, s) {
+			return fmt.Errorf("must be one of %s", strings.Join(c.EnumLabels, ", "))
+		}
+		return nil
+	}
+
+	err := checkType(c.OID, value)
+	if err != nil {
+		return err
+	}
+
+	if isString && c.MaxLength > 0 {
+		// PostgreSQL truncates excess spaces instead of failing.
+		if n := utf8.RuneCountInString(strings.TrimRight(s, " ")); n > c.MaxLength {
+			return fmt.Errorf("is too long (maximum is %d characters)", c.MaxLength)
+		}
+	}
+
+	if c.OID == pgtype.NumericOID && c.Precision > 0 && c.Scale <= c.Precision {
+		n, err := toNumeric(value)
+		if err != nil {
+			return err
+		}
+		if numericIntegerDigits(n) > c.Precision-c.Scale {
+			return fmt.Errorf("is out of range for numeric(%d,%d)", c.Precision, c.Scale)
+		}
+	}
+
+	return nil
+}
+
+// toNumeric converts value to a pgtype.Numeric by encoding and decoding it as a numeric.
+func toNumeric(value any) (pgtype.Numeric, error) {
+	if n, ok := value.(pgtype.Numeric); ok {
+		return n, nil
+	}
+
+	typeMap := typeMapPool.Get().(*pgtype.Map)
+	defer typeMapPool.Put(typeMap)
+
+	var n pgtype.Numeric
+	if s, ok := value.(string); ok {
+		err := typeMap.Scan(pgtype.NumericOID, pgtype.TextFormatCode, []byte(strings.TrimSpace(s)), &n)
+		return n, err
+	}
+
+	format := int16(pgtype.BinaryFormatCode)
+	buf, err := typeMap.Encode(pgtype.NumericOID, format, value, nil)
+	if err != nil {
+		format = pgtype.TextFormatCode
+		buf, err = typeMap.Encode(pgtype.NumericOID, format, value, nil)
+		if err != nil {
+			return n, err
+		}
+	}
+	err = typeMap.Scan(pgtype.NumericOID, format, buf, &n)
+	return n, err
+}
+
+// numericIntegerDigits returns the number of significant digits before the decimal point of n. It returns 0 for NULL,
+// NaN, and infinity.
+func numericIntegerDigits(n pgtype.Numeric) int {
+	if !n.Valid || n.NaN || n.InfinityModifier != pgtype.Finite || n.Int == nil || n.Int.Sign() == 0 {
+		return 0
+	}
+
+	digits := len(new(big.Int).Abs(n.Int).String()) + int(n.Exp)
+	if digits < 0 {
+		return 0
+	}
+	return digits
+}
+
+type queryValidation struct {
+	sql    string
+	argsFn func(*Record) []any
+	errMsg string
+}
+
+// ValidatesWithQuery adds a validation that runs sql with the arguments returned by argsFn before each Save. sql must
+// return a single boolean such as "select exists(...)". If it returns false Save fails with a *ValidationError with
+// errMsg. The query runs on the db given to Save before the write. Save does not begin a transaction, so unless db is a
+// pgx.Tx the query and the write may run on different connections of a pool. Even in a transaction the check is racy:
+// a concurrent transaction can change the rows it read before the write commits unless the query locks them such as
+// with for share or the transaction is serializable. Use a constraint for an invariant that must always hold. Each
+// validation costs an extra round trip to the database on every Save. It must be called before Finalize.
+func (t *Table) ValidatesWithQuery(sql string, argsFn func(*Record) []any, errMsg string) {
+	if t.finalized {
+		panic("cannot call after table finalized")
+	}
+
+	t.queryValidations = append(t.queryValidations, queryValidation{sql: sql, argsFn: argsFn, errMsg: errMsg})
+}
+
+// validateWithQueries runs the validations added with ValidatesWithQuery. It returns a *ValidationError with every
+// validation that failed.
+func (r *Record) validateWithQueries(ctx context.Context, db DB) error {
+	var errs []error
+	for _, qv := range r.table.queryValidations {
+		var args []any
+		if qv.argsFn != nil {
+			args = qv.argsFn(r)
+		}
+
+		rows, _ := r.table.db(db, "select").Query(ctx, qv.sql, args...)
+		valid, err := collectOneRow(ctx, rows, pgx.RowTo[bool])
+		if err != nil {
+			return err
+		}
+
+		if !valid {
+			errs = append(errs, errors.New(qv.errMsg))
+		}
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+
+	return nil
+}
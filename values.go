@@ -0,0 +1,209 @@
+package pgxrecord
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// FromValues sets attributes from values such as a submitted HTML form. Each column whose name is a key in values is
+// set to the first value for that key parsed as the column's type. Columns without a key, generated columns, and
+// generated always identity columns are not changed. An empty string sets a nullable column to NULL. If any value
+// cannot be parsed a *ValidationError with a *FieldError for each invalid column is returned and the valid values are
+// still set.
+func (r *Record) FromValues(values url.Values) error {
+	typeMap := pgtype.NewMap()
+	var errs []error
+
+	for i, c := range r.table.Columns {
+		vs, ok := values[c.Name]
+		if !ok || len(vs) == 0 || c.readOnly() {
+			continue
+		}
+
+		var value any
+		if vs[0] != "" || c.NotNull {
+			var err error
+			value, err = parseText(typeMap, c.OID, vs[0])
+			if err != nil {
+				errs = append(errs, FieldErrorf(c.Name, "is invalid: %v", err))
+				continue
+			}
+		}
+
+		err := r.setAttribute(i, value)
+		if err != nil {
+			errs = append(errs, FieldErrorf(c.Name, "is invalid: %v", err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("pgxrecord.Record (%s): FromValues: %w", r.table.quotedQualifiedName, &ValidationError{Errors: errs})
+	}
+
+	return nil
+}
+
+// ToValues returns the loaded attributes formatted in the PostgreSQL text format. NULL is formatted as an empty string.
+// It is the inverse of FromValues.
+func (r *Record) ToValues() url.Values {
+	typeMap := pgtype.NewMap()
+	values := make(url.Values, len(r.table.Columns))
+
+	for i, c := range r.table.Columns {
+		if !r.isLoaded(i) {
+			continue
+		}
+		values.Set(c.Name, formatText(typeMap, c.OID, r.attributes[i]))
+	}
+
+	return values
+}
+
+// parseText parses s as the PostgreSQL text format of the type with oid. s is returned unchanged if the type is not
+// registered in typeMap.
+func parseText(typeMap *pgtype.Map, oid uint32, s string) (any, error) {
+	if _, ok := typeMap.TypeForOID(oid); !ok {
+		return s, nil
+	}
+
+	var value any
+	err := typeMap.Scan(oid, pgtype.TextFormatCode, []byte(s), &value)
+	if err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+// formatText formats value in the PostgreSQL text format of the type with oid. nil is formatted as an empty string.
+// If value cannot be encoded it is formatted with fmt.Sprint.
+func formatText(typeMap *pgtype.Map, oid uint32, value any) string {
+	if value == nil {
+		return ""
+	}
+
+	if _, ok := typeMap.TypeForOID(oid); ok {
+		buf, err := typeMap.Encode(oid, pgtype.TextFormatCode, value, nil)
+		if err == nil {
+			if buf == nil {
+				return ""
+			}
+			return string(buf)
+		}
+	}
+
+	return fmt.Sprint(value)
+}
+
+// typeMapPool holds type maps for checkType. A *pgtype.Map is not safe for concurrent use.
+var typeMapPool = sync.Pool{
+	New: func() any {
+		return pgtype.NewMap()
+	},
+}
+
+// checkType returns an error if value cannot be encoded as the type with oid. A string is checked by parsing it as the
+// text format of the type. Values for types that are not registered are not checked.
+func checkType(oid uint32, value any) error {
+	typeMap := typeMapPool.Get().(*pgtype.Map)
+	defer typeMapPool.Put(typeMap)
+
+	if _, ok := typeMap.TypeForOID(oid); !ok {
+		return nil
+	}
+
+	if s, ok := value.(string); ok {
+		// pgtype only parses t and f but PostgreSQL accepts other boolean literals.
+		if oid == pgtype.BoolOID {
+			_, err := parseBool(s)
+			return err
+		}
+
+		_, err := parseText(typeMap, oid, s)
+		return err
+	}
+
+	_, err := typeMap.Encode(oid, pgtype.BinaryFormatCode, value, nil)
+	if err != nil {
+		_, err = typeMap.Encode(oid, pgtype.TextFormatCode, value, nil)
+	}
+	return err
+}
+
+// parseBool parses s as any of the boolean literals PostgreSQL accepts.
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "t", "tr", "tru", "true", "y", "ye", "yes", "on", "1":
+		return true, nil
+	case "f", "fa", "fal", "fals", "false", "n", "no", "of", "off", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q", s)
+}
+
+// coerceString converts s to the Go type pgx reads for the type with oid. Integer, floating point, numeric, boolean,
+// date, timestamp, and interval types are converted. Timestamps may be in RFC 3339 or the PostgreSQL text format. s is
+// returned unchanged for any other type.
+func coerceString(oid uint32, s string) (any, error) {
+	trimmed := strings.TrimSpace(s)
+	switch oid {
+	case pgtype.Int2OID:
+		n, err := strconv.ParseInt(trimmed, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid smallint %q", s)
+		}
+		return int16(n), nil
+	case pgtype.Int4OID:
+		n, err := strconv.ParseInt(trimmed, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %q", s)
+		}
+		return int32(n), nil
+	case pgtype.Int8OID:
+		n, err := strconv.ParseInt(trimmed, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bigint %q", s)
+		}
+		return n, nil
+	case pgtype.Float4OID:
+		n, err := strconv.ParseFloat(trimmed, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid real %q", s)
+		}
+		return float32(n), nil
+	case pgtype.Float8OID:
+		n, err := strconv.ParseFloat(trimmed, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid double precision %q", s)
+		}
+		return n, nil
+	case pgtype.BoolOID:
+		return parseBool(s)
+	case pgtype.TimestampOID, pgtype.TimestamptzOID:
+		if t, err := time.Parse(time.RFC3339Nano, trimmed); err == nil {
+			if oid == pgtype.TimestampOID {
+				// A timestamp without time zone is read as UTC with the same wall clock.
+				t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+			}
+			return t, nil
+		}
+	case pgtype.NumericOID, pgtype.DateOID, pgtype.IntervalOID:
+	default:
+		return s, nil
+	}
+
+	typeMap := typeMapPool.Get().(*pgtype.Map)
+	defer typeMapPool.Put(typeMap)
+
+	value, err := parseText(typeMap, oid, trimmed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q: %w", s, err)
+	}
+	return value, nil
+}